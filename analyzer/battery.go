@@ -0,0 +1,74 @@
+package main
+
+import (
+	"coldchain/analyzer/dao"
+	"coldchain/analyzer/stream"
+	"coldchain/common/logger"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type batterySample struct {
+	level     float64
+	eventTime time.Time
+}
+
+// BatteryTracker 记录各设备最近一次上报的电量，定期写回 MySQL 供服务端分配冷链箱时使用
+type BatteryTracker struct {
+	mu     sync.Mutex
+	latest map[string]batterySample
+
+	deviceRepo *dao.DeviceRepository
+}
+
+func NewBatteryTracker(db *gorm.DB) *BatteryTracker {
+	return &BatteryTracker{
+		latest:     make(map[string]batterySample),
+		deviceRepo: dao.NewDeviceRepository(db),
+	}
+}
+
+// Record 只保留采样时间最新的电量，迟到的数据不会覆盖新数据
+func (bt *BatteryTracker) Record(r stream.Reading) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if s, ok := bt.latest[r.DeviceID]; ok && s.eventTime.After(r.EventTime) {
+		return
+	}
+	bt.latest[r.DeviceID] = batterySample{level: r.BatteryLevel, eventTime: r.EventTime}
+}
+
+// Flush 写回上次写回之后变化的电量，失败时保留到下次重试
+func (bt *BatteryTracker) Flush() {
+	bt.mu.Lock()
+	pending := bt.latest
+	bt.latest = make(map[string]batterySample)
+	bt.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	levels := make(map[string]float64, len(pending))
+	for deviceID, s := range pending {
+		levels[deviceID] = s.level
+	}
+	if err := bt.deviceRepo.UpdateBatteryLevels(levels); err != nil {
+		logger.Errorf("Failed to sync battery levels: %v", err)
+		for deviceID, s := range pending {
+			bt.Record(stream.Reading{DeviceID: deviceID, BatteryLevel: s.level, EventTime: s.eventTime})
+		}
+	}
+}
+
+// Start 每隔 interval 写回一次
+func (bt *BatteryTracker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			bt.Flush()
+		}
+	}()
+}
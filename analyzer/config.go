@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 
 	_ "coldchain/common/config"
@@ -9,13 +11,49 @@ import (
 var (
 	SOURCE_BROKERS = []string{"localhost:9092"}
 	SINK_BROKERS   = []string{"localhost:9093"}
+	// 消息总线实现，kafka 或 memory，memory 只在与生成器、监控运行于同一进程时可用
+	TRANSPORT = "kafka"
+
+	// 阈值缓存的兜底过期时间，正常情况下由变更通知使缓存失效
+	THRESHOLD_CACHE_TTL = 10 * time.Minute
+	// 进程内阈值缓存的过期时间，变更通知丢失时阈值最多滞后这么久再重新读取
+	THRESHOLD_LOCAL_TTL = 30 * time.Second
+
+	// 事件时间处理参数，见 Reorderer
+	MAX_OUT_OF_ORDERNESS = 2 * time.Second
+	ALLOWED_LATENESS     = 30 * time.Second
+	IDLE_TIMEOUT         = 5 * time.Second
+
+	// 设备电量写回 MySQL 的间隔
+	BATTERY_SYNC_INTERVAL = time.Minute
 )
 
 func importConfig() {
+	if viper.IsSet("analyzer.transport") {
+		TRANSPORT = viper.GetString("analyzer.transport")
+	}
 	if viper.IsSet("analyzer.source.brokers") {
 		SOURCE_BROKERS = viper.GetStringSlice("analyzer.source.brokers")
 	}
 	if viper.IsSet("analyzer.sink.brokers") {
 		SINK_BROKERS = viper.GetStringSlice("analyzer.sink.brokers")
 	}
+	if viper.IsSet("analyzer.threshold_cache_ttl") {
+		THRESHOLD_CACHE_TTL = viper.GetDuration("analyzer.threshold_cache_ttl")
+	}
+	if viper.IsSet("analyzer.threshold_local_ttl") {
+		THRESHOLD_LOCAL_TTL = viper.GetDuration("analyzer.threshold_local_ttl")
+	}
+	if viper.IsSet("analyzer.event_time.max_out_of_orderness") {
+		MAX_OUT_OF_ORDERNESS = viper.GetDuration("analyzer.event_time.max_out_of_orderness")
+	}
+	if viper.IsSet("analyzer.event_time.allowed_lateness") {
+		ALLOWED_LATENESS = viper.GetDuration("analyzer.event_time.allowed_lateness")
+	}
+	if viper.IsSet("analyzer.event_time.idle_timeout") {
+		IDLE_TIMEOUT = viper.GetDuration("analyzer.event_time.idle_timeout")
+	}
+	if viper.IsSet("analyzer.battery_sync_interval") {
+		BATTERY_SYNC_INTERVAL = viper.GetDuration("analyzer.battery_sync_interval")
+	}
 }
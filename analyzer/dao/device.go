@@ -23,3 +23,18 @@ func (dr *DeviceRepository) GetDeviceByID(deviceID string) (*models.Module, erro
 
 	return &device, nil
 }
+
+// UpdateBatteryLevels 批量写入设备最近上报的电量，不更新 updated_at，避免影响阈值缓存的版本号
+func (dr *DeviceRepository) UpdateBatteryLevels(levels map[string]float64) error {
+	return dr.db.Transaction(func(tx *gorm.DB) error {
+		for deviceID, level := range levels {
+			err := tx.Model(&models.Module{}).
+				Where("device_id = ?", deviceID).
+				UpdateColumn("battery_level", level).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"coldchain/analyzer/dao"
 	"coldchain/common/logger"
+	cache "coldchain/common/redis"
 	"context"
 	"encoding/json"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
@@ -13,26 +16,52 @@ import (
 type HistoryStorage struct {
 	cache *redis.Client
 
+	// 进程内缓存，收到变更通知后失效。变更通知可能丢失，读库与通知之间也可能写入旧值，
+	// 条目在 localTTL 之后过期，阈值最多滞后 localTTL 加上 Redis 缓存的 THRESHOLD_CACHE_TTL
+	local    sync.Map
+	localTTL time.Duration
+	now      func() time.Time
+
 	deviceRepo *dao.DeviceRepository
 }
 
+// localEntry 进程内缓存的阈值及过期时间
+type localEntry struct {
+	device  *Device
+	expires time.Time
+}
+
 type Device struct {
 	DeviceID       string  `json:"device_id"`
 	MaxTemperature float64 `json:"max_temperature"`
 	MinTemperature float64 `json:"min_temperature"`
+	Version        int64   `json:"version"`
 }
 
 func NewHistoryStorage(cache *redis.Client, db *gorm.DB) *HistoryStorage {
 	return &HistoryStorage{
 		cache:      cache,
+		localTTL:   THRESHOLD_LOCAL_TTL,
+		now:        time.Now,
 		deviceRepo: dao.NewDeviceRepository(db),
 	}
 }
 
+func (hs *HistoryStorage) storeLocal(d *Device) {
+	hs.local.Store(d.DeviceID, localEntry{device: d, expires: hs.now().Add(hs.localTTL)})
+}
+
 func (hs *HistoryStorage) GetDeviceData(deviceID string) (*Device, error) {
+	if v, ok := hs.local.Load(deviceID); ok {
+		if e := v.(localEntry); hs.now().Before(e.expires) {
+			return e.device, nil
+		}
+		hs.local.CompareAndDelete(deviceID, v)
+	}
+
 	if hs.cache != nil {
-		res := hs.cache.Get(context.Background(), deviceID)
-		if hs.cache != nil && res.Err() == nil {
+		res := hs.cache.Get(context.Background(), cache.DeviceThresholdKey(deviceID))
+		if res.Err() == nil {
 			logger.Infof("Cache hit for device %s", deviceID)
 			s := res.Val()
 			var d Device
@@ -41,6 +70,8 @@ func (hs *HistoryStorage) GetDeviceData(deviceID string) (*Device, error) {
 				return nil, err
 			}
 
+			d.DeviceID = deviceID
+			hs.storeLocal(&d)
 			return &d, nil
 		}
 	}
@@ -53,6 +84,7 @@ func (hs *HistoryStorage) GetDeviceData(deviceID string) (*Device, error) {
 		DeviceID:       device.DeviceID,
 		MaxTemperature: device.MaxTemperature,
 		MinTemperature: device.MinTemperature,
+		Version:        device.UpdatedAt.UnixNano(),
 	}
 	s, err := json.Marshal(d)
 	if err != nil {
@@ -60,9 +92,55 @@ func (hs *HistoryStorage) GetDeviceData(deviceID string) (*Device, error) {
 	}
 
 	if hs.cache != nil {
-		if err := hs.cache.Set(context.Background(), deviceID, s, 0).Err(); err != nil {
+		if err := hs.cache.Set(context.Background(), cache.DeviceThresholdKey(deviceID), s, THRESHOLD_CACHE_TTL).Err(); err != nil {
 			return nil, err
 		}
 	}
+	hs.storeLocal(d)
 	return d, nil
 }
+
+// Invalidate 使版本号低于通知版本的缓存失效
+func (hs *HistoryStorage) Invalidate(change cache.ThresholdChange) {
+	if v, ok := hs.local.Load(change.DeviceID); ok && v.(localEntry).device.Version < change.Version {
+		hs.local.CompareAndDelete(change.DeviceID, v)
+	}
+
+	if hs.cache == nil {
+		return
+	}
+	// 读库与通知之间可能有并发写入旧值，这里按版本号再清理一次
+	key := cache.DeviceThresholdKey(change.DeviceID)
+	res := hs.cache.Get(context.Background(), key)
+	if res.Err() != nil {
+		return
+	}
+	var d Device
+	if err := json.Unmarshal([]byte(res.Val()), &d); err != nil || d.Version < change.Version {
+		hs.cache.Del(context.Background(), key)
+	}
+}
+
+// Watch 订阅服务端发布的阈值变更通知
+func (hs *HistoryStorage) Watch(ctx context.Context) {
+	if hs.cache == nil {
+		return
+	}
+	go func() {
+		for ctx.Err() == nil {
+			err := cache.SubscribeThresholdChanges(ctx, hs.cache, func(change cache.ThresholdChange) {
+				logger.Infof("Threshold of device %s changed, version %d", change.DeviceID, change.Version)
+				hs.Invalidate(change)
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.Errorf("Threshold subscription error: %v", err)
+				// 重新订阅期间可能丢失通知，清空进程内缓存
+				hs.local.Range(func(key, _ any) bool {
+					hs.local.Delete(key)
+					return true
+				})
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
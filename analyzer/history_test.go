@@ -0,0 +1,72 @@
+package main
+
+import (
+	cache "coldchain/common/redis"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 变更通知丢失时，进程内缓存过期后重新读取阈值
+func TestLocalThresholdCacheExpires(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "history.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec(`CREATE TABLE modules (
+		id INTEGER PRIMARY KEY, created_at DATETIME, updated_at DATETIME, deleted_at DATETIME,
+		device_id TEXT, max_temperature REAL, min_temperature REAL)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	if err := db.Exec("INSERT INTO modules (id, updated_at, device_id, max_temperature, min_temperature) VALUES (1, ?, 'DEV-1', 8, 2)", updated).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	hs := NewHistoryStorage(nil, db)
+	hs.localTTL = time.Minute
+	hs.now = func() time.Time { return now }
+
+	get := func() *Device {
+		t.Helper()
+		d, err := hs.GetDeviceData("DEV-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	if d := get(); d.MaxTemperature != 8 {
+		t.Fatalf("max temperature = %v, want 8", d.MaxTemperature)
+	}
+
+	// 阈值已修改，但未收到变更通知
+	if err := db.Exec("UPDATE modules SET max_temperature = 10, updated_at = ? WHERE id = 1", updated.Add(time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if d := get(); d.MaxTemperature != 8 {
+		t.Fatalf("max temperature = %v, want cached 8 before expiry", d.MaxTemperature)
+	}
+	now = now.Add(time.Minute)
+	if d := get(); d.MaxTemperature != 10 || d.Version != updated.Add(time.Hour).UnixNano() {
+		t.Fatalf("device = %+v, want reloaded threshold after expiry", d)
+	}
+
+	// 旧版本的通知不会使新条目失效，新版本的通知立即失效
+	if err := db.Exec("UPDATE modules SET max_temperature = 12 WHERE id = 1").Error; err != nil {
+		t.Fatal(err)
+	}
+	hs.Invalidate(cache.ThresholdChange{DeviceID: "DEV-1", Version: updated.UnixNano()})
+	if d := get(); d.MaxTemperature != 10 {
+		t.Fatalf("max temperature = %v, want 10 after stale notification", d.MaxTemperature)
+	}
+	hs.Invalidate(cache.ThresholdChange{DeviceID: "DEV-1", Version: updated.Add(2 * time.Hour).UnixNano()})
+	if d := get(); d.MaxTemperature != 12 {
+		t.Fatalf("max temperature = %v, want 12 after notification", d.MaxTemperature)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"coldchain/analyzer/stream"
 	"coldchain/common/clickhouse"
 	"coldchain/common/kafka"
 	"coldchain/common/logger"
@@ -12,45 +13,41 @@ import (
 	"time"
 )
 
-func initKafka() {
-	// 初始化Kafka，生产者和消费者
-	admin, err := kafka.NewAdmin(SINK_BROKERS)
+func initKafka() (source, sink kafka.Transport) {
+	source, err := kafka.NewTransport(TRANSPORT, SOURCE_BROKERS)
 	if err != nil {
-		logger.Fatalf("Failed to create Kafka admin: %v", err)
+		logger.Fatalf("Failed to create source transport: %v", err)
+	}
+	sink, err = kafka.NewTransport(TRANSPORT, SINK_BROKERS)
+	if err != nil {
+		logger.Fatalf("Failed to create sink transport: %v", err)
 	}
-	defer admin.Close()
 
-	isExists, err := admin.Exists("device")
+	// 按配置文件创建或更新主题
+	specs, err := kafka.LoadTopicSpecs("analyzer.sink.topics", kafka.DeviceTopic)
 	if err != nil {
-		logger.Fatalf("Failed to check if topic device exists: %v", err)
+		logger.Fatalf("Failed to load Kafka topic specs: %v", err)
 	}
-	retentionMs := "60000" // 60s
-	if !isExists {
-		err = admin.CreateTopicWithConfig("device", map[string]*string{
-			"retention.ms": &retentionMs,
-		}, 3, 1)
-		if err != nil {
-			logger.Fatalf("Failed to create topic device_temperature: %v", err)
-		}
-	} else {
-		err = admin.UpdateTopic("device", map[string]*string{
-			"retention.ms": &retentionMs,
-		})
-		if err != nil {
-			logger.Fatalf("Failed to update topic device_temperature: %v", err)
-		}
+	diffs, err := sink.Provision(specs)
+	if err != nil {
+		logger.Fatalf("Failed to provision Kafka topics: %v", err)
+	}
+	for _, diff := range diffs {
+		logger.Warnf("Kafka topic differs from spec, %s", diff)
 	}
 	logger.Infof("Kafka init successfully")
+	return source, sink
 }
 
+// time_stamp 写入设备采样时间而不是写入时间，保证积压消费后时间线仍然正确
 const (
 	InsertAlarmRecordSQL = `INSERT INTO 
 								alarm_record (time_stamp, device_id, alarm_level, alarm_description, alarm_status) 
-							VALUES (now(), ?, ?, ?, ?)`
+							VALUES (?, ?, ?, ?, ?)`
 
 	InsertDeviceRecordSQL = `INSERT INTO
 								module_monitor (time_stamp, device_id, temperature, battery_level)
-							VALUES (now(), ?, ?, ?)`
+							VALUES (?, ?, ?, ?)`
 )
 
 func main() {
@@ -59,26 +56,37 @@ func main() {
 	mysql.InitDB()
 	redis.InitDB()
 	clickhouse.InitDB()
-	initKafka()
+	sourceBus, sinkBus := initKafka()
 
 	history := NewHistoryStorage(redis.GetInstance(), mysql.GetInstance())
+	history.Watch(context.Background())
+	battery := NewBatteryTracker(mysql.GetInstance())
+	battery.Start(BATTERY_SYNC_INTERVAL)
 	ch := clickhouse.GetInstance()
 
-	NewAnalyzer(SOURCE_BROKERS, SINK_BROKERS, "device").
-		SetAnalysisFunc(func(deviceID string, msg string) error {
+	stream.NewAnalyzer(sourceBus, sinkBus, "device", stream.EventTimeConfig{
+		MaxOutOfOrderness: MAX_OUT_OF_ORDERNESS,
+		AllowedLateness:   ALLOWED_LATENESS,
+		IdleTimeout:       IDLE_TIMEOUT,
+	}).
+		SetAnalysisFunc(func(r stream.Reading) error {
+			deviceID := r.DeviceID
 			device, err := history.GetDeviceData(deviceID)
 			if err != nil {
 				return err
 			}
-			var CurTemperature, CurBattery float64
-			fmt.Sscanf(msg, "%f %f", &CurTemperature, &CurBattery)
-			logger.Debugf("Device %s temperature: %f, battery: %f", deviceID, CurTemperature, CurBattery)
+			CurTemperature, CurBattery := r.Temperature, r.BatteryLevel
+			battery.Record(r)
+			logger.Debugf("Device %s temperature: %f, battery: %f, event time: %s", deviceID, CurTemperature, CurBattery, r.EventTime)
+			if r.Late {
+				logger.Warnf("Device %s reading at %s arrived after watermark", deviceID, r.EventTime)
+			}
 
 			if CurTemperature > device.MaxTemperature || CurTemperature < device.MinTemperature {
 				// 发送温度超限告警
 				logger.Warnf("Device %s current temperature is %f , out of range [%f, %f]", deviceID, CurTemperature, device.MinTemperature, device.MaxTemperature)
 				if err := ch.AsyncInsert(context.Background(), InsertAlarmRecordSQL,
-					false, deviceID, "HIGH", fmt.Sprintf("Current temperature is %f , out of range [%f, %f]", CurTemperature, device.MinTemperature, device.MaxTemperature), "未读"); err != nil {
+					false, r.EventTime, deviceID, "HIGH", fmt.Sprintf("Current temperature is %f , out of range [%f, %f]", CurTemperature, device.MinTemperature, device.MaxTemperature), "未读"); err != nil {
 					logger.Errorf("Failed to insert alarm record: %v", err)
 				}
 			}
@@ -87,13 +95,13 @@ func main() {
 				// 发送低电告警
 				logger.Warnf("Device %s battery too low: %f", deviceID, CurBattery)
 				if err := ch.AsyncInsert(context.Background(), InsertAlarmRecordSQL,
-					false, deviceID, "HIGH", "Battery is too low", "未读"); err != nil {
+					false, r.EventTime, deviceID, "HIGH", "Battery is too low", "未读"); err != nil {
 					logger.Errorf("Failed to insert alarm record: %v", err)
 				}
 			}
 
 			if err := ch.AsyncInsert(context.Background(), InsertDeviceRecordSQL,
-				false, deviceID, CurTemperature, CurBattery); err != nil {
+				false, r.EventTime, deviceID, CurTemperature, CurBattery); err != nil {
 				logger.Errorf("Failed to insert device record: %v", err)
 			}
 
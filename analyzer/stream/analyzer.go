@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"coldchain/common/kafka"
+	"coldchain/common/logger"
+	"context"
+	"fmt"
+	"time"
+)
+
+// EventTimeConfig 事件时间处理参数，见 Reorderer
+type EventTimeConfig struct {
+	MaxOutOfOrderness time.Duration
+	AllowedLateness   time.Duration
+	IdleTimeout       time.Duration
+}
+
+type Analyzer struct {
+	Source kafka.Subscriber
+	Sink   kafka.Publisher
+
+	// 每个分区按此参数创建 Reorderer，将乱序数据整理为按采样时间有序的数据
+	EventTime EventTimeConfig
+
+	// 处理函数
+	AnalysisFunc func(r Reading) error
+}
+
+func NewAnalyzer(sourceBus, sinkBus kafka.Transport, topic string, eventTime EventTimeConfig) *Analyzer {
+	source, err := sourceBus.NewSubscriber(topic, "")
+	if err != nil {
+		panic(err)
+	}
+
+	sink, err := sinkBus.NewPublisher(topic)
+	if err != nil {
+		panic(err)
+	}
+	return &Analyzer{
+		Source:    source,
+		Sink:      sink,
+		EventTime: eventTime,
+	}
+}
+
+func (a *Analyzer) newReorderer() *Reorderer {
+	reorder := NewReorderer(a.EventTime.MaxOutOfOrderness, a.EventTime.AllowedLateness, a.EventTime.IdleTimeout)
+	reorder.OnDropped = func(r Reading) {
+		logger.Warnf("Drop late reading of device %s at %s", r.DeviceID, r.EventTime.Format(time.RFC3339Nano))
+	}
+	return reorder
+}
+
+// partitionReader 处理一个分区的数据，同一设备的数据只在所属分区的消费 goroutine 中按顺序处理
+//
+// 缓冲在 Reorderer 中的数据尚未处理，只提交到缓冲区中最早一条数据的偏移量，
+// 重启或再均衡后这些数据会重新消费，不会丢失
+type partitionReader struct {
+	analyzer *Analyzer
+	reorder  *Reorderer
+	// 已读取的下一条消息的偏移量，还没有读取时为 -1
+	next int64
+}
+
+func (p *partitionReader) Handle(message kafka.Message) (int64, error) {
+	p.next = message.Offset + 1
+	// 没有采样时间的旧数据使用消息时间戳
+	reading, err := ParseReading(message.Key, message.Value, message.Timestamp)
+	if err != nil {
+		fmt.Println("Parse error:", err)
+		return p.committable(), nil
+	}
+	reading.Offset = message.Offset
+
+	for _, r := range p.reorder.Add(reading, time.Now()) {
+		p.analyzer.process(r)
+	}
+	return p.committable(), nil
+}
+
+// Tick 输出空闲设备缓冲区中的数据
+func (p *partitionReader) Tick(now time.Time) (int64, error) {
+	for _, r := range p.reorder.Flush(now) {
+		p.analyzer.process(r)
+	}
+	return p.committable(), nil
+}
+
+// committable 可以提交的偏移量：缓冲区中最早一条数据之前的都已处理
+func (p *partitionReader) committable() int64 {
+	if p.next < 0 {
+		return -1
+	}
+	if oldest, ok := p.reorder.OldestOffset(); ok && oldest < p.next {
+		return oldest
+	}
+	return p.next
+}
+
+func (a *Analyzer) process(r Reading) {
+	// 处理消息
+	if a.AnalysisFunc != nil {
+		err := a.AnalysisFunc(r)
+		if err != nil {
+			fmt.Println("Analysis error:", err)
+			return
+		}
+	}
+	// 发送消息到下游
+	_, _, err := a.Sink.Publish(r.DeviceID, r.String(), r.EventTime)
+	if err != nil {
+		fmt.Println("Send message error:", err)
+	}
+}
+
+func (a *Analyzer) SetAnalysisFunc(f func(r Reading) error) *Analyzer {
+	a.AnalysisFunc = f
+	return a
+}
+
+// Run 消费消息直到 ctx 结束，空闲设备缓冲区中的数据在消费 goroutine 中定期输出
+func (a *Analyzer) Run(ctx context.Context) error {
+	return a.Source.SubscribeClaims(ctx, func(int32) kafka.ClaimHandler {
+		return &partitionReader{analyzer: a, reorder: a.newReorderer(), next: -1}
+	}, a.EventTime.IdleTimeout/2)
+}
+
+func (a *Analyzer) Start() {
+	// 消费消息
+	go func() {
+		if err := a.Run(context.Background()); err != nil {
+			fmt.Println("Consume error:", err)
+		}
+	}()
+}
+
+func (a *Analyzer) Close() {
+	if err := a.Source.Close(); err != nil {
+		panic(err)
+	}
+	if err := a.Sink.Close(); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"coldchain/common/kafka"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestAnalyzer(t *testing.T, bus kafka.Transport, processed chan<- Reading) *Analyzer {
+	t.Helper()
+	a := NewAnalyzer(bus, bus, "device", EventTimeConfig{
+		MaxOutOfOrderness: 2 * time.Second,
+		AllowedLateness:   time.Minute,
+		IdleTimeout:       time.Hour,
+	})
+	a.Sink = discardPublisher{}
+	return a.SetAnalysisFunc(func(r Reading) error {
+		processed <- r
+		return nil
+	})
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(string, string, time.Time) (int32, int64, error) { return 0, 0, nil }
+func (discardPublisher) Close() error                                            { return nil }
+
+func publishReadings(t *testing.T, bus kafka.Transport, base time.Time, seconds ...int) {
+	t.Helper()
+	pub, err := bus.NewPublisher("device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range seconds {
+		ms := base.Add(time.Duration(s) * time.Second).UnixMilli()
+		if _, _, err := pub.Publish("DEV-1", "4.0 90.0 "+strconv.FormatInt(ms, 10), base); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func collect(t *testing.T, processed <-chan Reading, n int) []Reading {
+	t.Helper()
+	var out []Reading
+	for len(out) < n {
+		select {
+		case r := <-processed:
+			out = append(out, r)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("processed %d readings, want %d", len(out), n)
+		}
+	}
+	return out
+}
+
+// 缓冲区中的数据不提交，重启后重新消费
+func TestAnalyzerRedeliversBufferedReadingsAfterRestart(t *testing.T) {
+	bus := kafka.NewMemoryTransport(1)
+	base := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	processed := make(chan Reading, 16)
+
+	first := newTestAnalyzer(t, bus, processed)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first.Run(ctx)
+	}()
+	// 水位线为 8 秒，9 和 10 秒的数据（偏移量 3、4）仍在缓冲区中
+	publishReadings(t, bus, base, 1, 2, 5, 9, 10)
+	if got := eventSeconds(base, collect(t, processed, 3)); !equalInts(got, []int{1, 2, 5}) {
+		t.Fatalf("processed %v, want 1, 2, 5", got)
+	}
+	cancel()
+	first.Source.Close()
+	wg.Wait()
+
+	second := newTestAnalyzer(t, bus, processed)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go second.Run(ctx)
+	publishReadings(t, bus, base, 20)
+	got := collect(t, processed, 2)
+	if s := eventSeconds(base, got); !equalInts(s, []int{9, 10}) || got[0].Offset != 3 {
+		t.Fatalf("after restart processed %v (offset %d), want buffered readings 9, 10 from offset 3", s, got[0].Offset)
+	}
+}
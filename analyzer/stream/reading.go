@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reading 冷链箱的一条采样数据
+// 消息格式为 "温度 电量 采样时间(Unix毫秒)"，旧格式没有采样时间，此时使用消息时间戳
+type Reading struct {
+	DeviceID     string
+	Temperature  float64
+	BatteryLevel float64
+	EventTime    time.Time
+
+	// 在水位线之后、允许延迟之内到达的数据
+	Late bool
+	// 消息在分区中的偏移量，仍在缓冲区中的数据不能提交
+	Offset int64
+}
+
+func ParseReading(deviceID, msg string, fallback time.Time) (Reading, error) {
+	fields := strings.Fields(msg)
+	if len(fields) < 2 {
+		return Reading{}, fmt.Errorf("invalid reading %q", msg)
+	}
+
+	r := Reading{DeviceID: deviceID, EventTime: fallback}
+	var err error
+	if r.Temperature, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return Reading{}, err
+	}
+	if r.BatteryLevel, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return Reading{}, err
+	}
+	if len(fields) > 2 {
+		ms, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Reading{}, err
+		}
+		r.EventTime = time.UnixMilli(ms)
+	}
+	return r, nil
+}
+
+func (r Reading) String() string {
+	return strconv.FormatFloat(r.Temperature, 'f', 2, 64) + " " +
+		strconv.FormatFloat(r.BatteryLevel, 'f', 2, 64) + " " +
+		strconv.FormatInt(r.EventTime.UnixMilli(), 10)
+}
@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// readingHeap 按采样时间排序的最小堆
+type readingHeap []Reading
+
+func (h readingHeap) Len() int           { return len(h) }
+func (h readingHeap) Less(i, j int) bool { return h[i].EventTime.Before(h[j].EventTime) }
+func (h readingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *readingHeap) Push(x any)        { *h = append(*h, x.(Reading)) }
+func (h *readingHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+type deviceBuffer struct {
+	pending readingHeap
+
+	// 已见过的最大采样时间
+	maxEventTime time.Time
+	// 最后一条已输出数据的采样时间
+	emitted time.Time
+	// 最后一次收到数据的处理时间
+	lastArrival time.Time
+}
+
+// watermark 水位线之前的数据认为已经全部到达
+func (b *deviceBuffer) watermark(outOfOrderness time.Duration) time.Time {
+	return b.maxEventTime.Add(-outOfOrderness)
+}
+
+// Reorderer 按设备将乱序到达的数据整理为按采样时间有序的数据流
+//
+// 每个设备的水位线为已见最大采样时间减去 OutOfOrderness，低于水位线的数据按顺序输出。
+// 输出之后才到达的数据若未超过 AllowedLateness 则标记为迟到并立即输出，否则丢弃。
+// 长时间没有新数据的设备在 IdleTimeout 之后全部输出，避免数据滞留在缓冲区中。
+type Reorderer struct {
+	OutOfOrderness  time.Duration
+	AllowedLateness time.Duration
+	IdleTimeout     time.Duration
+
+	// 丢弃过晚数据时的回调，可以为空
+	OnDropped func(Reading)
+
+	mu      sync.Mutex
+	devices map[string]*deviceBuffer
+}
+
+func NewReorderer(outOfOrderness, allowedLateness, idleTimeout time.Duration) *Reorderer {
+	return &Reorderer{
+		OutOfOrderness:  outOfOrderness,
+		AllowedLateness: allowedLateness,
+		IdleTimeout:     idleTimeout,
+		devices:         make(map[string]*deviceBuffer),
+	}
+}
+
+// Add 加入一条数据，返回可以按顺序处理的数据
+func (ro *Reorderer) Add(r Reading, now time.Time) []Reading {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	b, ok := ro.devices[r.DeviceID]
+	if !ok {
+		b = &deviceBuffer{}
+		ro.devices[r.DeviceID] = b
+	}
+	b.lastArrival = now
+
+	if !b.emitted.IsZero() && r.EventTime.Before(b.emitted) {
+		if b.emitted.Sub(r.EventTime) > ro.AllowedLateness {
+			if ro.OnDropped != nil {
+				ro.OnDropped(r)
+			}
+			return nil
+		}
+		r.Late = true
+		return []Reading{r}
+	}
+
+	heap.Push(&b.pending, r)
+	if r.EventTime.After(b.maxEventTime) {
+		b.maxEventTime = r.EventTime
+	}
+	return b.drain(b.watermark(ro.OutOfOrderness))
+}
+
+// Flush 输出空闲设备缓冲区中的全部数据
+func (ro *Reorderer) Flush(now time.Time) []Reading {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	var ready []Reading
+	for id, b := range ro.devices {
+		if now.Sub(b.lastArrival) < ro.IdleTimeout {
+			continue
+		}
+		ready = append(ready, b.drain(b.maxEventTime)...)
+		// 长时间空闲的设备不再保留状态
+		if now.Sub(b.lastArrival) > ro.IdleTimeout+ro.AllowedLateness {
+			delete(ro.devices, id)
+		}
+	}
+	return ready
+}
+
+// Watermark 返回设备当前的水位线
+func (ro *Reorderer) Watermark(deviceID string) time.Time {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	if b, ok := ro.devices[deviceID]; ok {
+		return b.watermark(ro.OutOfOrderness)
+	}
+	return time.Time{}
+}
+
+// OldestOffset 返回缓冲区中尚未输出的数据的最小偏移量，缓冲区为空时返回 false
+func (ro *Reorderer) OldestOffset() (int64, bool) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	oldest, ok := int64(0), false
+	for _, b := range ro.devices {
+		for _, r := range b.pending {
+			if !ok || r.Offset < oldest {
+				oldest, ok = r.Offset, true
+			}
+		}
+	}
+	return oldest, ok
+}
+
+func (b *deviceBuffer) drain(until time.Time) []Reading {
+	var ready []Reading
+	for b.pending.Len() > 0 && !b.pending[0].EventTime.After(until) {
+		r := heap.Pop(&b.pending).(Reading)
+		b.emitted = r.EventTime
+		ready = append(ready, r)
+	}
+	return ready
+}
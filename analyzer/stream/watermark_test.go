@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func reading(device string, base time.Time, seconds int, offset int64) Reading {
+	return Reading{DeviceID: device, EventTime: base.Add(time.Duration(seconds) * time.Second), Offset: offset}
+}
+
+func eventSeconds(base time.Time, rs []Reading) []int {
+	out := make([]int, len(rs))
+	for i, r := range rs {
+		out[i] = int(r.EventTime.Sub(base) / time.Second)
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReordererEmitsInEventTimeOrder(t *testing.T) {
+	base := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	now := base
+	ro := NewReorderer(2*time.Second, 30*time.Second, 5*time.Second)
+
+	var out []Reading
+	for i, s := range []int{1, 3, 2, 6, 5, 4, 9} {
+		out = append(out, ro.Add(reading("A", base, s, int64(i)), now)...)
+	}
+	// 水位线为已见最大采样时间减 2 秒
+	if got := eventSeconds(base, out); !equalInts(got, []int{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("emitted %v, want 1..6 in order", got)
+	}
+	if wm := ro.Watermark("A"); !wm.Equal(base.Add(7 * time.Second)) {
+		t.Fatalf("watermark = %v, want base+7s", wm)
+	}
+}
+
+func TestReordererLateAndDroppedReadings(t *testing.T) {
+	base := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	ro := NewReorderer(time.Second, 10*time.Second, 5*time.Second)
+	var dropped []Reading
+	ro.OnDropped = func(r Reading) { dropped = append(dropped, r) }
+
+	ro.Add(reading("A", base, 20, 0), base)
+	ro.Add(reading("A", base, 30, 1), base) // 输出 20
+
+	late := ro.Add(reading("A", base, 15, 2), base)
+	if len(late) != 1 || !late[0].Late {
+		t.Fatalf("reading within allowed lateness = %+v, want emitted as late", late)
+	}
+	if out := ro.Add(reading("A", base, 5, 3), base); len(out) != 0 || len(dropped) != 1 {
+		t.Fatalf("too late reading emitted %v, dropped %v", out, dropped)
+	}
+	// 其他设备不受影响
+	if out := ro.Add(reading("B", base, 5, 4), base); len(out) != 0 || ro.Watermark("B").IsZero() {
+		t.Fatalf("device B emitted %v", out)
+	}
+}
+
+func TestReordererFlushesIdleDevices(t *testing.T) {
+	base := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	ro := NewReorderer(10*time.Second, 30*time.Second, 5*time.Second)
+
+	ro.Add(reading("A", base, 2, 0), base)
+	ro.Add(reading("A", base, 1, 1), base)
+	ro.Add(reading("B", base, 1, 2), base.Add(4*time.Second))
+
+	if out := ro.Flush(base.Add(3 * time.Second)); len(out) != 0 {
+		t.Fatalf("flushed %v before idle timeout", out)
+	}
+	out := ro.Flush(base.Add(6 * time.Second))
+	if got := eventSeconds(base, out); !equalInts(got, []int{1, 2}) || out[0].DeviceID != "A" {
+		t.Fatalf("flushed %v, want device A readings 1, 2", got)
+	}
+	// 设备 B 仍在缓冲区中
+	if oldest, ok := ro.OldestOffset(); !ok || oldest != 2 {
+		t.Fatalf("oldest offset = %d, %v; want 2", oldest, ok)
+	}
+}
+
+func TestReordererOldestOffset(t *testing.T) {
+	base := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	ro := NewReorderer(5*time.Second, 30*time.Second, 5*time.Second)
+	if _, ok := ro.OldestOffset(); ok {
+		t.Fatal("empty reorderer has no buffered offset")
+	}
+	// 偏移量较小的数据采样时间较晚，最小偏移量不一定在堆顶
+	ro.Add(reading("A", base, 4, 7), base)
+	ro.Add(reading("A", base, 3, 8), base)
+	ro.Add(reading("B", base, 1, 9), base)
+	if oldest, ok := ro.OldestOffset(); !ok || oldest != 7 {
+		t.Fatalf("oldest offset = %d, %v; want 7", oldest, ok)
+	}
+	ro.Add(reading("A", base, 20, 10), base) // 输出 A 的 3 和 4
+	if oldest, _ := ro.OldestOffset(); oldest != 9 {
+		t.Fatalf("oldest offset = %d, want 9", oldest)
+	}
+}
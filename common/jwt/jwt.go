@@ -1,43 +1,190 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
 )
 
-var jwt_key = []byte("coldchain")
+// token 类型
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	JWT_ISSUER      = "coldchain"
+	JWT_ACCESS_TTL  = 15 * time.Minute
+	JWT_REFRESH_TTL = 7 * 24 * time.Hour
+
+	// 签名密钥，按 kid 查找。新 token 使用 JWT_ACTIVE_KID 签名，
+	// 旧密钥保留到其签发的 token 全部过期后再从配置中删除。没有默认密钥，未配置时启动失败
+	JWT_KEYS       map[string][]byte
+	JWT_ACTIVE_KID string
+)
+
+// signingKey 配置中的签名密钥，密钥优先从 secret_env 指定的环境变量读取，不在配置文件中明文保存
+type signingKey struct {
+	ID        string `mapstructure:"id"`
+	Secret    string `mapstructure:"secret"`
+	SecretEnv string `mapstructure:"secret_env"`
+}
+
+func importConfig() error {
+	if viper.IsSet("jwt.issuer") {
+		JWT_ISSUER = viper.GetString("jwt.issuer")
+	}
+	if viper.IsSet("jwt.access_ttl") {
+		JWT_ACCESS_TTL = viper.GetDuration("jwt.access_ttl")
+	}
+	if viper.IsSet("jwt.refresh_ttl") {
+		JWT_REFRESH_TTL = viper.GetDuration("jwt.refresh_ttl")
+	}
+	if viper.IsSet("jwt.keys") {
+		var keys []signingKey
+		if err := viper.UnmarshalKey("jwt.keys", &keys); err != nil {
+			return err
+		}
+		JWT_KEYS = make(map[string][]byte, len(keys))
+		for _, k := range keys {
+			if k.SecretEnv != "" {
+				k.Secret = os.Getenv(k.SecretEnv)
+			}
+			if k.ID == "" || k.Secret == "" {
+				return fmt.Errorf("jwt key id and secret are required (key %q, env %q)", k.ID, k.SecretEnv)
+			}
+			JWT_KEYS[k.ID] = []byte(k.Secret)
+		}
+	}
+	if viper.IsSet("jwt.active_kid") {
+		JWT_ACTIVE_KID = viper.GetString("jwt.active_kid")
+	}
+	if len(JWT_KEYS) == 0 {
+		return fmt.Errorf("no jwt signing keys configured")
+	}
+	if _, ok := JWT_KEYS[JWT_ACTIVE_KID]; !ok {
+		return fmt.Errorf("jwt active key %q is not configured", JWT_ACTIVE_KID)
+	}
+	return nil
+}
+
+// Init 读取签名密钥和有效期配置，需在配置文件加载后调用
+func init() {
+	// 签发时间精确到毫秒，用户级吊销后立即重新登录签发的 token 不会被误判为吊销前签发
+	jwt.TimePrecision = time.Millisecond
+}
+
+func Init() {
+	if err := importConfig(); err != nil {
+		panic("Failed to load JWT config: " + err.Error())
+	}
+}
 
 type Claims struct {
-	Id   uint32
-	Role uint32
+	Id        uint32
+	Role      uint32
+	RoleName  string
+	TokenType string
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user_id uint32, role uint32) (string, error) {
+// TokenPair 登录或刷新后返回的 token
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sign(user_id uint32, role uint32, role_name string, token_type string, ttl time.Duration) (string, time.Time, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := &Claims{
-		Id:   user_id,
-		Role: role,
+		Id:        user_id,
+		Role:      role,
+		RoleName:  role_name,
+		TokenType: token_type,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "coldchain",
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    JWT_ISSUER,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwt_key)
+	token.Header["kid"] = JWT_ACTIVE_KID
+	s, err := token.SignedString(JWT_KEYS[JWT_ACTIVE_KID])
+	return s, expiresAt, err
+}
+
+// GenerateToken 签发访问 token
+func GenerateToken(user_id uint32, role uint32, role_name string) (string, error) {
+	s, _, err := sign(user_id, role, role_name, TokenTypeAccess, JWT_ACCESS_TTL)
+	return s, err
+}
+
+// GenerateTokenPair 签发短期访问 token 和长期刷新 token
+func GenerateTokenPair(user_id uint32, role uint32, role_name string) (*TokenPair, error) {
+	access, accessExp, err := sign(user_id, role, role_name, TokenTypeAccess, JWT_ACCESS_TTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, refreshExp, err := sign(user_id, role, role_name, TokenTypeRefresh, JWT_REFRESH_TTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		AccessExpiresAt:  accessExp,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExp,
+	}, nil
 }
 
 func ParseToken(token_str string) (int, int, error) {
-	token, err := jwt.ParseWithClaims(token_str, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		return jwt_key, nil
-	})
+	claims, err := ParseClaims(token_str)
 	if err != nil {
 		return 0, 0, err
 	}
+	return int(claims.Id), int(claims.Role), nil
+}
+
+// ParseClaims 按 kid 选择密钥校验token并返回其中的声明
+// 没有 kid 的旧 token 使用当前密钥校验
+func ParseClaims(token_str string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(token_str, &Claims{}, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = JWT_ACTIVE_KID
+		}
+		key, ok := JWT_KEYS[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(JWT_ISSUER))
+	if err != nil {
+		return nil, err
+	}
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return int(claims.Id), int(claims.Role), nil
+		return claims, nil
 	}
-	return 0, 0, fmt.Errorf("token is invalid")
+	return nil, fmt.Errorf("token is invalid")
 }
@@ -0,0 +1,137 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// configure 按给定的密钥加载配置，测试结束后恢复
+func configure(t *testing.T, activeKid string, keys ...signingKey) {
+	t.Helper()
+	savedKeys, savedKid := JWT_KEYS, JWT_ACTIVE_KID
+	t.Cleanup(func() {
+		viper.Reset()
+		JWT_KEYS, JWT_ACTIVE_KID = savedKeys, savedKid
+	})
+
+	viper.Reset()
+	var list []map[string]any
+	for _, k := range keys {
+		list = append(list, map[string]any{"id": k.ID, "secret": k.Secret, "secret_env": k.SecretEnv})
+	}
+	if list != nil {
+		viper.Set("jwt.keys", list)
+	}
+	if activeKid != "" {
+		viper.Set("jwt.active_kid", activeKid)
+	}
+	if err := importConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportConfigRequiresKeys(t *testing.T) {
+	savedKeys, savedKid := JWT_KEYS, JWT_ACTIVE_KID
+	t.Cleanup(func() {
+		viper.Reset()
+		JWT_KEYS, JWT_ACTIVE_KID = savedKeys, savedKid
+	})
+	JWT_KEYS, JWT_ACTIVE_KID = nil, ""
+
+	viper.Reset()
+	if err := importConfig(); err == nil {
+		t.Fatal("importConfig without keys succeeded, want error")
+	}
+
+	// 环境变量未设置时不能退回空密钥
+	viper.Set("jwt.keys", []map[string]any{{"id": "k1", "secret_env": "COLDCHAIN_TEST_JWT_SECRET_UNSET"}})
+	viper.Set("jwt.active_kid", "k1")
+	if err := importConfig(); err == nil {
+		t.Fatal("importConfig with unset secret env succeeded, want error")
+	}
+}
+
+func TestSecretFromEnv(t *testing.T) {
+	t.Setenv("COLDCHAIN_TEST_JWT_SECRET", "from-env")
+	configure(t, "k1", signingKey{ID: "k1", SecretEnv: "COLDCHAIN_TEST_JWT_SECRET"})
+	if string(JWT_KEYS["k1"]) != "from-env" {
+		t.Fatalf("secret = %q, want value from environment", JWT_KEYS["k1"])
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	configure(t, "k1", signingKey{ID: "k1", Secret: "secret-1"})
+	old, err := GenerateTokenPair(7, 2, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 添加新密钥并切换，旧密钥签发的 token 仍然有效
+	configure(t, "k2", signingKey{ID: "k1", Secret: "secret-1"}, signingKey{ID: "k2", Secret: "secret-2"})
+	claims, err := ParseClaims(old.RefreshToken)
+	if err != nil {
+		t.Fatalf("token signed with retired key: %v", err)
+	}
+	if claims.Id != 7 || claims.TokenType != TokenTypeRefresh {
+		t.Fatalf("claims = %+v, want refresh token of user 7", claims)
+	}
+	current, err := GenerateToken(7, 2, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseClaims(current); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除旧密钥后其签发的 token 失效，新 token 不受影响
+	configure(t, "k2", signingKey{ID: "k2", Secret: "secret-2"})
+	if _, err := ParseClaims(old.AccessToken); err == nil || !strings.Contains(err.Error(), "k1") {
+		t.Fatalf("token signed with removed key: err = %v, want unknown key k1", err)
+	}
+	if _, err := ParseClaims(current); err != nil {
+		t.Fatalf("token signed with active key: %v", err)
+	}
+
+	// 同一 kid 换了密钥，签名校验失败
+	configure(t, "k2", signingKey{ID: "k2", Secret: "secret-3"})
+	if _, err := ParseClaims(current); err == nil {
+		t.Fatal("token verified with replaced secret, want error")
+	}
+}
+
+// 用户级吊销后同一秒内重新签发的 token 仍然有效
+func TestIssuedBeforeUsesMilliseconds(t *testing.T) {
+	configure(t, "k1", signingKey{ID: "k1", Secret: "secret-1"})
+	revokedAt := time.Now().UnixMilli()
+	time.Sleep(2 * time.Millisecond)
+	tokens, err := GenerateTokenPair(7, 2, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseClaims(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.IssuedAt.UnixMilli() <= revokedAt {
+		t.Fatalf("issued at %d ms, want after revocation at %d ms", claims.IssuedAt.UnixMilli(), revokedAt)
+	}
+
+	cases := []struct {
+		name   string
+		before int64
+		want   bool
+	}{
+		{"revoked just before issue", revokedAt, false},
+		{"revoked after issue", claims.IssuedAt.UnixMilli() + 1, true},
+		{"revoked at the same millisecond", claims.IssuedAt.UnixMilli(), false},
+		{"legacy revocation in the issue second", claims.IssuedAt.Unix(), true},
+	}
+	for _, c := range cases {
+		if got := issuedBefore(claims, c.before); got != c.want {
+			t.Errorf("%s: issuedBefore = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 设置 COLDCHAIN_TEST_REDIS_ADDR 时测试 token 吊销
+func TestRevoker(t *testing.T) {
+	addr := os.Getenv("COLDCHAIN_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("COLDCHAIN_TEST_REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx := context.Background()
+	revoker := NewRevoker(client)
+
+	configure(t, "k1", signingKey{ID: "k1", Secret: "secret-1"})
+	const userID = 4242
+	client.Del(ctx, revokedBeforeKey(userID))
+	tokens, err := GenerateTokenPair(userID, 2, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := ParseClaims(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发使用同一个刷新 token，只有一个请求能吊销成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first, err := revoker.RevokeOnce(ctx, refresh)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if first {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent refreshes succeeded, want 1", succeeded)
+	}
+	if revoked, err := revoker.IsRevoked(ctx, refresh); err != nil || !revoked {
+		t.Fatalf("refresh token revoked = %v, %v; want true", revoked, err)
+	}
+
+	// 用户级吊销使此前签发的访问 token 失效
+	access, err := ParseClaims(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := revoker.IsRevoked(ctx, access); err != nil || revoked {
+		t.Fatalf("access token revoked = %v, %v; want false", revoked, err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := revoker.RevokeUser(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Del(ctx, revokedBeforeKey(userID))
+	if revoked, err := revoker.IsRevoked(ctx, access); err != nil || !revoked {
+		t.Fatalf("access token after user revocation = %v, %v; want revoked", revoked, err)
+	}
+
+	// 吊销后立即重新登录签发的 token 有效
+	time.Sleep(2 * time.Millisecond)
+	relogin, err := GenerateTokenPair(userID, 2, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := ParseClaims(relogin.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := revoker.IsRevoked(ctx, fresh); err != nil || revoked {
+		t.Fatalf("token issued after user revocation = %v, %v; want valid", revoked, err)
+	}
+
+	// 过期的 token 不能再吊销成功
+	refresh.ExpiresAt.Time = time.Now().Add(-time.Second)
+	if first, err := revoker.RevokeOnce(ctx, refresh); err != nil || first {
+		t.Fatalf("revoke expired token = %v, %v; want false", first, err)
+	}
+}
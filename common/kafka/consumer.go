@@ -2,6 +2,8 @@ package kafka
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 )
@@ -13,11 +15,16 @@ type Consumer struct {
 }
 
 func NewConsumer(brokers []string, topic string) (*Consumer, error) {
+	return NewGroupConsumer(brokers, topic, topic)
+}
+
+// NewGroupConsumer 使用指定的消费组消费主题
+func NewGroupConsumer(brokers []string, topic, group string) (*Consumer, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Return.Errors = true
 	config.Consumer.Offsets.Initial = sarama.OffsetNewest // 从最新的偏移量开始消费
 
-	consumerGroup, err := sarama.NewConsumerGroup(brokers, topic, config)
+	consumerGroup, err := sarama.NewConsumerGroup(brokers, group, config)
 	if err != nil {
 		return nil, err
 	}
@@ -35,3 +42,198 @@ func (cg *Consumer) Consume(handler sarama.ConsumerGroupHandler) error {
 		}
 	}
 }
+
+// Subscribe 消费消息直到 ctx 结束或 handler 返回错误
+func (cg *Consumer) Subscribe(ctx context.Context, handler Handler) error {
+	return cg.SubscribeClaims(ctx, func(int32) ClaimHandler { return handlerFunc(handler) }, 0)
+}
+
+// SubscribeClaims 按分区消费消息直到 ctx 结束或处理器返回错误
+func (cg *Consumer) SubscribeClaims(ctx context.Context, newHandler func(partition int32) ClaimHandler, tick time.Duration) error {
+	h := &groupHandler{newHandler: newHandler, tick: tick}
+	for {
+		if err := cg.Consumer.Consume(ctx, []string{cg.Topic}, h); err != nil {
+			return err
+		}
+		if err := h.failure(); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (cg *Consumer) Close() error {
+	return cg.Consumer.Close()
+}
+
+// groupHandler 将 ClaimHandler 适配为 sarama.ConsumerGroupHandler
+// 各分区的 ConsumeClaim 并发执行，每个分区使用各自的处理器
+type groupHandler struct {
+	newHandler func(partition int32) ClaimHandler
+	tick       time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+func (h *groupHandler) fail(err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = err
+	return err
+}
+
+func (h *groupHandler) failure() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	handler := h.newHandler(claim.Partition())
+	var ticks <-chan time.Time
+	if h.tick > 0 {
+		ticker := time.NewTicker(h.tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		var next int64
+		var err error
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			next, err = handler.Handle(Message{
+				Topic:     message.Topic,
+				Key:       string(message.Key),
+				Value:     string(message.Value),
+				Partition: message.Partition,
+				Offset:    message.Offset,
+				Timestamp: message.Timestamp,
+			})
+		case now := <-ticks:
+			next, err = handler.Tick(now)
+		case <-session.Context().Done():
+			return nil
+		}
+		if err != nil {
+			return h.fail(err)
+		}
+		// 偏移量只会前移，处理器仍缓存的消息在重启或再均衡后会重新消费
+		if next >= 0 {
+			session.MarkOffset(claim.Topic(), claim.Partition(), next, "")
+		}
+	}
+}
+
+// PartitionListener 不加入消费组，直接从主题各分区最新的偏移量开始读取，不提交偏移量。
+// 断开后不会在集群中留下消费组，适合每个连接各自读取实时数据
+type PartitionListener struct {
+	Consumer sarama.Consumer
+	Topic    string
+
+	closeOnce sync.Once
+	done      chan struct{}
+	// 正在读取的 SubscribeClaims，关闭 Consumer 前需先关闭其中的分区消费者
+	running sync.WaitGroup
+}
+
+func NewPartitionListener(brokers []string, topic string) (*PartitionListener, error) {
+	consumer, err := sarama.NewConsumer(brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &PartitionListener{Consumer: consumer, Topic: topic, done: make(chan struct{})}, nil
+}
+
+func (l *PartitionListener) Subscribe(ctx context.Context, handler Handler) error {
+	return l.SubscribeClaims(ctx, func(int32) ClaimHandler { return handlerFunc(handler) }, 0)
+}
+
+// SubscribeClaims 所有分区的消息在同一个 goroutine 中交给各分区的处理器，返回的偏移量被忽略
+func (l *PartitionListener) SubscribeClaims(ctx context.Context, newHandler func(partition int32) ClaimHandler, tick time.Duration) error {
+	l.running.Add(1)
+	defer l.running.Done()
+	partitions, err := l.Consumer.Partitions(l.Topic)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	var consumers []sarama.PartitionConsumer
+	defer func() {
+		close(stop)
+		for _, pc := range consumers {
+			pc.Close()
+		}
+	}()
+	messages := make(chan *sarama.ConsumerMessage)
+	handlers := make(map[int32]ClaimHandler, len(partitions))
+	for _, partition := range partitions {
+		pc, err := l.Consumer.ConsumePartition(l.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return err
+		}
+		consumers = append(consumers, pc)
+		handlers[partition] = newHandler(partition)
+		go func() {
+			for message := range pc.Messages() {
+				select {
+				case messages <- message:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	var ticks <-chan time.Time
+	if tick > 0 {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case message := <-messages:
+			_, err := handlers[message.Partition].Handle(Message{
+				Topic:     message.Topic,
+				Key:       string(message.Key),
+				Value:     string(message.Value),
+				Partition: message.Partition,
+				Offset:    message.Offset,
+				Timestamp: message.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+		case now := <-ticks:
+			for _, h := range handlers {
+				if _, err := h.Tick(now); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		case <-l.done:
+			return nil
+		}
+	}
+}
+
+func (l *PartitionListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	l.running.Wait()
+	return l.Consumer.Close()
+}
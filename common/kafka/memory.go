@@ -0,0 +1,286 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// MemoryTransport 进程内的消息总线，用于本地开发和测试
+//
+// 与 Kafka 保持相同的语义：按 key 哈希分区，分区内偏移量递增，
+// 消费组各自记录已提交的偏移量，新的消费组从最新的偏移量开始消费。
+// 一个消费组同一时刻只应有一个 Subscriber。
+type MemoryTransport struct {
+	// 新主题的默认分区数
+	Partitions int32
+
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+func NewMemoryTransport(partitions int32) *MemoryTransport {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &MemoryTransport{
+		Partitions: partitions,
+		topics:     make(map[string]*memoryTopic),
+	}
+}
+
+// CreateTopic 按配置创建主题，已存在的主题只会增加分区
+func (t *MemoryTransport) CreateTopic(spec TopicSpec) {
+	topic := t.topic(spec.Name)
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	for int32(len(topic.partitions)) < spec.Partitions {
+		topic.partitions = append(topic.partitions, nil)
+	}
+}
+
+// Provision 按配置创建主题，进程内实现没有主题级别的配置，不会有差异
+func (t *MemoryTransport) Provision(specs []TopicSpec) ([]TopicDiff, error) {
+	for _, spec := range specs {
+		t.CreateTopic(spec)
+	}
+	return nil, nil
+}
+
+func (t *MemoryTransport) topic(name string) *memoryTopic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	topic, ok := t.topics[name]
+	if !ok {
+		topic = &memoryTopic{
+			name:       name,
+			partitions: make([][]Message, t.Partitions),
+			groups:     make(map[string][]int64),
+			notify:     make(chan struct{}),
+		}
+		t.topics[name] = topic
+	}
+	return topic
+}
+
+func (t *MemoryTransport) NewPublisher(topic string) (Publisher, error) {
+	return &memoryPublisher{topic: t.topic(topic)}, nil
+}
+
+func (t *MemoryTransport) NewSubscriber(topic, group string) (Subscriber, error) {
+	if group == "" {
+		group = topic
+	}
+	mt := t.topic(topic)
+	mt.join(group)
+	return &memorySubscriber{topic: mt, group: group, done: make(chan struct{})}, nil
+}
+
+// NewListener 从各分区最新的偏移量开始读取，不加入消费组
+func (t *MemoryTransport) NewListener(topic string) (Subscriber, error) {
+	return &memorySubscriber{topic: t.topic(topic), done: make(chan struct{})}, nil
+}
+
+type memoryTopic struct {
+	name string
+
+	mu         sync.Mutex
+	partitions [][]Message
+	// 各消费组在每个分区上的下一个待消费偏移量
+	groups map[string][]int64
+	// 有新消息时关闭并替换，用于唤醒等待中的消费者
+	notify chan struct{}
+	// 无 key 消息的轮询计数
+	next int32
+}
+
+// hashPartition 与 sarama.NewHashPartitioner 相同的分区算法
+func hashPartition(key string, numPartitions int32) int32 {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	partition := int32(hasher.Sum32()) % numPartitions
+	if partition < 0 {
+		partition = -partition
+	}
+	return partition
+}
+
+func (mt *memoryTopic) join(group string) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if _, ok := mt.groups[group]; ok {
+		return
+	}
+	// 新消费组从最新的偏移量开始消费
+	offsets := make([]int64, len(mt.partitions))
+	for p := range mt.partitions {
+		offsets[p] = int64(len(mt.partitions[p]))
+	}
+	mt.groups[group] = offsets
+}
+
+func (mt *memoryTopic) append(key, value string, timestamp time.Time) (int32, int64) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	n := int32(len(mt.partitions))
+	var partition int32
+	if key == "" {
+		partition = mt.next % n
+		mt.next++
+	} else {
+		partition = hashPartition(key, n)
+	}
+	offset := int64(len(mt.partitions[partition]))
+	mt.partitions[partition] = append(mt.partitions[partition], Message{
+		Topic:     mt.name,
+		Key:       key,
+		Value:     value,
+		Partition: partition,
+		Offset:    offset,
+		Timestamp: timestamp,
+	})
+
+	close(mt.notify)
+	mt.notify = make(chan struct{})
+	return partition, offset
+}
+
+// offsets 返回消费组在各分区上已提交的偏移量，group 为空时返回各分区最新的偏移量
+func (mt *memoryTopic) offsets(group string) []int64 {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if group == "" {
+		latest := make([]int64, len(mt.partitions))
+		for p := range mt.partitions {
+			latest[p] = int64(len(mt.partitions[p]))
+		}
+		return latest
+	}
+	return append([]int64(nil), mt.groups[group]...)
+}
+
+// pending 返回从 position 开始尚未读取的消息以及下一次等待用的通知，position 会按读取的消息前移
+func (mt *memoryTopic) pending(position []int64) ([]Message, []int64, <-chan struct{}) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	for len(position) < len(mt.partitions) {
+		position = append(position, 0)
+	}
+	var msgs []Message
+	for p, log := range mt.partitions {
+		msgs = append(msgs, log[position[p]:]...)
+		position[p] = int64(len(log))
+	}
+	return msgs, position, mt.notify
+}
+
+// commit 提交消费组在分区上的下一个待消费偏移量，偏移量只会前移，group 为空时不提交
+func (mt *memoryTopic) commit(group string, partition int32, next int64) {
+	if group == "" {
+		return
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	offsets := mt.groups[group]
+	for int32(len(offsets)) <= partition {
+		offsets = append(offsets, 0)
+	}
+	if next > offsets[partition] {
+		offsets[partition] = next
+	}
+	mt.groups[group] = offsets
+}
+
+type memoryPublisher struct {
+	topic *memoryTopic
+}
+
+func (p *memoryPublisher) Publish(key, value string, timestamp time.Time) (int32, int64, error) {
+	partition, offset := p.topic.append(key, value, timestamp)
+	return partition, offset, nil
+}
+
+func (p *memoryPublisher) Close() error {
+	return nil
+}
+
+type memorySubscriber struct {
+	topic *memoryTopic
+	// 为空时不属于消费组，见 NewListener
+	group string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *memorySubscriber) Subscribe(ctx context.Context, handler Handler) error {
+	return s.SubscribeClaims(ctx, func(int32) ClaimHandler { return handlerFunc(handler) }, 0)
+}
+
+// SubscribeClaims 所有分区在同一个 goroutine 中处理，从消费组已提交的偏移量开始读取
+func (s *memorySubscriber) SubscribeClaims(ctx context.Context, newHandler func(partition int32) ClaimHandler, tick time.Duration) error {
+	handlers := make(map[int32]ClaimHandler)
+	handler := func(partition int32) ClaimHandler {
+		h, ok := handlers[partition]
+		if !ok {
+			h = newHandler(partition)
+			handlers[partition] = h
+		}
+		return h
+	}
+	var ticks <-chan time.Time
+	if tick > 0 {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	position := s.topic.offsets(s.group)
+	for {
+		var msgs []Message
+		var notify <-chan struct{}
+		msgs, position, notify = s.topic.pending(position)
+		for _, msg := range msgs {
+			select {
+			case <-s.done:
+				return nil
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			next, err := handler(msg.Partition).Handle(msg)
+			if err != nil {
+				return err
+			}
+			if next >= 0 {
+				s.topic.commit(s.group, msg.Partition, next)
+			}
+		}
+
+		select {
+		case <-notify:
+		case now := <-ticks:
+			for partition, h := range handlers {
+				next, err := h.Tick(now)
+				if err != nil {
+					return err
+				}
+				if next >= 0 {
+					s.topic.commit(s.group, partition, next)
+				}
+			}
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -13,10 +14,10 @@ type Producer struct {
 
 func NewProducer(brokers []string, topic string) (*Producer, error) {
 	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForLocal        // 等待本地副本写入成功
-	config.Producer.Retry.Max = 5                             // 最大重试次数
-	config.Producer.Return.Successes = true                   // 发送成功返回
-	config.Producer.Partitioner = sarama.NewRandomPartitioner // 随机分区器
+	config.Producer.RequiredAcks = sarama.WaitForLocal      // 等待本地副本写入成功
+	config.Producer.Retry.Max = 5                           // 最大重试次数
+	config.Producer.Return.Successes = true                 // 发送成功返回
+	config.Producer.Partitioner = sarama.NewHashPartitioner // 按key哈希分区，同一设备的数据进入同一分区
 
 	producer, err := sarama.NewSyncProducer(brokers, config)
 	if err != nil {
@@ -30,11 +31,16 @@ func NewProducer(brokers []string, topic string) (*Producer, error) {
 }
 
 func (kp *Producer) SendMessage(key, value string) (int32, int64, error) {
+	return kp.SendMessageAt(key, value, time.Now())
+}
+
+// SendMessageAt 发送消息并使用指定的事件时间作为消息时间戳
+func (kp *Producer) SendMessageAt(key, value string, timestamp time.Time) (int32, int64, error) {
 	msg := &sarama.ProducerMessage{
 		Topic:     kp.topic,
 		Key:       sarama.StringEncoder(key),
 		Value:     sarama.StringEncoder(value),
-		Timestamp: time.Now(),
+		Timestamp: timestamp,
 	}
 
 	partition, offset, err := kp.syncProducer.SendMessage(msg)
@@ -45,6 +51,135 @@ func (kp *Producer) SendMessage(key, value string) (int32, int64, error) {
 	return partition, offset, nil
 }
 
+// Publish 实现 Publisher
+func (kp *Producer) Publish(key, value string, timestamp time.Time) (int32, int64, error) {
+	return kp.SendMessageAt(key, value, timestamp)
+}
+
 func (kp *Producer) Close() error {
 	return kp.syncProducer.Close()
 }
+
+// AsyncProducerConfig 异步生产者配置
+type AsyncProducerConfig struct {
+	// 批量发送的消息条数和最长等待时间，任一条件满足即发送
+	BatchSize int
+	Linger    time.Duration
+
+	// 压缩算法，如 sarama.CompressionSnappy
+	Compression sarama.CompressionCodec
+
+	// 幂等生产，避免重试导致重复消息，要求 acks=all 且单连接只有一个在途请求
+	Idempotent bool
+
+	// 发送失败的回调，为空时丢弃错误
+	OnError func(key, value string, err error)
+	// 发送成功的回调，可以为空
+	OnSuccess func(key string, partition int32, offset int64)
+}
+
+func DefaultAsyncProducerConfig() AsyncProducerConfig {
+	return AsyncProducerConfig{
+		BatchSize:   500,
+		Linger:      50 * time.Millisecond,
+		Compression: sarama.CompressionSnappy,
+		Idempotent:  true,
+	}
+}
+
+// AsyncProducer 异步批量发送消息，发送结果通过回调返回
+type AsyncProducer struct {
+	asyncProducer sarama.AsyncProducer
+	topic         string
+	conf          AsyncProducerConfig
+
+	wg sync.WaitGroup
+}
+
+func NewAsyncProducer(brokers []string, topic string, conf AsyncProducerConfig) (*AsyncProducer, error) {
+	producer, err := sarama.NewAsyncProducer(brokers, asyncProducerConfig(conf))
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncProducer(producer, topic, conf), nil
+}
+
+// asyncProducerConfig 异步生产者的 sarama 配置
+func asyncProducerConfig(conf AsyncProducerConfig) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_4_0_0
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Errors = true
+	config.Producer.Return.Successes = conf.OnSuccess != nil
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Flush.Messages = conf.BatchSize
+	config.Producer.Flush.Frequency = conf.Linger
+	config.Producer.Compression = conf.Compression
+	if conf.Idempotent {
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+	return config
+}
+
+// newAsyncProducer 包装 sarama 的异步生产者，并开始将发送结果交给回调
+func newAsyncProducer(producer sarama.AsyncProducer, topic string, conf AsyncProducerConfig) *AsyncProducer {
+	ap := &AsyncProducer{
+		asyncProducer: producer,
+		topic:         topic,
+		conf:          conf,
+	}
+	ap.wg.Add(1)
+	go ap.dispatch()
+	return ap
+}
+
+func (ap *AsyncProducer) dispatch() {
+	defer ap.wg.Done()
+
+	errors := ap.asyncProducer.Errors()
+	var successes <-chan *sarama.ProducerMessage
+	if ap.conf.OnSuccess != nil {
+		successes = ap.asyncProducer.Successes()
+	}
+	for errors != nil || successes != nil {
+		select {
+		case perr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			if ap.conf.OnError != nil {
+				key, _ := perr.Msg.Key.Encode()
+				value, _ := perr.Msg.Value.Encode()
+				ap.conf.OnError(string(key), string(value), perr.Err)
+			}
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			key, _ := msg.Key.Encode()
+			ap.conf.OnSuccess(string(key), msg.Partition, msg.Offset)
+		}
+	}
+}
+
+// SendMessageAt 将消息放入发送队列，不等待发送结果
+func (ap *AsyncProducer) SendMessageAt(key, value string, timestamp time.Time) {
+	ap.asyncProducer.Input() <- &sarama.ProducerMessage{
+		Topic:     ap.topic,
+		Key:       sarama.StringEncoder(key),
+		Value:     sarama.StringEncoder(value),
+		Timestamp: timestamp,
+	}
+}
+
+// Close 发送完队列中的消息后关闭
+func (ap *AsyncProducer) Close() error {
+	ap.asyncProducer.AsyncClose()
+	ap.wg.Wait()
+	return nil
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// 同一设备的数据必须始终进入同一分区，内存实现的分区也要与 sarama 一致
+func TestHashPartitionerKeepsDeviceOnPartition(t *testing.T) {
+	const partitions = 12
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("device-%03d", i)
+		want := hashPartition(key, partitions)
+		for round := 0; round < 3; round++ {
+			// 每次新建分区器，模拟生产者重启
+			partitioner := asyncProducerConfig(DefaultAsyncProducerConfig()).Producer.Partitioner("telemetry")
+			msg := &sarama.ProducerMessage{Topic: "telemetry", Key: sarama.StringEncoder(key)}
+			got, err := partitioner.Partition(msg, partitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("key %s: partition %d, want %d", key, got, want)
+			}
+		}
+	}
+}
+
+func TestAsyncProducerConfig(t *testing.T) {
+	conf := asyncProducerConfig(AsyncProducerConfig{BatchSize: 200, Linger: 20 * time.Millisecond, Idempotent: true})
+	if conf.Producer.Flush.Messages != 200 || conf.Producer.Flush.Frequency != 20*time.Millisecond {
+		t.Fatalf("flush = %d/%v", conf.Producer.Flush.Messages, conf.Producer.Flush.Frequency)
+	}
+	if !conf.Producer.Idempotent || conf.Producer.RequiredAcks != sarama.WaitForAll || conf.Net.MaxOpenRequests != 1 {
+		t.Fatalf("idempotent producer not configured: acks=%d maxOpen=%d", conf.Producer.RequiredAcks, conf.Net.MaxOpenRequests)
+	}
+	if conf.Producer.Return.Successes {
+		t.Fatal("successes returned without OnSuccess")
+	}
+	if err := conf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncProducerReportsErrors(t *testing.T) {
+	type failure struct {
+		key, value string
+		err        error
+	}
+	var mu sync.Mutex
+	var failures []failure
+	var succeeded []string
+
+	conf := DefaultAsyncProducerConfig()
+	conf.OnError = func(key, value string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, failure{key, value, err})
+	}
+	conf.OnSuccess = func(key string, partition int32, offset int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		succeeded = append(succeeded, key)
+	}
+
+	brokerDown := errors.New("broker down")
+	mock := mocks.NewAsyncProducer(t, asyncProducerConfig(conf))
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(brokerDown)
+
+	producer := newAsyncProducer(mock, "telemetry", conf)
+	now := time.Now()
+	producer.SendMessageAt("device-1", `{"t":1}`, now)
+	producer.SendMessageAt("device-2", `{"t":2}`, now)
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(succeeded) != 1 || succeeded[0] != "device-1" {
+		t.Fatalf("successes = %v", succeeded)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("failures = %+v", failures)
+	}
+	if f := failures[0]; f.key != "device-2" || f.value != `{"t":2}` || !errors.Is(f.err, brokerDown) {
+		t.Fatalf("failure = %+v", f)
+	}
+}
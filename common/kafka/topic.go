@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/spf13/viper"
+)
+
+// TopicSpec 主题的声明式配置
+type TopicSpec struct {
+	Name              string            `mapstructure:"name"`
+	Partitions        int32             `mapstructure:"partitions"`
+	ReplicationFactor int16             `mapstructure:"replication_factor"`
+	Retention         time.Duration     `mapstructure:"retention"`      // 对应 retention.ms，为0时使用集群默认值
+	CleanupPolicy     string            `mapstructure:"cleanup_policy"` // delete 或 compact
+	Configs           map[string]string `mapstructure:"configs"`        // 其他主题配置
+}
+
+// DeviceTopic 设备数据主题的默认配置：3个分区，1个副本，保存60s
+var DeviceTopic = TopicSpec{
+	Name:              "device",
+	Partitions:        3,
+	ReplicationFactor: 1,
+	Retention:         60 * time.Second,
+}
+
+// TopicDiff 主题期望配置与集群实际配置的差异
+type TopicDiff struct {
+	Topic string
+	Field string
+	Want  string
+	Have  string
+}
+
+func (d TopicDiff) String() string {
+	return fmt.Sprintf("topic %s: %s want %s, have %s", d.Topic, d.Field, d.Want, d.Have)
+}
+
+// configEntries 主题级别的配置项
+func (s TopicSpec) configEntries() map[string]string {
+	entries := make(map[string]string, len(s.Configs)+2)
+	for k, v := range s.Configs {
+		entries[k] = v
+	}
+	if s.Retention > 0 {
+		entries["retention.ms"] = strconv.FormatInt(s.Retention.Milliseconds(), 10)
+	}
+	if s.CleanupPolicy != "" {
+		entries["cleanup.policy"] = s.CleanupPolicy
+	}
+	return entries
+}
+
+// LoadTopicSpecs 从配置文件读取主题配置，未配置时返回 defaults
+func LoadTopicSpecs(key string, defaults ...TopicSpec) ([]TopicSpec, error) {
+	if !viper.IsSet(key) {
+		return defaults, nil
+	}
+	var specs []TopicSpec
+	if err := viper.UnmarshalKey(key, &specs); err != nil {
+		return nil, err
+	}
+	for i := range specs {
+		if specs[i].Name == "" {
+			return nil, fmt.Errorf("%s[%d]: topic name is required", key, i)
+		}
+		if specs[i].Partitions <= 0 {
+			specs[i].Partitions = 1
+		}
+		if specs[i].ReplicationFactor <= 0 {
+			specs[i].ReplicationFactor = 1
+		}
+	}
+	return specs, nil
+}
+
+// Diff 比较主题配置与集群实际配置
+func (a *Admin) Diff(specs []TopicSpec) ([]TopicDiff, error) {
+	topics, err := a.admin.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []TopicDiff
+	for _, spec := range specs {
+		detail, ok := topics[spec.Name]
+		if !ok {
+			diffs = append(diffs, TopicDiff{Topic: spec.Name, Field: "existence", Want: "present", Have: "missing"})
+			continue
+		}
+		if detail.NumPartitions != spec.Partitions {
+			diffs = append(diffs, TopicDiff{
+				Topic: spec.Name,
+				Field: "partitions",
+				Want:  strconv.Itoa(int(spec.Partitions)),
+				Have:  strconv.Itoa(int(detail.NumPartitions)),
+			})
+		}
+		if detail.ReplicationFactor != spec.ReplicationFactor {
+			diffs = append(diffs, TopicDiff{
+				Topic: spec.Name,
+				Field: "replication_factor",
+				Want:  strconv.Itoa(int(spec.ReplicationFactor)),
+				Have:  strconv.Itoa(int(detail.ReplicationFactor)),
+			})
+		}
+
+		entries, err := a.admin.DescribeConfig(sarama.ConfigResource{
+			Type: sarama.TopicResource,
+			Name: spec.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		actual := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			actual[entry.Name] = entry.Value
+		}
+		for name, want := range spec.configEntries() {
+			if have := actual[name]; have != want {
+				diffs = append(diffs, TopicDiff{Topic: spec.Name, Field: name, Want: want, Have: have})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// Apply 按配置创建或更新主题，返回无法自动修正的差异
+// 分区数只能增加，副本数不会自动修改
+func (a *Admin) Apply(specs []TopicSpec) ([]TopicDiff, error) {
+	diffs, err := a.Diff(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	bySpec := make(map[string]TopicSpec, len(specs))
+	for _, spec := range specs {
+		bySpec[spec.Name] = spec
+	}
+
+	var remaining []TopicDiff
+	altered := make(map[string]bool)
+	for _, diff := range diffs {
+		spec := bySpec[diff.Topic]
+		switch diff.Field {
+		case "existence":
+			if err := a.CreateTopicWithConfig(spec.Name, toConfigPtrs(spec.configEntries()), spec.Partitions, spec.ReplicationFactor); err != nil {
+				return nil, err
+			}
+		case "partitions":
+			have, _ := strconv.Atoi(diff.Have)
+			if int32(have) > spec.Partitions {
+				remaining = append(remaining, diff)
+				continue
+			}
+			if err := a.admin.CreatePartitions(spec.Name, spec.Partitions, nil, false); err != nil {
+				return nil, err
+			}
+		case "replication_factor":
+			remaining = append(remaining, diff)
+		default:
+			// 配置项一次性全部更新，AlterConfig 会覆盖未指定的配置
+			if altered[spec.Name] {
+				continue
+			}
+			if err := a.UpdateTopic(spec.Name, toConfigPtrs(spec.configEntries())); err != nil {
+				return nil, err
+			}
+			altered[spec.Name] = true
+		}
+	}
+	return remaining, nil
+}
+
+// ProvisionTopics 连接集群并应用主题配置，返回无法自动修正的差异
+func ProvisionTopics(brokers []string, specs []TopicSpec) ([]TopicDiff, error) {
+	admin, err := NewAdmin(brokers)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	return admin.Apply(specs)
+}
+
+func toConfigPtrs(entries map[string]string) map[string]*string {
+	ptrs := make(map[string]*string, len(entries))
+	for k := range entries {
+		v := entries[k]
+		ptrs[k] = &v
+	}
+	return ptrs
+}
@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeClusterAdmin 内存中的集群，只实现主题管理用到的方法
+type fakeClusterAdmin struct {
+	sarama.ClusterAdmin
+
+	topics  map[string]sarama.TopicDetail
+	configs map[string]map[string]string
+
+	created    []string
+	partitions map[string]int32
+	altered    map[string]int
+}
+
+func newFakeClusterAdmin() *fakeClusterAdmin {
+	return &fakeClusterAdmin{
+		topics:     make(map[string]sarama.TopicDetail),
+		configs:    make(map[string]map[string]string),
+		partitions: make(map[string]int32),
+		altered:    make(map[string]int),
+	}
+}
+
+func (f *fakeClusterAdmin) addTopic(name string, partitions int32, replication int16, configs map[string]string) {
+	f.topics[name] = sarama.TopicDetail{NumPartitions: partitions, ReplicationFactor: replication}
+	f.configs[name] = configs
+}
+
+func (f *fakeClusterAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return f.topics, nil
+}
+
+func (f *fakeClusterAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	var entries []sarama.ConfigEntry
+	for name, value := range f.configs[resource.Name] {
+		entries = append(entries, sarama.ConfigEntry{Name: name, Value: value})
+	}
+	return entries, nil
+}
+
+func (f *fakeClusterAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	f.created = append(f.created, topic)
+	configs := make(map[string]string, len(detail.ConfigEntries))
+	for name, value := range detail.ConfigEntries {
+		configs[name] = *value
+	}
+	f.addTopic(topic, detail.NumPartitions, detail.ReplicationFactor, configs)
+	return nil
+}
+
+func (f *fakeClusterAdmin) CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error {
+	f.partitions[topic] = count
+	return nil
+}
+
+func (f *fakeClusterAdmin) AlterConfig(resourceType sarama.ConfigResourceType, name string, entries map[string]*string, validateOnly bool) error {
+	f.altered[name]++
+	return nil
+}
+
+// sortDiffs 配置项差异的顺序不固定，排序后再比较
+func sortDiffs(diffs []TopicDiff) []TopicDiff {
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Topic != diffs[j].Topic {
+			return diffs[i].Topic < diffs[j].Topic
+		}
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
+func TestAdminDiff(t *testing.T) {
+	spec := TopicSpec{Name: "device", Partitions: 6, ReplicationFactor: 1, Retention: time.Minute, CleanupPolicy: "delete"}
+	inSync := map[string]string{"retention.ms": "60000", "cleanup.policy": "delete"}
+
+	tests := []struct {
+		name    string
+		cluster func(f *fakeClusterAdmin)
+		want    []TopicDiff
+	}{
+		{
+			name:    "in sync",
+			cluster: func(f *fakeClusterAdmin) { f.addTopic("device", 6, 1, inSync) },
+		},
+		{
+			name:    "missing topic",
+			cluster: func(f *fakeClusterAdmin) {},
+			want:    []TopicDiff{{Topic: "device", Field: "existence", Want: "present", Have: "missing"}},
+		},
+		{
+			name:    "partition increase",
+			cluster: func(f *fakeClusterAdmin) { f.addTopic("device", 3, 1, inSync) },
+			want:    []TopicDiff{{Topic: "device", Field: "partitions", Want: "6", Have: "3"}},
+		},
+		{
+			name:    "partition decrease",
+			cluster: func(f *fakeClusterAdmin) { f.addTopic("device", 12, 1, inSync) },
+			want:    []TopicDiff{{Topic: "device", Field: "partitions", Want: "6", Have: "12"}},
+		},
+		{
+			name: "config drift",
+			cluster: func(f *fakeClusterAdmin) {
+				f.addTopic("device", 6, 1, map[string]string{"retention.ms": "604800000", "cleanup.policy": "compact"})
+			},
+			want: []TopicDiff{
+				{Topic: "device", Field: "cleanup.policy", Want: "delete", Have: "compact"},
+				{Topic: "device", Field: "retention.ms", Want: "60000", Have: "604800000"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeClusterAdmin()
+			tt.cluster(fake)
+			diffs, err := (&Admin{admin: fake}).Diff([]TopicSpec{spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortDiffs(diffs); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminApply(t *testing.T) {
+	fake := newFakeClusterAdmin()
+	fake.addTopic("grown", 3, 1, map[string]string{"retention.ms": "60000"})
+	fake.addTopic("shrunk", 12, 1, map[string]string{"retention.ms": "60000"})
+	fake.addTopic("drifted", 3, 1, map[string]string{"retention.ms": "1000", "cleanup.policy": "compact"})
+
+	specs := []TopicSpec{
+		{Name: "missing", Partitions: 3, ReplicationFactor: 1, Retention: time.Minute},
+		{Name: "grown", Partitions: 6, ReplicationFactor: 1, Retention: time.Minute},
+		{Name: "shrunk", Partitions: 6, ReplicationFactor: 1, Retention: time.Minute},
+		{Name: "drifted", Partitions: 3, ReplicationFactor: 1, Retention: time.Minute, CleanupPolicy: "delete"},
+	}
+	remaining, err := (&Admin{admin: fake}).Apply(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 分区数不能减少，留给人工处理
+	want := []TopicDiff{{Topic: "shrunk", Field: "partitions", Want: "6", Have: "12"}}
+	if !reflect.DeepEqual(remaining, want) {
+		t.Fatalf("remaining = %v, want %v", remaining, want)
+	}
+	if !reflect.DeepEqual(fake.created, []string{"missing"}) {
+		t.Fatalf("created = %v", fake.created)
+	}
+	if got := fake.configs["missing"]["retention.ms"]; got != "60000" {
+		t.Fatalf("missing topic created with retention.ms %q", got)
+	}
+	if !reflect.DeepEqual(fake.partitions, map[string]int32{"grown": 6}) {
+		t.Fatalf("partitions = %v", fake.partitions)
+	}
+	// 两个配置项不同，只调用一次 AlterConfig
+	if !reflect.DeepEqual(fake.altered, map[string]int{"drifted": 1}) {
+		t.Fatalf("altered = %v", fake.altered)
+	}
+}
@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 主题中的一条消息
+type Message struct {
+	Topic     string
+	Key       string
+	Value     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+}
+
+// Publisher 向主题发送消息，同一个 key 的消息进入同一分区
+type Publisher interface {
+	Publish(key, value string, timestamp time.Time) (partition int32, offset int64, err error)
+	Close() error
+}
+
+// Handler 处理一条消息，返回错误时停止消费，该消息的偏移量不会提交
+type Handler func(msg Message) error
+
+// ClaimHandler 处理一个分区的消息，由处理器决定可以提交的偏移量，用于会缓存消息的处理器。
+// 同一分区的 Handle 和 Tick 在同一个 goroutine 中顺序调用，不同分区并发调用
+type ClaimHandler interface {
+	// Handle 处理一条消息，返回该分区下一个可以提交的偏移量，仍缓存在处理器中的消息不能提交。
+	// 返回错误时停止消费
+	Handle(msg Message) (next int64, err error)
+	// Tick 定期调用，返回下一个可以提交的偏移量，小于0表示不变
+	Tick(now time.Time) (next int64, err error)
+}
+
+// Subscriber 以消费组的方式消费主题，同一分区内的消息按偏移量顺序交给 Handler
+type Subscriber interface {
+	Subscribe(ctx context.Context, handler Handler) error
+	// SubscribeClaims 每获得一个分区调用 newHandler 创建该分区的处理器，tick 为 Tick 的调用间隔，为0时不调用。
+	// 分区被收回或重启后从最后提交的偏移量继续消费，未提交的消息会再次交给处理器
+	SubscribeClaims(ctx context.Context, newHandler func(partition int32) ClaimHandler, tick time.Duration) error
+	Close() error
+}
+
+// handlerFunc 将 Handler 适配为 ClaimHandler，每条消息处理完即可提交
+type handlerFunc Handler
+
+func (h handlerFunc) Handle(msg Message) (int64, error) {
+	if err := h(msg); err != nil {
+		return -1, err
+	}
+	return msg.Offset + 1, nil
+}
+
+func (h handlerFunc) Tick(time.Time) (int64, error) {
+	return -1, nil
+}
+
+// Transport 消息总线，Kafka 集群或进程内实现
+type Transport interface {
+	NewPublisher(topic string) (Publisher, error)
+	// group 为空时使用主题名作为消费组
+	NewSubscriber(topic, group string) (Subscriber, error)
+	// NewListener 不加入消费组，从各分区最新的偏移量开始读取，不提交偏移量，用于推送实时数据
+	NewListener(topic string) (Subscriber, error)
+	// Provision 按配置创建或更新主题，返回与配置不一致且无法自动修正的差异
+	Provision(specs []TopicSpec) ([]TopicDiff, error)
+}
+
+// 消息总线的实现
+const (
+	TransportKafka  = "kafka"
+	TransportMemory = "memory"
+)
+
+var (
+	memoryMu       sync.Mutex
+	memoryClusters = make(map[string]*MemoryTransport)
+)
+
+// SharedMemoryTransport 返回进程内以 name 区分的共享消息总线，同一进程中名称相同的组件连接到同一个总线
+func SharedMemoryTransport(name string) *MemoryTransport {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	t, ok := memoryClusters[name]
+	if !ok {
+		t = NewMemoryTransport(1)
+		memoryClusters[name] = t
+	}
+	return t
+}
+
+// NewTransport 按配置创建消息总线，kind 为空时使用 Kafka。
+// 进程内实现以 brokers 作为总线名称，生产者和消费者的 brokers 配置相同时连接到同一个总线，
+// 只在各组件运行于同一进程（如测试）时互通
+func NewTransport(kind string, brokers []string) (Transport, error) {
+	switch kind {
+	case "", TransportKafka:
+		return NewKafkaTransport(brokers), nil
+	case TransportMemory:
+		return SharedMemoryTransport(strings.Join(brokers, ",")), nil
+	default:
+		return nil, fmt.Errorf("unknown message transport %q", kind)
+	}
+}
+
+// KafkaTransport 基于 sarama 的 Kafka 实现
+type KafkaTransport struct {
+	Brokers []string
+}
+
+func NewKafkaTransport(brokers []string) *KafkaTransport {
+	return &KafkaTransport{Brokers: brokers}
+}
+
+func (t *KafkaTransport) NewPublisher(topic string) (Publisher, error) {
+	return NewProducer(t.Brokers, topic)
+}
+
+func (t *KafkaTransport) NewSubscriber(topic, group string) (Subscriber, error) {
+	if group == "" {
+		group = topic
+	}
+	return NewGroupConsumer(t.Brokers, topic, group)
+}
+
+func (t *KafkaTransport) NewListener(topic string) (Subscriber, error) {
+	return NewPartitionListener(t.Brokers, topic)
+}
+
+func (t *KafkaTransport) Provision(specs []TopicSpec) ([]TopicDiff, error) {
+	return ProvisionTopics(t.Brokers, specs)
+}
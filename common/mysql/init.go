@@ -68,24 +68,77 @@ func InitDB() {
 		panic("数据库初始化失败")
 	}
 
+	// 分配记录表首次创建时为已分配的模块补齐记录
+	hadAssignments := Db.Migrator().HasTable(&models.ModuleAssignment{})
 	err = Db.AutoMigrate(
 		&models.User{},
 		&models.UserRole{},
 		&models.OrderStatus{},
+		&models.OrderStatusTransition{},
 		&models.Category{},
 		&models.Product{},
 		&models.RentalOrder{},
 		&models.OrderItem{},
+		&models.Depot{},
+		&models.DepotTransfer{},
 		&models.Vehicle{},
+		&models.Dispatch{},
+		&models.DispatchOrder{},
+		&models.DispatchModule{},
+		&models.RoutePlan{},
+		&models.RouteStop{},
+		&models.Geofence{},
+		&models.RouteAlert{},
 		&models.Module{},
+		&models.ModuleAssignment{},
 		&models.Notification{},
 	)
 	if err != nil {
 		logger.Fatal(map[string]interface{}{"error": err.Error()}, "AutoMigrate failed")
 	}
+	if err := seed(Db); err != nil {
+		logger.Fatal(map[string]interface{}{"error": err.Error()}, "Seeding database failed")
+	}
+	if !hadAssignments {
+		n, err := backfillAssignments(Db)
+		if err != nil {
+			logger.Fatal(map[string]interface{}{"error": err.Error()}, "Backfilling module assignments failed")
+		}
+		logger.Infof("Backfilled %d module assignments", n)
+	}
 	logger.Infof("Mysql Database migrated successfully")
 }
 
+// backfillAssignments 为引入分配记录之前已分配的模块补齐记录，开始时间取模块的最后更新时间
+func backfillAssignments(db *gorm.DB) (int64, error) {
+	result := db.Exec(`
+		INSERT INTO module_assignments (module_id, device_id, order_id, order_item_id, assigned_at)
+		SELECT m.id, m.device_id, oi.order_id, m.order_item_id, m.updated_at
+		FROM modules m JOIN order_items oi ON oi.id = m.order_item_id
+		WHERE m.status IN (?, ?) AND m.deleted_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM module_assignments a WHERE a.module_id = m.id AND a.released_at IS NULL
+		)`, models.StatusAssigned, models.StatusReturned)
+	return result.RowsAffected, result.Error
+}
+
+// seed 写入缺少的角色和订单状态，已有记录保留原ID
+func seed(db *gorm.DB) error {
+	for _, name := range models.Roles {
+		role := models.UserRole{RoleName: name}
+		if err := db.Where("role_name = ?", name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+	}
+	for _, name := range models.OrderStatuses {
+		status := models.OrderStatus{StatusName: name}
+		if err := db.Where("status_name = ?", name).FirstOrCreate(&status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func GetInstance() *gorm.DB {
 	return Db
 }
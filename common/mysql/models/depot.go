@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 仓库，冷链箱和车辆都归属一个仓库
+type Depot struct {
+	gorm.Model
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	Name      string  `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Address   string  `gorm:"size:255;not null" json:"address"`
+	Longitude float64 `gorm:"type:decimal(10,6);not null" json:"longitude"`
+	Latitude  float64 `gorm:"type:decimal(10,6);not null" json:"latitude"`
+	Capacity  int     `gorm:"not null" json:"capacity"` // 可存放的冷链箱数量，0 表示不限
+}
+
+// 仓库间调拨记录，每次调拨一个冷链箱或一辆车
+type DepotTransfer struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FromDepotID *uint     `gorm:"index" json:"from_depot_id"` // 调出仓库，原先未归属仓库时为空
+	ToDepotID   uint      `gorm:"not null;index" json:"to_depot_id"`
+	ModuleID    *uint     `gorm:"index" json:"module_id"`
+	VehicleID   *uint     `gorm:"index" json:"vehicle_id"`
+	CreatedBy   uint      `json:"created_by"`
+	Remark      string    `gorm:"size:255" json:"remark"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// 调度单状态
+const (
+	DispatchPlanned   = "planned"    // 已装车，待发车
+	DispatchInTransit = "in_transit" // 运输中
+	DispatchCompleted = "completed"  // 行程结束，车辆已释放
+)
+
+// 车辆调度单，一次出车装载若干已审核订单的冷链箱
+type Dispatch struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	VehicleID        uint       `gorm:"not null;index" json:"vehicle_id"`
+	DriverName       string     `gorm:"size:50;not null" json:"driver_name"`
+	DriverPhone      string     `gorm:"size:20" json:"driver_phone"`
+	PlannedDeparture time.Time  `gorm:"not null" json:"planned_departure"` // 计划发车时间
+	DepartedAt       *time.Time `json:"departed_at"`                       // 实际发车时间
+	CompletedAt      *time.Time `json:"completed_at"`                      // 行程结束时间
+	Status           string     `gorm:"size:20;not null;index" json:"status"`
+	ModuleCount      int        `gorm:"not null" json:"module_count"`          // 装载的冷链箱数量
+	LoadWeight       float64    `gorm:"type:decimal(10,2)" json:"load_weight"` // 装载总重，含冷链箱自重，千克
+	LoadVolume       float64    `gorm:"type:decimal(10,3)" json:"load_volume"` // 冷链箱占用的货厢容积，立方米
+	CreatedBy        uint       `json:"created_by"`
+	Remark           string     `gorm:"size:255" json:"remark"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Vehicle Vehicle          `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	Orders  []DispatchOrder  `gorm:"foreignKey:DispatchID" json:"orders"`
+	Modules []DispatchModule `gorm:"foreignKey:DispatchID" json:"modules"`
+}
+
+// 调度单包含的订单
+type DispatchOrder struct {
+	ID         uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	DispatchID uint `gorm:"not null;index" json:"dispatch_id"`
+	OrderID    uint `gorm:"not null;index" json:"order_id"`
+}
+
+// 调度单装载的冷链箱，按送达顺序倒序装车，最先送达的最后装、靠近车门
+type DispatchModule struct {
+	ID            uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	DispatchID    uint    `gorm:"not null;index" json:"dispatch_id"`
+	ModuleID      uint    `gorm:"not null;index" json:"module_id"`
+	DeviceID      string  `gorm:"size:255;not null" json:"device_id"`
+	OrderID       uint    `gorm:"not null" json:"order_id"`
+	LoadSequence  int     `json:"load_sequence"`                    // 装车顺序，从1开始，1 在货厢最里侧
+	DeliveryIndex int     `json:"delivery_index"`                   // 所属订单的送达顺序，从1开始
+	Weight        float64 `gorm:"type:decimal(10,2)" json:"weight"` // 含冷链箱自重，千克
+}
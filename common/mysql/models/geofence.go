@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 地理围栏类型
+const (
+	GeofenceDepot     = "depot"     // 仓库，允许停车
+	GeofenceCustomer  = "customer"  // 客户站点，允许停车
+	GeofenceForbidden = "forbidden" // 禁行区域，车辆进入即告警
+)
+
+// 地理围栏，Polygon 非空时按多边形判断，否则按圆心和半径判断
+type Geofence struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string         `gorm:"size:100;not null" json:"name"`
+	Kind      string         `gorm:"size:20;not null;index" json:"kind"`
+	Longitude float64        `gorm:"type:decimal(10,6)" json:"longitude"`
+	Latitude  float64        `gorm:"type:decimal(10,6)" json:"latitude"`
+	RadiusKm  float64        `gorm:"type:decimal(8,3)" json:"radius_km"`
+	Polygon   datatypes.JSON `gorm:"type:json" json:"polygon"`    // [[经度, 纬度], ...]
+	DepotID   *uint          `gorm:"index" json:"depot_id"`       // 仓库围栏对应的仓库
+	Enabled   bool           `gorm:"default:true" json:"enabled"` // 停用的围栏不参与检查
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// 路线告警类型
+const (
+	RouteAlertCorridor  = "corridor"  // 驶出路线走廊
+	RouteAlertStop      = "stop"      // 在站点和允许停车的围栏以外长时间停车
+	RouteAlertForbidden = "forbidden" // 进入禁行区域
+)
+
+// 路线告警处理状态，与 alarm_record 一致
+const (
+	AlertUnread = "未读"
+	AlertRead   = "已读"
+)
+
+// 执行中的路线按车辆定位检查出的告警，同一段持续的异常只记一条
+type RouteAlert struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoutePlanID uint      `gorm:"not null;index" json:"route_plan_id"`
+	VehicleID   uint      `gorm:"not null;index" json:"vehicle_id"`
+	Kind        string    `gorm:"size:20;not null" json:"kind"`
+	GeofenceID  *uint     `json:"geofence_id"` // 禁行区域告警对应的围栏
+	StartedAt   time.Time `gorm:"not null;index" json:"started_at"`
+	EndedAt     time.Time `gorm:"not null" json:"ended_at"` // 最近一次检查时异常的最后一个定位
+	Longitude   float64   `gorm:"type:decimal(10,6)" json:"longitude"`
+	Latitude    float64   `gorm:"type:decimal(10,6)" json:"latitude"`
+	Detail      string    `gorm:"size:255" json:"detail"`
+	Status      string    `gorm:"size:20;not null" json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
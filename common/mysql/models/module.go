@@ -11,16 +11,27 @@ const (
 	StatusAssigned   ModuleStatus = "assigned"   // 设备分配
 	StatusUnassigned ModuleStatus = "unassigned" // 设备未分配
 	StatusFaulty     ModuleStatus = "faulty"     // 设备故障
+	StatusReturned   ModuleStatus = "returned"   // 已归还仓库，待清洁检查
 )
 
 type Module struct {
 	gorm.Model
 	ID                 uint         `gorm:"primaryKey" json:"id"`
-	DeviceID           string       `gorm:"size:255;unique" json:"device_id"`                          // 设备物理ID
-	SettingTemperature float64      `gorm:"type:decimal(5,1)" json:"setting_temperature"`              // 设定温度值
-	MaxTemperature     float64      `gorm:"type:decimal(5,1)" json:"max_temperature"`                  // 最高温度值
-	MinTemperature     float64      `gorm:"type:decimal(5,1)" json:"min_temperature"`                  // 最低温度值
-	Status             ModuleStatus `gorm:"type:enum('assigned','unassigned','faulty')" json:"status"` // 设备状态 (枚举)
-	IsEnabled          bool         `gorm:"default:false" json:"is_enabled"`                           // 是否启用
-	OrderItemID        *uint        `json:"order_item_id"`                                             // 关联的订单项ID
+	DeviceID           string       `gorm:"size:255;unique" json:"device_id"`                                     // 设备物理ID
+	SettingTemperature float64      `gorm:"type:decimal(5,1)" json:"setting_temperature"`                         // 设定温度值
+	MaxTemperature     float64      `gorm:"type:decimal(5,1)" json:"max_temperature"`                             // 最高温度值
+	MinTemperature     float64      `gorm:"type:decimal(5,1)" json:"min_temperature"`                             // 最低温度值
+	Status             ModuleStatus `gorm:"type:enum('assigned','unassigned','faulty','returned')" json:"status"` // 设备状态 (枚举)
+	IsEnabled          bool         `gorm:"default:false" json:"is_enabled"`                                      // 是否启用
+	OrderItemID        *uint        `json:"order_item_id"`                                                        // 关联的订单项ID
+
+	// 设备能力和状态，分配时按这些字段筛选和排序
+	SupportedMinTemperature float64 `gorm:"type:decimal(5,1);default:-25" json:"supported_min_temperature"` // 可维持的最低温度
+	SupportedMaxTemperature float64 `gorm:"type:decimal(5,1);default:25" json:"supported_max_temperature"`  // 可维持的最高温度
+	BatteryLevel            float64 `gorm:"type:decimal(5,1);default:100" json:"battery_level"`             // 最近上报的电量百分比
+	Longitude               float64 `gorm:"type:decimal(10,6)" json:"longitude"`                            // 存放位置经度，未知时为0
+	Latitude                float64 `gorm:"type:decimal(10,6)" json:"latitude"`                             // 存放位置纬度，未知时为0
+	DepotID                 *uint   `gorm:"index" json:"depot_id"`                                          // 所在仓库，出库后保留出发的仓库
+	InnerVolume             float64 `gorm:"type:decimal(10,3);default:0.1" json:"inner_volume"`             // 内部容积，立方米
+	MaxPayload              float64 `gorm:"type:decimal(10,2);default:50" json:"max_payload"`               // 最大载重，千克
 }
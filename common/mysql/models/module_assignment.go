@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 模块分配记录，模块每服务一个订单项产生一条，释放后保留用于追溯
+// [DispatchedAt, ReturnedAt] 是模块为该订单工作的时间段，监控数据按设备ID和该时间段归属到订单
+type ModuleAssignment struct {
+	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	ModuleID     uint           `gorm:"not null;index" json:"module_id"`
+	DeviceID     string         `gorm:"size:255;not null;index:idx_assignment_device_time" json:"device_id"` // 设备物理ID，用于关联监控数据
+	OrderID      uint           `gorm:"not null;index" json:"order_id"`
+	OrderItemID  uint           `gorm:"not null" json:"order_item_id"`
+	AssignedAt   time.Time      `gorm:"not null;index:idx_assignment_device_time" json:"assigned_at"`
+	DispatchedAt *time.Time     `json:"dispatched_at"`                // 装车发车的时间，此前冷链箱仍在仓库
+	ReturnedAt   *time.Time     `json:"returned_at"`                  // 归还到仓库的时间
+	ReturnDepot  string         `gorm:"size:100" json:"return_depot"` // 归还的仓库
+	ReleasedAt   *time.Time     `json:"released_at"`                  // 检查完毕或订单取消后释放的时间，未释放时为空
+	Checklist    datatypes.JSON `gorm:"type:json" json:"checklist"`   // 清洁检查结果
+	Damaged      bool           `gorm:"default:false" json:"damaged"` // 检查时是否发现损坏
+	DamageNote   string         `gorm:"size:255" json:"damage_note"`  // 损坏说明
+	InspectorID  uint           `json:"inspector_id"`                 // 检查人
+	Contents     datatypes.JSON `gorm:"type:json" json:"contents"`    // 装箱规划放入的订单项，[]ModuleContent
+}
+
+// ModuleContent 冷链箱内装载的一个订单项及件数
+type ModuleContent struct {
+	OrderItemID uint    `json:"order_item_id"`
+	ProductName string  `json:"product_name"`
+	Quantity    int     `json:"quantity"`
+	Weight      float64 `json:"weight"` // 千克
+	Volume      float64 `json:"volume"` // 立方米
+}
+
+// Window 模块为订单工作的时间段，从装车发车开始，没有发车记录时从分配开始；
+// 归还前取消的订单以释放时间结束，仍在使用的以 now 结束
+func (a *ModuleAssignment) Window(now time.Time) (start, end time.Time) {
+	start = a.AssignedAt
+	if a.DispatchedAt != nil {
+		start = *a.DispatchedAt
+	}
+	switch {
+	case a.ReturnedAt != nil:
+		return start, *a.ReturnedAt
+	case a.ReleasedAt != nil:
+		return start, *a.ReleasedAt
+	default:
+		return start, now
+	}
+}
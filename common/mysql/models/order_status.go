@@ -1,9 +1,54 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 订单状态名称
+const (
+	OrderPendingPayment  = "待支付"
+	OrderPaid            = "已支付"
+	OrderApproved        = "已审核"
+	OrderRejected        = "已驳回"
+	OrderDispatched      = "已发车"
+	OrderInTransit       = "运输中"
+	OrderDelivered       = "已送达"
+	OrderModulesReturned = "已归还"
+	OrderClosed          = "已完成"
+	OrderCancelled       = "已取消"
+)
+
+// OrderStatuses 全部订单状态，数据库迁移时写入 order_statuses
+var OrderStatuses = []string{
+	OrderPendingPayment,
+	OrderPaid,
+	OrderApproved,
+	OrderRejected,
+	OrderDispatched,
+	OrderInTransit,
+	OrderDelivered,
+	OrderModulesReturned,
+	OrderClosed,
+	OrderCancelled,
+}
 
 type OrderStatus struct {
 	gorm.Model
 	ID         uint   `gorm:"primaryKey" json:"id"`
 	StatusName string `gorm:"size:20;not null" json:"status_name"`
 }
+
+// 订单状态流转记录
+type OrderStatusTransition struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID    uint      `gorm:"not null;index" json:"order_id"`
+	Event      string    `gorm:"size:30;not null" json:"event"`
+	FromStatus string    `gorm:"size:20" json:"from_status"` // 创建订单时为空
+	ToStatus   string    `gorm:"size:20;not null" json:"to_status"`
+	ActorID    uint      `json:"actor_id"` // 操作人，系统触发时为0
+	ActorRole  string    `gorm:"size:50" json:"actor_role"`
+	Remark     string    `gorm:"size:255" json:"remark"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -18,6 +18,9 @@ type RentalOrder struct {
 	ReceiverInfo datatypes.JSON `gorm:"type:json;not null" json:"receiver_info"`
 	DeliveryDate time.Time      `gorm:"size:10;not null;default:CURRENT_TIMESTAMP(3)" json:"delivery_date"`
 	OrderNote    string         `gorm:"size:255;" json:"order_note"`
+	RentalDays   int            `gorm:"not null;default:1" json:"rental_days"` // 租期天数
+	Deposit      float64        `gorm:"type:decimal(12,2)" json:"deposit"`     // 冷链箱押金，已计入 TotalPrice
+	Quote        datatypes.JSON `gorm:"type:json" json:"quote"`                // 下单时的分项报价
 	OrderItems   []OrderItem    `gorm:"foreignKey:OrderID" json:"order_items"`
 	OrderStatus  OrderStatus    `gorm:"foreignKey:StatusID" json:"status"`
 	User         User           `gorm:"foreignKey:UserID" json:"user"`
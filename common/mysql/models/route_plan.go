@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// 路线计划状态
+const (
+	RoutePlanPlanned   = "planned"   // 已保存，待执行
+	RoutePlanExecuting = "executing" // 车辆已出发
+	RoutePlanCompleted = "completed" // 所有站点已到达
+	RoutePlanReplaced  = "replaced"  // 执行中重新规划，剩余站点由新路线接替
+)
+
+// 到达时间的来源
+const (
+	ArrivalSourceGPS     = "gps"     // 按 vehicle_location 轨迹匹配
+	ArrivalSourceCheckIn = "checkin" // 司机签到
+	ArrivalSourceReroute = "reroute" // 重新规划时车辆所在的位置
+)
+
+// 一辆车的路线计划，由路径规划结果保存而来
+type RoutePlan struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	VehicleID    uint       `gorm:"not null;index" json:"vehicle_id"`
+	DepotID      *uint      `gorm:"index" json:"depot_id"`
+	Status       string     `gorm:"size:20;not null;index" json:"status"`
+	DistanceKm   float64    `gorm:"type:decimal(10,2)" json:"distance_km"` // 计划里程
+	PlannedStart time.Time  `gorm:"not null" json:"planned_start"`
+	PlannedEnd   time.Time  `gorm:"not null" json:"planned_end"` // 到达最后一站的计划时间
+	StartedAt    *time.Time `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	ReplacesID   *uint      `gorm:"index" json:"replaces_id"`     // 重新规划前的路线
+	RerouteNote  string     `gorm:"size:255" json:"reroute_note"` // 重新规划的原因
+	CreatedBy    uint       `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	Vehicle Vehicle     `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	Stops   []RouteStop `gorm:"foreignKey:RoutePlanID" json:"stops"`
+}
+
+// 路线计划的一个站点，Sequence 为0的是出发仓库，重新规划的路线为车辆当时所在的位置
+type RouteStop struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoutePlanID    uint       `gorm:"not null;index" json:"route_plan_id"`
+	Sequence       int        `gorm:"not null" json:"sequence"`
+	NodeType       int        `gorm:"not null" json:"node_type"` // 0=仓库，1=取货，2=送货
+	OrderID        *uint      `gorm:"index" json:"order_id"`     // 仓库为空
+	Longitude      float64    `gorm:"type:decimal(10,6)" json:"longitude"`
+	Latitude       float64    `gorm:"type:decimal(10,6)" json:"latitude"`
+	LegDistanceKm  float64    `gorm:"type:decimal(10,2)" json:"leg_distance_km"` // 距上一站的计划里程
+	PlannedArrival time.Time  `gorm:"not null" json:"planned_arrival"`
+	Deadline       *time.Time `json:"deadline"` // 送货站点的最晚送达时间
+	ActualArrival  *time.Time `json:"actual_arrival"`
+	ArrivalSource  string     `gorm:"size:20" json:"arrival_source"`
+	RiskNotifiedAt *time.Time `json:"risk_notified_at"` // 已通知客户可能延误的时间
+}
+
+// DeviationMinutes 实际到达比计划晚的分钟数，提前为负，未到达时返回 false
+func (s *RouteStop) DeviationMinutes() (float64, bool) {
+	if s.ActualArrival == nil {
+		return 0, false
+	}
+	return s.ActualArrival.Sub(s.PlannedArrival).Minutes(), true
+}
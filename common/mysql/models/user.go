@@ -5,6 +5,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// 角色名称
+const (
+	RoleAdmin      = "admin"      // 系统管理员
+	RoleManager    = "manager"    // 冷链业务管理员
+	RoleMerchant   = "merchant"   // 商户客户
+	RoleIndividual = "individual" // 个人客户
+	RoleDriver     = "driver"     // 司机，只能查看所驾驶车辆的路线
+)
+
+// Roles 系统中的全部角色，数据库迁移时写入 user_roles
+var Roles = []string{RoleAdmin, RoleManager, RoleMerchant, RoleIndividual, RoleDriver}
+
+// IsCustomerRole 客户只能访问自己的订单、通知和个人信息
+func IsCustomerRole(roleName string) bool {
+	return roleName == RoleMerchant || roleName == RoleIndividual
+}
+
 type UserRole struct {
 	ID       uint   `gorm:"primaryKey" json:"id"`
 	RoleName string `gorm:"type:varchar(50);not null" json:"role_name"`
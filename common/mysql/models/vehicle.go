@@ -20,6 +20,11 @@ type Vehicle struct {
 	ID          uint          `gorm:"primaryKey" json:"id"`
 	PlateNumber string        `gorm:"type:varchar(20);uniqueIndex;not null" json:"plate_number"`
 	Status      VehicleStatus `gorm:"type:varchar(20);not null" json:"status"`
-	MaxCapacity int           `gorm:"not null" json:"max_capacity"`
+	MaxCapacity int           `gorm:"not null" json:"max_capacity"` // 最多装载的冷链箱数量
 	ImgUrl      string        `gorm:"type:varchar(255)" json:"img_url"`
+	DepotID     *uint         `gorm:"index" json:"depot_id"`  // 所属仓库，车辆从这里出发
+	DriverID    *uint         `gorm:"index" json:"driver_id"` // 驾驶该车辆的司机用户，可查看和订阅车辆路线
+	// 货厢容积（立方米）和额定载重（千克），为0时不限制
+	CargoVolume float64 `gorm:"type:decimal(10,2);default:0" json:"cargo_volume"`
+	MaxPayload  float64 `gorm:"type:decimal(10,2);default:0" json:"max_payload"`
 }
@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RouteUpdateChannel 车辆路线变更通知频道，司机端按车辆订阅
+func RouteUpdateChannel(vehicleID uint) string {
+	return KeyPrefix + "route:vehicle:" + strconv.FormatUint(uint64(vehicleID), 10)
+}
+
+// RouteUpdate 车辆路线变更通知，收到后按 RoutePlanID 重新获取路线
+type RouteUpdate struct {
+	VehicleID   uint   `json:"vehicle_id"`
+	RoutePlanID uint   `json:"route_plan_id"`
+	ReplacesID  uint   `json:"replaces_id"`
+	Reason      string `json:"reason"`
+}
+
+// PublishRouteUpdate 发布车辆路线变更通知，必须在数据库事务提交之后调用
+func PublishRouteUpdate(ctx context.Context, client *redis.Client, update RouteUpdate) error {
+	if client == nil {
+		return nil
+	}
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	return client.Publish(ctx, RouteUpdateChannel(update.VehicleID), payload).Err()
+}
+
+// SubscribeRouteUpdates 订阅车辆的路线变更通知，返回时订阅已生效，调用方负责关闭
+func SubscribeRouteUpdates(ctx context.Context, client *redis.Client, vehicleID uint) (*redis.PubSub, error) {
+	sub := client.Subscribe(ctx, RouteUpdateChannel(vehicleID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// 所有缓存键统一使用该前缀，避免与其他业务的键冲突
+	KeyPrefix = "coldchain:"
+
+	// 设备温度阈值变更通知频道
+	DeviceThresholdChannel = KeyPrefix + "device:threshold:changed"
+)
+
+// DeviceThresholdKey 设备温度阈值的缓存键
+func DeviceThresholdKey(deviceID string) string {
+	return KeyPrefix + "device:threshold:" + deviceID
+}
+
+// ThresholdChange 设备阈值变更通知
+// Version 取模块记录的更新时间（UnixNano），版本号更小的缓存视为过期
+type ThresholdChange struct {
+	DeviceID string `json:"device_id"`
+	Version  int64  `json:"version"`
+}
+
+// PublishThresholdChanges 删除设备阈值缓存并发布变更通知
+// 必须在数据库事务提交之后调用，否则订阅方可能重新读到旧值
+func PublishThresholdChanges(ctx context.Context, client *redis.Client, changes ...ThresholdChange) error {
+	if client == nil || len(changes) == 0 {
+		return nil
+	}
+
+	pipe := client.TxPipeline()
+	for _, change := range changes {
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		pipe.Del(ctx, DeviceThresholdKey(change.DeviceID))
+		pipe.Publish(ctx, DeviceThresholdChannel, payload)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SubscribeThresholdChanges 订阅设备阈值变更通知，直到 ctx 结束
+func SubscribeThresholdChanges(ctx context.Context, client *redis.Client, handler func(ThresholdChange)) error {
+	sub := client.Subscribe(ctx, DeviceThresholdChannel)
+	defer sub.Close()
+
+	// 等待订阅确认，保证之后发布的通知不会丢失
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var change ThresholdChange
+			if err := json.Unmarshal([]byte(msg.Payload), &change); err != nil {
+				continue
+			}
+			handler(change)
+		}
+	}
+}
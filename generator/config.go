@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 
 	_ "coldchain/common/config"
@@ -21,6 +23,14 @@ var (
 	MYSQL_HOST    = "localhost"
 	MYSQL_PORT    = "3306"
 	KAFKA_BROKERS = []string{"localhost:9092"}
+	// 消息总线实现，kafka 或 memory，memory 只在与分析器运行于同一进程时可用
+	KAFKA_TRANSPORT = "kafka"
+
+	// 异步批量发送
+	KAFKA_ASYNC      = true
+	KAFKA_BATCH_SIZE = 500
+	KAFKA_LINGER     = 50 * time.Millisecond
+	KAFKA_IDEMPOTENT = true
 )
 
 func ImportConfig() {
@@ -45,7 +55,22 @@ func ImportConfig() {
 	if viper.IsSet("generator.gen_port") {
 		GEN_PORT = viper.GetString("gen_port")
 	}
+	if viper.IsSet("generator.kafka.transport") {
+		KAFKA_TRANSPORT = viper.GetString("generator.kafka.transport")
+	}
 	if viper.IsSet("generator.kafka.brokers") {
 		KAFKA_BROKERS = viper.GetStringSlice("generator.kafka.brokers")
 	}
+	if viper.IsSet("generator.kafka.async") {
+		KAFKA_ASYNC = viper.GetBool("generator.kafka.async")
+	}
+	if viper.IsSet("generator.kafka.batch_size") {
+		KAFKA_BATCH_SIZE = viper.GetInt("generator.kafka.batch_size")
+	}
+	if viper.IsSet("generator.kafka.linger") {
+		KAFKA_LINGER = viper.GetDuration("generator.kafka.linger")
+	}
+	if viper.IsSet("generator.kafka.idempotent") {
+		KAFKA_IDEMPOTENT = viper.GetBool("generator.kafka.idempotent")
+	}
 }
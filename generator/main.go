@@ -12,41 +12,38 @@ import (
 	"time"
 )
 
-func initKafka() {
-	// 初始化Kafka
-	// 连接Kafka
-	admin, err := kafka.NewAdmin(KAFKA_BROKERS)
+func initKafka() kafka.Transport {
+	bus, err := kafka.NewTransport(KAFKA_TRANSPORT, KAFKA_BROKERS)
 	if err != nil {
-		logger.Fatalf("Failed to create Kafka admin: %v", err)
+		logger.Fatalf("Failed to create transport: %v", err)
 	}
-	defer admin.Close()
 
-	isExist, err := admin.Exists("device")
+	// 按配置文件创建或更新主题
+	specs, err := kafka.LoadTopicSpecs("generator.kafka.topics", kafka.DeviceTopic)
 	if err != nil {
-		logger.Fatalf("Failed to check if topic device exists: %v", err)
+		logger.Fatalf("Failed to load Kafka topic specs: %v", err)
 	}
-	retentionMs := "60000" // 保存60s
-	if !isExist {
-		// 如果topic不存在，则创建topic
-		// 3个分区，1个副本
-		err = admin.CreateTopicWithConfig("device", map[string]*string{
-			"retention.ms": &retentionMs,
-		}, 3, 1)
-		if err != nil {
-			logger.Fatalf("Failed to create topic device_temperature: %v", err)
-		}
-
-	} else {
-		// 如果topic已经存在，则更新配置
-		err = admin.UpdateTopic("device", map[string]*string{
-			"retention.ms": &retentionMs,
-		})
-		if err != nil {
-			logger.Fatalf("Failed to update topic device_temperature: %v", err)
-		}
+	diffs, err := bus.Provision(specs)
+	if err != nil {
+		logger.Fatalf("Failed to provision Kafka topics: %v", err)
+	}
+	for _, diff := range diffs {
+		logger.Warnf("Kafka topic differs from spec, %s", diff)
 	}
-
 	logger.Infof("Kafka init successfully")
+	return bus
+}
+
+// sendReadings 为每个设备生成一条采样数据并发送，然后更新设备状态
+func sendReadings(send sender, devices map[string]*Device, now time.Time) {
+	for _, device := range devices {
+		device.CurTemperature = device.SetTemperature + (rand.Float64()-0.5)*2
+		// 消息内容: 温度 电量 采样时间(Unix毫秒)
+		send.SendMessageAt(device.DeviceID, strconv.FormatFloat(device.CurTemperature, 'f', 2, 64)+" "+strconv.FormatFloat(device.BatteryLevel, 'f', 2, 64)+" "+strconv.FormatInt(now.UnixMilli(), 10), now)
+
+		// 更新设备状态
+		device.UpdateStat()
+	}
 }
 
 func main() {
@@ -54,16 +51,13 @@ func main() {
 	ImportConfig()
 	mysql.InitDB()
 	logger.SetOutput(os.Stdout)
-	initKafka()
+	bus := initKafka()
 
 	moduleRepo := dao.NewModuleRepository(mysql.Db)
 	devices := make(map[string]*Device)
 	var modulesMut sync.Mutex
-	producer, err := kafka.NewProducer(KAFKA_BROKERS, "device")
-	if err != nil {
-		panic(err)
-	}
-	defer producer.Close()
+	send := newSender(bus)
+	defer send.Close()
 
 	go func() {
 		// 每10秒钟检查一次数据库，获取最新的模块列表
@@ -97,20 +91,9 @@ func main() {
 	}()
 
 	tricker := time.NewTicker(time.Second / time.Duration(GENERATION_RATE))
-	for range tricker.C {
+	for now := range tricker.C {
 		modulesMut.Lock()
-		for _, device := range devices {
-			device.CurTemperature = device.SetTemperature + (rand.Float64()-0.5)*2
-			partition, offset, err := producer.SendMessage(device.DeviceID, strconv.FormatFloat(device.CurTemperature, 'f', 2, 64)+" "+strconv.FormatFloat(device.BatteryLevel, 'f', 2, 64))
-			if err != nil {
-				logger.Errorf("发送数据失败: %v", err)
-			} else {
-				logger.Infof("发送数据成功: %s, partition: %d, offset: %d", device.DeviceID, partition, offset)
-			}
-
-			// 更新设备状态
-			device.UpdateStat()
-		}
+		sendReadings(send, devices, now)
 		modulesMut.Unlock()
 	}
 }
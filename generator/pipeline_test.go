@@ -0,0 +1,112 @@
+package main
+
+import (
+	"coldchain/analyzer/stream"
+	"coldchain/common/kafka"
+	"coldchain/monitor/services"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 生成器 → 分析器 → 监控 在同一进程中通过进程内消息总线运行，不需要 Kafka
+func TestPipelineRunsInProcess(t *testing.T) {
+	source, err := kafka.NewTransport(kafka.TransportMemory, []string{"pipeline-test-source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := kafka.NewTransport(kafka.TransportMemory, []string{"pipeline-test-sink"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bus := range []kafka.Transport{source, sink} {
+		if _, err := bus.Provision([]kafka.TopicSpec{kafka.DeviceTopic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 分析器
+	var mu sync.Mutex
+	analyzed := map[string]int{}
+	analyzer := stream.NewAnalyzer(source, sink, "device", stream.EventTimeConfig{
+		AllowedLateness: time.Second,
+		IdleTimeout:     100 * time.Millisecond,
+	}).SetAnalysisFunc(func(r stream.Reading) error {
+		mu.Lock()
+		analyzed[r.DeviceID]++
+		mu.Unlock()
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go analyzer.Run(ctx)
+
+	// 监控
+	monitor := services.NewMonitorService(sink, "device")
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		monitor.MonitorTemperature(conn, "DEV-CHILLED")
+	}))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 生成器，监控从最新数据开始读取，持续发送直到收到数据
+	send := newSender(source)
+	defer send.Close()
+	devices := map[string]*Device{
+		"DEV-CHILLED": {DeviceID: "DEV-CHILLED", SetTemperature: 4, BatteryLevel: 100},
+		"DEV-FROZEN":  {DeviceID: "DEV-FROZEN", SetTemperature: -18, BatteryLevel: 100},
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				sendReadings(send, devices, now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 3; i++ {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read monitor message %d: %v", i, err)
+		}
+		temperature, err := strconv.ParseFloat(string(msg), 64)
+		if err != nil {
+			t.Fatalf("monitor message %q: %v", msg, err)
+		}
+		// 只收到所监控设备的数据
+		if temperature < 2 || temperature > 6 {
+			t.Fatalf("monitor temperature = %v, want DEV-CHILLED reading near 4", temperature)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if analyzed["DEV-CHILLED"] == 0 || analyzed["DEV-FROZEN"] == 0 {
+		t.Fatalf("analyzed readings = %v, want both devices", analyzed)
+	}
+}
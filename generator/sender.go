@@ -0,0 +1,54 @@
+package main
+
+import (
+	"coldchain/common/kafka"
+	"coldchain/common/logger"
+	"time"
+)
+
+// sender 设备数据的发送方式，同步发送或异步批量发送
+type sender interface {
+	SendMessageAt(key, value string, timestamp time.Time)
+	Close() error
+}
+
+type syncSender struct {
+	producer kafka.Publisher
+}
+
+func (s *syncSender) SendMessageAt(key, value string, timestamp time.Time) {
+	partition, offset, err := s.producer.Publish(key, value, timestamp)
+	if err != nil {
+		logger.Errorf("发送数据失败: %v", err)
+	} else {
+		logger.Infof("发送数据成功: %s, partition: %d, offset: %d", key, partition, offset)
+	}
+}
+
+func (s *syncSender) Close() error {
+	return s.producer.Close()
+}
+
+// 异步批量发送只支持 Kafka 集群
+func newSender(bus kafka.Transport) sender {
+	if _, isKafka := bus.(*kafka.KafkaTransport); !KAFKA_ASYNC || !isKafka {
+		producer, err := bus.NewPublisher("device")
+		if err != nil {
+			panic(err)
+		}
+		return &syncSender{producer: producer}
+	}
+
+	conf := kafka.DefaultAsyncProducerConfig()
+	conf.BatchSize = KAFKA_BATCH_SIZE
+	conf.Linger = KAFKA_LINGER
+	conf.Idempotent = KAFKA_IDEMPOTENT
+	conf.OnError = func(key, value string, err error) {
+		logger.Errorf("发送数据失败: %s, %v", key, err)
+	}
+	producer, err := kafka.NewAsyncProducer(KAFKA_BROKERS, "device", conf)
+	if err != nil {
+		panic(err)
+	}
+	return producer
+}
@@ -11,6 +11,8 @@ var (
 	MONITOR_IP   string = "0.0.0.0"
 
 	KAFKA_SOURCE_BROKERS = []string{"localhost:29092"}
+	// 消息总线实现，kafka 或 memory，memory 只在与分析器运行于同一进程时可用
+	KAFKA_TRANSPORT = "kafka"
 )
 
 func ImportConfig() {
@@ -23,4 +25,7 @@ func ImportConfig() {
 	if viper.IsSet("kafka.sink.brokers") {
 		KAFKA_SOURCE_BROKERS = viper.GetStringSlice("kafka.sink.brokers")
 	}
+	if viper.IsSet("kafka.transport") {
+		KAFKA_TRANSPORT = viper.GetString("kafka.transport")
+	}
 }
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"coldchain/common/kafka"
 	"coldchain/monitor/config"
 	"coldchain/monitor/services"
 	"net/http"
@@ -17,6 +18,10 @@ type Monitor struct {
 }
 
 func NewMonitor(ch driver.Conn) *Monitor {
+	bus, err := kafka.NewTransport(config.KAFKA_TRANSPORT, config.KAFKA_SOURCE_BROKERS)
+	if err != nil {
+		panic(err)
+	}
 	return &Monitor{
 		ch: ch,
 		upgrader: websocket.Upgrader{
@@ -27,7 +32,7 @@ func NewMonitor(ch driver.Conn) *Monitor {
 				return true
 			},
 		},
-		ms: services.NewMonitorService(config.KAFKA_SOURCE_BROKERS, "device"),
+		ms: services.NewMonitorService(bus, "device"),
 	}
 }
 
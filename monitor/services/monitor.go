@@ -2,35 +2,36 @@ package services
 
 import (
 	"coldchain/common/kafka"
+	"context"
 
 	"github.com/gorilla/websocket"
 )
 
 // MonitorService 监控服务
 type MonitorService struct {
-	kf *kafka.Consumer
+	bus   kafka.Transport
+	topic string
 }
 
 // NewMonitorService 创建一个新的监控服务
-func NewMonitorService(brokers []string, topic string) *MonitorService {
-	kf, err := kafka.NewConsumer(brokers, topic)
-	if err != nil {
-		panic(err)
-	}
+func NewMonitorService(bus kafka.Transport, topic string) *MonitorService {
 	return &MonitorService{
-		kf: kf,
+		bus:   bus,
+		topic: topic,
 	}
 }
 
 // MonitorTemperature 监控温度数据
+// 每个连接直接读取所有分区的最新数据，不加入消费组，断开后不会在集群中留下消费组
 func (ms *MonitorService) MonitorTemperature(conn *websocket.Conn, deviceID string) error {
-	th := NewTemperatureHandler(conn, deviceID)
-	for {
-		err := ms.kf.Consume(th)
-		if err != nil {
-			return err
-		}
+	sub, err := ms.bus.NewListener(ms.topic)
+	if err != nil {
+		return err
 	}
+	defer sub.Close()
+
+	th := NewTemperatureHandler(conn, deviceID)
+	return sub.Subscribe(context.Background(), th.Handle)
 }
 
 func (ms *MonitorService) MonitorBattery(conn *websocket.Conn, deviceID string) error {
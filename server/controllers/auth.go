@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"coldchain/common/jwt"
+	"coldchain/common/mysql/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 认证中间件写入上下文的键
+const (
+	CtxUserID   = "auth_user_id"
+	CtxRoleName = "auth_role_name"
+	CtxClaims   = "auth_claims"
+)
+
+// CurrentUser 返回当前登录用户的ID和角色，未登录时 ok 为 false
+func CurrentUser(ctx *gin.Context) (userID uint, roleName string, ok bool) {
+	id, exists := ctx.Get(CtxUserID)
+	if !exists {
+		return 0, "", false
+	}
+	return id.(uint), ctx.GetString(CtxRoleName), true
+}
+
+// CurrentClaims 返回当前请求的访问token声明
+func CurrentClaims(ctx *gin.Context) (*jwt.Claims, bool) {
+	claims, exists := ctx.Get(CtxClaims)
+	if !exists {
+		return nil, false
+	}
+	return claims.(*jwt.Claims), true
+}
+
+// isStaff 当前用户是否为系统管理员或业务管理员
+func isStaff(ctx *gin.Context) bool {
+	_, role, ok := CurrentUser(ctx)
+	return ok && (role == models.RoleAdmin || role == models.RoleManager)
+}
+
+// isAdmin 当前用户是否为系统管理员
+func isAdmin(ctx *gin.Context) bool {
+	_, role, ok := CurrentUser(ctx)
+	return ok && role == models.RoleAdmin
+}
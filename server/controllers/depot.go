@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/dto"
+	"coldchain/server/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DepotController 仓库管理和仓库间调拨
+type DepotController struct {
+	depotRepo *dao.DepotRepository
+}
+
+func NewDepotController(db *gorm.DB) *DepotController {
+	if db == nil {
+		panic("NewDepotController received nil DB instance")
+	}
+	return &DepotController{
+		depotRepo: dao.NewDepotRepository(db),
+	}
+}
+
+func toDepotDTO(d *models.Depot, stored int) dto.DepotDTO {
+	return dto.DepotDTO{
+		ID:        d.ID,
+		Name:      d.Name,
+		Address:   d.Address,
+		Longitude: d.Longitude,
+		Latitude:  d.Latitude,
+		Capacity:  d.Capacity,
+		Stored:    stored,
+	}
+}
+
+func toTransferDTOs(transfers []models.DepotTransfer) []dto.DepotTransferDTO {
+	responses := make([]dto.DepotTransferDTO, 0, len(transfers))
+	for _, t := range transfers {
+		responses = append(responses, dto.DepotTransferDTO{
+			ID:          t.ID,
+			FromDepotID: t.FromDepotID,
+			ToDepotID:   t.ToDepotID,
+			ModuleID:    t.ModuleID,
+			VehicleID:   t.VehicleID,
+			CreatedBy:   t.CreatedBy,
+			Remark:      t.Remark,
+			CreatedAt:   t.CreatedAt,
+		})
+	}
+	return responses
+}
+
+func (c *DepotController) ListDepots(ctx *gin.Context) {
+	depots, err := c.depotRepo.ListDepots()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取仓库列表失败"})
+		return
+	}
+	stored, err := c.depotRepo.CountModulesByDepot()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "统计仓库库存失败"})
+		return
+	}
+
+	responses := make([]dto.DepotDTO, 0, len(depots))
+	for i := range depots {
+		responses = append(responses, toDepotDTO(&depots[i], stored[depots[i].ID]))
+	}
+	ctx.JSON(http.StatusOK, responses)
+}
+
+func (c *DepotController) CreateDepot(ctx *gin.Context) {
+	var req dto.CreateDepotRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exists, err := c.depotRepo.CheckDepotNameExists(req.Name, 0)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "检查仓库名称失败"})
+		return
+	}
+	if exists {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "仓库名称已存在"})
+		return
+	}
+
+	depot := models.Depot{
+		Name:      req.Name,
+		Address:   req.Address,
+		Longitude: req.Longitude,
+		Latitude:  req.Latitude,
+		Capacity:  req.Capacity,
+	}
+	if err := c.depotRepo.CreateDepot(&depot); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建仓库失败"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, toDepotDTO(&depot, 0))
+}
+
+func (c *DepotController) UpdateDepot(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的仓库ID"})
+		return
+	}
+
+	var req dto.UpdateDepotRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	depot, err := c.depotRepo.GetDepotByID(uint(id))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "仓库不存在"})
+		return
+	}
+	if req.Name != nil {
+		exists, err := c.depotRepo.CheckDepotNameExists(*req.Name, depot.ID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "检查仓库名称失败"})
+			return
+		}
+		if exists {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "仓库名称已存在"})
+			return
+		}
+		depot.Name = *req.Name
+	}
+	if req.Address != nil {
+		depot.Address = *req.Address
+	}
+	if req.Longitude != nil {
+		depot.Longitude = *req.Longitude
+	}
+	if req.Latitude != nil {
+		depot.Latitude = *req.Latitude
+	}
+	if req.Capacity != nil {
+		depot.Capacity = *req.Capacity
+	}
+
+	if err := c.depotRepo.UpdateDepot(depot); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新仓库失败"})
+		return
+	}
+	stored, err := c.depotRepo.CountDepotModules(depot.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "统计仓库库存失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, toDepotDTO(depot, stored))
+}
+
+// Transfer 将冷链箱和车辆调拨到指定仓库
+func (c *DepotController) Transfer(ctx *gin.Context) {
+	var req dto.TransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if len(req.ModuleIDs) == 0 && len(req.VehicleIDs) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请选择要调拨的冷链箱或车辆"})
+		return
+	}
+
+	var transfers []models.DepotTransfer
+	err := c.depotRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfers, err = services.TransferToDepot(tx, services.TransferPlan{
+			ToDepotID:  req.ToDepotID,
+			ModuleIDs:  req.ModuleIDs,
+			VehicleIDs: req.VehicleIDs,
+			Remark:     req.Remark,
+		}, actor(ctx))
+		return err
+	})
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, toTransferDTOs(transfers))
+	case errors.Is(err, services.ErrDepotFull),
+		errors.Is(err, services.ErrModuleNotMovable),
+		errors.Is(err, services.ErrVehicleNotMovable):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "仓库、冷链箱或车辆不存在"})
+	default:
+		logger.Errorf("仓库调拨失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "仓库调拨失败"})
+	}
+}
+
+// ListTransfers 调拨记录，可按 ?depot_id= 过滤
+func (c *DepotController) ListTransfers(ctx *gin.Context) {
+	var depotID uint64
+	if s := ctx.Query("depot_id"); s != "" {
+		var err error
+		if depotID, err = strconv.ParseUint(s, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的仓库ID"})
+			return
+		}
+	}
+
+	transfers, err := c.depotRepo.ListTransfers(uint(depotID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取调拨记录失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, toTransferDTOs(transfers))
+}
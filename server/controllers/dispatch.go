@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/dto"
+	"coldchain/server/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DispatchController 车辆调度：装车、发车和行程结束
+type DispatchController struct {
+	dispatchRepo *dao.DispatchRepository
+	dispatcher   *services.Dispatcher
+}
+
+func NewDispatchController(db *gorm.DB, fsm *services.OrderStateMachine) *DispatchController {
+	if db == nil {
+		panic("NewDispatchController received nil DB instance")
+	}
+	return &DispatchController{
+		dispatchRepo: dao.NewDispatchRepository(db),
+		dispatcher:   services.NewDispatcher(fsm),
+	}
+}
+
+func toDispatchDTO(d *models.Dispatch) dto.DispatchDTO {
+	resp := dto.DispatchDTO{
+		ID:               d.ID,
+		VehicleID:        d.VehicleID,
+		PlateNumber:      d.Vehicle.PlateNumber,
+		DriverName:       d.DriverName,
+		DriverPhone:      d.DriverPhone,
+		PlannedDeparture: d.PlannedDeparture,
+		DepartedAt:       d.DepartedAt,
+		CompletedAt:      d.CompletedAt,
+		Status:           d.Status,
+		ModuleCount:      d.ModuleCount,
+		LoadWeight:       d.LoadWeight,
+		LoadVolume:       d.LoadVolume,
+		OrderIDs:         make([]uint, 0, len(d.Orders)),
+		Remark:           d.Remark,
+		CreatedAt:        d.CreatedAt,
+	}
+	for _, o := range d.Orders {
+		resp.OrderIDs = append(resp.OrderIDs, o.OrderID)
+	}
+	for _, m := range d.Modules {
+		resp.Modules = append(resp.Modules, toDispatchModuleDTO(m))
+	}
+	return resp
+}
+
+func toDispatchModuleDTO(m models.DispatchModule) dto.DispatchModuleDTO {
+	return dto.DispatchModuleDTO{
+		ModuleID:      m.ModuleID,
+		DeviceID:      m.DeviceID,
+		OrderID:       m.OrderID,
+		LoadSequence:  m.LoadSequence,
+		DeliveryIndex: m.DeliveryIndex,
+		Weight:        m.Weight,
+	}
+}
+
+// dispatchError 将调度错误写入响应
+func dispatchError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrVehicleUnavailable),
+		errors.Is(err, services.ErrOverCapacity),
+		errors.Is(err, services.ErrOverWeight),
+		errors.Is(err, services.ErrDispatchState),
+		errors.Is(err, services.ErrInvalidTransition):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrForbidden):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "车辆、订单或调度单不存在"})
+	default:
+		logger.Errorf("车辆调度失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "车辆调度失败"})
+	}
+}
+
+// CreateDispatch 将已审核订单的冷链箱装车
+func (c *DispatchController) CreateDispatch(ctx *gin.Context) {
+	var req dto.CreateDispatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var dispatch *models.Dispatch
+	err := c.dispatchRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		dispatch, err = c.dispatcher.Create(tx, services.DispatchPlan{
+			VehicleID:        req.VehicleID,
+			OrderIDs:         req.OrderIDs,
+			DriverName:       req.DriverName,
+			DriverPhone:      req.DriverPhone,
+			PlannedDeparture: req.PlannedDeparture,
+			Remark:           req.Remark,
+		}, actor(ctx))
+		return err
+	})
+	if err != nil {
+		dispatchError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, toDispatchDTO(dispatch))
+}
+
+// PlanLoading 预览车辆装载订单冷链箱的装车顺序和重量，超出车辆限制时返回错误
+func (c *DispatchController) PlanLoading(ctx *gin.Context) {
+	var req dto.LoadingPlanRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var vehicle *models.Vehicle
+	var loading *services.VehicleLoading
+	err := c.dispatchRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		vehicle, err = dao.NewVehicleRepository(tx).GetVehicleForUpdate(req.VehicleID)
+		if err != nil {
+			return err
+		}
+		loading, err = c.dispatcher.PlanLoading(tx, vehicle, req.OrderIDs)
+		return err
+	})
+	if err != nil {
+		dispatchError(ctx, err)
+		return
+	}
+
+	resp := dto.LoadingPlanDTO{
+		VehicleID:   vehicle.ID,
+		PlateNumber: vehicle.PlateNumber,
+		MaxCapacity: vehicle.MaxCapacity,
+		CargoVolume: vehicle.CargoVolume,
+		MaxPayload:  vehicle.MaxPayload,
+		ModuleCount: len(loading.Modules),
+		LoadWeight:  loading.Weight,
+		LoadVolume:  loading.Volume,
+		Modules:     make([]dto.DispatchModuleDTO, 0, len(loading.Modules)),
+	}
+	for _, m := range loading.Modules {
+		resp.Modules = append(resp.Modules, toDispatchModuleDTO(m))
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// DepartDispatch 车辆发车
+func (c *DispatchController) DepartDispatch(ctx *gin.Context) {
+	c.advance(ctx, c.dispatcher.Depart, "车辆已发车")
+}
+
+// CompleteDispatch 行程结束，释放车辆
+func (c *DispatchController) CompleteDispatch(ctx *gin.Context) {
+	c.advance(ctx, c.dispatcher.Complete, "行程已结束")
+}
+
+func (c *DispatchController) advance(ctx *gin.Context,
+	step func(*gorm.DB, uint, services.Actor, time.Time) (*models.Dispatch, error), message string) {
+	dispatchID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的调度单ID"})
+		return
+	}
+
+	err = c.dispatchRepo.Transaction(func(tx *gorm.DB) error {
+		_, err := step(tx, uint(dispatchID), actor(ctx), time.Now())
+		return err
+	})
+	if err != nil {
+		dispatchError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (c *DispatchController) GetDispatch(ctx *gin.Context) {
+	dispatchID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的调度单ID"})
+		return
+	}
+
+	dispatch, err := c.dispatchRepo.GetDispatchByID(uint(dispatchID))
+	if err != nil {
+		dispatchError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toDispatchDTO(dispatch))
+}
+
+func (c *DispatchController) ListDispatches(ctx *gin.Context) {
+	dispatches, err := c.dispatchRepo.ListDispatches(ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取调度单失败"})
+		return
+	}
+
+	responses := make([]dto.DispatchDTO, 0, len(dispatches))
+	for i := range dispatches {
+		responses = append(responses, toDispatchDTO(&dispatches[i]))
+	}
+	ctx.JSON(http.StatusOK, responses)
+}
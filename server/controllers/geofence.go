@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/dto"
+	"coldchain/server/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GeofenceController 地理围栏管理：仓库、客户站点和禁行区域
+type GeofenceController struct {
+	fenceRepo *dao.GeofenceRepository
+	depotRepo *dao.DepotRepository
+}
+
+func NewGeofenceController(db *gorm.DB) *GeofenceController {
+	if db == nil {
+		panic("NewGeofenceController received nil DB instance")
+	}
+	return &GeofenceController{
+		fenceRepo: dao.NewGeofenceRepository(db),
+		depotRepo: dao.NewDepotRepository(db),
+	}
+}
+
+func toGeofenceDTO(f *models.Geofence) dto.GeofenceDTO {
+	resp := dto.GeofenceDTO{
+		ID:        f.ID,
+		Name:      f.Name,
+		Kind:      f.Kind,
+		Longitude: f.Longitude,
+		Latitude:  f.Latitude,
+		RadiusKm:  f.RadiusKm,
+		Polygon:   [][2]float64{},
+		DepotID:   f.DepotID,
+		Enabled:   f.Enabled,
+		CreatedAt: f.CreatedAt,
+	}
+	polygon, _ := services.GeofencePolygon(*f)
+	for _, p := range polygon {
+		resp.Polygon = append(resp.Polygon, [2]float64{p.Longitude, p.Latitude})
+	}
+	return resp
+}
+
+// encodePolygon 空多边形存为空值，表示圆形围栏
+func encodePolygon(polygon [][2]float64) datatypes.JSON {
+	if len(polygon) == 0 {
+		return nil
+	}
+	raw, _ := json.Marshal(polygon)
+	return raw
+}
+
+func geofenceID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的围栏ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (c *GeofenceController) ListGeofences(ctx *gin.Context) {
+	fences, err := c.fenceRepo.ListGeofences(false)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取围栏列表失败"})
+		return
+	}
+
+	responses := make([]dto.GeofenceDTO, 0, len(fences))
+	for i := range fences {
+		responses = append(responses, toGeofenceDTO(&fences[i]))
+	}
+	ctx.JSON(http.StatusOK, responses)
+}
+
+func (c *GeofenceController) CreateGeofence(ctx *gin.Context) {
+	var req dto.CreateGeofenceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fence := models.Geofence{
+		Name:      req.Name,
+		Kind:      req.Kind,
+		Longitude: req.Longitude,
+		Latitude:  req.Latitude,
+		RadiusKm:  req.RadiusKm,
+		Polygon:   encodePolygon(req.Polygon),
+		Enabled:   true,
+	}
+	if req.DepotID != nil {
+		depot, err := c.depotRepo.GetDepotByID(*req.DepotID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "仓库不存在"})
+			return
+		}
+		fence.DepotID = &depot.ID
+		if req.Longitude == 0 && req.Latitude == 0 {
+			fence.Longitude, fence.Latitude = depot.Longitude, depot.Latitude
+		}
+	}
+	if err := services.ValidateGeofence(fence); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.fenceRepo.CreateGeofence(&fence); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建围栏失败"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, toGeofenceDTO(&fence))
+}
+
+func (c *GeofenceController) UpdateGeofence(ctx *gin.Context) {
+	id, ok := geofenceID(ctx)
+	if !ok {
+		return
+	}
+	var req dto.UpdateGeofenceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fence, err := c.fenceRepo.GetGeofenceByID(id)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "围栏不存在"})
+		return
+	}
+	if req.Name != nil {
+		fence.Name = *req.Name
+	}
+	if req.Longitude != nil {
+		fence.Longitude = *req.Longitude
+	}
+	if req.Latitude != nil {
+		fence.Latitude = *req.Latitude
+	}
+	if req.RadiusKm != nil {
+		fence.RadiusKm = *req.RadiusKm
+	}
+	if req.Polygon != nil {
+		fence.Polygon = encodePolygon(*req.Polygon)
+	}
+	if req.Enabled != nil {
+		fence.Enabled = *req.Enabled
+	}
+	if err := services.ValidateGeofence(*fence); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.fenceRepo.UpdateGeofence(fence); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新围栏失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, toGeofenceDTO(fence))
+}
+
+func (c *GeofenceController) DeleteGeofence(ctx *gin.Context) {
+	id, ok := geofenceID(ctx)
+	if !ok {
+		return
+	}
+	err := c.fenceRepo.DeleteGeofence(id)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, gin.H{"message": "围栏已删除"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "围栏不存在"})
+	default:
+		logger.Errorf("删除围栏失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "删除围栏失败"})
+	}
+}
@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"coldchain/common/logger"
 	"coldchain/common/mysql/models"
 	"coldchain/server/dao"
 	"coldchain/server/dto"
+	"coldchain/server/services"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -12,11 +18,33 @@ import (
 
 type ModuleController struct {
 	moduleRepo *dao.ModuleRepository
+	depotRepo  *dao.DepotRepository
+
+	// 冷链箱全部归还后推进订单状态
+	fsm *services.OrderStateMachine
 }
 
-func NewModuleController(db *gorm.DB) *ModuleController {
+func NewModuleController(db *gorm.DB, fsm *services.OrderStateMachine) *ModuleController {
 	return &ModuleController{
 		moduleRepo: dao.NewModuleRepository(db),
+		depotRepo:  dao.NewDepotRepository(db),
+		fsm:        fsm,
+	}
+}
+
+// moduleError 将归还和检查流程的错误写入响应
+func moduleError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrModuleNotAssigned),
+		errors.Is(err, services.ErrModuleNotReturned),
+		errors.Is(err, services.ErrChecklistIncomplete),
+		errors.Is(err, services.ErrDepotFull):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "冷链箱、仓库或分配记录不存在"})
+	default:
+		logger.Errorf("冷链箱归还流程失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新冷链箱状态失败"})
 	}
 }
 
@@ -28,10 +56,40 @@ func (c *ModuleController) AddModule(ctx *gin.Context) {
 	}
 
 	module := models.Module{
-		DeviceID:    req.DeviceID,
-		Status:      models.StatusUnassigned,
-		IsEnabled:   false,
-		OrderItemID: nil,
+		DeviceID:                req.DeviceID,
+		Status:                  models.StatusUnassigned,
+		IsEnabled:               false,
+		OrderItemID:             nil,
+		SupportedMinTemperature: -25,
+		SupportedMaxTemperature: 25,
+		BatteryLevel:            100,
+		Longitude:               req.Longitude,
+		Latitude:                req.Latitude,
+		DepotID:                 req.DepotID,
+		InnerVolume:             services.MODULE_INNER_VOLUME,
+		MaxPayload:              services.MODULE_MAX_PAYLOAD,
+	}
+	if req.InnerVolume != nil {
+		module.InnerVolume = *req.InnerVolume
+	}
+	if req.MaxPayload != nil {
+		module.MaxPayload = *req.MaxPayload
+	}
+	if req.SupportedMinTemperature != nil {
+		module.SupportedMinTemperature = *req.SupportedMinTemperature
+	}
+	if req.SupportedMaxTemperature != nil {
+		module.SupportedMaxTemperature = *req.SupportedMaxTemperature
+	}
+	if module.SupportedMinTemperature > module.SupportedMaxTemperature {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "温区下限不能高于上限"})
+		return
+	}
+	if req.DepotID != nil {
+		if _, err := c.depotRepo.GetDepotByID(*req.DepotID); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "仓库不存在"})
+			return
+		}
 	}
 
 	if err := c.moduleRepo.CreateModule(&module); err != nil {
@@ -59,6 +117,121 @@ func (c *ModuleController) ListModules(ctx *gin.Context) {
 			MinTemperature:     module.MinTemperature,
 			Status:             dto.ModuleStatus(module.Status),
 			IsEnabled:          module.IsEnabled,
+
+			SupportedMinTemperature: module.SupportedMinTemperature,
+			SupportedMaxTemperature: module.SupportedMaxTemperature,
+			BatteryLevel:            module.BatteryLevel,
+			Longitude:               module.Longitude,
+			Latitude:                module.Latitude,
+			DepotID:                 module.DepotID,
+			InnerVolume:             module.InnerVolume,
+			MaxPayload:              module.MaxPayload,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, responses)
+}
+
+// ReturnModules 冷链箱归还到仓库，已送达订单的冷链箱全部归还后订单进入已归还状态；
+// 订单尚未送达时在送达后进入已归还
+func (c *ModuleController) ReturnModules(ctx *gin.Context) {
+	var req dto.ReturnModulesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var completed []uint
+	err := c.moduleRepo.Transaction(func(tx *gorm.DB) error {
+		orderIDs, err := services.ReturnModules(tx, req.ModuleIDs, req.DepotID, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, orderID := range orderIDs {
+			// 订单尚未送达时只记录冷链箱归还，送达时由状态机推进到已归还
+			done, err := c.fsm.CompleteModuleReturn(tx, orderID, actor(ctx), "冷链箱已全部归还")
+			if err != nil {
+				return err
+			}
+			if done {
+				completed = append(completed, orderID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		moduleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "冷链箱已归还，等待清洁检查", "returned_orders": completed})
+}
+
+// InspectModule 记录清洁检查结果，检查通过的冷链箱重新进入可分配状态
+func (c *ModuleController) InspectModule(ctx *gin.Context) {
+	moduleID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的模块ID"})
+		return
+	}
+
+	var req dto.InspectModuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	userID, _, _ := CurrentUser(ctx)
+
+	var module *models.Module
+	err = c.moduleRepo.Transaction(func(tx *gorm.DB) error {
+		module, err = services.InspectModule(tx, uint(moduleID), services.InspectionResult{
+			Checklist:   req.Checklist,
+			DamageNote:  req.DamageNote,
+			InspectorID: userID,
+		}, time.Now())
+		return err
+	})
+	if err != nil {
+		moduleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "清洁检查已记录", "status": module.Status})
+}
+
+// GetModuleHistory 冷链箱服务过的订单
+func (c *ModuleController) GetModuleHistory(ctx *gin.Context) {
+	moduleID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的模块ID"})
+		return
+	}
+
+	assignments, err := c.moduleRepo.ListModuleAssignments(uint(moduleID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取分配记录失败"})
+		return
+	}
+
+	responses := make([]dto.ModuleAssignmentDTO, 0, len(assignments))
+	for _, a := range assignments {
+		var checklist map[string]bool
+		if len(a.Checklist) > 0 {
+			_ = json.Unmarshal(a.Checklist, &checklist)
+		}
+		responses = append(responses, dto.ModuleAssignmentDTO{
+			ID:           a.ID,
+			OrderID:      a.OrderID,
+			OrderItemID:  a.OrderItemID,
+			AssignedAt:   a.AssignedAt,
+			DispatchedAt: a.DispatchedAt,
+			ReturnedAt:   a.ReturnedAt,
+			ReturnDepot:  a.ReturnDepot,
+			ReleasedAt:   a.ReleasedAt,
+			Checklist:    checklist,
+			Damaged:      a.Damaged,
+			DamageNote:   a.DamageNote,
+			InspectorID:  a.InspectorID,
 		})
 	}
 
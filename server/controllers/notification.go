@@ -59,7 +59,7 @@ func (c *NotificationController) CreateNotification(ctx *gin.Context) {
 }
 
 func (c *NotificationController) GetNotificationByUserID(ctx *gin.Context) {
-	s := ctx.Param("user_id")
+	s := ctx.Param("id")
 	userID, err := strconv.Atoi(s)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
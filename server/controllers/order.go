@@ -1,17 +1,25 @@
 package controllers
 
 import (
+	"bytes"
 	"coldchain/common/logger"
 	"coldchain/common/mysql/models"
+	cache "coldchain/common/redis"
 	"coldchain/server/dao"
 	"coldchain/server/dto"
+	"coldchain/server/services"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strconv"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -20,9 +28,30 @@ type OrderController struct {
 	orderRepo  *dao.OrderRepository
 	userRepo   *dao.UserRepository
 	moduleRepo *dao.ModuleRepository
+	depotRepo  *dao.DepotRepository
+
+	// 计价时按路径规划的距离数据来源估算配送里程
+	planner *services.RoutePlanner
+	// 按路线和车辆定位推算预计送达时间
+	eta *services.ETATracker
+
+	// 订单状态机
+	fsm *services.OrderStateMachine
+
+	// 用于通知分析器设备阈值变更，可以为空
+	cache *redis.Client
+}
+
+// NewOrderStateMachine 创建订单状态机并注册各事件的副作用，由路由创建一次后传给各控制器
+func NewOrderStateMachine() *services.OrderStateMachine {
+	return services.NewOrderStateMachine().
+		OnEvent(services.EventReject, notifyRejected).
+		OnEvent(services.EventDispatch, markModulesDispatched).
+		OnEvent(services.EventCancel, releaseModulesOnCancel).
+		OnEvent(services.EventReturnModules, returnModulesOnEvent)
 }
 
-func NewOrderController(db *gorm.DB) *OrderController {
+func NewOrderController(db *gorm.DB, fsm *services.OrderStateMachine, cache *redis.Client, ch driver.Conn) *OrderController {
 	if db == nil {
 		panic("NewOrderController received nil DB instance")
 	}
@@ -30,6 +59,62 @@ func NewOrderController(db *gorm.DB) *OrderController {
 		orderRepo:  dao.NewOrderRepository(db),
 		userRepo:   dao.NewUserRepository(db),
 		moduleRepo: dao.NewModuleRepository(db),
+		depotRepo:  dao.NewDepotRepository(db),
+		planner:    newRoutePlanner(cache),
+		eta:        services.NewETATracker(db, ch),
+		fsm:        fsm,
+		cache:      cache,
+	}
+}
+
+// notifyRejected 订单被驳回时通知客户
+func notifyRejected(tc *services.TransitionContext) error {
+	content := "您的订单 " + tc.Order.OrderNumber + " 已被驳回"
+	if tc.Remark != "" {
+		content += "，原因：" + tc.Remark
+	}
+	return dao.NewNotificationRepository(tc.Tx).CreateNotification(&models.Notification{
+		Type:    "reject",
+		Title:   "订单已驳回",
+		Content: content,
+	}, []uint{tc.Order.UserID})
+}
+
+// releaseModulesOnCancel 已审核的订单取消时释放已分配的冷链箱
+func releaseModulesOnCancel(tc *services.TransitionContext) error {
+	if tc.From != models.OrderApproved {
+		return nil
+	}
+	return dao.NewModuleRepository(tc.Tx).ReleaseOrderModules(tc.Order.ID)
+}
+
+// markModulesDispatched 订单装车发车时记录冷链箱开始为订单工作的时间，监控数据从此时起归属到订单
+func markModulesDispatched(tc *services.TransitionContext) error {
+	return dao.NewModuleRepository(tc.Tx).MarkOrderDispatched(tc.Order.ID, time.Now())
+}
+
+// returnModulesOnEvent 手动标记订单已归还时，仍占用的冷链箱一并标记为已归还，等待清洁检查
+func returnModulesOnEvent(tc *services.TransitionContext) error {
+	return services.ReturnOrderModules(tc.Tx, tc.Order.ID, nil, time.Now())
+}
+
+// actor 当前操作人
+func actor(ctx *gin.Context) services.Actor {
+	userID, roleName, _ := CurrentUser(ctx)
+	return services.Actor{UserID: userID, RoleName: roleName}
+}
+
+// transitionError 将状态流转错误写入响应
+func transitionError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTransition):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
 	}
 }
 
@@ -69,12 +154,23 @@ func (c *OrderController) GetOrderDetail(ctx *gin.Context) {
 		SenderInfo:   order.SenderInfo,
 		ReceiverInfo: order.ReceiverInfo,
 		OrderNote:    order.OrderNote,
+		RentalDays:   order.RentalDays,
+		Deposit:      order.Deposit,
 		User: dto.UserDTO{
 			Username: order.User.Username,
 			RoleName: order.User.Role.RoleName,
 		},
 		OrderItems: []dto.OrderItemDTO{},
 	}
+	// 下单时保存的分项报价，旧订单没有
+	if len(order.Quote) > 0 {
+		var quote dto.QuoteDTO
+		if err := json.Unmarshal(order.Quote, &quote); err != nil {
+			logger.Errorf("订单 %s 的报价无法解析: %v", order.OrderNumber, err)
+		} else {
+			response.Quote = &quote
+		}
+	}
 
 	orderItems, err := c.orderRepo.GetOrderItemsByOrderID(order.ID)
 	if err != nil {
@@ -129,6 +225,26 @@ func (c *OrderController) GetOrderDetail(ctx *gin.Context) {
 		})
 	}
 
+	eta, err := c.eta.OrderETA(order.ID, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取预计送达时间失败"})
+		return
+	}
+	if eta != nil {
+		response.ETA = &dto.OrderETADTO{
+			RoutePlanID: eta.RoutePlanID,
+			PlateNumber: eta.PlateNumber,
+			ETA:         eta.ETA,
+			Deadline:    eta.Deadline,
+			Delivered:   eta.Delivered,
+			LateRisk:    eta.LateRisk,
+			LateMinutes: eta.LateMinutes,
+			StopsAhead:  eta.StopsAhead,
+			Source:      eta.Source,
+			ComputedAt:  eta.ComputedAt,
+		}
+	}
+
 	ctx.JSON(http.StatusOK, response)
 }
 
@@ -304,6 +420,12 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		return
 	}
 
+	// 客户只能为自己创建订单
+	if userID, _, _ := CurrentUser(ctx); !isStaff(ctx) && req.UserID != userID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+		return
+	}
+
 	// 验证用户是否存在
 	_, err := c.userRepo.GetUserByID(req.UserID)
 	if err != nil {
@@ -311,24 +433,25 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		return
 	}
 
-	sender_info, err := json.Marshal(req.SenderInfo)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "发件人信息格式错误"})
+	sender_info, receiver_info, delivery_date, ok := parseOrderRequest(ctx, req)
+	if !ok {
 		return
 	}
-	receiver_info, err := json.Marshal(req.ReceiverInfo)
+
+	// 按商品、冷链箱、里程和租期计价，单件超出冷链箱规格的商品无法配送
+	q, err := c.quoteOrder(ctx.Request.Context(), req, sender_info, receiver_info, delivery_date, time.Now())
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "收件人信息格式错误"})
+		quoteError(ctx, err)
 		return
 	}
-
-	delivery_date, err := time.Parse("2006-01-02 15:04", req.DeliveryDate)
+	quote, orderItems := q.quote, q.items
+	quoteJSON, err := json.Marshal(quote)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "交付日期格式错误"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存报价失败"})
 		return
 	}
 
-	StatusID, err := c.orderRepo.GetOrderStatusIDByName("待支付")
+	StatusID, err := c.orderRepo.GetOrderStatusIDByName(models.OrderPendingPayment)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
 		return
@@ -337,31 +460,24 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 	order := models.RentalOrder{
 		OrderNumber:  c.genOrderNumber(),
 		StatusID:     StatusID,
+		TotalPrice:   quote.Total,
 		SenderInfo:   sender_info,
 		ReceiverInfo: receiver_info,
 		DeliveryDate: delivery_date,
 		OrderNote:    req.OrderNote,
 		UserID:       req.UserID,
+		RentalDays:   quote.RentalDays,
+		Deposit:      quote.Deposit,
+		Quote:        quoteJSON,
 	}
 
 	err = c.orderRepo.Transaction(func(tx *gorm.DB) error {
 		orderTxn := dao.NewOrderRepository(tx)
 
-		orderItems := make([]models.OrderItem, 0)
-		var totalPrice float64
-
-		for _, item := range req.OrderItems {
-			Category, err := orderTxn.GetCategoryByName(item.Product.CategoryName)
-			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取产品分类失败"})
-				return err
-			}
-
-			totalPrice += float64(item.Quantity) * Category.Price
-
+		for i, item := range req.OrderItems {
 			product := &models.Product{
 				ProductName:    item.Product.ProductName,
-				CategoryID:     Category.ID,
+				CategoryID:     orderItems[i].Product.Category.ID,
 				MaxTemperature: item.Product.MaxTemperature,
 				MinTemperature: item.Product.MinTemperature,
 				SpecWeight:     item.Product.SpecWeight,
@@ -378,14 +494,13 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 				}
 			}
 
-			orderItem := models.OrderItem{
+			// UnitPrice 为分类单价，行金额见报价中的商品服务费
+			orderItems[i] = models.OrderItem{
 				Quantity:  item.Quantity,
 				ProductID: product.ID,
-				UnitPrice: Category.Price * float64(item.Quantity),
+				UnitPrice: orderItems[i].Product.Category.Price,
 			}
-			orderItems = append(orderItems, orderItem)
 		}
-		order.TotalPrice = totalPrice
 
 		if err := orderTxn.CreateOrder(&order); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
@@ -400,13 +515,83 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单明细失败"})
 			return err
 		}
+
+		if err := c.fsm.RecordCreated(tx, &order, actor(ctx)); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "记录订单状态失败"})
+			return err
+		}
 		return nil
 	})
 	if err != nil {
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"message": "订单创建成功", "order_id": order.ID})
+	ctx.JSON(http.StatusCreated, gin.H{"message": "订单创建成功", "order_id": order.ID, "quote": toQuoteDTO(quote)})
+}
+
+// QuoteOrder 按下单请求计算报价，并评估送达日冷链箱是否充足、能否按时送达，不保存订单
+func (c *OrderController) QuoteOrder(ctx *gin.Context) {
+	var req dto.CreateOrderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		logger.Errorf("请求参数错误: %v", err)
+		return
+	}
+
+	if userID, _, _ := CurrentUser(ctx); !isStaff(ctx) && req.UserID != userID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+		return
+	}
+
+	sender, receiver, deliveryDate, ok := parseOrderRequest(ctx, req)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	q, err := c.quoteOrder(ctx.Request.Context(), req, sender, receiver, deliveryDate, now)
+	if err != nil {
+		quoteError(ctx, err)
+		return
+	}
+	availability, err := services.ModuleAvailabilityOn(c.moduleRepo, q.load, q.items, deliveryDate, now)
+	if err != nil {
+		logger.Errorf("查询冷链箱可用情况失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查询冷链箱可用情况失败"})
+		return
+	}
+	delivery := services.EstimateDelivery(q.route, deliveryDate, now)
+
+	resp := dto.QuoteResponse{
+		Quote:        toQuoteDTO(q.quote),
+		ModuleCount:  q.quote.ModuleCount,
+		Availability: make([]dto.ModuleAvailabilityDTO, 0, len(availability)),
+		Delivery: dto.DeliveryFeasibilityDTO{
+			Feasible:        delivery.Feasible,
+			DistanceKnown:   delivery.DistanceKnown,
+			EarliestArrival: delivery.EarliestArrival,
+			WindowOpen:      delivery.WindowOpen,
+			WindowClose:     delivery.WindowClose,
+			Reason:          delivery.Reason,
+		},
+		Feasible: delivery.Feasible,
+	}
+	for _, a := range availability {
+		resp.Availability = append(resp.Availability, dto.ModuleAvailabilityDTO{
+			ProductName:    a.ProductName,
+			MinTemperature: a.MinTemperature,
+			MaxTemperature: a.MaxTemperature,
+			MinVolume:      a.MinVolume,
+			MinPayload:     a.MinPayload,
+			MinBattery:     a.MinBattery,
+			Needed:         a.Needed,
+			Available:      a.Available,
+			Returning:      a.Returning,
+			Sufficient:     a.Sufficient,
+		})
+		resp.Feasible = resp.Feasible && a.Sufficient
+	}
+	ctx.JSON(http.StatusOK, resp)
 }
 
 func (c *OrderController) GetOrderStatus(ctx *gin.Context) {
@@ -443,11 +628,17 @@ func (c *OrderController) UpdateOrder(ctx *gin.Context) {
 		return
 	}
 
-	if req.TotalPrice != nil {
-		order.TotalPrice = *req.TotalPrice
+	// 客户不能修改订单号和价格
+	if !isStaff(ctx) && ((req.TotalPrice != nil && *req.TotalPrice != order.TotalPrice) ||
+		(req.OrderNumber != nil && *req.OrderNumber != order.OrderNumber)) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "无权修改订单号或价格"})
+		return
 	}
+
+	quotedTotal := order.TotalPrice
+	deliveryDate, sender, receiver := order.DeliveryDate, order.SenderInfo, order.ReceiverInfo
 	if req.DeliveryDate != nil {
-		order.DeliveryDate, err = time.Parse("2006-01-02 15:04", *req.DeliveryDate)
+		deliveryDate, err = time.ParseInLocation("2006-01-02 15:04", *req.DeliveryDate, time.Local)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "交付日期格式错误"})
 			return
@@ -456,59 +647,89 @@ func (c *OrderController) UpdateOrder(ctx *gin.Context) {
 	if req.OrderNumber != nil {
 		order.OrderNumber = *req.OrderNumber
 	}
-	if req.StatusID != nil {
-		order.StatusID = *req.StatusID
+	if req.StatusID != nil && *req.StatusID != order.StatusID {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请通过状态流转接口修改订单状态"})
+		return
 	}
 	if req.SenderInfo != nil {
-		senderInfoJSON, err := json.Marshal(*req.SenderInfo)
-		if err != nil {
+		if sender, err = contactInfo(*req.SenderInfo); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "发件人信息格式错误"})
 			return
 		}
-		order.SenderInfo = datatypes.JSON(senderInfoJSON)
 	}
 	if req.ReceiverInfo != nil {
-		receiverInfoJSON, err := json.Marshal(*req.ReceiverInfo)
-		if err != nil {
+		if receiver, err = contactInfo(*req.ReceiverInfo); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "收件人信息格式错误"})
 			return
 		}
-		order.ReceiverInfo = datatypes.JSON(receiverInfoJSON)
 	}
 	if req.OrderNote != nil {
 		order.OrderNote = *req.OrderNote
 	}
 
+	// 送达时间和收寄件地址影响配送费和加急费：待支付时重新计价，支付后不能修改
+	if !deliveryDate.Equal(order.DeliveryDate) || !sameJSON(sender, order.SenderInfo) || !sameJSON(receiver, order.ReceiverInfo) {
+		if order.OrderStatus.StatusName != models.OrderPendingPayment {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "订单已不是待支付状态，不能修改送达时间和收寄件信息"})
+			return
+		}
+		q, err := c.priceItems(ctx.Request.Context(), order.OrderItems, order.RentalDays, sender, receiver, deliveryDate, time.Now())
+		if err != nil {
+			quoteError(ctx, err)
+			return
+		}
+		quoteJSON, err := json.Marshal(q.quote)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存报价失败"})
+			return
+		}
+		order.DeliveryDate, order.SenderInfo, order.ReceiverInfo = deliveryDate, sender, receiver
+		order.Quote, order.Deposit = quoteJSON, q.quote.Deposit
+		order.TotalPrice = q.quote.Total
+	}
+	// 工作人员可以手动调整价格，客户修改价格已在前面拒绝
+	if req.TotalPrice != nil && *req.TotalPrice != quotedTotal {
+		order.TotalPrice = *req.TotalPrice
+	}
+
 	if err := c.orderRepo.UpdateOrder(order); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "订单更新成功"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "订单更新成功", "total_price": order.TotalPrice})
 }
 
-// AllocateColdChainModules 处理冷链模块分配
-func (c *OrderController) AllocateColdChainModules(ctx *gin.Context, tx *gorm.DB, orderItems []models.OrderItem) bool {
-	moduleTxn := dao.NewModuleRepository(tx)
-
-	for _, orderItem := range orderItems {
-		availableModules, err := moduleTxn.FindAvailableModules(orderItem.Quantity)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查找可用冷链箱失败"})
-			return false
-		}
+// contactInfo 修改订单时提交的收寄件信息：JSON 对象按原样保存，与下单时一致，其他文本保存为 JSON 字符串
+func contactInfo(info string) (datatypes.JSON, error) {
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(info), &fields) == nil {
+		return json.Marshal(fields)
+	}
+	return json.Marshal(info)
+}
 
-		if len(availableModules) < orderItem.Quantity {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "可用冷链箱数量不足"})
-			return false
-		}
+// sameJSON 两段 JSON 的内容是否相同，忽略格式和字段顺序
+func sameJSON(a, b datatypes.JSON) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(x, y)
+}
 
-		if err := moduleTxn.AssignModulesToOrderItem(orderItem, availableModules); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "冷链箱分配失败"})
-			return false
-		}
+// notifyThresholdChanges 通知分析器模块温度阈值已变更
+func (c *OrderController) notifyThresholdChanges(modules []models.Module) {
+	changes := make([]cache.ThresholdChange, 0, len(modules))
+	for _, module := range modules {
+		changes = append(changes, cache.ThresholdChange{
+			DeviceID: module.DeviceID,
+			Version:  module.UpdatedAt.UnixNano(),
+		})
+	}
+	if err := cache.PublishThresholdChanges(context.Background(), c.cache, changes...); err != nil {
+		logger.Errorf("发布设备阈值变更通知失败: %v", err)
 	}
-	return true
 }
 
 func (c *OrderController) AcceptOrder(ctx *gin.Context) {
@@ -517,110 +738,362 @@ func (c *OrderController) AcceptOrder(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
 		return
 	}
-	err = c.orderRepo.Transaction(func(tx *gorm.DB) error {
-		orderTxn := dao.NewOrderRepository(tx)
-		order, err := orderTxn.GetOrderByID(uint(orderID))
-		if err != nil {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
-			return err
-		}
 
-		StatusName, err := orderTxn.GetOrderStatusName(order.StatusID)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
-			return err
-		}
+	// 审核和分配在同一事务中完成，冷链箱被其他订单抢占时整体回滚后重试
+	var allocated []services.ModuleMatch
+	err = services.RetryAllocation(func() error {
+		return c.orderRepo.Transaction(func(tx *gorm.DB) error {
+			tc, err := c.fsm.Fire(tx, uint(orderID), services.EventApprove, actor(ctx), "")
+			if err != nil {
+				return err
+			}
 
-		if StatusName != "已支付" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "订单状态不允许接收"})
-			return err
-		}
+			order, err := dao.NewOrderRepository(tx).GetOrderByID(tc.Order.ID)
+			if err != nil {
+				return err
+			}
 
-		StatusID, err := orderTxn.GetOrderStatusIDByName("已审核")
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
+			allocated, err = services.AllocateModules(tx, order, time.Now())
 			return err
-		}
+		})
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrInsufficientModules), errors.Is(err, services.ErrItemTooLarge):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrAllocationConflict):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrInvalidTransition),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		transitionError(ctx, err)
+		return
+	default:
+		logger.Errorf("订单 %d 冷链箱分配失败: %v", orderID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "冷链箱分配失败"})
+		return
+	}
+	assigned := make([]models.Module, 0, len(allocated))
+	allocation := make([]dto.ModuleAllocationDTO, 0, len(allocated))
+	for _, match := range allocated {
+		assigned = append(assigned, match.Module)
+		allocation = append(allocation, dto.ModuleAllocationDTO{
+			ModuleID:    match.Module.ID,
+			DeviceID:    match.Module.DeviceID,
+			OrderItemID: *match.Module.OrderItemID,
+			DistanceKm:  match.DistanceKm,
+			Reason:      match.Reason,
+		})
+	}
+	c.notifyThresholdChanges(assigned)
 
-		if err := orderTxn.UpdateStatus(order.ID, StatusID); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
-			return err
-		}
+	ctx.JSON(http.StatusOK, gin.H{"message": "订单已接收", "allocation": allocation})
+}
 
-		if !c.AllocateColdChainModules(ctx, tx, order.OrderItems) {
-			return fmt.Errorf("冷链模块分配失败")
-		}
-		return nil
+func (c *OrderController) RejectOrder(ctx *gin.Context) {
+	orderID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	// 驳回原因可以为空
+	var req dto.OrderTransitionRequest
+	_ = ctx.ShouldBindJSON(&req)
+
+	err = c.orderRepo.Transaction(func(tx *gorm.DB) error {
+		_, err := c.fsm.Fire(tx, uint(orderID), services.EventReject, actor(ctx), req.Remark)
+		return err
 	})
 	if err != nil {
+		transitionError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "订单已接收"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "订单已驳回"})
 }
 
-func (c *OrderController) RejectOrder(ctx *gin.Context) {
+func (c *OrderController) PayOrder(ctx *gin.Context) {
 	orderID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
 		return
 	}
+
 	err = c.orderRepo.Transaction(func(tx *gorm.DB) error {
-		orderTxn := dao.NewOrderRepository(tx)
-		order, err := orderTxn.GetOrderByID(uint(orderID))
-		if err != nil {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
-			return err
-		}
+		_, err := c.fsm.Fire(tx, uint(orderID), services.EventPay, actor(ctx), "")
+		return err
+	})
+	if err != nil {
+		transitionError(ctx, err)
+		return
+	}
 
-		StatusName, err := orderTxn.GetOrderStatusName(order.StatusID)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
-			return err
-		}
+	ctx.JSON(http.StatusOK, gin.H{"message": "订单已支付"})
+}
 
-		if StatusName != "已支付" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "订单状态不允许拒绝"})
-			return err
-		}
+// TransitionOrder 触发订单状态流转，如发车、送达、归还、完成和取消
+func (c *OrderController) TransitionOrder(ctx *gin.Context) {
+	orderID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
 
-		StatusID, err := orderTxn.GetOrderStatusIDByName("已驳回")
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
-			return err
-		}
+	var req dto.OrderTransitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
 
-		if err := orderTxn.UpdateStatus(order.ID, StatusID); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
-			return err
-		}
-		return nil
+	event := services.OrderEvent(req.Event)
+	// 支付、审核和驳回有单独的接口，发车需通过车辆调度完成
+	if event == services.EventPay || event == services.EventApprove || event == services.EventReject ||
+		event == services.EventDispatch || event == services.EventDepart {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请使用对应的订单接口"})
+		return
+	}
+
+	var tc *services.TransitionContext
+	err = c.orderRepo.Transaction(func(tx *gorm.DB) error {
+		tc, err = c.fsm.Fire(tx, uint(orderID), event, actor(ctx), req.Remark)
+		return err
 	})
 	if err != nil {
+		transitionError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "订单已驳回"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "订单状态已更新", "from": tc.From, "to": tc.To})
 }
 
-func (c *OrderController) PayOrder(ctx *gin.Context) {
+// GetOrderHistory 获取订单的状态流转记录
+func (c *OrderController) GetOrderHistory(ctx *gin.Context) {
 	orderID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
 		return
 	}
 
-	payedStatusID, err := c.orderRepo.GetOrderStatusIDByName("已支付")
+	transitions, err := c.orderRepo.ListStatusTransitions(uint(orderID))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态失败"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单状态记录失败"})
+		return
+	}
+
+	response := make([]dto.OrderStatusTransitionDTO, 0, len(transitions))
+	for _, t := range transitions {
+		response = append(response, dto.OrderStatusTransitionDTO{
+			Event:      t.Event,
+			FromStatus: t.FromStatus,
+			ToStatus:   t.ToStatus,
+			ActorID:    t.ActorID,
+			ActorRole:  t.ActorRole,
+			Remark:     t.Remark,
+			CreatedAt:  t.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// requestOrderItems 把下单请求中的订单项转换为装箱规划的输入
+func requestOrderItems(items []dto.OrderItem) []models.OrderItem {
+	result := make([]models.OrderItem, len(items))
+	for i, item := range items {
+		result[i] = models.OrderItem{
+			Quantity: item.Quantity,
+			Product: models.Product{
+				ProductName:    item.Product.ProductName,
+				MaxTemperature: item.Product.MaxTemperature,
+				MinTemperature: item.Product.MinTemperature,
+				SpecWeight:     item.Product.SpecWeight,
+				SpecVolume:     item.Product.SpecVolume,
+			},
+		}
+	}
+	return result
+}
+
+func toLoadPlanDTO(plan *services.LoadPlan) dto.LoadPlanDTO {
+	response := dto.LoadPlanDTO{
+		InnerVolume: plan.Spec.InnerVolume,
+		MaxPayload:  plan.Spec.MaxPayload,
+		ModuleCount: len(plan.Modules),
+		Weight:      plan.Weight,
+		Volume:      plan.Volume,
+		Modules:     make([]dto.PackedModuleDTO, 0, len(plan.Modules)),
+	}
+	for _, m := range plan.Modules {
+		module := dto.PackedModuleDTO{
+			MinTemperature: m.MinTemperature,
+			MaxTemperature: m.MaxTemperature,
+			Weight:         m.Weight,
+			Volume:         m.Volume,
+			VolumeRatio:    m.Volume / plan.Spec.InnerVolume,
+			PayloadRatio:   m.Weight / plan.Spec.MaxPayload,
+		}
+		for _, item := range m.Items {
+			module.Items = append(module.Items, dto.LoadItemDTO{
+				OrderItemID: item.OrderItemID,
+				Index:       item.Index,
+				ProductName: item.ProductName,
+				Quantity:    item.Quantity,
+				Weight:      item.Weight,
+				Volume:      item.Volume,
+			})
+		}
+		response.Modules = append(response.Modules, module)
+	}
+	return response
+}
+
+// PreviewLoadPlan 下单前按商品规格预览所需的冷链箱数和每箱的装载内容
+func (c *OrderController) PreviewLoadPlan(ctx *gin.Context) {
+	var req dto.LoadPlanRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
 		return
 	}
 
-	err = c.orderRepo.UpdateStatus(uint(orderID), payedStatusID)
+	plan, err := services.PlanLoad(requestOrderItems(req.OrderItems), services.StandardModuleSpec())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, toLoadPlanDTO(plan))
+}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "订单已支付"})
+// GetOrderLoadPlan 订单的装箱规划，审核分配冷链箱时按此规划
+func (c *OrderController) GetOrderLoadPlan(ctx *gin.Context) {
+	orderID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	order, err := c.orderRepo.GetOrderByID(uint(orderID))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	plan, err := services.PlanLoad(order.OrderItems, services.StandardModuleSpec())
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, toLoadPlanDTO(plan))
+}
+
+var errUnknownCategory = errors.New("产品分类不存在")
+
+// parseOrderRequest 解析下单请求中的收寄件信息和送达时间，格式错误时写入响应并返回 false
+func parseOrderRequest(ctx *gin.Context, req dto.CreateOrderRequest) (sender, receiver datatypes.JSON, deliveryDate time.Time, ok bool) {
+	sender, err := json.Marshal(req.SenderInfo)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "发件人信息格式错误"})
+		return nil, nil, time.Time{}, false
+	}
+	receiver, err = json.Marshal(req.ReceiverInfo)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "收件人信息格式错误"})
+		return nil, nil, time.Time{}, false
+	}
+	// 按服务器所在时区解析，与报价时的当前时间和路径规划从数据库读回的送达时间一致
+	deliveryDate, err = time.ParseInLocation("2006-01-02 15:04", req.DeliveryDate, time.Local)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "交付日期格式错误"})
+		return nil, nil, time.Time{}, false
+	}
+	return sender, receiver, deliveryDate, true
+}
+
+// orderQuote 下单请求的计价结果，route 为 nil 表示地址无法定位或里程估算失败
+type orderQuote struct {
+	quote *services.Quote
+	load  *services.LoadPlan
+	route *services.DeliveryRoute
+	items []models.OrderItem
+}
+
+// quoteOrder 按下单请求计算分项报价、装箱规划和配送路线，订单项带有商品分类。
+// 配送里程从距寄件地最近的仓库经寄件地到收件地，地址无法定位时只收起步价
+func (c *OrderController) quoteOrder(ctx context.Context, req dto.CreateOrderRequest, sender, receiver datatypes.JSON,
+	deliveryDate, now time.Time) (*orderQuote, error) {
+	items := requestOrderItems(req.OrderItems)
+	for i, item := range req.OrderItems {
+		category, err := c.orderRepo.GetCategoryByName(item.Product.CategoryName)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", errUnknownCategory, item.Product.CategoryName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items[i].Product.CategoryID = category.ID
+		items[i].Product.Category = category
+	}
+
+	return c.priceItems(ctx, items, req.RentalDays, sender, receiver, deliveryDate, now)
+}
+
+// priceItems 按订单项、租期、收寄件地址和送达时间计价，订单项需带有商品分类
+func (c *OrderController) priceItems(ctx context.Context, items []models.OrderItem, rentalDays int, sender, receiver datatypes.JSON,
+	deliveryDate, now time.Time) (*orderQuote, error) {
+	quoteReq := services.QuoteRequest{Items: items, RentalDays: rentalDays, DeliveryDate: deliveryDate}
+	depots, err := c.depotRepo.ListDepots()
+	if err != nil {
+		return nil, err
+	}
+	route, err := c.planner.DeliveryRoute(ctx, sender, receiver, depots)
+	switch {
+	case err == nil:
+		quoteReq.DistanceKm, quoteReq.DistanceKnown = route.DistanceKm, true
+	case errors.Is(err, services.ErrGeocodeNotFound):
+	default:
+		logger.Warnf("估算配送里程失败，只收起步价: %v", err)
+	}
+
+	quote, load, err := services.PriceOrder(quoteReq, now)
+	if err != nil {
+		return nil, err
+	}
+	return &orderQuote{quote: quote, load: load, route: route, items: items}, nil
+}
+
+// quoteError 将计价错误写入响应
+func quoteError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownCategory), errors.Is(err, services.ErrItemTooLarge):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.Errorf("订单计价失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "订单计价失败"})
+	}
+}
+
+func toQuoteDTO(quote *services.Quote) dto.QuoteDTO {
+	resp := dto.QuoteDTO{
+		Lines:         make([]dto.QuoteLineDTO, 0, len(quote.Lines)),
+		Subtotal:      quote.Subtotal,
+		Deposit:       quote.Deposit,
+		Total:         quote.Total,
+		ModuleCount:   quote.ModuleCount,
+		RentalDays:    quote.RentalDays,
+		DistanceKm:    quote.DistanceKm,
+		DistanceKnown: quote.DistanceKnown,
+		Urgent:        quote.Urgent,
+		QuotedAt:      quote.QuotedAt,
+	}
+	for _, line := range quote.Lines {
+		resp.Lines = append(resp.Lines, dto.QuoteLineDTO{
+			Kind:        line.Kind,
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.UnitPrice,
+			Amount:      line.Amount,
+			ItemIndex:   line.ItemIndex,
+		})
+	}
+	return resp
 }
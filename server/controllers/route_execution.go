@@ -0,0 +1,562 @@
+package controllers
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	cache "coldchain/common/redis"
+	"coldchain/server/dao"
+	"coldchain/server/dto"
+	"coldchain/server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// 单次查询返回的车辆定位条数上限
+const maxTrackPoints = 10000
+
+// RouteExecutionController 已保存路线的执行跟踪：出发、站点签到、按车辆轨迹匹配到达时间，
+// 计划与实际路线的对比、偏离告警，以及冷链箱故障时重新规划
+type RouteExecutionController struct {
+	db         *gorm.DB
+	routeRepo  *dao.RoutePlanRepository
+	trackRepo  *dao.VehicleTrackRepository
+	telemetry  *dao.TelemetryRepository
+	depotRepo  *dao.DepotRepository
+	moduleRepo *dao.ModuleRepository
+	alertRepo  *dao.RouteAlertRepository
+	fenceRepo  *dao.GeofenceRepository
+	planner    *services.RoutePlanner
+	monitor    *services.RouteMonitor
+
+	// 用于向司机端推送路线变更，可以为空
+	cache *redis.Client
+}
+
+func NewRouteExecutionController(db *gorm.DB, ch driver.Conn, cache *redis.Client) *RouteExecutionController {
+	if db == nil {
+		panic("NewRouteExecutionController received nil DB instance")
+	}
+	return &RouteExecutionController{
+		db:         db,
+		routeRepo:  dao.NewRoutePlanRepository(db),
+		trackRepo:  dao.NewVehicleTrackRepository(ch),
+		telemetry:  dao.NewTelemetryRepository(ch),
+		depotRepo:  dao.NewDepotRepository(db),
+		moduleRepo: dao.NewModuleRepository(db),
+		alertRepo:  dao.NewRouteAlertRepository(db),
+		fenceRepo:  dao.NewGeofenceRepository(db),
+		planner:    newRoutePlanner(cache),
+		monitor:    services.NewRouteMonitor(db, ch),
+		cache:      cache,
+	}
+}
+
+func toRoutePlanDTO(p *models.RoutePlan) dto.RoutePlanDTO {
+	resp := dto.RoutePlanDTO{
+		ID:           p.ID,
+		VehicleID:    p.VehicleID,
+		PlateNumber:  p.Vehicle.PlateNumber,
+		DepotID:      p.DepotID,
+		Status:       p.Status,
+		DistanceKm:   p.DistanceKm,
+		PlannedStart: p.PlannedStart,
+		PlannedEnd:   p.PlannedEnd,
+		StartedAt:    p.StartedAt,
+		CompletedAt:  p.CompletedAt,
+		ReplacesID:   p.ReplacesID,
+		RerouteNote:  p.RerouteNote,
+		Stops:        make([]dto.RouteStopDTO, 0, len(p.Stops)),
+		CreatedAt:    p.CreatedAt,
+	}
+	for i := range p.Stops {
+		s := &p.Stops[i]
+		stop := dto.RouteStopDTO{
+			ID:             s.ID,
+			Sequence:       s.Sequence,
+			NodeType:       s.NodeType,
+			OrderID:        s.OrderID,
+			Longitude:      s.Longitude,
+			Latitude:       s.Latitude,
+			LegDistanceKm:  s.LegDistanceKm,
+			PlannedArrival: s.PlannedArrival,
+			Deadline:       s.Deadline,
+			ActualArrival:  s.ActualArrival,
+			ArrivalSource:  s.ArrivalSource,
+		}
+		if deviation, ok := s.DeviationMinutes(); ok {
+			stop.DeviationMinutes = &deviation
+			stop.Late = s.Deadline != nil && s.ActualArrival.After(*s.Deadline)
+			resp.ArrivedStops++
+		}
+		resp.Stops = append(resp.Stops, stop)
+	}
+	return resp
+}
+
+// routePlanError 将路线执行错误写入响应
+func routePlanError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoutePlanState),
+		errors.Is(err, services.ErrRouteStop),
+		errors.Is(err, services.ErrUnknownStrategy),
+		errors.Is(err, services.ErrNoSwapDepot):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRouteChanged):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "路线计划不存在"})
+	default:
+		logger.Errorf("路线执行跟踪失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "路线执行跟踪失败"})
+	}
+}
+
+func routePlanID(ctx *gin.Context) (uint, bool) {
+	planID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || planID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的路线计划ID"})
+		return 0, false
+	}
+	return uint(planID), true
+}
+
+func (c *RouteExecutionController) ListRoutePlans(ctx *gin.Context) {
+	plans, err := c.routeRepo.ListRoutePlans(ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取路线计划失败"})
+		return
+	}
+
+	responses := make([]dto.RoutePlanDTO, 0, len(plans))
+	for i := range plans {
+		responses = append(responses, toRoutePlanDTO(&plans[i]))
+	}
+	ctx.JSON(http.StatusOK, responses)
+}
+
+func (c *RouteExecutionController) GetRoutePlan(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	plan, err := c.routeRepo.GetRoutePlanByID(planID)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toRoutePlanDTO(plan))
+}
+
+// StartRoutePlan 车辆按路线出发
+func (c *RouteExecutionController) StartRoutePlan(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+
+	var plan *models.RoutePlan
+	err := c.routeRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = services.StartRoutePlan(tx, planID, time.Now())
+		return err
+	})
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toRoutePlanDTO(plan))
+}
+
+// CheckInStop 司机在站点签到
+func (c *RouteExecutionController) CheckInStop(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	var req dto.CheckInStopRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	arrivedAt := time.Now()
+	if req.ArrivedAt != nil {
+		arrivedAt = *req.ArrivedAt
+	}
+
+	var plan *models.RoutePlan
+	err := c.routeRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = services.CheckInStop(tx, planID, req.StopID, arrivedAt)
+		return err
+	})
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toRoutePlanDTO(plan))
+}
+
+// track 查询路线出发后的车辆轨迹，未出发时返回空
+func (c *RouteExecutionController) track(plan *models.RoutePlan, now time.Time) ([]dao.TrackPoint, error) {
+	start, end, ok := services.RouteTrackWindow(plan, now)
+	if !ok {
+		return []dao.TrackPoint{}, nil
+	}
+	return c.trackRepo.ListTrack(services.VehicleTrackKeys(plan.Vehicle), start, end, maxTrackPoints)
+}
+
+// SyncRoutePlan 按 vehicle_location 中的车辆轨迹补全站点到达时间。
+// 从最近连续到达的站点起按时间分页查询轨迹，每页匹配后从该页最后一个定位继续
+func (c *RouteExecutionController) SyncRoutePlan(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	plan, err := c.routeRepo.GetRoutePlanByID(planID)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	if plan.Status != models.RoutePlanExecuting {
+		routePlanError(ctx, services.ErrRoutePlanState)
+		return
+	}
+
+	now := time.Now()
+	start, ok := services.RouteSyncStart(plan)
+	for ok {
+		points, err := c.trackRepo.ListTrack(services.VehicleTrackKeys(plan.Vehicle), start, now, maxTrackPoints)
+		if err != nil {
+			logger.Errorf("获取车辆轨迹失败: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆轨迹失败"})
+			return
+		}
+		err = c.routeRepo.Transaction(func(tx *gorm.DB) error {
+			var err error
+			plan, err = services.SyncRoutePlan(tx, planID, points, now)
+			return err
+		})
+		if err != nil {
+			routePlanError(ctx, err)
+			return
+		}
+		if len(points) < maxTrackPoints || plan.Status != models.RoutePlanExecuting {
+			break
+		}
+		next := points[len(points)-1].TimeStamp
+		ok = next.After(start)
+		start = next
+	}
+	ctx.JSON(http.StatusOK, toRoutePlanDTO(plan))
+}
+
+// GetRouteTrack 对比计划路线和车辆实际轨迹
+func (c *RouteExecutionController) GetRouteTrack(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	plan, err := c.routeRepo.GetRoutePlanByID(planID)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+
+	points, err := c.track(plan, time.Now())
+	if err != nil {
+		logger.Errorf("获取车辆轨迹失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆轨迹失败"})
+		return
+	}
+	alerts, err := c.alertRepo.ListAlerts(plan.ID, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取路线告警失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"plan": toRoutePlanDTO(plan), "track": points, "alerts": toRouteAlertDTOs(alerts)})
+}
+
+func toRouteAlertDTOs(alerts []models.RouteAlert) []dto.RouteAlertDTO {
+	responses := make([]dto.RouteAlertDTO, 0, len(alerts))
+	for _, a := range alerts {
+		responses = append(responses, dto.RouteAlertDTO{
+			ID:          a.ID,
+			RoutePlanID: a.RoutePlanID,
+			VehicleID:   a.VehicleID,
+			Kind:        a.Kind,
+			GeofenceID:  a.GeofenceID,
+			StartedAt:   a.StartedAt,
+			EndedAt:     a.EndedAt,
+			Longitude:   a.Longitude,
+			Latitude:    a.Latitude,
+			Detail:      a.Detail,
+			Status:      a.Status,
+		})
+	}
+	return responses
+}
+
+// CheckRoutePlan 立即按车辆轨迹检查路线是否偏离走廊、异常停车或进入禁行区域，返回新产生的告警
+func (c *RouteExecutionController) CheckRoutePlan(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	plan, err := c.routeRepo.GetRoutePlanByID(planID)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	if plan.StartedAt == nil {
+		routePlanError(ctx, services.ErrRoutePlanState)
+		return
+	}
+	fences, err := c.fenceRepo.ListGeofences(true)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取围栏列表失败"})
+		return
+	}
+
+	created, err := c.monitor.CheckPlan(plan, fences, time.Now())
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toRouteAlertDTOs(created))
+}
+
+// ListRouteAlerts 路线告警列表，可按 plan_id 和 status 筛选
+func (c *RouteExecutionController) ListRouteAlerts(ctx *gin.Context) {
+	planID, err := strconv.ParseUint(ctx.DefaultQuery("plan_id", "0"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的路线计划ID"})
+		return
+	}
+	alerts, err := c.alertRepo.ListAlerts(uint(planID), ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取路线告警失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, toRouteAlertDTOs(alerts))
+}
+
+// ReadRouteAlert 将路线告警标记为已读
+func (c *RouteExecutionController) ReadRouteAlert(ctx *gin.Context) {
+	alertID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
+		return
+	}
+	err = c.alertRepo.UpdateAlertStatus(uint(alertID), models.AlertRead)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, gin.H{"message": "告警已读"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "告警不存在"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新告警失败"})
+	}
+}
+
+// GetVehicleRoute 车辆当前待执行或执行中的路线，供司机端获取最新路线
+func (c *RouteExecutionController) GetVehicleRoute(ctx *gin.Context) {
+	vehicleID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || vehicleID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的车辆ID"})
+		return
+	}
+	plan, err := c.routeRepo.GetActiveRoutePlan(uint(vehicleID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "车辆没有待执行的路线"})
+		return
+	}
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, toRoutePlanDTO(plan))
+}
+
+// WatchVehicleRoute 司机端订阅车辆路线变更，以 SSE 推送：连接后先推送一次当前路线（事件 route），
+// 之后每次重新规划推送 cache.RouteUpdate（事件 update），司机端收到后重新获取路线
+func (c *RouteExecutionController) WatchVehicleRoute(ctx *gin.Context) {
+	vehicleID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || vehicleID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的车辆ID"})
+		return
+	}
+	if c.cache == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "路线推送不可用"})
+		return
+	}
+	reqCtx := ctx.Request.Context()
+	// 先订阅再读取当前路线，两者之间的变更不会丢失
+	sub, err := cache.SubscribeRouteUpdates(reqCtx, c.cache, uint(vehicleID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "订阅路线变更失败"})
+		return
+	}
+	defer sub.Close()
+	plan, err := c.routeRepo.GetActiveRoutePlan(uint(vehicleID))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		routePlanError(ctx, err)
+		return
+	}
+
+	if plan != nil {
+		ctx.SSEvent("route", toRoutePlanDTO(plan))
+	}
+	updates := sub.Channel()
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case msg, ok := <-updates:
+			if !ok {
+				return false
+			}
+			ctx.SSEvent("update", json.RawMessage(msg.Payload))
+			return true
+		case <-reqCtx.Done():
+			return false
+		}
+	})
+}
+
+// currentPosition 车辆当前位置：请求中的坐标，其次是出发后最近的车辆定位，最后是最近到达的站点
+func (c *RouteExecutionController) currentPosition(plan *models.RoutePlan, req dto.RerouteRequest) (services.Point, error) {
+	if req.Longitude != nil && req.Latitude != nil {
+		return services.Point{Longitude: *req.Longitude, Latitude: *req.Latitude}, nil
+	}
+	point, err := c.trackRepo.GetLatestPoint(services.VehicleTrackKeys(plan.Vehicle), *plan.StartedAt)
+	if err != nil {
+		return services.Point{}, err
+	}
+	if point != nil {
+		return services.Point{Longitude: float64(point.Longitude), Latitude: float64(point.Latitude)}, nil
+	}
+	var last models.RouteStop
+	for _, s := range plan.Stops {
+		if s.ActualArrival != nil {
+			last = s
+		}
+	}
+	return services.Point{Longitude: last.Longitude, Latitude: last.Latitude}, nil
+}
+
+// ReroutePlan 车辆在途中冷链箱故障时，按车辆当前位置和剩余站点重新规划路线，
+// 原路线由新路线接替，并推送给司机端、通知受影响的客户
+func (c *RouteExecutionController) ReroutePlan(ctx *gin.Context) {
+	planID, ok := routePlanID(ctx)
+	if !ok {
+		return
+	}
+	var req dto.RerouteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	plan, err := c.routeRepo.GetRoutePlanByID(planID)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	if plan.Status != models.RoutePlanExecuting {
+		routePlanError(ctx, services.ErrRoutePlanState)
+		return
+	}
+
+	now := time.Now()
+	position, err := c.currentPosition(plan, req)
+	if err != nil {
+		logger.Errorf("获取车辆位置失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆位置失败"})
+		return
+	}
+	var remaining []models.RouteStop
+	for _, s := range plan.Stops {
+		if s.ActualArrival == nil {
+			remaining = append(remaining, s)
+		}
+	}
+	orders, err := services.RouteStopOrders(c.db, remaining)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	orderIDs := make([]uint, 0, len(orders))
+	for id := range orders {
+		orderIDs = append(orderIDs, id)
+	}
+	failing, err := services.FailingOrders(c.db, c.telemetry, orderIDs, req.ModuleIDs, *plan.StartedAt, now)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+
+	opts := services.RerouteOptions{
+		Strategy: req.Strategy,
+		Position: position,
+		Orders:   orders,
+		Failing:  failing,
+	}
+	if req.Strategy == services.RerouteSwap {
+		if len(failing) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "路线上没有发现故障的冷链箱"})
+			return
+		}
+		depots, err := c.depotRepo.ListDepots()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取仓库列表失败"})
+			return
+		}
+		unassigned, err := c.moduleRepo.ListUnassignedModules()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取冷链箱列表失败"})
+			return
+		}
+		if opts.Depot, err = services.SwapDepot(depots, unassigned, position); err != nil {
+			routePlanError(ctx, err)
+			return
+		}
+	}
+
+	reroute, err := c.planner.Reroute(ctx.Request.Context(), plan, opts, now)
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+	var replanned *models.RoutePlan
+	err = c.routeRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		replanned, err = services.SaveReroute(tx, reroute, actor(ctx), now)
+		return err
+	})
+	if err != nil {
+		routePlanError(ctx, err)
+		return
+	}
+
+	update := cache.RouteUpdate{
+		VehicleID:   replanned.VehicleID,
+		RoutePlanID: replanned.ID,
+		ReplacesID:  plan.ID,
+		Reason:      replanned.RerouteNote,
+	}
+	if err := cache.PublishRouteUpdate(context.Background(), c.cache, update); err != nil {
+		logger.Errorf("推送路线变更失败: %v", err)
+	}
+	ctx.JSON(http.StatusCreated, gin.H{
+		"plan":           toRoutePlanDTO(replanned),
+		"failing_orders": failing,
+		"late_orders":    reroute.Late,
+	})
+}
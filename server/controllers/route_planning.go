@@ -1,5 +1,138 @@
 package controllers
 
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// RoutePlanningController 为已审核的订单规划取送货路径
 type RoutePlanningController struct {
-	
+	orderRepo   *dao.OrderRepository
+	vehicleRepo *dao.VehicleRepository
+	depotRepo   *dao.DepotRepository
+	routeRepo   *dao.RoutePlanRepository
+	planner     *services.RoutePlanner
+}
+
+// newRoutePlanner 距离数据来源配置有误时记录错误并改用球面距离估算
+func newRoutePlanner(cache *redis.Client) *services.RoutePlanner {
+	distances, err := services.NewDistanceProvider(cache)
+	if err != nil {
+		logger.Errorf("创建距离数据来源失败，改用球面距离估算: %v", err)
+		distances = services.HaversineProvider{RoadFactor: services.DISTANCE_ROAD_FACTOR}
+	}
+	return services.NewRoutePlanner(distances, services.ROUTE_ACO)
+}
+
+func NewRoutePlanningController(db *gorm.DB, cache *redis.Client) *RoutePlanningController {
+	if db == nil {
+		panic("NewRoutePlanningController received nil DB instance")
+	}
+	return &RoutePlanningController{
+		orderRepo:   dao.NewOrderRepository(db),
+		vehicleRepo: dao.NewVehicleRepository(db),
+		depotRepo:   dao.NewDepotRepository(db),
+		routeRepo:   dao.NewRoutePlanRepository(db),
+		planner:     newRoutePlanner(cache),
+	}
+}
+
+// idleVehicles 参与规划的空闲车辆
+func (c *RoutePlanningController) idleVehicles() ([]models.Vehicle, error) {
+	vehicles, err := c.vehicleRepo.ListVehicles()
+	if err != nil {
+		return nil, err
+	}
+	idle := make([]models.Vehicle, 0, len(vehicles))
+	for _, v := range vehicles {
+		if v.Status == models.StatusIdle {
+			idle = append(idle, v)
+		}
+	}
+	return idle, nil
+}
+
+// plan 为 userID 的已审核订单规划路径，userID 为0时规划所有订单，失败时写入响应
+func (c *RoutePlanningController) plan(ctx *gin.Context, userID uint) (*services.RoutePlan, bool) {
+	vehicles, err := c.idleVehicles()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆列表失败"})
+		return nil, false
+	}
+	if len(vehicles) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "没有空闲车辆"})
+		return nil, false
+	}
+	depots, err := c.depotRepo.ListDepots()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取仓库列表失败"})
+		return nil, false
+	}
+	orders, err := c.orderRepo.ListOrdersByStatus(models.OrderApproved, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单列表失败"})
+		return nil, false
+	}
+
+	plan, err := c.planner.Plan(ctx.Request.Context(), orders, vehicles, depots, time.Now())
+	if err != nil {
+		logger.Errorf("路径规划失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "路径规划失败"})
+		return nil, false
+	}
+	return plan, true
+}
+
+// GetAllRoutes 规划所有已审核订单的路径
+func (c *RoutePlanningController) GetAllRoutes(ctx *gin.Context) {
+	if plan, ok := c.plan(ctx, 0); ok {
+		ctx.JSON(http.StatusOK, plan)
+	}
+}
+
+// GetUserRoutes 规划指定用户已审核订单的路径
+func (c *RoutePlanningController) GetUserRoutes(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || userID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if plan, ok := c.plan(ctx, uint(userID)); ok {
+		ctx.JSON(http.StatusOK, plan)
+	}
+}
+
+// SaveRoutes 规划所有已审核订单的路径并保存为路线计划，每辆车一条
+func (c *RoutePlanningController) SaveRoutes(ctx *gin.Context) {
+	plan, ok := c.plan(ctx, 0)
+	if !ok {
+		return
+	}
+
+	var saved []models.RoutePlan
+	err := c.routeRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		saved, err = services.SaveRoutePlans(tx, plan, actor(ctx))
+		return err
+	})
+	if err != nil {
+		logger.Errorf("保存路线计划失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存路线计划失败"})
+		return
+	}
+
+	ids := make([]uint, 0, len(saved))
+	for _, p := range saved {
+		ids = append(ids, p.ID)
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"route_plan_ids": ids, "plan": plan})
 }
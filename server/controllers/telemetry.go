@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"coldchain/common/logger"
+	"coldchain/server/dao"
+	"coldchain/server/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 单次查询返回的监控数据条数上限
+const maxTelemetryReadings = 10000
+
+// TelemetryController 按冷链箱分配时间段查询订单的监控数据、告警和温控合规情况
+type TelemetryController struct {
+	db        *gorm.DB
+	telemetry *dao.TelemetryRepository
+}
+
+func NewTelemetryController(db *gorm.DB, ch driver.Conn) *TelemetryController {
+	return &TelemetryController{
+		db:        db,
+		telemetry: dao.NewTelemetryRepository(ch),
+	}
+}
+
+// windows 读取订单的分配时间段，失败时写入响应
+func (c *TelemetryController) windows(ctx *gin.Context) (uint, []dao.TelemetryWindow, bool) {
+	orderID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return 0, nil, false
+	}
+	windows, err := services.OrderTelemetryWindows(c.db, uint(orderID), time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return 0, nil, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取冷链箱分配记录失败"})
+		return 0, nil, false
+	}
+	return uint(orderID), windows, true
+}
+
+func (c *TelemetryController) GetOrderTelemetry(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 || limit > maxTelemetryReadings {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit 需在 1 到 10000 之间"})
+		return
+	}
+	_, windows, ok := c.windows(ctx)
+	if !ok {
+		return
+	}
+
+	readings, err := c.telemetry.ListReadings(windows, limit)
+	if err != nil {
+		logger.Errorf("获取订单监控数据失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取监控数据失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"windows": windows, "readings": readings})
+}
+
+func (c *TelemetryController) GetOrderAlarms(ctx *gin.Context) {
+	_, windows, ok := c.windows(ctx)
+	if !ok {
+		return
+	}
+
+	alarms, err := c.telemetry.ListAlarms(windows)
+	if err != nil {
+		logger.Errorf("获取订单告警失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取报警记录失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, alarms)
+}
+
+func (c *TelemetryController) GetOrderCompliance(ctx *gin.Context) {
+	orderID, windows, ok := c.windows(ctx)
+	if !ok {
+		return
+	}
+
+	report, err := services.OrderCompliance(c.telemetry, orderID, windows)
+	if err != nil {
+		logger.Errorf("统计订单温控合规失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "统计温控合规失败"})
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -2,12 +2,14 @@ package controllers
 
 import (
 	"coldchain/common/jwt"
+	"coldchain/common/logger"
 	"coldchain/common/mysql"
 	"coldchain/common/mysql/models"
 	"coldchain/server/dao"
 	"coldchain/server/dto"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -20,15 +22,17 @@ import (
 
 type UserController struct {
 	userRepo *dao.UserRepository
+	revoker  *jwt.Revoker
 }
 
 // 修改控制器构造函数
-func NewUserController(db *gorm.DB) *UserController {
+func NewUserController(db *gorm.DB, revoker *jwt.Revoker) *UserController {
 	if db == nil {
 		panic("NewUserController received nil DB instance")
 	}
 	return &UserController{
 		userRepo: dao.NewUserRepository(mysql.Db),
+		revoker:  revoker,
 	}
 }
 
@@ -83,14 +87,98 @@ func (c *UserController) Login(ctx *gin.Context) {
 		return
 	}
 
-	auth, err := jwt.GenerateToken(uint32(user.ID), uint32(user.RoleID))
+	tokens, err := jwt.GenerateTokenPair(uint32(user.ID), uint32(user.RoleID), user.Role.RoleName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
-	ctx.Header("Authorization", "Bearer "+auth)
-	ctx.JSON(http.StatusOK, gin.H{"message": "登录成功", "user_id": user.ID, "role": user.Role.RoleName})
+	ctx.Header("Authorization", "Bearer "+tokens.AccessToken)
+	ctx.JSON(http.StatusOK, gin.H{"message": "登录成功", "user_id": user.ID, "role": user.Role.RoleName, "tokens": tokens})
+}
+
+// RefreshToken 使用刷新token换取新的token，旧的刷新token随即失效
+func (c *UserController) RefreshToken(ctx *gin.Context) {
+	var req dto.RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := jwt.ParseClaims(req.RefreshToken)
+	if err != nil || claims.TokenType != jwt.TokenTypeRefresh {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "无效的刷新token"})
+		return
+	}
+
+	revoked, err := c.revoker.IsRevoked(ctx, claims)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "校验token失败"})
+		return
+	}
+	if revoked {
+		// 已轮换的刷新token被再次使用，可能已泄露，吊销该用户的全部token
+		if err := c.revoker.RevokeUser(ctx, claims.Id); err != nil {
+			logger.Errorf("吊销用户token失败: %v", err)
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "刷新token已失效，请重新登录"})
+		return
+	}
+
+	// 重新读取用户，角色变更后立即生效
+	user, err := c.userRepo.GetUserWithRole(uint(claims.Id))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	// 先占用刷新token，同一个刷新token的并发请求只有一个能换取新token
+	first, err := c.revoker.RevokeOnce(ctx, claims)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销token失败"})
+		return
+	}
+	if !first {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "刷新token已失效，请重新登录"})
+		return
+	}
+	tokens, err := jwt.GenerateTokenPair(uint32(user.ID), uint32(user.RoleID), user.Role.RoleName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	ctx.Header("Authorization", "Bearer "+tokens.AccessToken)
+	ctx.JSON(http.StatusOK, gin.H{"message": "刷新成功", "tokens": tokens})
+}
+
+// Logout 吊销当前访问token以及请求中携带的刷新token
+func (c *UserController) Logout(ctx *gin.Context) {
+	var req dto.LogoutRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if claims, ok := CurrentClaims(ctx); ok {
+		if err := c.revoker.Revoke(ctx, claims); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销token失败"})
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		claims, err := jwt.ParseClaims(req.RefreshToken)
+		userID, _, _ := CurrentUser(ctx)
+		if err == nil && uint(claims.Id) == userID {
+			if err := c.revoker.Revoke(ctx, claims); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销token失败"})
+				return
+			}
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
 }
 
 func (c *UserController) GetUserByID(ctx *gin.Context) {
@@ -160,6 +248,12 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 		return
 	}
 
+	// 只有系统管理员可以创建管理员账号
+	if !models.IsCustomerRole(req.Role) && !isAdmin(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "无权创建该角色的用户"})
+		return
+	}
+
 	// 序列化地址数据
 	addressJSON, err := json.Marshal(req.Address)
 	if err != nil {
@@ -235,6 +329,11 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		}
 		user.PasswordHash = string(hashed)
 	}
+	if req.Role != nil && *req.Role != user.Role.RoleName && !isAdmin(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "无权修改用户角色"})
+		return
+	}
+	roleChanged := req.Role != nil && *req.Role != user.Role.RoleName
 	if req.Role != nil {
 		roleID, err := c.userRepo.GetRoleId(*req.Role)
 		if err != nil {
@@ -256,6 +355,15 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		user.Address = datatypes.JSON(addressJSON)
 	}
 
+	// 修改密码或角色后此前签发的 token 全部失效，先吊销再保存，吊销失败时不修改
+	if req.Password != nil || roleChanged {
+		if err := c.revoker.RevokeUser(ctx, uint32(user.ID)); err != nil {
+			logger.Errorf("吊销用户token失败: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销用户token失败"})
+			return
+		}
+	}
+
 	if err := c.userRepo.UpdateUser(user); err != nil {
 		if err == gorm.ErrDuplicatedKey {
 			ctx.JSON(http.StatusConflict, gin.H{"error": "有重复的记录"})
@@ -289,6 +397,12 @@ func (c *UserController) DeleteUser(ctx *gin.Context) {
 		return
 	}
 
+	// 删除前吊销该用户的全部 token
+	if err := c.revoker.RevokeUser(ctx, uint32(userID)); err != nil {
+		logger.Errorf("吊销用户token失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销用户token失败"})
+		return
+	}
 	if err := c.userRepo.DeleteUser(uint(userID)); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 		return
@@ -13,6 +13,8 @@ import (
 
 type VehicleController struct {
 	vehicleRepo *dao.VehicleRepository
+	depotRepo   *dao.DepotRepository
+	userRepo    *dao.UserRepository
 }
 
 func NewVehicleController(db *gorm.DB) *VehicleController {
@@ -21,9 +23,25 @@ func NewVehicleController(db *gorm.DB) *VehicleController {
 	}
 	return &VehicleController{
 		vehicleRepo: dao.NewVehicleRepository(db),
+		depotRepo:   dao.NewDepotRepository(db),
+		userRepo:    dao.NewUserRepository(db),
 	}
 }
 
+// checkDriver 绑定到车辆的用户必须是司机
+func (c *VehicleController) checkDriver(ctx *gin.Context, driverID uint) bool {
+	user, err := c.userRepo.GetUserWithRole(driverID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "司机不存在"})
+		return false
+	}
+	if user.Role.RoleName != models.RoleDriver {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "该用户不是司机"})
+		return false
+	}
+	return true
+}
+
 func (c *VehicleController) GetVehicleList(ctx *gin.Context) {
 	vehicles, err := c.vehicleRepo.ListVehicles()
 	if err != nil {
@@ -39,6 +57,10 @@ func (c *VehicleController) GetVehicleList(ctx *gin.Context) {
 			Status:      string(v.Status),
 			MaxCapacity: v.MaxCapacity,
 			ImgUrl:      v.ImgUrl,
+			DepotID:     v.DepotID,
+			DriverID:    v.DriverID,
+			CargoVolume: v.CargoVolume,
+			MaxPayload:  v.MaxPayload,
 		})
 	}
 	ctx.JSON(http.StatusOK, response)
@@ -62,11 +84,25 @@ func (c *VehicleController) AddVehicle(ctx *gin.Context) {
 		return
 	}
 
+	if req.DepotID != nil {
+		if _, err := c.depotRepo.GetDepotByID(*req.DepotID); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "仓库不存在"})
+			return
+		}
+	}
+	if req.DriverID != nil && !c.checkDriver(ctx, *req.DriverID) {
+		return
+	}
+
 	vehicle := models.Vehicle{
 		PlateNumber: req.PlateNumber,
 		Status:      models.VehicleStatus(req.Status),
 		MaxCapacity: req.MaxCapacity,
 		ImgUrl:      req.ImgUrl,
+		DepotID:     req.DepotID,
+		DriverID:    req.DriverID,
+		CargoVolume: req.CargoVolume,
+		MaxPayload:  req.MaxPayload,
 	}
 
 	if err := c.vehicleRepo.CreateVehicle(&vehicle); err != nil {
@@ -80,6 +116,10 @@ func (c *VehicleController) AddVehicle(ctx *gin.Context) {
 		Status:      string(vehicle.Status),
 		MaxCapacity: vehicle.MaxCapacity,
 		ImgUrl:      vehicle.ImgUrl,
+		DepotID:     vehicle.DepotID,
+		DriverID:    vehicle.DriverID,
+		CargoVolume: vehicle.CargoVolume,
+		MaxPayload:  vehicle.MaxPayload,
 	})
 }
 
@@ -125,6 +165,21 @@ func (c *VehicleController) UpdateVehicle(ctx *gin.Context) {
 	if req.ImgUrl != nil {
 		vehicle.ImgUrl = *req.ImgUrl
 	}
+	if req.DriverID != nil {
+		if *req.DriverID == 0 {
+			vehicle.DriverID = nil
+		} else if !c.checkDriver(ctx, *req.DriverID) {
+			return
+		} else {
+			vehicle.DriverID = req.DriverID
+		}
+	}
+	if req.CargoVolume != nil {
+		vehicle.CargoVolume = *req.CargoVolume
+	}
+	if req.MaxPayload != nil {
+		vehicle.MaxPayload = *req.MaxPayload
+	}
 
 	if err := c.vehicleRepo.UpdateVehicle(vehicle); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -137,6 +192,10 @@ func (c *VehicleController) UpdateVehicle(ctx *gin.Context) {
 		Status:      string(vehicle.Status),
 		MaxCapacity: vehicle.MaxCapacity,
 		ImgUrl:      vehicle.ImgUrl,
+		DepotID:     vehicle.DepotID,
+		DriverID:    vehicle.DriverID,
+		CargoVolume: vehicle.CargoVolume,
+		MaxPayload:  vehicle.MaxPayload,
 	})
 }
 
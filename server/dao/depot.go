@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"coldchain/common/mysql/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DepotRepository struct {
+	db *gorm.DB
+}
+
+func NewDepotRepository(db *gorm.DB) *DepotRepository {
+	return &DepotRepository{db: db}
+}
+
+func (r *DepotRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+func (r *DepotRepository) ListDepots() ([]models.Depot, error) {
+	var depots []models.Depot
+	if err := r.db.Order("id").Find(&depots).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return depots, nil
+}
+
+func (r *DepotRepository) CreateDepot(depot *models.Depot) error {
+	if err := r.db.Create(depot).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func (r *DepotRepository) GetDepotByID(id uint) (*models.Depot, error) {
+	var depot models.Depot
+	if err := r.db.First(&depot, id).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return &depot, nil
+}
+
+// GetDepotForUpdate 加行锁读取仓库，调拨时串行检查容量，需在事务中调用
+func (r *DepotRepository) GetDepotForUpdate(id uint) (*models.Depot, error) {
+	var depot models.Depot
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&depot, id).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return &depot, nil
+}
+
+func (r *DepotRepository) UpdateDepot(depot *models.Depot) error {
+	if err := r.db.Save(depot).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func (r *DepotRepository) CheckDepotNameExists(name string, excludeID uint) (bool, error) {
+	var count int64
+	query := r.db.Model(&models.Depot{}).Where("name = ?", name)
+	if excludeID > 0 {
+		query = query.Where("id != ?", excludeID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return false, handleDBError(err)
+	}
+	return count > 0, nil
+}
+
+// CountDepotModules 统计存放在仓库中的冷链箱，已出库的不计入
+func (r *DepotRepository) CountDepotModules(depotID uint) (int, error) {
+	var count int64
+	err := r.db.Model(&models.Module{}).
+		Where("depot_id = ? AND status <> ?", depotID, models.StatusAssigned).
+		Count(&count).Error
+	if err != nil {
+		return 0, handleDBError(err)
+	}
+	return int(count), nil
+}
+
+// CountModulesByDepot 按仓库统计存放的冷链箱
+func (r *DepotRepository) CountModulesByDepot() (map[uint]int, error) {
+	var rows []struct {
+		DepotID uint
+		Count   int
+	}
+	err := r.db.Model(&models.Module{}).
+		Select("depot_id, COUNT(*) AS count").
+		Where("depot_id IS NOT NULL AND status <> ?", models.StatusAssigned).
+		Group("depot_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.DepotID] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *DepotRepository) CreateTransfers(transfers []models.DepotTransfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	if err := r.db.Create(&transfers).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// ListTransfers 列出调拨记录，depotID 不为0时只列出调入或调出该仓库的记录
+func (r *DepotRepository) ListTransfers(depotID uint) ([]models.DepotTransfer, error) {
+	var transfers []models.DepotTransfer
+	query := r.db.Order("id DESC")
+	if depotID != 0 {
+		query = query.Where("from_depot_id = ? OR to_depot_id = ?", depotID, depotID)
+	}
+	if err := query.Find(&transfers).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"coldchain/common/mysql/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DispatchRepository struct {
+	db *gorm.DB
+}
+
+func NewDispatchRepository(db *gorm.DB) *DispatchRepository {
+	return &DispatchRepository{db: db}
+}
+
+func (r *DispatchRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// CreateDispatch 创建调度单及其订单和冷链箱
+func (r *DispatchRepository) CreateDispatch(dispatch *models.Dispatch) error {
+	if err := r.db.Create(dispatch).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// GetDispatchForUpdate 加行锁读取调度单，需在事务中调用
+func (r *DispatchRepository) GetDispatchForUpdate(id uint) (*models.Dispatch, error) {
+	var dispatch models.Dispatch
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Orders").
+		First(&dispatch, id).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &dispatch, nil
+}
+
+func (r *DispatchRepository) GetDispatchByID(id uint) (*models.Dispatch, error) {
+	var dispatch models.Dispatch
+	err := r.db.Preload("Vehicle").
+		Preload("Orders").
+		Preload("Modules", func(db *gorm.DB) *gorm.DB { return db.Order("load_sequence") }).
+		First(&dispatch, id).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &dispatch, nil
+}
+
+// ListDispatches 按创建时间倒序列出调度单，status 为空时列出全部
+func (r *DispatchRepository) ListDispatches(status string) ([]models.Dispatch, error) {
+	var dispatches []models.Dispatch
+	query := r.db.Preload("Vehicle").Preload("Orders").Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&dispatches).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return dispatches, nil
+}
+
+func (r *DispatchRepository) UpdateDispatch(dispatch *models.Dispatch) error {
+	err := r.db.Model(dispatch).Select("status", "departed_at", "completed_at", "updated_at").Updates(dispatch).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
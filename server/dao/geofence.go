@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"coldchain/common/mysql/models"
+
+	"gorm.io/gorm"
+)
+
+type GeofenceRepository struct {
+	db *gorm.DB
+}
+
+func NewGeofenceRepository(db *gorm.DB) *GeofenceRepository {
+	return &GeofenceRepository{db: db}
+}
+
+// ListGeofences 列出地理围栏，enabledOnly 为 true 时只列出启用的
+func (r *GeofenceRepository) ListGeofences(enabledOnly bool) ([]models.Geofence, error) {
+	var fences []models.Geofence
+	query := r.db.Order("id")
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+	if err := query.Find(&fences).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return fences, nil
+}
+
+func (r *GeofenceRepository) GetGeofenceByID(id uint) (*models.Geofence, error) {
+	var fence models.Geofence
+	if err := r.db.First(&fence, id).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return &fence, nil
+}
+
+func (r *GeofenceRepository) CreateGeofence(fence *models.Geofence) error {
+	if err := r.db.Create(fence).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func (r *GeofenceRepository) UpdateGeofence(fence *models.Geofence) error {
+	if err := r.db.Save(fence).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func (r *GeofenceRepository) DeleteGeofence(id uint) error {
+	result := r.db.Delete(&models.Geofence{}, id)
+	if result.Error != nil {
+		return handleDBError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package dao
 
 import (
 	"coldchain/common/mysql/models"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ModuleRepository struct {
@@ -14,25 +18,155 @@ func NewModuleRepository(db *gorm.DB) *ModuleRepository {
 	return &ModuleRepository{db: db}
 }
 
-// 查找可用的冷链模块
-func (r *ModuleRepository) FindAvailableModules(quantity int) ([]models.Module, error) {
+func (r *ModuleRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// ErrModuleConflict 模块在读取之后已被其他订单占用
+var ErrModuleConflict = errors.New("冷链箱已被其他订单占用")
+
+// ModuleFilter 分配冷链箱时的硬性条件
+type ModuleFilter struct {
+	MinTemperature float64 // 需要维持的最低温度
+	MaxTemperature float64 // 需要维持的最高温度
+	MinBattery     float64 // 最低电量百分比
+	MinVolume      float64 // 需要装下的体积，立方米
+	MinPayload     float64 // 需要承载的重量，千克
+}
+
+// 查找满足条件的空闲模块，不加锁，选定后需通过 LockModules 锁定
+func (r *ModuleRepository) FindCandidateModules(filter ModuleFilter) ([]models.Module, error) {
 	var modules []models.Module
 	err := r.db.
-		Where("status = ?", "unassigned"). // 直接筛选未分配状态
-		Limit(quantity).
+		Where("status = ?", models.StatusUnassigned).
+		Where("supported_min_temperature <= ? AND supported_max_temperature >= ?", filter.MinTemperature, filter.MaxTemperature).
+		Where("battery_level >= ?", filter.MinBattery).
+		Where("inner_volume >= ? AND max_payload >= ?", filter.MinVolume, filter.MinPayload).
+		Order("id").
 		Find(&modules).Error
 	return modules, err
 }
 
-// 分配模块给订单项
+// LockModules 按 id 顺序锁定选中的模块并重新读取，需在事务中调用。
+// 模块已被其他事务分配或删除时返回 ErrModuleConflict，由调用方整体重试
+func (r *ModuleRepository) LockModules(ids []uint) ([]models.Module, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var modules []models.Module
+	err := r.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&modules).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	if len(modules) != len(ids) {
+		return nil, ErrModuleConflict
+	}
+	for _, m := range modules {
+		if m.Status != models.StatusUnassigned {
+			return nil, ErrModuleConflict
+		}
+	}
+	return modules, nil
+}
+
+// 列出所有空闲模块，不加锁，用于解释分配失败的原因
+func (r *ModuleRepository) ListUnassignedModules() ([]models.Module, error) {
+	var modules []models.Module
+	if err := r.db.Where("status = ?", models.StatusUnassigned).Find(&modules).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return modules, nil
+}
+
+// ModuleRelease 已分配模块及其所属订单的送达时间和租期，用于估算模块何时归还
+type ModuleRelease struct {
+	models.Module
+	DeliveryDate time.Time
+	RentalDays   int
+}
+
+// ListModuleReleases 列出已分配给订单的模块及订单的送达时间和租期，不加锁
+func (r *ModuleRepository) ListModuleReleases() ([]ModuleRelease, error) {
+	var releases []ModuleRelease
+	err := r.db.Model(&models.Module{}).
+		Select("modules.*, rental_orders.delivery_date, rental_orders.rental_days").
+		Joins("JOIN order_items ON order_items.id = modules.order_item_id").
+		Joins("JOIN rental_orders ON rental_orders.id = order_items.order_id").
+		Where("modules.status = ?", models.StatusAssigned).
+		Find(&releases).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return releases, nil
+}
+
+// 分配模块给订单项并记录分配历史，modules 会被原地更新
+// 只有仍处于未分配状态的模块才会被更新，否则返回 ErrModuleConflict
 func (r *ModuleRepository) AssignModulesToOrderItem(orderItem models.OrderItem, modules []models.Module) error {
+	loads := make([]ModuleLoad, len(modules))
+	for i := range loads {
+		loads[i] = ModuleLoad{
+			MinTemperature: orderItem.Product.MinTemperature,
+			MaxTemperature: orderItem.Product.MaxTemperature,
+		}
+	}
+	return r.AssignModuleLoads(orderItem, modules, loads)
+}
 
-	for _, module := range modules {
+// ModuleLoad 装箱规划给一个模块的温度阈值和装载内容
+type ModuleLoad struct {
+	MinTemperature float64
+	MaxTemperature float64
+	Contents       []models.ModuleContent
+}
+
+// AssignModuleLoads 按装箱规划分配模块，modules[i] 装载 loads[i]，模块归属于 orderItem。
+// 与 AssignModulesToOrderItem 相同，只有仍处于未分配状态的模块才会被更新，否则返回 ErrModuleConflict
+func (r *ModuleRepository) AssignModuleLoads(orderItem models.OrderItem, modules []models.Module, loads []ModuleLoad) error {
+	now := time.Now()
+	for i := range modules {
+		module := &modules[i]
+		load := loads[i]
+		result := r.db.Model(&models.Module{}).
+			Where("id = ? AND status = ?", module.ID, models.StatusUnassigned).
+			Updates(map[string]interface{}{
+				"order_item_id":   orderItem.ID,
+				"status":          models.StatusAssigned,
+				"max_temperature": load.MaxTemperature,
+				"min_temperature": load.MinTemperature,
+				"updated_at":      now,
+			})
+		if result.Error != nil {
+			return handleDBError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrModuleConflict
+		}
 		module.OrderItemID = &orderItem.ID
-		module.Status = "assigned"
-		module.MaxTemperature = orderItem.Product.MaxTemperature
-		module.MinTemperature = orderItem.Product.MinTemperature
-		if err := r.db.Save(&module).Error; err != nil {
+		module.Status = models.StatusAssigned
+		module.MaxTemperature = load.MaxTemperature
+		module.MinTemperature = load.MinTemperature
+		module.UpdatedAt = now
+
+		assignment := models.ModuleAssignment{
+			ModuleID:    module.ID,
+			DeviceID:    module.DeviceID,
+			OrderID:     orderItem.OrderID,
+			OrderItemID: orderItem.ID,
+			AssignedAt:  now,
+		}
+		if load.Contents != nil {
+			contents, err := json.Marshal(load.Contents)
+			if err != nil {
+				return err
+			}
+			assignment.Contents = contents
+		}
+		if err := r.db.Create(&assignment).Error; err != nil {
 			return handleDBError(err)
 		}
 	}
@@ -54,3 +188,115 @@ func (r *ModuleRepository) ListModules() ([]models.Module, error) {
 	}
 	return modules, nil
 }
+
+// ReleaseOrderModules 释放订单仍占用的模块并结束其分配记录。
+// 已归还的模块保留未结束的分配记录，由清洁检查释放
+func (r *ModuleRepository) ReleaseOrderModules(orderID uint) error {
+	now := time.Now()
+	err := r.db.Model(&models.ModuleAssignment{}).
+		Where("order_id = ? AND released_at IS NULL AND returned_at IS NULL", orderID).
+		Update("released_at", now).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+
+	err = r.db.Model(&models.Module{}).
+		Where("order_item_id IN (?) AND status = ?",
+			r.db.Model(&models.OrderItem{}).Select("id").Where("order_id = ?", orderID), models.StatusAssigned).
+		Updates(map[string]interface{}{"status": models.StatusUnassigned, "order_item_id": nil}).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// GetModuleForUpdate 加行锁读取模块，需在事务中调用
+func (r *ModuleRepository) GetModuleForUpdate(moduleID uint) (*models.Module, error) {
+	var module models.Module
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&module, moduleID).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &module, nil
+}
+
+// UpdateModuleStatus 更新模块状态，释放时 orderItemID 传 nil
+func (r *ModuleRepository) UpdateModuleStatus(moduleID uint, status models.ModuleStatus, orderItemID *uint) error {
+	err := r.db.Model(&models.Module{}).Where("id = ?", moduleID).
+		Updates(map[string]interface{}{"status": status, "order_item_id": orderItemID}).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// ListOrderModules 列出订单当前占用的模块
+func (r *ModuleRepository) ListOrderModules(orderID uint) ([]models.Module, error) {
+	var modules []models.Module
+	err := r.db.
+		Where("order_item_id IN (?)", r.db.Model(&models.OrderItem{}).Select("id").Where("order_id = ?", orderID)).
+		Find(&modules).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return modules, nil
+}
+
+// MarkOrderDispatched 记录订单在用冷链箱的装车发车时间，已记录的不覆盖
+func (r *ModuleRepository) MarkOrderDispatched(orderID uint, at time.Time) error {
+	err := r.db.Model(&models.ModuleAssignment{}).
+		Where("order_id = ? AND released_at IS NULL AND returned_at IS NULL AND dispatched_at IS NULL", orderID).
+		Update("dispatched_at", at).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// GetOpenAssignment 获取模块尚未释放的分配记录
+func (r *ModuleRepository) GetOpenAssignment(moduleID uint) (*models.ModuleAssignment, error) {
+	var assignment models.ModuleAssignment
+	err := r.db.Where("module_id = ? AND released_at IS NULL", moduleID).
+		Order("assigned_at DESC").
+		First(&assignment).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &assignment, nil
+}
+
+func (r *ModuleRepository) SaveAssignment(assignment *models.ModuleAssignment) error {
+	if err := r.db.Save(assignment).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// ListModuleAssignments 模块服务过的全部订单，按分配时间倒序
+func (r *ModuleRepository) ListModuleAssignments(moduleID uint) ([]models.ModuleAssignment, error) {
+	var assignments []models.ModuleAssignment
+	err := r.db.Where("module_id = ?", moduleID).Order("assigned_at DESC").Find(&assignments).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return assignments, nil
+}
+
+// ListOrderAssignments 订单的全部分配记录，包括已释放的
+func (r *ModuleRepository) ListOrderAssignments(orderID uint) ([]models.ModuleAssignment, error) {
+	var assignments []models.ModuleAssignment
+	err := r.db.Where("order_id = ?", orderID).Order("assigned_at").Find(&assignments).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return assignments, nil
+}
+
+// UpdateModuleDepot 更新模块所在的仓库
+func (r *ModuleRepository) UpdateModuleDepot(moduleID, depotID uint) error {
+	err := r.db.Model(&models.Module{}).Where("id = ?", moduleID).Update("depot_id", depotID).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
@@ -46,3 +46,20 @@ func (r *NotificationRepository) GetNotificationByUserID(userID int) ([]models.N
 	}
 	return notifications, nil
 }
+
+// CreateNotification 创建通知并发送给指定用户
+func (r *NotificationRepository) CreateNotification(notification *models.Notification, userIDs []uint) error {
+	if err := r.db.Create(notification).Error; err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		userNotification := models.NotificationUser{
+			UserID:         userID,
+			NotificationID: notification.ID,
+		}
+		if err := r.db.Create(&userNotification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
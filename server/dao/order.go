@@ -2,8 +2,10 @@ package dao
 
 import (
 	"coldchain/common/mysql/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository struct {
@@ -38,6 +40,32 @@ func (r *OrderRepository) GetOrderByID(orderID uint) (*models.RentalOrder, error
 	return &order, nil
 }
 
+// GetOrderOwnerID 获取订单所属用户ID
+func (r *OrderRepository) GetOrderOwnerID(orderID uint) (uint, error) {
+	var order models.RentalOrder
+	err := r.db.Select("user_id").First(&order, orderID).Error
+	if err != nil {
+		return 0, handleDBError(err)
+	}
+	return order.UserID, nil
+}
+
+// GetDeliveryDates 获取订单承诺的送达时间，按订单ID索引
+func (r *OrderRepository) GetDeliveryDates(orderIDs []uint) (map[uint]time.Time, error) {
+	dates := make(map[uint]time.Time, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return dates, nil
+	}
+	var orders []models.RentalOrder
+	if err := r.db.Select("id", "delivery_date").Where("id IN ?", orderIDs).Find(&orders).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	for _, o := range orders {
+		dates[o.ID] = o.DeliveryDate
+	}
+	return dates, nil
+}
+
 func (r *OrderRepository) ListOrdersByUserID(userID uint) ([]models.RentalOrder, error) {
 	var orders []models.RentalOrder
 	err := r.db.Preload("User.Role").
@@ -172,3 +200,49 @@ func (r *OrderRepository) CreateProduct(product *models.Product) error {
 	}
 	return nil
 }
+
+// GetOrderForUpdate 加行锁读取订单，需在事务中调用
+func (r *OrderRepository) GetOrderForUpdate(orderID uint) (*models.RentalOrder, error) {
+	var order models.RentalOrder
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("OrderStatus").
+		First(&order, orderID).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) CreateStatusTransition(transition *models.OrderStatusTransition) error {
+	if err := r.db.Create(transition).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// ListStatusTransitions 按时间顺序返回订单的状态流转记录
+func (r *OrderRepository) ListStatusTransitions(orderID uint) ([]models.OrderStatusTransition, error) {
+	var transitions []models.OrderStatusTransition
+	err := r.db.Where("order_id = ?", orderID).Order("id").Find(&transitions).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return transitions, nil
+}
+
+// ListOrdersByStatus 列出处于某一状态的订单，userID 为0时列出所有用户的订单
+func (r *OrderRepository) ListOrdersByStatus(statusName string, userID uint) ([]models.RentalOrder, error) {
+	var orders []models.RentalOrder
+	query := r.db.Preload("OrderStatus").
+		Preload("OrderItems.Product").
+		Joins("JOIN order_statuses ON order_statuses.id = rental_orders.status_id").
+		Where("order_statuses.status_name = ?", statusName).
+		Order("rental_orders.id")
+	if userID != 0 {
+		query = query.Where("rental_orders.user_id = ?", userID)
+	}
+	if err := query.Find(&orders).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return orders, nil
+}
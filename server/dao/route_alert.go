@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"coldchain/common/mysql/models"
+
+	"gorm.io/gorm"
+)
+
+type RouteAlertRepository struct {
+	db *gorm.DB
+}
+
+func NewRouteAlertRepository(db *gorm.DB) *RouteAlertRepository {
+	return &RouteAlertRepository{db: db}
+}
+
+func (r *RouteAlertRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// ListAlerts 按开始时间倒序列出路线告警，planID 为0或 status 为空时不按其筛选
+func (r *RouteAlertRepository) ListAlerts(planID uint, status string) ([]models.RouteAlert, error) {
+	var alerts []models.RouteAlert
+	query := r.db.Order("started_at DESC")
+	if planID != 0 {
+		query = query.Where("route_plan_id = ?", planID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&alerts).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return alerts, nil
+}
+
+func (r *RouteAlertRepository) CreateAlert(alert *models.RouteAlert) error {
+	if err := r.db.Create(alert).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// UpdateAlertEnd 延长持续中的告警
+func (r *RouteAlertRepository) UpdateAlertEnd(alert *models.RouteAlert) error {
+	err := r.db.Model(alert).Select("ended_at", "detail").Updates(alert).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func (r *RouteAlertRepository) UpdateAlertStatus(id uint, status string) error {
+	var alert models.RouteAlert
+	if err := r.db.First(&alert, id).Error; err != nil {
+		return handleDBError(err)
+	}
+	if err := r.db.Model(&alert).Update("status", status).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
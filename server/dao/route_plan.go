@@ -0,0 +1,139 @@
+package dao
+
+import (
+	"coldchain/common/mysql/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoutePlanRepository struct {
+	db *gorm.DB
+}
+
+func NewRoutePlanRepository(db *gorm.DB) *RoutePlanRepository {
+	return &RoutePlanRepository{db: db}
+}
+
+func (r *RoutePlanRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// CreateRoutePlans 创建路线计划及其站点
+func (r *RoutePlanRepository) CreateRoutePlans(plans []models.RoutePlan) error {
+	if len(plans) == 0 {
+		return nil
+	}
+	if err := r.db.Omit("Vehicle").Create(&plans).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+func orderedStops(db *gorm.DB) *gorm.DB {
+	return db.Order("sequence")
+}
+
+// GetRoutePlanForUpdate 加行锁读取路线计划及其站点，需在事务中调用
+func (r *RoutePlanRepository) GetRoutePlanForUpdate(id uint) (*models.RoutePlan, error) {
+	var plan models.RoutePlan
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Vehicle").
+		Preload("Stops", orderedStops).
+		First(&plan, id).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &plan, nil
+}
+
+func (r *RoutePlanRepository) GetRoutePlanByID(id uint) (*models.RoutePlan, error) {
+	var plan models.RoutePlan
+	err := r.db.Preload("Vehicle").
+		Preload("Stops", orderedStops).
+		First(&plan, id).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &plan, nil
+}
+
+// GetRoutePlanDriverID 路线计划所用车辆绑定的司机用户ID，未绑定时为 nil
+func (r *RoutePlanRepository) GetRoutePlanDriverID(id uint) (*uint, error) {
+	var plan models.RoutePlan
+	err := r.db.Select("id", "vehicle_id").
+		Preload("Vehicle", func(db *gorm.DB) *gorm.DB { return db.Select("id", "driver_id") }).
+		First(&plan, id).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return plan.Vehicle.DriverID, nil
+}
+
+// ListRoutePlans 按创建时间倒序列出路线计划，status 为空时列出全部
+func (r *RoutePlanRepository) ListRoutePlans(status string) ([]models.RoutePlan, error) {
+	var plans []models.RoutePlan
+	query := r.db.Preload("Vehicle").Preload("Stops", orderedStops).Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&plans).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return plans, nil
+}
+
+func (r *RoutePlanRepository) UpdateRoutePlan(plan *models.RoutePlan) error {
+	err := r.db.Model(plan).Select("status", "started_at", "completed_at", "updated_at").Updates(plan).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// UpdateStopArrival 记录站点的实际到达时间和来源
+func (r *RoutePlanRepository) UpdateStopArrival(stop *models.RouteStop) error {
+	err := r.db.Model(stop).Select("actual_arrival", "arrival_source").Updates(stop).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// GetActiveRoutePlan 车辆最近一条待执行或执行中的路线计划
+func (r *RoutePlanRepository) GetActiveRoutePlan(vehicleID uint) (*models.RoutePlan, error) {
+	var plan models.RoutePlan
+	err := r.db.Preload("Vehicle").
+		Preload("Stops", orderedStops).
+		Where("vehicle_id = ? AND status IN ?", vehicleID, []string{models.RoutePlanPlanned, models.RoutePlanExecuting}).
+		Order("created_at DESC").
+		First(&plan).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &plan, nil
+}
+
+// GetOrderRoutePlan 包含订单站点的最新一条路线计划，已被重新规划接替的除外
+func (r *RoutePlanRepository) GetOrderRoutePlan(orderID uint) (*models.RoutePlan, error) {
+	var plan models.RoutePlan
+	err := r.db.Preload("Vehicle").
+		Preload("Stops", orderedStops).
+		Where("status <> ?", models.RoutePlanReplaced).
+		Where("id IN (?)", r.db.Model(&models.RouteStop{}).Select("route_plan_id").Where("order_id = ?", orderID)).
+		Order("created_at DESC").
+		First(&plan).Error
+	if err != nil {
+		return nil, handleDBError(err)
+	}
+	return &plan, nil
+}
+
+// UpdateStopRiskNotified 记录已通知客户站点可能延误
+func (r *RoutePlanRepository) UpdateStopRiskNotified(stop *models.RouteStop) error {
+	err := r.db.Model(stop).Select("risk_notified_at").Updates(stop).Error
+	if err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dao
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// TelemetryWindow 一个设备为订单项工作的时间段，以及该订单项商品要求的温区
+type TelemetryWindow struct {
+	DeviceID       string    `json:"device_id"`
+	OrderItemID    uint      `json:"order_item_id"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	MinTemperature float64   `json:"min_temperature"`
+	MaxTemperature float64   `json:"max_temperature"`
+}
+
+// TelemetryReading 归属到订单的一条监控数据
+type TelemetryReading struct {
+	TimeStamp    time.Time `ch:"time_stamp" json:"timestamp"`
+	DeviceID     string    `ch:"device_id" json:"device_id"`
+	Temperature  float32   `ch:"temperature" json:"temperature"`
+	BatteryLevel float32   `ch:"battery_level" json:"battery_level"`
+}
+
+// TelemetryAlarm 归属到订单的一条告警
+type TelemetryAlarm struct {
+	TimeStamp        time.Time `ch:"time_stamp" json:"timestamp"`
+	DeviceID         string    `ch:"device_id" json:"device_id"`
+	AlarmLevel       string    `ch:"alarm_level" json:"alarm_level"`
+	AlarmDescription string    `ch:"alarm_description" json:"alarm_description"`
+	AlarmStatus      string    `ch:"alarm_status" json:"alarm_status"`
+}
+
+// TelemetrySummary 一个时间段内的温度统计
+type TelemetrySummary struct {
+	Readings       uint64  `ch:"readings" json:"readings"`
+	Excursions     uint64  `ch:"excursions" json:"excursions"` // 超出商品温区的读数
+	MinTemperature float32 `ch:"min_temperature" json:"min_temperature"`
+	MaxTemperature float32 `ch:"max_temperature" json:"max_temperature"`
+	AvgTemperature float64 `ch:"avg_temperature" json:"avg_temperature"`
+}
+
+// TelemetryRepository 按分配时间段查询 ClickHouse 中的监控数据
+type TelemetryRepository struct {
+	ch driver.Conn
+}
+
+func NewTelemetryRepository(ch driver.Conn) *TelemetryRepository {
+	return &TelemetryRepository{ch: ch}
+}
+
+// windowCondition 生成 (device_id = ? AND time_stamp BETWEEN ? AND ?) OR ... 条件
+func windowCondition(windows []TelemetryWindow) (string, []interface{}) {
+	conds := make([]string, 0, len(windows))
+	args := make([]interface{}, 0, len(windows)*3)
+	for _, w := range windows {
+		conds = append(conds, "(device_id = ? AND time_stamp BETWEEN ? AND ?)")
+		args = append(args, w.DeviceID, w.Start, w.End)
+	}
+	return strings.Join(conds, " OR "), args
+}
+
+// ListReadings 查询各时间段内的监控数据，按时间排序，最多返回 limit 条
+func (r *TelemetryRepository) ListReadings(windows []TelemetryWindow, limit int) ([]TelemetryReading, error) {
+	var readings []TelemetryReading
+	if len(windows) == 0 {
+		return readings, nil
+	}
+	cond, args := windowCondition(windows)
+	err := r.ch.Select(context.Background(), &readings, `
+	SELECT time_stamp, device_id, temperature, battery_level
+	FROM module_monitor
+	WHERE `+cond+`
+	ORDER BY time_stamp
+	LIMIT ?`, append(args, limit)...)
+	return readings, err
+}
+
+// ListAlarms 查询各时间段内的告警
+func (r *TelemetryRepository) ListAlarms(windows []TelemetryWindow) ([]TelemetryAlarm, error) {
+	var alarms []TelemetryAlarm
+	if len(windows) == 0 {
+		return alarms, nil
+	}
+	cond, args := windowCondition(windows)
+	err := r.ch.Select(context.Background(), &alarms, `
+	SELECT time_stamp, device_id, toString(alarm_level) AS alarm_level, alarm_description, toString(alarm_status) AS alarm_status
+	FROM alarm_record
+	WHERE `+cond+`
+	ORDER BY time_stamp`, args...)
+	return alarms, err
+}
+
+// Summarize 统计一个时间段内的温度，超出窗口温区的读数计为偏离
+func (r *TelemetryRepository) Summarize(w TelemetryWindow) (*TelemetrySummary, error) {
+	var rows []TelemetrySummary
+	err := r.ch.Select(context.Background(), &rows, `
+	SELECT
+		count() AS readings,
+		countIf(temperature < ? OR temperature > ?) AS excursions,
+		min(temperature) AS min_temperature,
+		max(temperature) AS max_temperature,
+		ifNotFinite(avg(temperature), 0) AS avg_temperature
+	FROM module_monitor
+	WHERE device_id = ? AND time_stamp BETWEEN ? AND ?`,
+		w.MinTemperature, w.MaxTemperature, w.DeviceID, w.Start, w.End)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return &TelemetrySummary{}, nil
+	}
+	return &rows[0], nil
+}
@@ -35,7 +35,7 @@ func (r *UserRepository) GetUserByID(userID uint) (*models.User, error) {
 
 func (r *UserRepository) GetUserByPhone(phone string) (*models.User, error) {
 	var user models.User
-	if err := r.db.Where("phone = ?", phone).First(&user).Error; err != nil {
+	if err := r.db.Preload("Role").Where("phone = ?", phone).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) { // GORM v2 使用 errors.Is()
 			return nil, errors.New("用户不存在")
 		}
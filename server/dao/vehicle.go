@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type VehicleRepository struct {
@@ -23,6 +24,15 @@ func (r *VehicleRepository) ListVehicles() ([]models.Vehicle, error) {
 	return vehicles, nil
 }
 
+// GetVehicleDriverID 车辆绑定的司机用户ID，未绑定时为 nil
+func (r *VehicleRepository) GetVehicleDriverID(id uint) (*uint, error) {
+	var vehicle models.Vehicle
+	if err := r.db.Select("id", "driver_id").First(&vehicle, id).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return vehicle.DriverID, nil
+}
+
 func (r *VehicleRepository) CreateVehicle(vehicle *models.Vehicle) error {
 	if err := r.db.Create(vehicle).Error; err != nil {
 		return handleDBError(err)
@@ -66,3 +76,27 @@ func (r *VehicleRepository) CheckPlateNumberExists(plateNumber string, excludeID
 	}
 	return count > 0, nil
 }
+
+// GetVehicleForUpdate 加行锁读取车辆，需在事务中调用
+func (r *VehicleRepository) GetVehicleForUpdate(id uint) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, id).Error; err != nil {
+		return nil, handleDBError(err)
+	}
+	return &vehicle, nil
+}
+
+func (r *VehicleRepository) UpdateVehicleStatus(id uint, status models.VehicleStatus) error {
+	if err := r.db.Model(&models.Vehicle{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
+
+// UpdateVehicleDepot 更新车辆所属的仓库
+func (r *VehicleRepository) UpdateVehicleDepot(id, depotID uint) error {
+	if err := r.db.Model(&models.Vehicle{}).Where("id = ?", id).Update("depot_id", depotID).Error; err != nil {
+		return handleDBError(err)
+	}
+	return nil
+}
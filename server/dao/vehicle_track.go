@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// TrackPoint vehicle_location 中的一条车辆定位
+type TrackPoint struct {
+	TimeStamp time.Time `ch:"time_stamp" json:"timestamp"`
+	Longitude float32   `ch:"longitude" json:"longitude"`
+	Latitude  float32   `ch:"latitude" json:"latitude"`
+	Speed     float32   `ch:"speed" json:"speed"`
+}
+
+// VehicleTrackRepository 查询 ClickHouse 中的车辆定位
+type VehicleTrackRepository struct {
+	ch driver.Conn
+}
+
+func NewVehicleTrackRepository(ch driver.Conn) *VehicleTrackRepository {
+	return &VehicleTrackRepository{ch: ch}
+}
+
+// ListTrack 查询车辆在 [start, end] 内的定位，按时间排序，最多返回 limit 条。
+// vehicleKeys 为车辆在 vehicle_location 中可能使用的标识
+func (r *VehicleTrackRepository) ListTrack(vehicleKeys []string, start, end time.Time, limit int) ([]TrackPoint, error) {
+	var points []TrackPoint
+	if len(vehicleKeys) == 0 {
+		return points, nil
+	}
+	err := r.ch.Select(context.Background(), &points, `
+	SELECT time_stamp, longitude, latitude, speed
+	FROM vehicle_location
+	WHERE vehicle_id IN (?) AND time_stamp BETWEEN ? AND ?
+	ORDER BY time_stamp
+	LIMIT ?`, vehicleKeys, start, end, limit)
+	return points, err
+}
+
+// GetLatestPoint 车辆在 since 之后最近的一条定位，没有定位时返回 nil
+func (r *VehicleTrackRepository) GetLatestPoint(vehicleKeys []string, since time.Time) (*TrackPoint, error) {
+	var points []TrackPoint
+	if len(vehicleKeys) == 0 {
+		return nil, nil
+	}
+	err := r.ch.Select(context.Background(), &points, `
+	SELECT time_stamp, longitude, latitude, speed
+	FROM vehicle_location
+	WHERE vehicle_id IN (?) AND time_stamp >= ?
+	ORDER BY time_stamp DESC
+	LIMIT 1`, vehicleKeys, since)
+	if err != nil || len(points) == 0 {
+		return nil, err
+	}
+	return &points[0], nil
+}
@@ -0,0 +1,48 @@
+package dto
+
+import "time"
+
+type CreateDepotRequest struct {
+	Name      string  `json:"name" binding:"required,max=100"`
+	Address   string  `json:"address" binding:"required,max=255"`
+	Longitude float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Latitude  float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Capacity  int     `json:"capacity" binding:"min=0"` // 0 表示不限
+}
+
+type UpdateDepotRequest struct {
+	Name      *string  `json:"name" binding:"omitempty,max=100"`
+	Address   *string  `json:"address" binding:"omitempty,max=255"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Capacity  *int     `json:"capacity" binding:"omitempty,min=0"`
+}
+
+type DepotDTO struct {
+	ID        uint    `json:"id"`
+	Name      string  `json:"name"`
+	Address   string  `json:"address"`
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Capacity  int     `json:"capacity"`
+	Stored    int     `json:"stored"` // 当前存放的冷链箱数量
+}
+
+// TransferRequest 将冷链箱和车辆调拨到仓库 to_depot_id
+type TransferRequest struct {
+	ToDepotID  uint   `json:"to_depot_id" binding:"required"`
+	ModuleIDs  []uint `json:"module_ids"`
+	VehicleIDs []uint `json:"vehicle_ids"`
+	Remark     string `json:"remark" binding:"max=255"`
+}
+
+type DepotTransferDTO struct {
+	ID          uint      `json:"id"`
+	FromDepotID *uint     `json:"from_depot_id"`
+	ToDepotID   uint      `json:"to_depot_id"`
+	ModuleID    *uint     `json:"module_id,omitempty"`
+	VehicleID   *uint     `json:"vehicle_id,omitempty"`
+	CreatedBy   uint      `json:"created_by"`
+	Remark      string    `json:"remark"`
+	CreatedAt   time.Time `json:"created_at"`
+}
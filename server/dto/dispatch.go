@@ -0,0 +1,58 @@
+package dto
+
+import "time"
+
+type CreateDispatchRequest struct {
+	VehicleID        uint      `json:"vehicle_id" binding:"required"`
+	OrderIDs         []uint    `json:"order_ids" binding:"required,min=1,dive,required"`
+	DriverName       string    `json:"driver_name" binding:"required,max=50"`
+	DriverPhone      string    `json:"driver_phone" binding:"max=20"`
+	PlannedDeparture time.Time `json:"planned_departure" binding:"required"`
+	Remark           string    `json:"remark" binding:"max=255"`
+}
+
+// LoadingPlanRequest 预览车辆的装车方案
+type LoadingPlanRequest struct {
+	VehicleID uint   `json:"vehicle_id" binding:"required"`
+	OrderIDs  []uint `json:"order_ids" binding:"required,min=1,dive,required"`
+}
+
+type DispatchModuleDTO struct {
+	ModuleID      uint    `json:"module_id"`
+	DeviceID      string  `json:"device_id"`
+	OrderID       uint    `json:"order_id"`
+	LoadSequence  int     `json:"load_sequence"`  // 装车顺序，1 在货厢最里侧
+	DeliveryIndex int     `json:"delivery_index"` // 送达顺序
+	Weight        float64 `json:"weight"`         // 含冷链箱自重，千克
+}
+
+type LoadingPlanDTO struct {
+	VehicleID   uint                `json:"vehicle_id"`
+	PlateNumber string              `json:"plate_number"`
+	MaxCapacity int                 `json:"max_capacity"`
+	CargoVolume float64             `json:"cargo_volume"`
+	MaxPayload  float64             `json:"max_payload"`
+	ModuleCount int                 `json:"module_count"`
+	LoadWeight  float64             `json:"load_weight"`
+	LoadVolume  float64             `json:"load_volume"`
+	Modules     []DispatchModuleDTO `json:"modules"`
+}
+
+type DispatchDTO struct {
+	ID               uint                `json:"id"`
+	VehicleID        uint                `json:"vehicle_id"`
+	PlateNumber      string              `json:"plate_number"`
+	DriverName       string              `json:"driver_name"`
+	DriverPhone      string              `json:"driver_phone"`
+	PlannedDeparture time.Time           `json:"planned_departure"`
+	DepartedAt       *time.Time          `json:"departed_at"`
+	CompletedAt      *time.Time          `json:"completed_at"`
+	Status           string              `json:"status"`
+	ModuleCount      int                 `json:"module_count"`
+	LoadWeight       float64             `json:"load_weight"`
+	LoadVolume       float64             `json:"load_volume"`
+	OrderIDs         []uint              `json:"order_ids"`
+	Modules          []DispatchModuleDTO `json:"modules,omitempty"`
+	Remark           string              `json:"remark"`
+	CreatedAt        time.Time           `json:"created_at"`
+}
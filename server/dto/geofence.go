@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+// CreateGeofenceRequest 多边形围栏填写 polygon，圆形围栏填写圆心和 radius_km；
+// 仓库围栏未填写圆心时取仓库坐标
+type CreateGeofenceRequest struct {
+	Name      string       `json:"name" binding:"required,max=100"`
+	Kind      string       `json:"kind" binding:"required,oneof=depot customer forbidden"`
+	Longitude float64      `json:"longitude" binding:"min=-180,max=180"`
+	Latitude  float64      `json:"latitude" binding:"min=-90,max=90"`
+	RadiusKm  float64      `json:"radius_km" binding:"min=0"`
+	Polygon   [][2]float64 `json:"polygon"`
+	DepotID   *uint        `json:"depot_id"`
+}
+
+type UpdateGeofenceRequest struct {
+	Name      *string       `json:"name" binding:"omitempty,max=100"`
+	Longitude *float64      `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	Latitude  *float64      `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	RadiusKm  *float64      `json:"radius_km" binding:"omitempty,min=0"`
+	Polygon   *[][2]float64 `json:"polygon"` // 传空数组改为圆形围栏
+	Enabled   *bool         `json:"enabled"`
+}
+
+type GeofenceDTO struct {
+	ID        uint         `json:"id"`
+	Name      string       `json:"name"`
+	Kind      string       `json:"kind"`
+	Longitude float64      `json:"longitude"`
+	Latitude  float64      `json:"latitude"`
+	RadiusKm  float64      `json:"radius_km"`
+	Polygon   [][2]float64 `json:"polygon"`
+	DepotID   *uint        `json:"depot_id"`
+	Enabled   bool         `json:"enabled"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RouteAlertDTO struct {
+	ID          uint      `json:"id"`
+	RoutePlanID uint      `json:"route_plan_id"`
+	VehicleID   uint      `json:"vehicle_id"`
+	Kind        string    `json:"kind"`
+	GeofenceID  *uint     `json:"geofence_id"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Longitude   float64   `json:"longitude"`
+	Latitude    float64   `json:"latitude"`
+	Detail      string    `json:"detail"`
+	Status      string    `json:"status"`
+}
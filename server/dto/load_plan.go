@@ -0,0 +1,36 @@
+package dto
+
+// LoadPlanRequest 下单前按商品规格预览装箱规划
+type LoadPlanRequest struct {
+	OrderItems []OrderItem `json:"order_items" binding:"required,min=1,dive"`
+}
+
+type LoadItemDTO struct {
+	// 订单项ID，预览时为0，按 index 对应请求中的订单项
+	OrderItemID uint    `json:"order_item_id"`
+	Index       int     `json:"index"`
+	ProductName string  `json:"product_name"`
+	Quantity    int     `json:"quantity"`
+	Weight      float64 `json:"weight"`
+	Volume      float64 `json:"volume"`
+}
+
+type PackedModuleDTO struct {
+	MinTemperature float64       `json:"min_temperature"`
+	MaxTemperature float64       `json:"max_temperature"`
+	Weight         float64       `json:"weight"`
+	Volume         float64       `json:"volume"`
+	VolumeRatio    float64       `json:"volume_ratio"`  // 容积利用率
+	PayloadRatio   float64       `json:"payload_ratio"` // 载重利用率
+	Items          []LoadItemDTO `json:"items"`
+}
+
+type LoadPlanDTO struct {
+	// 规划使用的冷链箱规格，立方米和千克
+	InnerVolume float64           `json:"inner_volume"`
+	MaxPayload  float64           `json:"max_payload"`
+	ModuleCount int               `json:"module_count"`
+	Weight      float64           `json:"weight"`
+	Volume      float64           `json:"volume"`
+	Modules     []PackedModuleDTO `json:"modules"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+type ReturnModulesRequest struct {
+	ModuleIDs []uint `json:"module_ids" binding:"required,min=1"`
+	DepotID   uint   `json:"depot_id"` // 归还的仓库，不填时归属原仓库
+}
+
+// InspectModuleRequest 清洁检查结果，checklist 需包含全部检查项：
+// cleaned 清洁消毒，sealed 箱体密封完好，sensor_ok 温度传感器正常，charged 电池已充电
+type InspectModuleRequest struct {
+	Checklist  map[string]bool `json:"checklist" binding:"required"`
+	DamageNote string          `json:"damage_note" binding:"max=255"` // 有损坏时填写，模块会被标记为故障
+}
+
+type ModuleAssignmentDTO struct {
+	ID           uint            `json:"id"`
+	OrderID      uint            `json:"order_id"`
+	OrderItemID  uint            `json:"order_item_id"`
+	AssignedAt   time.Time       `json:"assigned_at"`
+	DispatchedAt *time.Time      `json:"dispatched_at"`
+	ReturnedAt   *time.Time      `json:"returned_at"`
+	ReturnDepot  string          `json:"return_depot"`
+	ReleasedAt   *time.Time      `json:"released_at"`
+	Checklist    map[string]bool `json:"checklist"`
+	Damaged      bool            `json:"damaged"`
+	DamageNote   string          `json:"damage_note"`
+	InspectorID  uint            `json:"inspector_id"`
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type OrderDTO struct {
 	ID           uint           `json:"id"`
 	OrderNumber  string         `json:"order_number"`
@@ -11,6 +13,79 @@ type OrderDTO struct {
 	OrderNote    string         `json:"order_note"`
 	User         UserDTO        `json:"user"`
 	OrderItems   []OrderItemDTO `json:"order_items"`
+	RentalDays   int            `json:"rental_days"`
+	Deposit      float64        `json:"deposit"`
+	// 下单时的分项报价，引入计价之前的订单为空
+	Quote *QuoteDTO `json:"quote,omitempty"`
+	// 预计送达时间，订单还没有安排路线时为空
+	ETA *OrderETADTO `json:"eta,omitempty"`
+}
+
+type QuoteLineDTO struct {
+	Kind        string  `json:"kind"` // service 商品服务费，rental 租金，distance 配送费，urgent 加急费，deposit 押金
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+	ItemIndex   *int    `json:"item_index,omitempty"` // 商品服务费对应的订单项下标
+}
+
+type QuoteDTO struct {
+	Lines         []QuoteLineDTO `json:"lines"`
+	Subtotal      float64        `json:"subtotal"` // 不含押金
+	Deposit       float64        `json:"deposit"`
+	Total         float64        `json:"total"` // 应付金额，含押金
+	ModuleCount   int            `json:"module_count"`
+	RentalDays    int            `json:"rental_days"`
+	DistanceKm    float64        `json:"distance_km"`
+	DistanceKnown bool           `json:"distance_known"`
+	Urgent        bool           `json:"urgent"`
+	QuotedAt      time.Time      `json:"quoted_at"`
+}
+
+// QuoteResponse 下单前的报价和可行性评估，不保存订单
+type QuoteResponse struct {
+	Quote        QuoteDTO                `json:"quote"`
+	ModuleCount  int                     `json:"module_count"`
+	Availability []ModuleAvailabilityDTO `json:"availability"` // 按装箱规划分组的冷链箱可用情况
+	Delivery     DeliveryFeasibilityDTO  `json:"delivery"`
+	// 冷链箱充足且能在送货时间窗内送达
+	Feasible bool `json:"feasible"`
+}
+
+type ModuleAvailabilityDTO struct {
+	ProductName    string  `json:"product_name"`
+	MinTemperature float64 `json:"min_temperature"`
+	MaxTemperature float64 `json:"max_temperature"`
+	MinVolume      float64 `json:"min_volume"`
+	MinPayload     float64 `json:"min_payload"`
+	MinBattery     float64 `json:"min_battery"`
+	Needed         int     `json:"needed"`
+	Available      int     `json:"available"` // 现在空闲的
+	Returning      int     `json:"returning"` // 送达日前预计归还的
+	Sufficient     bool    `json:"sufficient"`
+}
+
+type DeliveryFeasibilityDTO struct {
+	Feasible        bool      `json:"feasible"`
+	DistanceKnown   bool      `json:"distance_known"`
+	EarliestArrival time.Time `json:"earliest_arrival"`
+	WindowOpen      time.Time `json:"window_open"`
+	WindowClose     time.Time `json:"window_close"`
+	Reason          string    `json:"reason,omitempty"`
+}
+
+type OrderETADTO struct {
+	RoutePlanID uint      `json:"route_plan_id"`
+	PlateNumber string    `json:"plate_number"`
+	ETA         time.Time `json:"eta"`
+	Deadline    time.Time `json:"deadline"`
+	Delivered   bool      `json:"delivered"`
+	LateRisk    bool      `json:"late_risk"`
+	LateMinutes float64   `json:"late_minutes"`
+	StopsAhead  int       `json:"stops_ahead"`
+	Source      string    `json:"source"`
+	ComputedAt  time.Time `json:"computed_at"`
 }
 
 type UserDTO struct {
@@ -43,6 +118,7 @@ const (
 	StatusAssigned   ModuleStatus = "assigned"   // 设备分配
 	StatusUnassigned ModuleStatus = "unassigned" // 设备未分配
 	StatusFaulty     ModuleStatus = "faulty"     // 设备故障
+	StatusReturned   ModuleStatus = "returned"   // 已归还仓库，待清洁检查
 )
 
 type ModuleInfoDTO struct {
@@ -53,6 +129,24 @@ type ModuleInfoDTO struct {
 	MinTemperature     float64      `json:"min_temperature"`
 	Status             ModuleStatus `json:"status"`
 	IsEnabled          bool         `json:"is_enabled"`
+
+	SupportedMinTemperature float64 `json:"supported_min_temperature"`
+	SupportedMaxTemperature float64 `json:"supported_max_temperature"`
+	BatteryLevel            float64 `json:"battery_level"`
+	Longitude               float64 `json:"longitude"`
+	Latitude                float64 `json:"latitude"`
+	DepotID                 *uint   `json:"depot_id"`
+	InnerVolume             float64 `json:"inner_volume"`
+	MaxPayload              float64 `json:"max_payload"`
+}
+
+// ModuleAllocationDTO 审核时选中的冷链箱及选择理由
+type ModuleAllocationDTO struct {
+	ModuleID    uint    `json:"module_id"`
+	DeviceID    string  `json:"device_id"`
+	OrderItemID uint    `json:"order_item_id"`
+	DistanceKm  float64 `json:"distance_km"` // 距寄件地的距离，位置未知时为-1
+	Reason      string  `json:"reason"`
 }
 
 type CreateOrderRequest struct {
@@ -62,6 +156,7 @@ type CreateOrderRequest struct {
 	DeliveryDate string                 `json:"delivery_date" binding:"required"`
 	OrderNote    string                 `json:"order_note"`
 	OrderItems   []OrderItem            `json:"order_items" binding:"required"`
+	RentalDays   int                    `json:"rental_days" binding:"omitempty,min=1,max=365"` // 租期天数，不填时为1天
 }
 
 type OrderItem struct {
@@ -83,16 +178,39 @@ type UpdateOrderRequest struct {
 	OrderNumber  *string  `json:"order_number" binding:"required"`
 	TotalPrice   *float64 `json:"total_price" binding:"required"`
 	DeliveryDate *string  `json:"delivery_date" binding:"required"`
-	StatusID     *uint    `json:"status_id" binding:"required"`
+	StatusID     *uint    `json:"status_id"` // 状态只能通过状态流转接口修改，这里只允许传入当前状态
 	SenderInfo   *string  `json:"sender_info" binding:"required"`
 	ReceiverInfo *string  `json:"receiver_info" binding:"required"`
 	OrderNote    *string  `json:"order_note"`
 }
 
 type AddModuleRequest struct {
-	DeviceID string `json:"device_id" binding:"required"`
+	DeviceID                string   `json:"device_id" binding:"required"`
+	SupportedMinTemperature *float64 `json:"supported_min_temperature"`
+	SupportedMaxTemperature *float64 `json:"supported_max_temperature"`
+	Longitude               float64  `json:"longitude"`
+	Latitude                float64  `json:"latitude"`
+	DepotID                 *uint    `json:"depot_id"`
+	// 容量规格，不填时取标准规格
+	InnerVolume *float64 `json:"inner_volume" binding:"omitempty,gt=0"`
+	MaxPayload  *float64 `json:"max_payload" binding:"omitempty,gt=0"`
 }
 
 type PayOrderRequest struct {
 	OrderID uint `json:"order_id" binding:"required"`
 }
+
+type OrderTransitionRequest struct {
+	Event  string `json:"event" binding:"required"`
+	Remark string `json:"remark" binding:"max=255"`
+}
+
+type OrderStatusTransitionDTO struct {
+	Event      string `json:"event"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	ActorID    uint   `json:"actor_id"`
+	ActorRole  string `json:"actor_role"`
+	Remark     string `json:"remark"`
+	CreatedAt  string `json:"created_at"`
+}
@@ -0,0 +1,53 @@
+package dto
+
+import "time"
+
+type CheckInStopRequest struct {
+	StopID    uint       `json:"stop_id" binding:"required"`
+	ArrivedAt *time.Time `json:"arrived_at"` // 为空时取当前时间
+}
+
+type RouteStopDTO struct {
+	ID             uint       `json:"id"`
+	Sequence       int        `json:"sequence"`
+	NodeType       int        `json:"node_type"`
+	OrderID        *uint      `json:"order_id"`
+	Longitude      float64    `json:"longitude"`
+	Latitude       float64    `json:"latitude"`
+	LegDistanceKm  float64    `json:"leg_distance_km"`
+	PlannedArrival time.Time  `json:"planned_arrival"`
+	Deadline       *time.Time `json:"deadline"`
+	ActualArrival  *time.Time `json:"actual_arrival"`
+	ArrivalSource  string     `json:"arrival_source"`
+	// 实际比计划晚的分钟数，提前为负，未到达时为空
+	DeviationMinutes *float64 `json:"deviation_minutes"`
+	// 实际到达晚于最晚送达时间
+	Late bool `json:"late"`
+}
+
+type RoutePlanDTO struct {
+	ID           uint           `json:"id"`
+	VehicleID    uint           `json:"vehicle_id"`
+	PlateNumber  string         `json:"plate_number"`
+	DepotID      *uint          `json:"depot_id"`
+	Status       string         `json:"status"`
+	DistanceKm   float64        `json:"distance_km"`
+	PlannedStart time.Time      `json:"planned_start"`
+	PlannedEnd   time.Time      `json:"planned_end"`
+	StartedAt    *time.Time     `json:"started_at"`
+	CompletedAt  *time.Time     `json:"completed_at"`
+	ReplacesID   *uint          `json:"replaces_id"`
+	RerouteNote  string         `json:"reroute_note"`
+	ArrivedStops int            `json:"arrived_stops"`
+	Stops        []RouteStopDTO `json:"stops"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type RerouteRequest struct {
+	Strategy string `json:"strategy" binding:"required,oneof=swap priority"`
+	// 故障冷链箱，为空时按冷链箱状态和分析器告警判断
+	ModuleIDs []uint `json:"module_ids"`
+	// 车辆当前位置，为空时取最近的车辆定位
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+}
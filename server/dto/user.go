@@ -43,6 +43,14 @@ type LoginResponse struct {
 	Role   string `json:"role"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"` // 同时吊销刷新token，可以为空
+}
+
 type CaptchaResponse struct {
 	Id  string `json:"id"`
 	Img string `json:"img"`
@@ -6,18 +6,30 @@ type VehicleResponse struct {
 	Status      string `json:"status"`
 	MaxCapacity int    `json:"MaxCapacity"`
 	ImgUrl      string `json:"imgUrl"`
+	DepotID     *uint  `json:"depotId"`
+	DriverID    *uint  `json:"driverId"`
+	// 货厢容积（立方米）和额定载重（千克），为0时不限制
+	CargoVolume float64 `json:"cargoVolume"`
+	MaxPayload  float64 `json:"maxPayload"`
 }
 
 type CreateVehicleRequest struct {
-	PlateNumber string `json:"plateNumber" binding:"required"`
-	Status      string `json:"status" binding:"required,oneof=空闲 使用中 维修中 停用"`
-	MaxCapacity int    `json:"MaxCapacity" binding:"required,min=1"`
-	ImgUrl      string `json:"imgUrl" binding:"omitempty,url"`
+	PlateNumber string  `json:"plateNumber" binding:"required"`
+	Status      string  `json:"status" binding:"required,oneof=空闲 使用中 维修中 停用"`
+	MaxCapacity int     `json:"MaxCapacity" binding:"required,min=1"`
+	ImgUrl      string  `json:"imgUrl" binding:"omitempty,url"`
+	DepotID     *uint   `json:"depotId"`
+	DriverID    *uint   `json:"driverId"`
+	CargoVolume float64 `json:"cargoVolume" binding:"gte=0"`
+	MaxPayload  float64 `json:"maxPayload" binding:"gte=0"`
 }
 
 type UpdateVehicleRequest struct {
-	PlateNumber *string `json:"plateNumber"`
-	Status      *string `json:"status" binding:"omitempty,oneof=空闲 使用中 维修中 停用"`
-	MaxCapacity *int    `json:"MaxCapacity" binding:"omitempty,min=1"`
-	ImgUrl      *string `json:"imgUrl" binding:"omitempty,url"`
+	PlateNumber *string  `json:"plateNumber"`
+	Status      *string  `json:"status" binding:"omitempty,oneof=空闲 使用中 维修中 停用"`
+	MaxCapacity *int     `json:"MaxCapacity" binding:"omitempty,min=1"`
+	ImgUrl      *string  `json:"imgUrl" binding:"omitempty,url"`
+	DriverID    *uint    `json:"driverId"` // 为0时解除司机绑定
+	CargoVolume *float64 `json:"cargoVolume" binding:"omitempty,gte=0"`
+	MaxPayload  *float64 `json:"maxPayload" binding:"omitempty,gte=0"`
 }
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"coldchain/common/clickhouse"
+	"coldchain/common/jwt"
 	"coldchain/common/mysql"
+	"coldchain/common/redis"
 	"coldchain/server/router"
+	"coldchain/server/services"
 )
 
 func main() {
 	importConfig()
 	mysql.InitDB()
+	redis.InitDB()
+	clickhouse.InitDB()
+	jwt.Init()
+	services.ImportConfig()
+
+	// 定期检查执行中路线的偏离和围栏告警
+	services.NewRouteMonitor(mysql.Db, clickhouse.GetInstance()).Start(services.ROUTE_MONITOR_INTERVAL)
 
 	// 启动路由
 	r := router.Router()
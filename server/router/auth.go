@@ -0,0 +1,160 @@
+package router
+
+import (
+	"coldchain/common/jwt"
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/controllers"
+	"coldchain/server/dao"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMiddleware 校验 Bearer token 及吊销列表，并将用户ID和角色写入上下文
+func AuthMiddleware(revoker *jwt.Revoker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticate(c, revoker) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "身份认证失败"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware 带有 token 时校验并写入上下文，没有 token 时匿名访问
+func OptionalAuthMiddleware(revoker *jwt.Revoker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" && !authenticate(c, revoker) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "身份认证失败"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticate(c *gin.Context, revoker *jwt.Revoker) bool {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return false
+	}
+	claims, err := jwt.ParseClaims(token)
+	if err != nil {
+		return false
+	}
+	// 刷新token不能用于访问接口，旧版本签发的token没有类型
+	if claims.TokenType != jwt.TokenTypeAccess && claims.TokenType != "" {
+		return false
+	}
+	revoked, err := revoker.IsRevoked(c, claims)
+	if err != nil {
+		logger.Errorf("校验token吊销状态失败: %v", err)
+		return false
+	}
+	if revoked {
+		return false
+	}
+	c.Set(controllers.CtxUserID, uint(claims.Id))
+	c.Set(controllers.CtxRoleName, claims.RoleName)
+	c.Set(controllers.CtxClaims, claims)
+	return true
+}
+
+func hasRole(role string, roles []string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRoles 只允许指定角色访问
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, role, ok := controllers.CurrentUser(c)
+		if !ok || !hasRole(role, roles) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SelfOrRoles 允许指定角色访问，或路径参数 param 为当前用户ID时访问
+func SelfOrRoles(param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, role, ok := controllers.CurrentUser(c)
+		if ok && !hasRole(role, roles) {
+			id, err := strconv.ParseUint(c.Param(param), 10, 64)
+			ok = err == nil && uint(id) == userID
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// VehicleDriverOrRoles 允许指定角色访问，或当前用户是车辆绑定的司机时访问
+func VehicleDriverOrRoles(vehicleRepo *dao.VehicleRepository, param string, roles ...string) gin.HandlerFunc {
+	return driverOrRoles(vehicleRepo.GetVehicleDriverID, "车辆", param, roles)
+}
+
+// RoutePlanDriverOrRoles 允许指定角色访问，或当前用户是路线计划所用车辆绑定的司机时访问
+func RoutePlanDriverOrRoles(routeRepo *dao.RoutePlanRepository, param string, roles ...string) gin.HandlerFunc {
+	return driverOrRoles(routeRepo.GetRoutePlanDriverID, "路线计划", param, roles)
+}
+
+// driverOrRoles 按路径参数 param 通过 driverOf 查找绑定的司机，subject 用于错误信息
+func driverOrRoles(driverOf func(id uint) (*uint, error), subject, param string, roles []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, role, ok := controllers.CurrentUser(c)
+		if ok && !hasRole(role, roles) {
+			id, err := strconv.ParseUint(c.Param(param), 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的" + subject + "ID"})
+				return
+			}
+			driverID, err := driverOf(uint(id))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": subject + "不存在"})
+				return
+			}
+			ok = role == models.RoleDriver && driverID != nil && *driverID == userID
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OrderOwnerOrRoles 允许指定角色访问，或订单属于当前用户时访问
+func OrderOwnerOrRoles(orderRepo *dao.OrderRepository, param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, role, ok := controllers.CurrentUser(c)
+		if ok && !hasRole(role, roles) {
+			orderID, err := strconv.ParseUint(c.Param(param), 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+				return
+			}
+			ownerID, err := orderRepo.GetOrderOwnerID(uint(orderID))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+				return
+			}
+			ok = ownerID == userID
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "拒绝访问"})
+			return
+		}
+		c.Next()
+	}
+}
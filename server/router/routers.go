@@ -1,9 +1,14 @@
 package router
 
 import (
+	"coldchain/common/clickhouse"
+	"coldchain/common/jwt"
 	"coldchain/common/logger"
 	"coldchain/common/mysql"
+	"coldchain/common/mysql/models"
+	"coldchain/common/redis"
 	"coldchain/server/controllers"
+	"coldchain/server/dao"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,62 +37,157 @@ func Router() *gin.Engine {
 	r.Use(logger.Recover)
 	r.Use(CorsMiddleware())
 
+	// 管理员与客户
+	staff := []string{models.RoleAdmin, models.RoleManager}
+	revoker := jwt.NewRevoker(redis.GetInstance())
+	auth := AuthMiddleware(revoker)
+
 	// 初始化控制器
-	userCtrl := controllers.NewUserController(mysql.Db)
+	userCtrl := controllers.NewUserController(mysql.Db, revoker)
 
 	// 用户路由组
 	userGroup := r.Group("/api/user")
 	{
-		userGroup.GET("/list", userCtrl.GetUsers)
-		userGroup.POST("/add", userCtrl.CreateUser)
-		userGroup.GET("/:id", userCtrl.GetUserByID)
-		userGroup.PUT("/update/:id", userCtrl.UpdateUser)
-		userGroup.DELETE("/delete/:id", userCtrl.DeleteUser)
 		userGroup.POST("/login", userCtrl.Login)
 		userGroup.GET("/captcha", userCtrl.CaptchaGenerate)
+		// 注册无需登录，创建管理员账号由控制器校验
+		userGroup.POST("/refresh", userCtrl.RefreshToken)
+		userGroup.POST("/logout", auth, userCtrl.Logout)
+		userGroup.POST("/add", OptionalAuthMiddleware(revoker), userCtrl.CreateUser)
+
+		userGroup.GET("/list", auth, RequireRoles(staff...), userCtrl.GetUsers)
+		userGroup.GET("/:id", auth, SelfOrRoles("id", staff...), userCtrl.GetUserByID)
+		userGroup.PUT("/update/:id", auth, SelfOrRoles("id", models.RoleAdmin), userCtrl.UpdateUser)
+		userGroup.DELETE("/delete/:id", auth, RequireRoles(models.RoleAdmin), userCtrl.DeleteUser)
 	}
 
 	// 初始化车辆控制器
 	vehicleCtrl := controllers.NewVehicleController(mysql.Db)
 
 	// 车辆路由组
-	vehicleGroup := r.Group("/api/resource/vehicle")
+	vehicleGroup := r.Group("/api/resource/vehicle", auth, RequireRoles(staff...))
 	{
 		vehicleGroup.GET("/list", vehicleCtrl.GetVehicleList)
 		vehicleGroup.POST("/add", vehicleCtrl.AddVehicle)
 		vehicleGroup.PUT("/update/:id", vehicleCtrl.UpdateVehicle)
 		vehicleGroup.DELETE("/delete/:id", vehicleCtrl.DeleteVehicle)
 	}
+	// 订单、冷链箱归还和车辆调度共用一个订单状态机
+	fsm := controllers.NewOrderStateMachine()
+
 	// 初始化订单控制器
-	orderCtrl := controllers.NewOrderController(mysql.Db)
+	orderCtrl := controllers.NewOrderController(mysql.Db, fsm, redis.GetInstance(), clickhouse.GetInstance())
+	orderOwner := OrderOwnerOrRoles(dao.NewOrderRepository(mysql.Db), "id", staff...)
 	// 订单路由组
-	orderGroup := r.Group("/api/orders")
+	orderGroup := r.Group("/api/orders", auth)
 	{
-		orderGroup.GET("/:id", orderCtrl.GetOrderDetail)
-		orderGroup.GET("/list", orderCtrl.ListOrders)
-		orderGroup.GET("/list/:id", orderCtrl.ListOrdersByUserID)
+		orderGroup.GET("/:id", orderOwner, orderCtrl.GetOrderDetail)
+		orderGroup.GET("/list", RequireRoles(staff...), orderCtrl.ListOrders)
+		orderGroup.GET("/list/:id", SelfOrRoles("id", staff...), orderCtrl.ListOrdersByUserID)
 		orderGroup.POST("/create", orderCtrl.CreateOrder)
-		orderGroup.PUT("/update/:id", orderCtrl.UpdateOrder)
-		orderGroup.POST("/accept/:id", orderCtrl.AcceptOrder)
-		orderGroup.POST("/reject/:id", orderCtrl.RejectOrder)
-		orderGroup.POST("/pay/:id", orderCtrl.PayOrder)
+		orderGroup.POST("/quote", orderCtrl.QuoteOrder)
+		orderGroup.PUT("/update/:id", orderOwner, orderCtrl.UpdateOrder)
+		orderGroup.POST("/accept/:id", RequireRoles(staff...), orderCtrl.AcceptOrder)
+		orderGroup.POST("/reject/:id", RequireRoles(staff...), orderCtrl.RejectOrder)
+		orderGroup.POST("/pay/:id", orderOwner, orderCtrl.PayOrder)
+		orderGroup.POST("/transition/:id", orderOwner, orderCtrl.TransitionOrder)
+		orderGroup.GET("/history/:id", orderOwner, orderCtrl.GetOrderHistory)
+		orderGroup.POST("/load/preview", orderCtrl.PreviewLoadPlan)
+		orderGroup.GET("/load/:id", orderOwner, orderCtrl.GetOrderLoadPlan)
+	}
+
+	// 订单监控数据按冷链箱分配时间段从 ClickHouse 查询
+	telemetryCtrl := controllers.NewTelemetryController(mysql.Db, clickhouse.GetInstance())
+	{
+		orderGroup.GET("/telemetry/:id", orderOwner, telemetryCtrl.GetOrderTelemetry)
+		orderGroup.GET("/alarms/:id", orderOwner, telemetryCtrl.GetOrderAlarms)
+		orderGroup.GET("/compliance/:id", orderOwner, telemetryCtrl.GetOrderCompliance)
 	}
 
-	moduleCtrl := controllers.NewModuleController(mysql.Db)
+	moduleCtrl := controllers.NewModuleController(mysql.Db, fsm)
 	// 模块路由组
-	moduleGroup := r.Group("/api/module")
+	moduleGroup := r.Group("/api/module", auth, RequireRoles(staff...))
 
 	{
 		moduleGroup.POST("/create", moduleCtrl.AddModule)
 		moduleGroup.GET("/list", moduleCtrl.ListModules)
+		moduleGroup.POST("/return", moduleCtrl.ReturnModules)
+		moduleGroup.POST("/inspect/:id", moduleCtrl.InspectModule)
+		moduleGroup.GET("/history/:id", moduleCtrl.GetModuleHistory)
+	}
+
+	depotCtrl := controllers.NewDepotController(mysql.Db)
+	// 仓库路由组
+	depotGroup := r.Group("/api/depot", auth, RequireRoles(staff...))
+	{
+		depotGroup.POST("/create", depotCtrl.CreateDepot)
+		depotGroup.GET("/list", depotCtrl.ListDepots)
+		depotGroup.PUT("/update/:id", depotCtrl.UpdateDepot)
+		depotGroup.POST("/transfer", depotCtrl.Transfer)
+		depotGroup.GET("/transfers", depotCtrl.ListTransfers)
+	}
+
+	geofenceCtrl := controllers.NewGeofenceController(mysql.Db)
+	// 地理围栏路由组
+	geofenceGroup := r.Group("/api/geofence", auth, RequireRoles(staff...))
+	{
+		geofenceGroup.POST("/create", geofenceCtrl.CreateGeofence)
+		geofenceGroup.GET("/list", geofenceCtrl.ListGeofences)
+		geofenceGroup.PUT("/update/:id", geofenceCtrl.UpdateGeofence)
+		geofenceGroup.DELETE("/delete/:id", geofenceCtrl.DeleteGeofence)
+	}
+
+	dispatchCtrl := controllers.NewDispatchController(mysql.Db, fsm)
+	// 车辆调度路由组
+	dispatchGroup := r.Group("/api/dispatch", auth, RequireRoles(staff...))
+	{
+		dispatchGroup.POST("/create", dispatchCtrl.CreateDispatch)
+		dispatchGroup.POST("/loading", dispatchCtrl.PlanLoading)
+		dispatchGroup.POST("/depart/:id", dispatchCtrl.DepartDispatch)
+		dispatchGroup.POST("/complete/:id", dispatchCtrl.CompleteDispatch)
+		dispatchGroup.GET("/list", dispatchCtrl.ListDispatches)
+		dispatchGroup.GET("/:id", dispatchCtrl.GetDispatch)
+	}
+
+	routeCtrl := controllers.NewRoutePlanningController(mysql.Db, redis.GetInstance())
+	// 路径规划路由组
+	routeGroup := r.Group("/api/routes", auth)
+	{
+		routeGroup.GET("/all", RequireRoles(staff...), routeCtrl.GetAllRoutes)
+		routeGroup.GET("/user/:id", SelfOrRoles("id", staff...), routeCtrl.GetUserRoutes)
+		routeGroup.POST("/plans", RequireRoles(staff...), routeCtrl.SaveRoutes)
+	}
+
+	// 已保存路线的执行跟踪，车辆轨迹从 ClickHouse 查询
+	routeExecCtrl := controllers.NewRouteExecutionController(mysql.Db, clickhouse.GetInstance(), redis.GetInstance())
+	routePlanGroup := r.Group("/api/routes/plans", auth)
+	{
+		routePlanGroup.GET("", RequireRoles(staff...), routeExecCtrl.ListRoutePlans)
+		routePlanGroup.GET("/:id", RequireRoles(staff...), routeExecCtrl.GetRoutePlan)
+		routePlanGroup.POST("/:id/start", RequireRoles(staff...), routeExecCtrl.StartRoutePlan)
+		// 司机可以在自己驾驶车辆的路线上签到
+		routePlanGroup.POST("/:id/checkin", RoutePlanDriverOrRoles(dao.NewRoutePlanRepository(mysql.Db), "id", staff...), routeExecCtrl.CheckInStop)
+		routePlanGroup.POST("/:id/sync", RequireRoles(staff...), routeExecCtrl.SyncRoutePlan)
+		routePlanGroup.GET("/:id/track", RequireRoles(staff...), routeExecCtrl.GetRouteTrack)
+		routePlanGroup.POST("/:id/reroute", RequireRoles(staff...), routeExecCtrl.ReroutePlan)
+		routePlanGroup.POST("/:id/check", RequireRoles(staff...), routeExecCtrl.CheckRoutePlan)
+	}
+	routeAlertGroup := r.Group("/api/routes/alerts", auth, RequireRoles(staff...))
+	{
+		routeAlertGroup.GET("/list", routeExecCtrl.ListRouteAlerts)
+		routeAlertGroup.POST("/read/:id", routeExecCtrl.ReadRouteAlert)
 	}
+	// 司机端获取车辆当前路线，并订阅路线变更推送；司机只能访问自己驾驶的车辆
+	vehicleDriver := VehicleDriverOrRoles(dao.NewVehicleRepository(mysql.Db), "id", staff...)
+	routeGroup.GET("/vehicle/:id", vehicleDriver, routeExecCtrl.GetVehicleRoute)
+	routeGroup.GET("/vehicle/:id/updates", vehicleDriver, routeExecCtrl.WatchVehicleRoute)
 
 	notificationGtrl := controllers.NewNotificationController(mysql.Db)
 
-	notificationGroup := r.Group("/api/notification")
+	notificationGroup := r.Group("/api/notification", auth)
 	{
-		notificationGroup.POST("/create", notificationGtrl.CreateNotification)
-		notificationGroup.GET("/:id", notificationGtrl.GetNotificationByUserID)
+		notificationGroup.POST("/create", RequireRoles(staff...), notificationGtrl.CreateNotification)
+		notificationGroup.GET("/:id", SelfOrRoles("id", staff...), notificationGtrl.GetNotificationByUserID)
 	}
 
 	return r
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientModules = errors.New("可用冷链箱数量不足")
+	ErrAllocationConflict  = errors.New("冷链箱已被其他订单占用，请稍后重试")
+)
+
+// MySQL 死锁和锁等待超时的错误码
+const (
+	mysqlErrDeadlock        = 1213
+	mysqlErrLockWaitTimeout = 1205
+)
+
+// InsufficientModulesError 订单项找不到足够的冷链箱，Detail 说明空闲模块不满足要求的原因
+type InsufficientModulesError struct {
+	ProductName string
+	Needed      int
+	Found       int
+	Detail      string
+}
+
+func (e *InsufficientModulesError) Error() string {
+	return fmt.Sprintf("%s需要%d个冷链箱，符合条件的只有%d个（%s）", e.ProductName, e.Needed, e.Found, e.Detail)
+}
+
+func (e *InsufficientModulesError) Is(target error) bool {
+	return target == ErrInsufficientModules
+}
+
+// moduleGroup 装箱规划中归属同一订单项、温区相同的冷链箱，一起查询和选取
+type moduleGroup struct {
+	index   int
+	modules []PackedModule
+}
+
+func groupPackedModules(plan *LoadPlan) []moduleGroup {
+	var groups []moduleGroup
+	for _, m := range plan.Modules {
+		index := m.Primary().Index
+		found := false
+		for k := range groups {
+			g := &groups[k]
+			if g.index == index && g.modules[0].MinTemperature == m.MinTemperature && g.modules[0].MaxTemperature == m.MaxTemperature {
+				g.modules = append(g.modules, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, moduleGroup{index: index, modules: []PackedModule{m}})
+		}
+	}
+	return groups
+}
+
+// AllocateModules 在事务 tx 中按装箱规划为订单分配冷链箱，返回选中的模块及理由
+//
+// PlanLoad 按商品重量、体积和温区算出所需的冷链箱及每箱的装载内容，每箱归属于箱内体积最大的订单项。
+// 候选模块需覆盖箱内温区、能装下箱内商品并有足够电量，不加锁读取，
+// 按 RankModules 排序后由 SelectModules 优先从距寄件地最近的仓库选取，只对选中的模块 SELECT ... FOR UPDATE 加锁并复查状态，
+// 已被其他事务分配时返回 ErrModuleConflict 由 RetryAllocation 重试，不会因并发审核误报数量不足。
+// 写入时再以 status = 'unassigned' 为条件更新，数据库不支持行锁时由条件更新保证同一模块不会被分配两次。
+func AllocateModules(tx *gorm.DB, order *models.RentalOrder, now time.Time) ([]ModuleMatch, error) {
+	moduleTxn := dao.NewModuleRepository(tx)
+	depots, err := dao.NewDepotRepository(tx).ListDepots()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := PlanLoad(order.OrderItems, StandardModuleSpec())
+	if err != nil {
+		return nil, err
+	}
+
+	var allocated []ModuleMatch
+	for _, group := range groupPackedModules(plan) {
+		orderItem := order.OrderItems[group.index]
+		req := RequirementFor(order, orderItem, now)
+		req.Depots = depots
+		req.MinTemperature = group.modules[0].MinTemperature
+		req.MaxTemperature = group.modules[0].MaxTemperature
+		for _, m := range group.modules {
+			req.MinVolume = math.Max(req.MinVolume, m.Volume)
+			req.MinPayload = math.Max(req.MinPayload, m.Weight)
+		}
+		candidates, err := moduleTxn.FindCandidateModules(req.ModuleFilter)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) < len(group.modules) {
+			unassigned, err := moduleTxn.ListUnassignedModules()
+			if err != nil {
+				return nil, err
+			}
+			return nil, &InsufficientModulesError{
+				ProductName: orderItem.Product.ProductName,
+				Needed:      len(group.modules),
+				Found:       len(candidates),
+				Detail:      ExplainShortage(unassigned, req),
+			}
+		}
+
+		matches := SelectModules(RankModules(candidates, req), req, len(group.modules))
+		ids := make([]uint, len(matches))
+		for i := range matches {
+			ids[i] = matches[i].Module.ID
+		}
+		locked, err := moduleTxn.LockModules(ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]models.Module, len(locked))
+		for _, m := range locked {
+			byID[m.ID] = m
+		}
+		modules := make([]models.Module, len(matches))
+		loads := make([]dao.ModuleLoad, len(matches))
+		for i := range matches {
+			modules[i] = byID[matches[i].Module.ID]
+			loads[i] = dao.ModuleLoad{
+				MinTemperature: group.modules[i].MinTemperature,
+				MaxTemperature: group.modules[i].MaxTemperature,
+				Contents:       group.modules[i].Contents(),
+			}
+		}
+		if err := moduleTxn.AssignModuleLoads(orderItem, modules, loads); err != nil {
+			return nil, err
+		}
+		for i := range matches {
+			matches[i].Module = modules[i]
+		}
+		allocated = append(allocated, matches...)
+	}
+	return allocated, nil
+}
+
+// isRetryable 并发分配时可以整体重试的错误：模块被抢占、死锁或锁等待超时
+func isRetryable(err error) bool {
+	if errors.Is(err, dao.ErrModuleConflict) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+	return false
+}
+
+// RetryAllocation 执行一次完整的分配事务，遇到并发冲突时重新执行
+// run 需要自行开启并回滚事务，重试用尽后返回 ErrAllocationConflict
+func RetryAllocation(run func() error) error {
+	var err error
+	for attempt := 0; attempt <= ALLOCATION_RETRIES; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(attempt) * ALLOCATION_BACKOFF
+			if ALLOCATION_BACKOFF > 0 {
+				backoff += time.Duration(rand.Int63n(int64(ALLOCATION_BACKOFF)))
+			}
+			time.Sleep(backoff)
+		}
+		err = run()
+		if !isRetryable(err) {
+			return err
+		}
+		logger.Warnf("冷链箱分配冲突，第 %d 次重试: %v", attempt+1, err)
+	}
+	return ErrAllocationConflict
+}
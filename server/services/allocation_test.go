@@ -0,0 +1,246 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 设置 COLDCHAIN_TEST_MYSQL_DSN 时使用 MySQL 测试行锁，否则使用临时的 SQLite 数据库
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	var db *gorm.DB
+	var err error
+	if dsn := os.Getenv("COLDCHAIN_TEST_MYSQL_DSN"); dsn != "" {
+		db, err = gorm.Open(mysql.Open(dsn), config)
+	} else {
+		// SQLite 不支持行锁，写事务通过 BEGIN IMMEDIATE 串行执行
+		path := filepath.Join(t.TempDir(), "allocation.db")
+		db, err = gorm.Open(sqlite.Open(path+"?_txlock=immediate&_busy_timeout=10000&_journal_mode=WAL"), config)
+	}
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	if db.Dialector.Name() == "sqlite" {
+		// enum 类型在 SQLite 中不可用，手动建表
+		err = db.Exec(`CREATE TABLE modules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at DATETIME, updated_at DATETIME, deleted_at DATETIME,
+			device_id TEXT UNIQUE,
+			setting_temperature REAL, max_temperature REAL, min_temperature REAL,
+			status TEXT, is_enabled NUMERIC DEFAULT 0, order_item_id INTEGER,
+			supported_min_temperature REAL DEFAULT -25, supported_max_temperature REAL DEFAULT 25,
+			battery_level REAL DEFAULT 100, longitude REAL, latitude REAL, depot_id INTEGER,
+			inner_volume REAL DEFAULT 0.1, max_payload REAL DEFAULT 50)`).Error
+	} else {
+		err = db.Migrator().DropTable(&models.Module{})
+		if err == nil {
+			err = db.AutoMigrate(&models.Module{})
+		}
+	}
+	if err == nil {
+		err = db.Migrator().DropTable(&models.ModuleAssignment{}, &models.Depot{})
+	}
+	if err == nil {
+		err = db.AutoMigrate(&models.ModuleAssignment{}, &models.Depot{})
+	}
+	if err != nil {
+		t.Fatalf("create modules table: %v", err)
+	}
+	return db
+}
+
+func seedModules(t *testing.T, db *gorm.DB, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		module := models.Module{
+			DeviceID:                fmt.Sprintf("DEV-%03d", i),
+			Status:                  models.StatusUnassigned,
+			SupportedMinTemperature: -25,
+			SupportedMaxTemperature: 25,
+			BatteryLevel:            100,
+		}
+		if err := db.Create(&module).Error; err != nil {
+			t.Fatalf("create module: %v", err)
+		}
+	}
+}
+
+func allocateWithRetry(db *gorm.DB, orderItem models.OrderItem) ([]models.Module, error) {
+	order := &models.RentalOrder{
+		DeliveryDate: time.Now(),
+		OrderItems:   []models.OrderItem{orderItem},
+	}
+	var assigned []models.Module
+	err := RetryAllocation(func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			matches, err := AllocateModules(tx, order, time.Now())
+			assigned = assigned[:0]
+			for _, match := range matches {
+				assigned = append(assigned, match.Module)
+			}
+			return err
+		})
+	})
+	return assigned, err
+}
+
+// setAllocationRetry 调整分配重试参数，测试结束后恢复
+func setAllocationRetry(t *testing.T, retries int, backoff time.Duration) {
+	t.Helper()
+	oldRetries, oldBackoff := ALLOCATION_RETRIES, ALLOCATION_BACKOFF
+	ALLOCATION_RETRIES, ALLOCATION_BACKOFF = retries, backoff
+	t.Cleanup(func() {
+		ALLOCATION_RETRIES, ALLOCATION_BACKOFF = oldRetries, oldBackoff
+	})
+}
+
+// 设置 COLDCHAIN_TEST_MYSQL_DSN 时测试行锁下的并发分配；
+// SQLite 的写事务串行执行，仍可验证条件更新和重试不会重复分配模块
+func TestConcurrentAllocationAssignsEachModuleOnce(t *testing.T) {
+	db := openTestDB(t)
+	const (
+		totalModules = 20
+		orders       = 16
+		perOrder     = 3
+	)
+	seedModules(t, db, totalModules)
+
+	// 并发审核都选中同一批模块，每轮只有一个能锁定成功，其余冲突后重试
+	setAllocationRetry(t, 2*orders, time.Millisecond)
+
+	type result struct {
+		itemID  uint
+		modules []models.Module
+		err     error
+	}
+	results := make(chan result, orders)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < orders; i++ {
+		wg.Add(1)
+		go func(itemID uint) {
+			defer wg.Done()
+			<-start
+			orderItem := models.OrderItem{ID: itemID, Quantity: perOrder}
+			modules, err := allocateWithRetry(db, orderItem)
+			results <- result{itemID: itemID, modules: modules, err: err}
+		}(uint(i + 1))
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	owner := make(map[uint]uint)
+	succeeded := 0
+	for r := range results {
+		if r.err != nil {
+			if !errors.Is(r.err, ErrInsufficientModules) {
+				t.Errorf("order item %d: unexpected error %v", r.itemID, r.err)
+			}
+			continue
+		}
+		succeeded++
+		if len(r.modules) != perOrder {
+			t.Errorf("order item %d: got %d modules, want %d", r.itemID, len(r.modules), perOrder)
+		}
+		for _, m := range r.modules {
+			if prev, ok := owner[m.ID]; ok {
+				t.Errorf("module %d assigned to both order item %d and %d", m.ID, prev, r.itemID)
+			}
+			owner[m.ID] = r.itemID
+		}
+	}
+	if want := totalModules / perOrder; succeeded != want {
+		t.Errorf("succeeded allocations = %d, want %d", succeeded, want)
+	}
+
+	// 数据库中的分配结果与各请求返回的一致
+	var modules []models.Module
+	if err := db.Where("status = ?", models.StatusAssigned).Find(&modules).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != len(owner) {
+		t.Errorf("assigned modules in db = %d, returned = %d", len(modules), len(owner))
+	}
+	for _, m := range modules {
+		if m.OrderItemID == nil || owner[m.ID] != *m.OrderItemID {
+			t.Errorf("module %d belongs to order item %v in db, returned to %d", m.ID, m.OrderItemID, owner[m.ID])
+		}
+	}
+}
+
+func TestAssignStaleModulesConflicts(t *testing.T) {
+	db := openTestDB(t)
+	seedModules(t, db, 4)
+	repo := dao.NewModuleRepository(db)
+
+	// 两个请求读到了同一批空闲模块
+	first, err := repo.FindCandidateModules(dao.ModuleFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first = first[:2]
+	stale := append([]models.Module(nil), first...)
+
+	if err := repo.AssignModulesToOrderItem(models.OrderItem{ID: 1}, first); err != nil {
+		t.Fatalf("first assignment: %v", err)
+	}
+	err = repo.AssignModulesToOrderItem(models.OrderItem{ID: 2}, stale)
+	if !errors.Is(err, dao.ErrModuleConflict) {
+		t.Fatalf("stale assignment error = %v, want ErrModuleConflict", err)
+	}
+	if !isRetryable(err) {
+		t.Fatal("module conflict should be retryable")
+	}
+
+	// 重试时重新读取，拿到剩余的模块
+	setAllocationRetry(t, 3, time.Millisecond)
+	modules, err := allocateWithRetry(db, models.OrderItem{ID: 2, Quantity: 2})
+	if err != nil {
+		t.Fatalf("retry allocation: %v", err)
+	}
+	for _, m := range modules {
+		if m.ID == first[0].ID || m.ID == first[1].ID {
+			t.Errorf("module %d allocated twice", m.ID)
+		}
+	}
+}
+
+func TestLockModulesRejectsAssignedModules(t *testing.T) {
+	db := openTestDB(t)
+	seedModules(t, db, 3)
+	repo := dao.NewModuleRepository(db)
+
+	candidates, err := repo.FindCandidateModules(dao.ModuleFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{candidates[0].ID, candidates[1].ID}
+	// 排序选取之后，其他请求抢先分配了其中一个
+	if err := repo.AssignModulesToOrderItem(models.OrderItem{ID: 1}, candidates[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := dao.NewModuleRepository(tx).LockModules(ids)
+		return err
+	})
+	if !errors.Is(err, dao.ErrModuleConflict) || !isRetryable(err) {
+		t.Fatalf("lock error = %v, want retryable ErrModuleConflict", err)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ModuleAvailability 装箱规划中一组冷链箱在送达日的可用情况，
+// Available 为现在空闲且电量足够的，Returning 为预计在送达日前租期结束归还的
+type ModuleAvailability struct {
+	ProductName    string  `json:"product_name"`
+	MinTemperature float64 `json:"min_temperature"`
+	MaxTemperature float64 `json:"max_temperature"`
+	MinVolume      float64 `json:"min_volume"`
+	MinPayload     float64 `json:"min_payload"`
+	MinBattery     float64 `json:"min_battery"`
+	Needed         int     `json:"needed"`
+	Available      int     `json:"available"`
+	Returning      int     `json:"returning"`
+	Sufficient     bool    `json:"sufficient"`
+}
+
+// DeliveryFeasibility 按配送里程估算能否在送达日的送货时间窗内送达。
+// 地址无法定位时 DistanceKnown 为 false，只检查时间窗是否已过
+type DeliveryFeasibility struct {
+	Feasible        bool      `json:"feasible"`
+	DistanceKnown   bool      `json:"distance_known"`
+	EarliestArrival time.Time `json:"earliest_arrival"`
+	WindowOpen      time.Time `json:"window_open"`
+	WindowClose     time.Time `json:"window_close"`
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// rentalEnd 订单租期结束的时间，租期从送达时起算
+func rentalEnd(deliveryDate time.Time, rentalDays int) time.Time {
+	return deliveryDate.AddDate(0, 0, max(rentalDays, 1))
+}
+
+// fitsModule 模块能否覆盖一组冷链箱的温区并装下其中最满的一箱
+func fitsModule(m models.Module, filter dao.ModuleFilter) bool {
+	return m.SupportedMinTemperature <= filter.MinTemperature && m.SupportedMaxTemperature >= filter.MaxTemperature &&
+		m.InnerVolume+loadEpsilon >= filter.MinVolume && m.MaxPayload+loadEpsilon >= filter.MinPayload
+}
+
+// CheckModuleAvailability 按装箱规划逐组统计可用的冷链箱，items 为规划输入的订单项。
+// 各组依次从 free 中选取温区余量最小的模块，不够时再从 returning 中选取，同一模块只计入一组；
+// free 需满足电量 battery，returning 归还后会重新充电，不检查电量
+func CheckModuleAvailability(plan *LoadPlan, items []models.OrderItem, free, returning []models.Module, battery float64) []ModuleAvailability {
+	taken := make(map[uint]bool)
+	pick := func(pool []models.Module, filter dao.ModuleFilter, needed int, checkBattery bool) int {
+		var fits []models.Module
+		for _, m := range pool {
+			if !taken[m.ID] && fitsModule(m, filter) && (!checkBattery || m.BatteryLevel >= filter.MinBattery) {
+				fits = append(fits, m)
+			}
+		}
+		req := ModuleRequirement{ModuleFilter: filter}
+		sort.SliceStable(fits, func(i, j int) bool {
+			return rangeSlack(fits[i], req) < rangeSlack(fits[j], req)
+		})
+		n := min(needed, len(fits))
+		for _, m := range fits[:n] {
+			taken[m.ID] = true
+		}
+		return n
+	}
+
+	var result []ModuleAvailability
+	for _, group := range groupPackedModules(plan) {
+		filter := dao.ModuleFilter{
+			MinTemperature: group.modules[0].MinTemperature,
+			MaxTemperature: group.modules[0].MaxTemperature,
+			MinBattery:     battery,
+		}
+		for _, m := range group.modules {
+			filter.MinVolume = math.Max(filter.MinVolume, m.Volume)
+			filter.MinPayload = math.Max(filter.MinPayload, m.Weight)
+		}
+		a := ModuleAvailability{
+			ProductName:    items[group.index].Product.ProductName,
+			MinTemperature: filter.MinTemperature,
+			MaxTemperature: filter.MaxTemperature,
+			MinVolume:      filter.MinVolume,
+			MinPayload:     filter.MinPayload,
+			MinBattery:     battery,
+			Needed:         len(group.modules),
+		}
+		a.Available = pick(free, filter, a.Needed, true)
+		a.Returning = pick(returning, filter, a.Needed-a.Available, false)
+		a.Sufficient = a.Available+a.Returning >= a.Needed
+		result = append(result, a)
+	}
+	return result
+}
+
+// ModuleAvailabilityOn 估算送达日 deliveryDate 按装箱规划所需冷链箱的可用情况：
+// 现在空闲的模块，加上所属订单租期在送达日送货时间窗开始前结束的已分配模块。只读，不锁定模块
+func ModuleAvailabilityOn(moduleRepo *dao.ModuleRepository, plan *LoadPlan, items []models.OrderItem, deliveryDate, now time.Time) ([]ModuleAvailability, error) {
+	free, err := moduleRepo.ListUnassignedModules()
+	if err != nil {
+		return nil, err
+	}
+	releases, err := moduleRepo.ListModuleReleases()
+	if err != nil {
+		return nil, err
+	}
+	open, _ := deliveryWindow(deliveryDate)
+	var returning []models.Module
+	for _, r := range releases {
+		if !rentalEnd(r.DeliveryDate, r.RentalDays).After(open) {
+			returning = append(returning, r.Module)
+		}
+	}
+	return CheckModuleAvailability(plan, items, free, returning, RequiredBattery(deliveryDate.Sub(now))), nil
+}
+
+// EstimateDelivery 估算在 now 时刻下单能否在 deliveryDate 当天的送货时间窗内送达：
+// 从仓库出发经寄件地取货后送到收件地，早于时间窗到达时等到时间窗开始。route 为 nil 表示地址无法定位
+func EstimateDelivery(route *DeliveryRoute, deliveryDate, now time.Time) DeliveryFeasibility {
+	open, close := deliveryWindow(deliveryDate)
+	f := DeliveryFeasibility{WindowOpen: open, WindowClose: close, EarliestArrival: maxTime(now, open)}
+	if route != nil {
+		f.DistanceKnown = true
+		arrival := now.Add(travelTime(route.PickupKm) + ROUTE_PICKUP_SERVICE + travelTime(route.DistanceKm-route.PickupKm))
+		f.EarliestArrival = maxTime(arrival, open)
+	}
+	switch {
+	case !now.Before(close):
+		f.Reason = "送达日的送货时间窗已过"
+	case f.EarliestArrival.After(close):
+		f.Reason = fmt.Sprintf("最早 %s 送达，晚于送货时间窗结束 %s",
+			f.EarliestArrival.Format(time.DateTime), close.Format(time.DateTime))
+	default:
+		f.Feasible = true
+		if !f.DistanceKnown {
+			f.Reason = "地址无法定位，未计入配送时长"
+		}
+	}
+	return f
+}
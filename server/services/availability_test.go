@@ -0,0 +1,66 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"testing"
+	"time"
+)
+
+func TestCheckModuleAvailabilityCountsFreeAndReturningModules(t *testing.T) {
+	items := pricingItems()
+	plan, err := PlanLoad(items, StandardModuleSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := []models.Module{
+		{ID: 1, SupportedMinTemperature: 0, SupportedMaxTemperature: 10, BatteryLevel: 90, InnerVolume: 0.1, MaxPayload: 50},
+		// 电量不足，不能立即使用
+		{ID: 2, SupportedMinTemperature: -25, SupportedMaxTemperature: 25, BatteryLevel: 10, InnerVolume: 0.1, MaxPayload: 50},
+	}
+	returning := []models.Module{
+		{ID: 3, SupportedMinTemperature: -25, SupportedMaxTemperature: -5, BatteryLevel: 5, InnerVolume: 0.1, MaxPayload: 50},
+	}
+
+	got := CheckModuleAvailability(plan, items, free, returning, 50)
+	if len(got) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(got), got)
+	}
+	byProduct := map[string]ModuleAvailability{}
+	for _, a := range got {
+		byProduct[a.ProductName] = a
+	}
+	vaccine, meat := byProduct["流感疫苗"], byProduct["冻牛肉"]
+	if vaccine.Needed != 2 || vaccine.Available != 1 || vaccine.Returning != 0 || vaccine.Sufficient {
+		t.Fatalf("vaccine availability = %+v, want 1 of 2 available", vaccine)
+	}
+	if meat.Needed != 1 || meat.Available != 0 || meat.Returning != 1 || !meat.Sufficient {
+		t.Fatalf("meat availability = %+v, want 1 returning", meat)
+	}
+}
+
+func TestEstimateDeliveryChecksWindow(t *testing.T) {
+	now := time.Date(2024, 5, 20, 15, 0, 0, 0, time.Local)
+	today := now.Add(3 * time.Hour)
+
+	// 取货 20 千米、全程 60 千米，16:15 送达
+	f := EstimateDelivery(&DeliveryRoute{PickupKm: 20, DistanceKm: 60}, today, now)
+	if !f.Feasible || !f.EarliestArrival.Equal(now.Add(75*time.Minute)) {
+		t.Fatalf("feasibility = %+v, want feasible at 16:15", f)
+	}
+
+	// 全程 400 千米，晚于 20:00
+	if f := EstimateDelivery(&DeliveryRoute{PickupKm: 20, DistanceKm: 400}, today, now); f.Feasible || f.Reason == "" {
+		t.Fatalf("feasibility = %+v, want infeasible with reason", f)
+	}
+
+	// 地址无法定位时只检查时间窗，最早在次日时间窗开始时送达
+	tomorrow := today.AddDate(0, 0, 1)
+	f = EstimateDelivery(nil, tomorrow, now)
+	if open, _ := deliveryWindow(tomorrow); !f.Feasible || f.DistanceKnown || !f.EarliestArrival.Equal(open) {
+		t.Fatalf("feasibility = %+v, want feasible from %s", f, open)
+	}
+
+	if f := EstimateDelivery(nil, now.AddDate(0, 0, -1), now); f.Feasible {
+		t.Fatalf("feasibility = %+v, want infeasible for a past date", f)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"coldchain/server/services/routing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// 分配冲突时的最大重试次数
+	ALLOCATION_RETRIES = 3
+	// 每次重试前的基础等待时间，按重试次数递增并加随机抖动
+	ALLOCATION_BACKOFF = 50 * time.Millisecond
+
+	// 冷链箱每小时的耗电百分比
+	BATTERY_DRAIN_PER_HOUR = 1.5
+	// 送达后仍需保留的电量百分比
+	BATTERY_RESERVE = 10.0
+	// 估算耗电时配送时长的上下限，距送达日期更短或更长时取边界值
+	MIN_DELIVERY_WINDOW = 4 * time.Hour
+	MAX_DELIVERY_WINDOW = 48 * time.Hour
+	// 装箱规划按该规格计算冷链箱数：内部容积（立方米）和最大载重（千克）
+	MODULE_INNER_VOLUME = 0.1
+	MODULE_MAX_PAYLOAD  = 50.0
+	// 冷链箱自重（千克）和外形占用的货厢容积（立方米），车辆装载时计入
+	MODULE_TARE_WEIGHT  = 8.0
+	MODULE_OUTER_VOLUME = 0.15
+
+	// 路径规划的出发仓库
+	ROUTE_DEPOT = Point{Longitude: 121.5440, Latitude: 29.9680}
+	// 路径规划的蚁群算法参数
+	ROUTE_ACO = routing.DefaultACOConfig()
+	// 车辆平均车速，千米/小时
+	ROUTE_SPEED_KMH = 60.0
+	// 取货和送货的停靠服务时长
+	ROUTE_PICKUP_SERVICE   = 15 * time.Minute
+	ROUTE_DELIVERY_SERVICE = 15 * time.Minute
+	// 送达日期当天可收货的时段，相对零点
+	ROUTE_DELIVERY_OPEN  = 8 * time.Hour
+	ROUTE_DELIVERY_CLOSE = 20 * time.Hour
+	// 车辆定位距站点在该半径内视为到达，千米
+	ROUTE_ARRIVAL_RADIUS_KM = 0.3
+	// 重新规划时绕行仓库更换冷链箱的停留时长
+	ROUTE_SWAP_SERVICE = 30 * time.Minute
+	// 分析器告警达到该级别（LOW、MEDIUM、HIGH）才视为冷链箱故障
+	ROUTE_FAILURE_ALARM_LEVEL = "HIGH"
+	// 推算预计到达时间时忽略早于该时长的车辆定位，按计划里程推算
+	ROUTE_ETA_STALE_AFTER = 10 * time.Minute
+
+	// 检查执行中路线轨迹的间隔，0 表示不定期检查；每次检查最近多长时间内的轨迹
+	ROUTE_MONITOR_INTERVAL = time.Minute
+	ROUTE_MONITOR_LOOKBACK = 2 * time.Hour
+	// 车辆距计划路线超过该距离并持续 ROUTE_CORRIDOR_GRACE 视为驶出走廊
+	ROUTE_CORRIDOR_KM    = 2.0
+	ROUTE_CORRIDOR_GRACE = 5 * time.Minute
+	// 车速不超过 ROUTE_STOP_SPEED_KMH 视为停车，在站点外停车超过 ROUTE_STOP_LIMIT 告警
+	ROUTE_STOP_SPEED_KMH = 3.0
+	ROUTE_STOP_LIMIT     = 20 * time.Minute
+
+	// 冷链箱每箱每天的租金，冷冻（温区上限低于0℃）和冷藏按系数计
+	PRICING_MODULE_DAILY_RATE = 30.0
+	PRICING_FROZEN_FACTOR     = 1.5
+	PRICING_CHILLED_FACTOR    = 1.0
+	// 配送起步价包含的里程，超出部分按每千米计费
+	PRICING_DISTANCE_BASE_FEE    = 50.0
+	PRICING_DISTANCE_INCLUDED_KM = 10.0
+	PRICING_PER_KM               = 3.0
+	// 距送达不足 PRICING_URGENT_WITHIN 的订单，租金和配送费加收的比例
+	PRICING_URGENT_WITHIN = 24 * time.Hour
+	PRICING_URGENT_RATE   = 0.3
+	// 每个冷链箱的押金，归还后退还
+	PRICING_MODULE_DEPOSIT = 200.0
+
+	// 距离数据来源：haversine、fixture 或 http
+	DISTANCE_PROVIDER = "haversine"
+	// 球面距离换算为道路距离的系数
+	DISTANCE_ROAD_FACTOR = 1.3
+	// fixture 数据文件路径
+	DISTANCE_FIXTURE = ""
+	// http 地图服务地址、密钥和超时
+	DISTANCE_HTTP_URL     = ""
+	DISTANCE_HTTP_KEY     = ""
+	DISTANCE_HTTP_TIMEOUT = 5 * time.Second
+	// 距离和地址解析结果在 Redis 中的缓存时间
+	DISTANCE_CACHE_TTL = 7 * 24 * time.Hour
+)
+
+// ImportConfig 读取 server.allocation 下的分配参数、server.route_planning 下的路径规划参数、
+// server.route_monitor 下的路线监控参数、server.pricing 下的计价参数和 server.distance 下的距离数据来源，
+// 需在配置文件加载后调用
+func ImportConfig() {
+	if viper.IsSet("server.allocation.retries") {
+		ALLOCATION_RETRIES = viper.GetInt("server.allocation.retries")
+	}
+	if viper.IsSet("server.allocation.backoff") {
+		ALLOCATION_BACKOFF = viper.GetDuration("server.allocation.backoff")
+	}
+	if viper.IsSet("server.allocation.battery_drain_per_hour") {
+		BATTERY_DRAIN_PER_HOUR = viper.GetFloat64("server.allocation.battery_drain_per_hour")
+	}
+	if viper.IsSet("server.allocation.battery_reserve") {
+		BATTERY_RESERVE = viper.GetFloat64("server.allocation.battery_reserve")
+	}
+	if viper.IsSet("server.allocation.min_delivery_window") {
+		MIN_DELIVERY_WINDOW = viper.GetDuration("server.allocation.min_delivery_window")
+	}
+	if viper.IsSet("server.allocation.max_delivery_window") {
+		MAX_DELIVERY_WINDOW = viper.GetDuration("server.allocation.max_delivery_window")
+	}
+	if viper.IsSet("server.allocation.module_inner_volume") {
+		MODULE_INNER_VOLUME = viper.GetFloat64("server.allocation.module_inner_volume")
+	}
+	if viper.IsSet("server.allocation.module_max_payload") {
+		MODULE_MAX_PAYLOAD = viper.GetFloat64("server.allocation.module_max_payload")
+	}
+	if viper.IsSet("server.allocation.module_tare_weight") {
+		MODULE_TARE_WEIGHT = viper.GetFloat64("server.allocation.module_tare_weight")
+	}
+	if viper.IsSet("server.allocation.module_outer_volume") {
+		MODULE_OUTER_VOLUME = viper.GetFloat64("server.allocation.module_outer_volume")
+	}
+	if viper.IsSet("server.route_planning.depot") {
+		ROUTE_DEPOT = Point{
+			Longitude: viper.GetFloat64("server.route_planning.depot.longitude"),
+			Latitude:  viper.GetFloat64("server.route_planning.depot.latitude"),
+		}
+	}
+	if viper.IsSet("server.route_planning.ants") {
+		ROUTE_ACO.Ants = viper.GetInt("server.route_planning.ants")
+	}
+	if viper.IsSet("server.route_planning.iterations") {
+		ROUTE_ACO.Iterations = viper.GetInt("server.route_planning.iterations")
+	}
+	if viper.IsSet("server.route_planning.time_limit") {
+		ROUTE_ACO.TimeLimit = viper.GetDuration("server.route_planning.time_limit")
+	}
+	if viper.IsSet("server.route_planning.seed") {
+		ROUTE_ACO.Seed = viper.GetInt64("server.route_planning.seed")
+	}
+	if viper.IsSet("server.route_planning.speed_kmh") {
+		ROUTE_SPEED_KMH = viper.GetFloat64("server.route_planning.speed_kmh")
+	}
+	if viper.IsSet("server.route_planning.pickup_service") {
+		ROUTE_PICKUP_SERVICE = viper.GetDuration("server.route_planning.pickup_service")
+	}
+	if viper.IsSet("server.route_planning.delivery_service") {
+		ROUTE_DELIVERY_SERVICE = viper.GetDuration("server.route_planning.delivery_service")
+	}
+	if viper.IsSet("server.route_planning.delivery_open") {
+		ROUTE_DELIVERY_OPEN = viper.GetDuration("server.route_planning.delivery_open")
+	}
+	if viper.IsSet("server.route_planning.delivery_close") {
+		ROUTE_DELIVERY_CLOSE = viper.GetDuration("server.route_planning.delivery_close")
+	}
+	if viper.IsSet("server.route_planning.arrival_radius_km") {
+		ROUTE_ARRIVAL_RADIUS_KM = viper.GetFloat64("server.route_planning.arrival_radius_km")
+	}
+	if viper.IsSet("server.route_planning.swap_service") {
+		ROUTE_SWAP_SERVICE = viper.GetDuration("server.route_planning.swap_service")
+	}
+	if viper.IsSet("server.route_planning.failure_alarm_level") {
+		ROUTE_FAILURE_ALARM_LEVEL = viper.GetString("server.route_planning.failure_alarm_level")
+	}
+	if viper.IsSet("server.route_planning.eta_stale_after") {
+		ROUTE_ETA_STALE_AFTER = viper.GetDuration("server.route_planning.eta_stale_after")
+	}
+	if viper.IsSet("server.route_monitor.interval") {
+		ROUTE_MONITOR_INTERVAL = viper.GetDuration("server.route_monitor.interval")
+	}
+	if viper.IsSet("server.route_monitor.lookback") {
+		ROUTE_MONITOR_LOOKBACK = viper.GetDuration("server.route_monitor.lookback")
+	}
+	if viper.IsSet("server.route_monitor.corridor_km") {
+		ROUTE_CORRIDOR_KM = viper.GetFloat64("server.route_monitor.corridor_km")
+	}
+	if viper.IsSet("server.route_monitor.corridor_grace") {
+		ROUTE_CORRIDOR_GRACE = viper.GetDuration("server.route_monitor.corridor_grace")
+	}
+	if viper.IsSet("server.route_monitor.stop_speed_kmh") {
+		ROUTE_STOP_SPEED_KMH = viper.GetFloat64("server.route_monitor.stop_speed_kmh")
+	}
+	if viper.IsSet("server.route_monitor.stop_limit") {
+		ROUTE_STOP_LIMIT = viper.GetDuration("server.route_monitor.stop_limit")
+	}
+	if viper.IsSet("server.pricing.module_daily_rate") {
+		PRICING_MODULE_DAILY_RATE = viper.GetFloat64("server.pricing.module_daily_rate")
+	}
+	if viper.IsSet("server.pricing.frozen_factor") {
+		PRICING_FROZEN_FACTOR = viper.GetFloat64("server.pricing.frozen_factor")
+	}
+	if viper.IsSet("server.pricing.chilled_factor") {
+		PRICING_CHILLED_FACTOR = viper.GetFloat64("server.pricing.chilled_factor")
+	}
+	if viper.IsSet("server.pricing.distance_base_fee") {
+		PRICING_DISTANCE_BASE_FEE = viper.GetFloat64("server.pricing.distance_base_fee")
+	}
+	if viper.IsSet("server.pricing.distance_included_km") {
+		PRICING_DISTANCE_INCLUDED_KM = viper.GetFloat64("server.pricing.distance_included_km")
+	}
+	if viper.IsSet("server.pricing.per_km") {
+		PRICING_PER_KM = viper.GetFloat64("server.pricing.per_km")
+	}
+	if viper.IsSet("server.pricing.urgent_within") {
+		PRICING_URGENT_WITHIN = viper.GetDuration("server.pricing.urgent_within")
+	}
+	if viper.IsSet("server.pricing.urgent_rate") {
+		PRICING_URGENT_RATE = viper.GetFloat64("server.pricing.urgent_rate")
+	}
+	if viper.IsSet("server.pricing.module_deposit") {
+		PRICING_MODULE_DEPOSIT = viper.GetFloat64("server.pricing.module_deposit")
+	}
+	if viper.IsSet("server.distance.provider") {
+		DISTANCE_PROVIDER = viper.GetString("server.distance.provider")
+	}
+	if viper.IsSet("server.distance.road_factor") {
+		DISTANCE_ROAD_FACTOR = viper.GetFloat64("server.distance.road_factor")
+	}
+	if viper.IsSet("server.distance.fixture") {
+		DISTANCE_FIXTURE = viper.GetString("server.distance.fixture")
+	}
+	if viper.IsSet("server.distance.http.url") {
+		DISTANCE_HTTP_URL = viper.GetString("server.distance.http.url")
+	}
+	if viper.IsSet("server.distance.http.key") {
+		DISTANCE_HTTP_KEY = viper.GetString("server.distance.http.key")
+	}
+	if viper.IsSet("server.distance.http.timeout") {
+		DISTANCE_HTTP_TIMEOUT = viper.GetDuration("server.distance.http.timeout")
+	}
+	if viper.IsSet("server.distance.cache_ttl") {
+		DISTANCE_CACHE_TTL = viper.GetDuration("server.distance.cache_ttl")
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDepotFull         = errors.New("目标仓库容量不足")
+	ErrModuleNotMovable  = errors.New("冷链箱正在使用或待检查，无法调拨")
+	ErrVehicleNotMovable = errors.New("车辆正在使用中，无法调拨")
+)
+
+// DepotLocation 仓库坐标
+func DepotLocation(depot models.Depot) Point {
+	return Point{Longitude: depot.Longitude, Latitude: depot.Latitude}
+}
+
+// findDepot 按ID查找仓库
+func findDepot(depots []models.Depot, id *uint) (models.Depot, bool) {
+	if id == nil {
+		return models.Depot{}, false
+	}
+	for _, d := range depots {
+		if d.ID == *id {
+			return d, true
+		}
+	}
+	return models.Depot{}, false
+}
+
+// NearestDepots 按距 p 的距离从近到远排列仓库，不修改 depots
+func NearestDepots(depots []models.Depot, p Point) []models.Depot {
+	sorted := append([]models.Depot(nil), depots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return HaversineKm(p, DepotLocation(sorted[i])) < HaversineKm(p, DepotLocation(sorted[j]))
+	})
+	return sorted
+}
+
+// checkDepotCapacity 冷链箱调入或归还后检查仓库容量，depot 需已通过 GetDepotForUpdate 加锁，
+// 保证并发调入同一仓库时依次检查
+func checkDepotCapacity(depotTxn *dao.DepotRepository, depot *models.Depot) error {
+	if depot.Capacity <= 0 {
+		return nil
+	}
+	stored, err := depotTxn.CountDepotModules(depot.ID)
+	if err != nil {
+		return err
+	}
+	if stored > depot.Capacity {
+		return fmt.Errorf("%w: %s 最多存放%d个，调入后为%d个", ErrDepotFull, depot.Name, depot.Capacity, stored)
+	}
+	return nil
+}
+
+// TransferPlan 调拨冷链箱和车辆到仓库 ToDepotID
+type TransferPlan struct {
+	ToDepotID  uint
+	ModuleIDs  []uint
+	VehicleIDs []uint
+	Remark     string
+}
+
+// TransferToDepot 在事务 tx 中执行调拨并记录调拨单。
+// 只能调拨空闲或故障的冷链箱和未在使用的车辆，调入后冷链箱数量不能超过仓库容量，
+// 已在目标仓库的跳过
+func TransferToDepot(tx *gorm.DB, plan TransferPlan, actor Actor) ([]models.DepotTransfer, error) {
+	depotTxn := dao.NewDepotRepository(tx)
+	depot, err := depotTxn.GetDepotForUpdate(plan.ToDepotID)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []models.DepotTransfer
+	moduleTxn := dao.NewModuleRepository(tx)
+	for _, moduleID := range plan.ModuleIDs {
+		module, err := moduleTxn.GetModuleForUpdate(moduleID)
+		if err != nil {
+			return nil, err
+		}
+		if module.DepotID != nil && *module.DepotID == depot.ID {
+			continue
+		}
+		if module.Status != models.StatusUnassigned && module.Status != models.StatusFaulty {
+			return nil, fmt.Errorf("%w: %s", ErrModuleNotMovable, module.DeviceID)
+		}
+		if err := moduleTxn.UpdateModuleDepot(module.ID, depot.ID); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, models.DepotTransfer{
+			FromDepotID: module.DepotID,
+			ToDepotID:   depot.ID,
+			ModuleID:    &module.ID,
+			CreatedBy:   actor.UserID,
+			Remark:      plan.Remark,
+		})
+	}
+	if len(transfers) > 0 {
+		if err := checkDepotCapacity(depotTxn, depot); err != nil {
+			return nil, err
+		}
+	}
+
+	vehicleTxn := dao.NewVehicleRepository(tx)
+	for _, vehicleID := range plan.VehicleIDs {
+		vehicle, err := vehicleTxn.GetVehicleForUpdate(vehicleID)
+		if err != nil {
+			return nil, err
+		}
+		if vehicle.DepotID != nil && *vehicle.DepotID == depot.ID {
+			continue
+		}
+		if vehicle.Status == models.StatusInUse {
+			return nil, fmt.Errorf("%w: %s", ErrVehicleNotMovable, vehicle.PlateNumber)
+		}
+		if err := vehicleTxn.UpdateVehicleDepot(vehicle.ID, depot.ID); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, models.DepotTransfer{
+			FromDepotID: vehicle.DepotID,
+			ToDepotID:   depot.ID,
+			VehicleID:   &vehicle.ID,
+			CreatedBy:   actor.UserID,
+			Remark:      plan.Remark,
+		})
+	}
+
+	if err := depotTxn.CreateTransfers(transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVehicleUnavailable = errors.New("车辆当前不可调度")
+	ErrOverCapacity       = errors.New("冷链箱数量超出车辆载量")
+	ErrDispatchState      = errors.New("调度单当前状态不允许该操作")
+)
+
+// DispatchPlan 创建调度单的参数
+type DispatchPlan struct {
+	VehicleID        uint
+	OrderIDs         []uint
+	DriverName       string
+	DriverPhone      string
+	PlannedDeparture time.Time
+	Remark           string
+}
+
+// Dispatcher 将已审核的订单及其冷链箱装车，并随行程推进订单状态
+type Dispatcher struct {
+	fsm *OrderStateMachine
+}
+
+func NewDispatcher(fsm *OrderStateMachine) *Dispatcher {
+	return &Dispatcher{fsm: fsm}
+}
+
+// Create 在事务 tx 中创建调度单：车辆需为空闲状态，订单需已审核，
+// 订单的冷链箱按 PlanLoading 的装车方案装载，数量、容积和重量不能超过车辆限制。车辆进入使用中，订单进入已发车
+func (d *Dispatcher) Create(tx *gorm.DB, plan DispatchPlan, actor Actor) (*models.Dispatch, error) {
+	vehicleTxn := dao.NewVehicleRepository(tx)
+	vehicle, err := vehicleTxn.GetVehicleForUpdate(plan.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+	if vehicle.Status != models.StatusIdle {
+		return nil, fmt.Errorf("%w: %s %s", ErrVehicleUnavailable, vehicle.PlateNumber, vehicle.Status)
+	}
+
+	dispatch := &models.Dispatch{
+		VehicleID:        vehicle.ID,
+		DriverName:       plan.DriverName,
+		DriverPhone:      plan.DriverPhone,
+		PlannedDeparture: plan.PlannedDeparture,
+		Status:           models.DispatchPlanned,
+		CreatedBy:        actor.UserID,
+		Remark:           plan.Remark,
+	}
+	for _, orderID := range plan.OrderIDs {
+		if _, err := d.fsm.Fire(tx, orderID, EventDispatch, actor, "车辆 "+vehicle.PlateNumber); err != nil {
+			return nil, fmt.Errorf("订单 %d: %w", orderID, err)
+		}
+		dispatch.Orders = append(dispatch.Orders, models.DispatchOrder{OrderID: orderID})
+	}
+	loading, err := d.PlanLoading(tx, vehicle, plan.OrderIDs)
+	if err != nil {
+		return nil, err
+	}
+	dispatch.Modules = loading.Modules
+	dispatch.ModuleCount = len(loading.Modules)
+	dispatch.LoadWeight = loading.Weight
+	dispatch.LoadVolume = loading.Volume
+
+	if err := vehicleTxn.UpdateVehicleStatus(vehicle.ID, models.StatusInUse); err != nil {
+		return nil, err
+	}
+	if err := dao.NewDispatchRepository(tx).CreateDispatch(dispatch); err != nil {
+		return nil, err
+	}
+	dispatch.Vehicle = *vehicle
+	dispatch.Vehicle.Status = models.StatusInUse
+	return dispatch, nil
+}
+
+// Depart 车辆发车，调度单内的订单进入运输中
+func (d *Dispatcher) Depart(tx *gorm.DB, dispatchID uint, actor Actor, now time.Time) (*models.Dispatch, error) {
+	dispatchTxn := dao.NewDispatchRepository(tx)
+	dispatch, err := dispatchTxn.GetDispatchForUpdate(dispatchID)
+	if err != nil {
+		return nil, err
+	}
+	if dispatch.Status != models.DispatchPlanned {
+		return nil, ErrDispatchState
+	}
+
+	for _, o := range dispatch.Orders {
+		if _, err := d.fsm.Fire(tx, o.OrderID, EventDepart, actor, ""); err != nil {
+			return nil, fmt.Errorf("订单 %d: %w", o.OrderID, err)
+		}
+	}
+	dispatch.Status = models.DispatchInTransit
+	dispatch.DepartedAt = &now
+	if err := dispatchTxn.UpdateDispatch(dispatch); err != nil {
+		return nil, err
+	}
+	return dispatch, nil
+}
+
+// Complete 行程结束，尚未标记送达的订单标记为已送达，车辆恢复空闲
+func (d *Dispatcher) Complete(tx *gorm.DB, dispatchID uint, actor Actor, now time.Time) (*models.Dispatch, error) {
+	dispatchTxn := dao.NewDispatchRepository(tx)
+	dispatch, err := dispatchTxn.GetDispatchForUpdate(dispatchID)
+	if err != nil {
+		return nil, err
+	}
+	if dispatch.Status != models.DispatchInTransit {
+		return nil, ErrDispatchState
+	}
+
+	for _, o := range dispatch.Orders {
+		_, err := d.fsm.Fire(tx, o.OrderID, EventDeliver, actor, "")
+		// 已单独标记送达的订单跳过
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			return nil, fmt.Errorf("订单 %d: %w", o.OrderID, err)
+		}
+	}
+	dispatch.Status = models.DispatchCompleted
+	dispatch.CompletedAt = &now
+	if err := dispatchTxn.UpdateDispatch(dispatch); err != nil {
+		return nil, err
+	}
+	if err := dao.NewVehicleRepository(tx).UpdateVehicleStatus(dispatch.VehicleID, models.StatusIdle); err != nil {
+		return nil, err
+	}
+	return dispatch, nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"coldchain/common/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrGeocodeNotFound  = errors.New("无法解析地址坐标")
+	ErrDistanceNotFound = errors.New("无法获取两点间的距离")
+)
+
+// DistanceProvider 地址解析和道路距离的数据来源
+type DistanceProvider interface {
+	// Name 数据来源名称，用于区分缓存
+	Name() string
+	// Geocode 将地址解析为坐标
+	Geocode(ctx context.Context, address string) (Point, error)
+	// Distance 两点间的道路距离，单位千米
+	Distance(ctx context.Context, from, to Point) (float64, error)
+}
+
+// MatrixProvider 可以批量计算距离矩阵的数据来源
+type MatrixProvider interface {
+	Matrix(ctx context.Context, points []Point) ([][]float64, error)
+}
+
+// DistanceMatrix 计算 points 两两之间的距离，对角线为0
+func DistanceMatrix(ctx context.Context, provider DistanceProvider, points []Point) ([][]float64, error) {
+	if m, ok := provider.(MatrixProvider); ok {
+		return m.Matrix(ctx, points)
+	}
+	dist := newMatrix(len(points))
+	for i := range points {
+		for j := range points {
+			if i == j {
+				continue
+			}
+			d, err := provider.Distance(ctx, points[i], points[j])
+			if err != nil {
+				return nil, err
+			}
+			dist[i][j] = d
+		}
+	}
+	return dist, nil
+}
+
+func newMatrix(n int) [][]float64 {
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	return dist
+}
+
+// AddressDetail 寄件或收件信息中的详细地址
+func AddressDetail(info datatypes.JSON) string {
+	var contact struct {
+		Detail string `json:"detail"`
+	}
+	if len(info) == 0 || json.Unmarshal(info, &contact) != nil {
+		return ""
+	}
+	return contact.Detail
+}
+
+// ResolveLocation 读取寄件或收件信息中的坐标，没有坐标时解析详细地址
+func ResolveLocation(ctx context.Context, provider DistanceProvider, info datatypes.JSON) (Point, error) {
+	if p, ok := AddressLocation(info); ok {
+		return p, nil
+	}
+	detail := AddressDetail(info)
+	if detail == "" {
+		return Point{}, ErrGeocodeNotFound
+	}
+	return provider.Geocode(ctx, detail)
+}
+
+// HaversineProvider 球面距离乘以道路系数估算道路距离，不依赖外部服务，不支持地址解析
+type HaversineProvider struct {
+	RoadFactor float64
+}
+
+func (h HaversineProvider) Name() string {
+	return "haversine"
+}
+
+func (h HaversineProvider) Geocode(ctx context.Context, address string) (Point, error) {
+	return Point{}, fmt.Errorf("%w: %s", ErrGeocodeNotFound, address)
+}
+
+func (h HaversineProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	factor := h.RoadFactor
+	if factor <= 0 {
+		factor = 1
+	}
+	return HaversineKm(from, to) * factor, nil
+}
+
+// FallbackProvider Primary 失败时改用 Fallback
+type FallbackProvider struct {
+	Primary  DistanceProvider
+	Fallback DistanceProvider
+}
+
+func (f FallbackProvider) Name() string {
+	return f.Primary.Name()
+}
+
+func (f FallbackProvider) Geocode(ctx context.Context, address string) (Point, error) {
+	p, err := f.Primary.Geocode(ctx, address)
+	if err == nil {
+		return p, nil
+	}
+	logger.Warnf("%s 地址解析失败，改用 %s: %v", f.Primary.Name(), f.Fallback.Name(), err)
+	return f.Fallback.Geocode(ctx, address)
+}
+
+func (f FallbackProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	d, err := f.Primary.Distance(ctx, from, to)
+	if err == nil {
+		return d, nil
+	}
+	logger.Warnf("%s 距离查询失败，改用 %s: %v", f.Primary.Name(), f.Fallback.Name(), err)
+	return f.Fallback.Distance(ctx, from, to)
+}
+
+// Matrix Primary 能批量计算时先整体查询，失败后逐对查询：
+// 查不到的点对改用 Fallback，Primary 出现其他错误后剩余点对都改用 Fallback
+func (f FallbackProvider) Matrix(ctx context.Context, points []Point) ([][]float64, error) {
+	if m, ok := f.Primary.(MatrixProvider); ok {
+		dist, err := m.Matrix(ctx, points)
+		if err == nil {
+			return dist, nil
+		}
+		logger.Warnf("%s 距离矩阵查询失败，逐对查询: %v", f.Primary.Name(), err)
+	}
+
+	dist := newMatrix(len(points))
+	primaryOK := true
+	for i := range points {
+		for j := range points {
+			if i == j {
+				continue
+			}
+			if primaryOK {
+				d, err := f.Primary.Distance(ctx, points[i], points[j])
+				if err == nil {
+					dist[i][j] = d
+					continue
+				}
+				if !errors.Is(err, ErrDistanceNotFound) {
+					logger.Warnf("%s 距离查询失败，改用 %s: %v", f.Primary.Name(), f.Fallback.Name(), err)
+					primaryOK = false
+				}
+			}
+			d, err := f.Fallback.Distance(ctx, points[i], points[j])
+			if err != nil {
+				return nil, err
+			}
+			dist[i][j] = d
+		}
+	}
+	return dist, nil
+}
+
+// CachedProvider 在 Redis 中缓存 Next 的地址解析和距离结果，
+// 距离按两端坐标缓存，查询失败的结果不缓存。Redis 不可用时直接查询 Next
+type CachedProvider struct {
+	Next   DistanceProvider
+	Client *redis.Client
+}
+
+const distanceCachePrefix = "coldchain:distance:"
+
+func coordKey(p Point) string {
+	return strconv.FormatFloat(p.Longitude, 'f', 6, 64) + "," + strconv.FormatFloat(p.Latitude, 'f', 6, 64)
+}
+
+func (c CachedProvider) distanceKey(from, to Point) string {
+	return distanceCachePrefix + c.Next.Name() + ":" + coordKey(from) + ":" + coordKey(to)
+}
+
+func (c CachedProvider) geocodeKey(address string) string {
+	return distanceCachePrefix + c.Next.Name() + ":geocode:" + address
+}
+
+func (c CachedProvider) Name() string {
+	return c.Next.Name()
+}
+
+func (c CachedProvider) Geocode(ctx context.Context, address string) (Point, error) {
+	key := c.geocodeKey(address)
+	if raw, err := c.Client.Get(ctx, key).Bytes(); err == nil {
+		var p Point
+		if json.Unmarshal(raw, &p) == nil {
+			return p, nil
+		}
+	} else if err != redis.Nil {
+		logger.Warnf("读取地址解析缓存失败: %v", err)
+	}
+
+	p, err := c.Next.Geocode(ctx, address)
+	if err != nil {
+		return Point{}, err
+	}
+	if raw, err := json.Marshal(p); err == nil {
+		if err := c.Client.Set(ctx, key, raw, DISTANCE_CACHE_TTL).Err(); err != nil {
+			logger.Warnf("写入地址解析缓存失败: %v", err)
+		}
+	}
+	return p, nil
+}
+
+func (c CachedProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	dist, err := c.Matrix(ctx, []Point{from, to})
+	if err != nil {
+		return 0, err
+	}
+	return dist[0][1], nil
+}
+
+// Matrix 一次读取所有点对的缓存，只查询缺失的距离并写回，查询出错时已查到的距离仍会写回
+func (c CachedProvider) Matrix(ctx context.Context, points []Point) ([][]float64, error) {
+	type pair struct{ i, j int }
+	var pairs []pair
+	var keys []string
+	for i := range points {
+		for j := range points {
+			if i != j {
+				pairs = append(pairs, pair{i, j})
+				keys = append(keys, c.distanceKey(points[i], points[j]))
+			}
+		}
+	}
+	dist := newMatrix(len(points))
+	if len(keys) == 0 {
+		return dist, nil
+	}
+
+	cached, err := c.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		logger.Warnf("读取距离缓存失败: %v", err)
+		cached = make([]interface{}, len(keys))
+	}
+
+	fresh := make(map[string]interface{})
+	var queryErr error
+	for k, pr := range pairs {
+		if s, ok := cached[k].(string); ok {
+			if d, err := strconv.ParseFloat(s, 64); err == nil {
+				dist[pr.i][pr.j] = d
+				continue
+			}
+		}
+		d, err := c.Next.Distance(ctx, points[pr.i], points[pr.j])
+		if err != nil {
+			queryErr = err
+			break
+		}
+		dist[pr.i][pr.j] = d
+		fresh[keys[k]] = strconv.FormatFloat(d, 'f', -1, 64)
+	}
+
+	if len(fresh) > 0 {
+		pipe := c.Client.Pipeline()
+		for key, value := range fresh {
+			pipe.Set(ctx, key, value, DISTANCE_CACHE_TTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Warnf("写入距离缓存失败: %v", err)
+		}
+	}
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	return dist, nil
+}
+
+// NewDistanceProvider 按 server.distance 配置创建数据来源：
+// haversine 直接估算；fixture 读取 DISTANCE_FIXTURE 文件；http 调用 DISTANCE_HTTP_URL。
+// 后两者查询结果缓存在 cache 中，查询失败时改用球面距离估算
+func NewDistanceProvider(cache *redis.Client) (DistanceProvider, error) {
+	fallback := HaversineProvider{RoadFactor: DISTANCE_ROAD_FACTOR}
+
+	var primary DistanceProvider
+	switch DISTANCE_PROVIDER {
+	case "", "haversine":
+		return fallback, nil
+	case "fixture":
+		fixture, err := LoadFixtureProvider(DISTANCE_FIXTURE)
+		if err != nil {
+			return nil, err
+		}
+		primary = fixture
+	case "http":
+		primary = NewHTTPProvider(DISTANCE_HTTP_URL, DISTANCE_HTTP_KEY, DISTANCE_HTTP_TIMEOUT)
+	default:
+		return nil, fmt.Errorf("未知的距离数据来源: %s", DISTANCE_PROVIDER)
+	}
+
+	if cache != nil {
+		primary = CachedProvider{Next: primary, Client: cache}
+	}
+	return FallbackProvider{Primary: primary, Fallback: fallback}, nil
+}
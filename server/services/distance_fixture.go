@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FixtureProvider 从 JSON 文件读取地址坐标和点对距离，用于测试和离线环境。文件格式：
+//
+//	{
+//	  "geocodes": {"浙江省宁波市鄞州区...": {"longitude": 121.54, "latitude": 29.87}},
+//	  "distances": [{"from": {"longitude": 121.54, "latitude": 29.87},
+//	                 "to": {"longitude": 121.62, "latitude": 29.92}, "km": 12.3}]
+//	}
+//
+// 距离未列出反方向时按对称处理
+type FixtureProvider struct {
+	geocodes  map[string]Point
+	distances map[string]float64
+}
+
+type fixtureFile struct {
+	Geocodes  map[string]Point `json:"geocodes"`
+	Distances []struct {
+		From Point   `json:"from"`
+		To   Point   `json:"to"`
+		Km   float64 `json:"km"`
+	} `json:"distances"`
+}
+
+func fixturePairKey(from, to Point) string {
+	return coordKey(from) + ":" + coordKey(to)
+}
+
+func LoadFixtureProvider(path string) (*FixtureProvider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取距离数据文件失败: %w", err)
+	}
+	var file fixtureFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("解析距离数据文件 %s 失败: %w", path, err)
+	}
+
+	f := &FixtureProvider{
+		geocodes:  file.Geocodes,
+		distances: make(map[string]float64, len(file.Distances)),
+	}
+	if f.geocodes == nil {
+		f.geocodes = make(map[string]Point)
+	}
+	for _, d := range file.Distances {
+		f.distances[fixturePairKey(d.From, d.To)] = d.Km
+	}
+	return f, nil
+}
+
+func (f *FixtureProvider) Name() string {
+	return "fixture"
+}
+
+func (f *FixtureProvider) Geocode(ctx context.Context, address string) (Point, error) {
+	if p, ok := f.geocodes[address]; ok {
+		return p, nil
+	}
+	return Point{}, fmt.Errorf("%w: %s", ErrGeocodeNotFound, address)
+}
+
+func (f *FixtureProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	if d, ok := f.distances[fixturePairKey(from, to)]; ok {
+		return d, nil
+	}
+	if d, ok := f.distances[fixturePairKey(to, from)]; ok {
+		return d, nil
+	}
+	return 0, fmt.Errorf("%w: %s -> %s", ErrDistanceNotFound, coordKey(from), coordKey(to))
+}
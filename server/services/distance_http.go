@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPProvider 调用外部地图服务的适配接口，接入具体地图服务时在其前面部署一个转换层即可：
+//
+//	GET {BaseURL}/geocode?address=...&key=...
+//	    -> {"longitude": 121.54, "latitude": 29.87}
+//	GET {BaseURL}/distance?origin=lon,lat&destination=lon,lat&key=...
+//	    -> {"distance_km": 12.3}
+//
+// 地址无法解析或两点间没有路线时返回 404
+type HTTPProvider struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewHTTPProvider(baseURL, apiKey string, timeout time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (h *HTTPProvider) Name() string {
+	return "http"
+}
+
+// get 请求 path 并将 JSON 响应解析到 out，404 时返回 notFound
+func (h *HTTPProvider) get(ctx context.Context, path string, query url.Values, out interface{}, notFound error) error {
+	if h.APIKey != "" {
+		query.Set("key", h.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.BaseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return notFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("地图服务返回 %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (h *HTTPProvider) Geocode(ctx context.Context, address string) (Point, error) {
+	var p Point
+	err := h.get(ctx, "/geocode", url.Values{"address": {address}}, &p,
+		fmt.Errorf("%w: %s", ErrGeocodeNotFound, address))
+	if err != nil {
+		return Point{}, err
+	}
+	if !p.Valid() {
+		return Point{}, fmt.Errorf("%w: %s", ErrGeocodeNotFound, address)
+	}
+	return p, nil
+}
+
+func (h *HTTPProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	var resp struct {
+		DistanceKm *float64 `json:"distance_km"`
+	}
+	query := url.Values{
+		"origin":      {coordKey(from)},
+		"destination": {coordKey(to)},
+	}
+	notFound := fmt.Errorf("%w: %s -> %s", ErrDistanceNotFound, coordKey(from), coordKey(to))
+	if err := h.get(ctx, "/distance", query, &resp, notFound); err != nil {
+		return 0, err
+	}
+	if resp.DistanceKm == nil {
+		return 0, errors.New("地图服务响应缺少 distance_km")
+	}
+	return *resp.DistanceKm, nil
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/datatypes"
+)
+
+func loadFixture(t *testing.T) *FixtureProvider {
+	t.Helper()
+	fixture, err := LoadFixtureProvider("testdata/distances.json")
+	if err != nil {
+		t.Fatalf("load fixture: %v", err)
+	}
+	return fixture
+}
+
+func contactInfo(t *testing.T, detail string) datatypes.JSON {
+	t.Helper()
+	raw, err := json.Marshal(map[string]string{"name": "测试", "phone": "13800000000", "detail": detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestFixtureProviderLooksUpBothDirections(t *testing.T) {
+	fixture := loadFixture(t)
+	ctx := context.Background()
+	a := Point{Longitude: 121.5790, Latitude: 29.8520}
+	b := Point{Longitude: 121.5480, Latitude: 29.8900}
+
+	for _, pair := range [][2]Point{{a, b}, {b, a}} {
+		d, err := fixture.Distance(ctx, pair[0], pair[1])
+		if err != nil || d != 7.2 {
+			t.Fatalf("distance %v -> %v = %v, %v; want 7.2", pair[0], pair[1], d, err)
+		}
+	}
+	if _, err := fixture.Distance(ctx, a, Point{Longitude: 120, Latitude: 30}); !errors.Is(err, ErrDistanceNotFound) {
+		t.Fatalf("missing pair error = %v, want ErrDistanceNotFound", err)
+	}
+	if _, err := fixture.Geocode(ctx, "不存在的地址"); !errors.Is(err, ErrGeocodeNotFound) {
+		t.Fatalf("missing address error = %v, want ErrGeocodeNotFound", err)
+	}
+}
+
+func TestFallbackMatrixFillsMissingPairs(t *testing.T) {
+	fixture := loadFixture(t)
+	fallback := HaversineProvider{RoadFactor: 1.3}
+	provider := FallbackProvider{Primary: fixture, Fallback: fallback}
+	points := []Point{
+		{Longitude: 121.5790, Latitude: 29.8520},
+		{Longitude: 121.5480, Latitude: 29.8900},
+		{Longitude: 121.8440, Latitude: 29.9010},
+	}
+
+	dist, err := DistanceMatrix(context.Background(), provider, points)
+	if err != nil {
+		t.Fatalf("matrix: %v", err)
+	}
+	if dist[0][1] != 7.2 || dist[1][0] != 7.2 {
+		t.Errorf("fixture pair = %v/%v, want 7.2", dist[0][1], dist[1][0])
+	}
+	want := HaversineKm(points[0], points[2]) * 1.3
+	if math.Abs(dist[0][2]-want) > 1e-9 {
+		t.Errorf("fallback pair = %v, want %v", dist[0][2], want)
+	}
+}
+
+func TestPlanRoutesOffline(t *testing.T) {
+	planner := NewRoutePlanner(FallbackProvider{Primary: loadFixture(t), Fallback: HaversineProvider{RoadFactor: 1.3}}, ROUTE_ACO)
+	now := time.Date(2024, 6, 1, 8, 0, 0, 0, time.Local)
+	orders := []models.RentalOrder{
+		{
+			ID:           1,
+			SenderInfo:   contactInfo(t, "浙江省宁波市鄞州区钱湖北路8号"),
+			ReceiverInfo: contactInfo(t, "浙江省宁波市江北区大庆南路99号"),
+			DeliveryDate: now,
+			OrderItems:   []models.OrderItem{{Quantity: 2}},
+		},
+		{
+			ID:           2,
+			SenderInfo:   contactInfo(t, "浙江省宁波市北仑区明州路188号"),
+			ReceiverInfo: contactInfo(t, "浙江省宁波市海曙区中山西路138号"),
+			DeliveryDate: now.AddDate(0, 0, 1),
+			OrderItems:   []models.OrderItem{{Quantity: 1}},
+		},
+		{
+			ID:           3,
+			SenderInfo:   contactInfo(t, "未登记的地址"),
+			ReceiverInfo: contactInfo(t, "浙江省宁波市海曙区中山西路138号"),
+			DeliveryDate: now,
+		},
+	}
+	fleet := []models.Vehicle{{ID: 1, PlateNumber: "浙B00001", MaxCapacity: 4}}
+
+	plan, err := planner.Plan(context.Background(), orders, fleet, nil, now)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].OrderID != 3 {
+		t.Fatalf("skipped = %+v, want order 3", plan.Skipped)
+	}
+	if len(plan.Infeasible) != 0 {
+		t.Fatalf("infeasible = %+v, want none", plan.Infeasible)
+	}
+	if len(plan.Trajectories) != 1 || len(plan.Trajectories[0]) != 5 || plan.Trajectories[0][0] != 0 {
+		t.Fatalf("trajectories = %v, want one route visiting all 4 stops from the depot", plan.Trajectories)
+	}
+	if len(plan.Vehicles[0].Arrivals) != len(plan.Trajectories[0]) {
+		t.Fatalf("arrivals = %v, want one per node", plan.Vehicles[0].Arrivals)
+	}
+}
+
+// countingProvider 统计 Next 的距离查询次数
+type countingProvider struct {
+	DistanceProvider
+	distances int
+}
+
+func (c *countingProvider) Distance(ctx context.Context, from, to Point) (float64, error) {
+	c.distances++
+	return c.DistanceProvider.Distance(ctx, from, to)
+}
+
+func TestCachedProviderStoresPairs(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	next := &countingProvider{DistanceProvider: loadFixture(t)}
+	cached := CachedProvider{Next: next, Client: client}
+	a := Point{Longitude: 121.5790, Latitude: 29.8520}
+	b := Point{Longitude: 121.5480, Latitude: 29.8900}
+
+	for i := 0; i < 2; i++ {
+		if d, err := cached.Distance(ctx, a, b); err != nil || d != 7.2 {
+			t.Fatalf("distance = %v, %v; want 7.2", d, err)
+		}
+	}
+	// 两个方向各查询一次，第二次全部命中缓存
+	if next.distances != 2 {
+		t.Fatalf("queried next %d times, want 2 with the second lookup cached", next.distances)
+	}
+	if v, err := server.Get(cached.distanceKey(a, b)); err != nil || v != "7.2" {
+		t.Fatalf("cached value = %q, %v; want 7.2", v, err)
+	}
+	if ttl := server.TTL(cached.distanceKey(a, b)); ttl != DISTANCE_CACHE_TTL {
+		t.Fatalf("cache ttl = %s, want %s", ttl, DISTANCE_CACHE_TTL)
+	}
+
+	// 查询失败的结果不缓存
+	far := Point{Longitude: 120, Latitude: 30}
+	if _, err := cached.Distance(ctx, a, far); !errors.Is(err, ErrDistanceNotFound) {
+		t.Fatalf("missing pair error = %v, want ErrDistanceNotFound", err)
+	}
+	if server.Exists(cached.distanceKey(a, far)) {
+		t.Fatal("failed lookup was cached")
+	}
+
+	// Redis 不可用时直接查询 Next
+	server.Close()
+	if d, err := cached.Distance(ctx, a, b); err != nil || d != 7.2 {
+		t.Fatalf("distance without redis = %v, %v; want 7.2", d, err)
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	a := Point{Longitude: 121.5790, Latitude: 29.8520}
+	b := Point{Longitude: 121.5480, Latitude: 29.8900}
+	far := Point{Longitude: 120, Latitude: 30}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/geocode" && q.Get("address") == "宁波市鄞州区":
+			fmt.Fprint(w, `{"longitude": 121.579, "latitude": 29.852}`)
+		case r.URL.Path == "/distance" && q.Get("destination") == coordKey(b):
+			fmt.Fprint(w, `{"distance_km": 7.5}`)
+		case r.URL.Path == "/distance" && q.Get("destination") == coordKey(far):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	provider := NewHTTPProvider(server.URL, "test-key", time.Second)
+
+	if p, err := provider.Geocode(ctx, "宁波市鄞州区"); err != nil || p != a {
+		t.Fatalf("geocode = %v, %v; want %v", p, err, a)
+	}
+	if _, err := provider.Geocode(ctx, "不存在的地址"); !errors.Is(err, ErrGeocodeNotFound) {
+		t.Fatalf("unknown address error = %v, want ErrGeocodeNotFound", err)
+	}
+	if d, err := provider.Distance(ctx, a, b); err != nil || d != 7.5 {
+		t.Fatalf("distance = %v, %v; want 7.5", d, err)
+	}
+	if _, err := provider.Distance(ctx, b, a); !errors.Is(err, ErrDistanceNotFound) {
+		t.Fatalf("404 distance error = %v, want ErrDistanceNotFound", err)
+	}
+
+	// 服务端错误时改用球面距离估算
+	_, err := provider.Distance(ctx, a, far)
+	if err == nil || errors.Is(err, ErrDistanceNotFound) {
+		t.Fatalf("5xx distance error = %v, want a service error", err)
+	}
+	fallback := HaversineProvider{RoadFactor: 1.3}
+	d, err := FallbackProvider{Primary: provider, Fallback: fallback}.Distance(ctx, a, far)
+	if want, _ := fallback.Distance(ctx, a, far); err != nil || d != want {
+		t.Fatalf("fallback distance = %v, %v; want %v", d, err, want)
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/services/routing"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"gorm.io/gorm"
+)
+
+// 预计到达时间的推算依据
+const (
+	ETASourceGPS     = "gps"     // 车辆最近的定位和车速
+	ETASourcePlan    = "plan"    // 没有定位时按计划里程和平均车速
+	ETASourceArrived = "arrived" // 已送达，为实际到达时间
+)
+
+// OrderETA 订单的预计送达时间，Deadline 为下单时承诺的送达时间，没有时为规划时的最晚送达时间
+type OrderETA struct {
+	OrderID     uint      `json:"order_id"`
+	RoutePlanID uint      `json:"route_plan_id"`
+	VehicleID   uint      `json:"vehicle_id"`
+	PlateNumber string    `json:"plate_number"`
+	ETA         time.Time `json:"eta"`
+	Deadline    time.Time `json:"deadline"`
+	Delivered   bool      `json:"delivered"`
+	// ETA 晚于 Deadline 时有延误风险，LateMinutes 为晚的分钟数
+	LateRisk    bool      `json:"late_risk"`
+	LateMinutes float64   `json:"late_minutes"`
+	StopsAhead  int       `json:"stops_ahead"` // 送达前还需经过的站点数
+	Source      string    `json:"source"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
+// travelAt 以 speed 千米/小时行驶 km 千米所需的时间
+func travelAt(km, speed float64) time.Duration {
+	if speed <= 0 {
+		return 0
+	}
+	return hoursToDuration(km / speed)
+}
+
+// RouteETAs 推算路线各站点的到达时间，与 plan.Stops 一一对应，已到达的站点为实际到达时间。
+// 未出发的路线按出发延误顺延计划时间；执行中的路线从 latest 定位出发，
+// 车辆在行驶时首段按定位车速、其余按 ROUTE_SPEED_KMH，没有定位或定位早于 ROUTE_ETA_STALE_AFTER 时从最近到达的站点出发
+func RouteETAs(plan *models.RoutePlan, latest *dao.TrackPoint, now time.Time) ([]time.Time, string) {
+	if latest != nil && now.Sub(latest.TimeStamp) > ROUTE_ETA_STALE_AFTER {
+		latest = nil
+	}
+	etas := make([]time.Time, len(plan.Stops))
+	if plan.StartedAt == nil {
+		delay := max(now.Sub(plan.PlannedStart), 0)
+		for k, s := range plan.Stops {
+			etas[k] = s.PlannedArrival.Add(delay)
+		}
+		return etas, ETASourcePlan
+	}
+
+	next := len(plan.Stops)
+	for k, s := range plan.Stops {
+		if s.ActualArrival != nil {
+			etas[k] = *s.ActualArrival
+		} else if next == len(plan.Stops) {
+			next = k
+		}
+	}
+	if next == len(plan.Stops) {
+		return etas, ETASourceArrived
+	}
+
+	// 首段：从定位或最近到达的站点到下一站
+	source := ETASourcePlan
+	clock := now
+	firstLeg := travelAt(plan.Stops[next].LegDistanceKm, ROUTE_SPEED_KMH)
+	if next > 0 {
+		prev := plan.Stops[next-1]
+		if prev.ActualArrival != nil {
+			clock = maxTime(now, prev.ActualArrival.Add(stopService(prev)))
+		}
+	}
+	if latest != nil && (next == 0 || plan.Stops[next-1].ActualArrival == nil || latest.TimeStamp.After(*plan.Stops[next-1].ActualArrival)) {
+		source = ETASourceGPS
+		clock = latest.TimeStamp
+		target := Point{Longitude: plan.Stops[next].Longitude, Latitude: plan.Stops[next].Latitude}
+		km := HaversineKm(trackPoint(*latest), target) * math.Max(DISTANCE_ROAD_FACTOR, 1)
+		speed := ROUTE_SPEED_KMH
+		if float64(latest.Speed) > ROUTE_STOP_SPEED_KMH {
+			speed = float64(latest.Speed)
+		}
+		firstLeg = travelAt(km, speed)
+	}
+
+	leg := firstLeg
+	for k := next; k < len(plan.Stops); k++ {
+		s := plan.Stops[k]
+		if k > next {
+			leg = travelAt(s.LegDistanceKm, ROUTE_SPEED_KMH)
+		}
+		arrival := clock.Add(leg)
+		if s.NodeType == routing.NodeDelivery && s.Deadline != nil {
+			if open, _ := deliveryWindow(*s.Deadline); arrival.Before(open) {
+				arrival = open
+			}
+		}
+		etas[k] = arrival
+		clock = arrival.Add(stopService(s))
+	}
+	return etas, source
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// orderETA 从路线各站点的到达时间中取订单送货站点的预计送达时间，按承诺的送达时间 promised 判断延误风险，
+// promised 为零值时按站点的最晚送达时间。路线上没有该订单的送货站点时返回 false
+func orderETA(plan *models.RoutePlan, orderID uint, etas []time.Time, source string, promised, now time.Time) (*OrderETA, bool) {
+	ahead := 0
+	for k, s := range plan.Stops {
+		if s.NodeType != routing.NodeDelivery || s.OrderID == nil || *s.OrderID != orderID {
+			if s.ActualArrival == nil {
+				ahead++
+			}
+			continue
+		}
+		eta := &OrderETA{
+			OrderID:     orderID,
+			RoutePlanID: plan.ID,
+			VehicleID:   plan.VehicleID,
+			PlateNumber: plan.Vehicle.PlateNumber,
+			ETA:         etas[k],
+			Deadline:    promised,
+			Delivered:   s.ActualArrival != nil,
+			StopsAhead:  ahead,
+			Source:      source,
+			ComputedAt:  now,
+		}
+		if eta.Delivered {
+			eta.Source = ETASourceArrived
+			eta.StopsAhead = 0
+		}
+		if eta.Deadline.IsZero() && s.Deadline != nil {
+			eta.Deadline = *s.Deadline
+		}
+		if !eta.Deadline.IsZero() {
+			if late := eta.ETA.Sub(eta.Deadline); late > 0 {
+				eta.LateRisk = !eta.Delivered
+				eta.LateMinutes = late.Minutes()
+			}
+		}
+		return eta, true
+	}
+	return nil, false
+}
+
+// ETATracker 按路线计划和 vehicle_location 中的车辆定位推算订单的预计送达时间
+type ETATracker struct {
+	db    *gorm.DB
+	track *dao.VehicleTrackRepository
+}
+
+// NewETATracker ch 为空时只按路线计划推算
+func NewETATracker(db *gorm.DB, ch driver.Conn) *ETATracker {
+	t := &ETATracker{db: db}
+	if ch != nil {
+		t.track = dao.NewVehicleTrackRepository(ch)
+	}
+	return t
+}
+
+// latestPoint 执行中路线的车辆最近定位，查询失败时记录错误并按没有定位处理
+func (t *ETATracker) latestPoint(plan *models.RoutePlan) *dao.TrackPoint {
+	if plan.Status != models.RoutePlanExecuting || plan.StartedAt == nil || t.track == nil {
+		return nil
+	}
+	point, err := t.track.GetLatestPoint(VehicleTrackKeys(plan.Vehicle), *plan.StartedAt)
+	if err != nil {
+		logger.Errorf("获取车辆 %s 最近定位失败: %v", plan.Vehicle.PlateNumber, err)
+		return nil
+	}
+	return point
+}
+
+// OrderETA 订单的预计送达时间，订单还没有安排路线时返回 nil
+func (t *ETATracker) OrderETA(orderID uint, now time.Time) (*OrderETA, error) {
+	plan, err := dao.NewRoutePlanRepository(t.db).GetOrderRoutePlan(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	promised, err := dao.NewOrderRepository(t.db).GetDeliveryDates([]uint{orderID})
+	if err != nil {
+		return nil, err
+	}
+	etas, source := RouteETAs(plan, t.latestPoint(plan), now)
+	eta, _ := orderETA(plan, orderID, etas, source, promised[orderID], now)
+	return eta, nil
+}
+
+// NotifyLateRisk 在事务 tx 中锁定路线，按最近定位 latest 推算到达时间，通知预计晚于最晚送达时间的订单客户，
+// 每个送货站点只通知一次。返回新通知的订单
+func NotifyLateRisk(tx *gorm.DB, planID uint, latest *dao.TrackPoint, now time.Time) ([]OrderETA, error) {
+	routeRepo := dao.NewRoutePlanRepository(tx)
+	orderRepo := dao.NewOrderRepository(tx)
+	notificationRepo := dao.NewNotificationRepository(tx)
+
+	plan, err := routeRepo.GetRoutePlanForUpdate(planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status != models.RoutePlanExecuting {
+		return nil, nil
+	}
+	etas, source := RouteETAs(plan, latest, now)
+	var orderIDs []uint
+	for _, s := range plan.Stops {
+		if s.NodeType == routing.NodeDelivery && s.OrderID != nil && s.RiskNotifiedAt == nil {
+			orderIDs = append(orderIDs, *s.OrderID)
+		}
+	}
+	promised, err := orderRepo.GetDeliveryDates(orderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var notified []OrderETA
+	for k := range plan.Stops {
+		s := &plan.Stops[k]
+		if s.NodeType != routing.NodeDelivery || s.OrderID == nil || s.RiskNotifiedAt != nil {
+			continue
+		}
+		eta, ok := orderETA(plan, *s.OrderID, etas, source, promised[*s.OrderID], now)
+		if !ok || !eta.LateRisk {
+			continue
+		}
+		order, err := orderRepo.GetOrderByID(*s.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		err = notificationRepo.CreateNotification(&models.Notification{
+			Type:  "notice",
+			Title: "订单可能延误",
+			Content: fmt.Sprintf("您的订单 %s 预计 %s 送达，可能晚于承诺的 %s，我们正在协调处理",
+				order.OrderNumber, eta.ETA.Format(time.DateTime), eta.Deadline.Format(time.DateTime)),
+		}, []uint{order.UserID})
+		if err != nil {
+			return nil, err
+		}
+		s.RiskNotifiedAt = &now
+		if err := routeRepo.UpdateStopRiskNotified(s); err != nil {
+			return nil, err
+		}
+		notified = append(notified, *eta)
+	}
+	return notified, nil
+}
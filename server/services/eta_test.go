@@ -0,0 +1,103 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"testing"
+	"time"
+)
+
+func TestRouteETAsFromLatestPosition(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	plan := executingPlan(now)
+	started := now.Add(-time.Hour)
+	plan.StartedAt = &started
+	soon := now.Add(10 * time.Minute)
+	plan.Stops[4].Deadline = &soon
+
+	latest := &dao.TrackPoint{TimeStamp: now.Add(-time.Minute), Longitude: 121.5600, Latitude: 29.8700, Speed: 40}
+	etas, source := RouteETAs(plan, latest, now)
+	if source != ETASourceGPS {
+		t.Fatalf("source = %s, want %s", source, ETASourceGPS)
+	}
+	if !etas[1].Equal(*plan.Stops[1].ActualArrival) {
+		t.Fatalf("arrived stop eta = %s, want actual arrival", etas[1])
+	}
+	target := Point{Longitude: plan.Stops[2].Longitude, Latitude: plan.Stops[2].Latitude}
+	want := latest.TimeStamp.Add(travelAt(HaversineKm(trackPoint(*latest), target)*DISTANCE_ROAD_FACTOR, 40))
+	if !etas[2].Equal(want) {
+		t.Fatalf("next stop eta = %s, want %s at the reported speed", etas[2], want)
+	}
+	for k := 3; k < len(etas); k++ {
+		if etas[k].Before(etas[k-1]) {
+			t.Fatalf("eta of stop %d before stop %d", k, k-1)
+		}
+	}
+
+	late, _ := orderETA(plan, 1, etas, source, time.Time{}, now)
+	if !late.LateRisk || late.LateMinutes <= 0 || late.StopsAhead != 2 {
+		t.Fatalf("order 1 eta = %+v, want late risk with 2 stops ahead", late)
+	}
+	onTime, _ := orderETA(plan, 2, etas, source, time.Time{}, now)
+	if onTime.LateRisk {
+		t.Fatalf("order 2 eta = %+v, want on time", onTime)
+	}
+}
+
+// 延误风险按下单时承诺的送达时间判断，而不是送货时间窗结束
+func TestOrderETAUsesPromisedDeliveryTime(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	plan := executingPlan(now)
+	started := now.Add(-time.Hour)
+	plan.StartedAt = &started
+	etas, source := RouteETAs(plan, nil, now)
+
+	promised := etas[4].Add(-30 * time.Minute)
+	eta, _ := orderETA(plan, 1, etas, source, promised, now)
+	if !eta.Deadline.Equal(promised) || !eta.LateRisk || eta.LateMinutes != 30 {
+		t.Fatalf("order 1 eta = %+v, want 30 minutes late against the promised %s", eta, promised)
+	}
+	if etas[4].After(*plan.Stops[4].Deadline) {
+		t.Fatalf("eta %s after the delivery window close, want late only against the promised time", etas[4])
+	}
+
+	eta, _ = orderETA(plan, 1, etas, source, etas[4].Add(time.Hour), now)
+	if eta.LateRisk {
+		t.Fatalf("order 1 eta = %+v, want on time", eta)
+	}
+}
+
+func TestRouteETAsIgnoresStalePosition(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	plan := executingPlan(now)
+	started := now.Add(-time.Hour)
+	plan.StartedAt = &started
+
+	stale := &dao.TrackPoint{TimeStamp: now.Add(-ROUTE_ETA_STALE_AFTER - time.Minute), Longitude: 121.5600, Latitude: 29.8700, Speed: 40}
+	etas, source := RouteETAs(plan, stale, now)
+	want, _ := RouteETAs(plan, nil, now)
+	if source != ETASourcePlan {
+		t.Fatalf("source = %s, want %s for a stale position", source, ETASourcePlan)
+	}
+	for k := range etas {
+		if !etas[k].Equal(want[k]) {
+			t.Fatalf("eta of stop %d = %s, want plan estimate %s", k, etas[k], want[k])
+		}
+	}
+}
+
+func TestRouteETAsShiftsLateDeparture(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 30, 0, 0, time.Local)
+	planned := now.Add(-20 * time.Minute)
+	plan := &models.RoutePlan{
+		PlannedStart: planned,
+		Stops: []models.RouteStop{
+			{PlannedArrival: planned},
+			{PlannedArrival: planned.Add(40 * time.Minute)},
+		},
+	}
+	etas, source := RouteETAs(plan, nil, now)
+	if source != ETASourcePlan || !etas[1].Equal(now.Add(40*time.Minute)) {
+		t.Fatalf("etas = %v (%s), want planned arrivals shifted by the 20 minute delay", etas, source)
+	}
+}
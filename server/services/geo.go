@@ -0,0 +1,41 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+
+	"gorm.io/datatypes"
+)
+
+const earthRadiusKm = 6371.0
+
+// Point 经纬度坐标
+type Point struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+}
+
+// Valid 经纬度都为0时视为未知位置
+func (p Point) Valid() bool {
+	return p.Longitude != 0 || p.Latitude != 0
+}
+
+// HaversineKm 两点间的球面距离，单位千米
+func HaversineKm(a, b Point) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// AddressLocation 从寄件或收件信息中读取 longitude/latitude，没有坐标时返回 false
+func AddressLocation(info datatypes.JSON) (Point, bool) {
+	var p Point
+	if len(info) == 0 || json.Unmarshal(info, &p) != nil {
+		return Point{}, false
+	}
+	return p, p.Valid()
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+var ErrInvalidGeofence = errors.New("围栏需要至少3个顶点的多边形或大于0的半径")
+
+// GeofencePolygon 解析围栏的多边形顶点，圆形围栏返回空
+func GeofencePolygon(fence models.Geofence) ([]Point, error) {
+	if len(fence.Polygon) == 0 || string(fence.Polygon) == "null" {
+		return nil, nil
+	}
+	var coords [][2]float64
+	if err := json.Unmarshal(fence.Polygon, &coords); err != nil {
+		return nil, err
+	}
+	polygon := make([]Point, 0, len(coords))
+	for _, c := range coords {
+		polygon = append(polygon, Point{Longitude: c[0], Latitude: c[1]})
+	}
+	return polygon, nil
+}
+
+// ValidateGeofence 检查围栏形状是否完整
+func ValidateGeofence(fence models.Geofence) error {
+	polygon, err := GeofencePolygon(fence)
+	if err != nil {
+		return ErrInvalidGeofence
+	}
+	if len(polygon) == 0 && fence.RadiusKm <= 0 {
+		return ErrInvalidGeofence
+	}
+	if len(polygon) > 0 && len(polygon) < 3 {
+		return ErrInvalidGeofence
+	}
+	return nil
+}
+
+// fenceShape 解析过顶点的围栏
+type fenceShape struct {
+	fence   models.Geofence
+	polygon []Point
+}
+
+func (f fenceShape) contains(p Point) bool {
+	if len(f.polygon) > 0 {
+		return pointInPolygon(p, f.polygon)
+	}
+	return HaversineKm(p, Point{Longitude: f.fence.Longitude, Latitude: f.fence.Latitude}) <= f.fence.RadiusKm
+}
+
+// pointInPolygon 射线法判断点是否在多边形内
+func pointInPolygon(p Point, polygon []Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) &&
+			p.Longitude < (b.Longitude-a.Longitude)*(p.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// localKm 以 origin 为原点的平面坐标，单位千米，只适用于小范围
+func localKm(origin, p Point) (float64, float64) {
+	rad := math.Pi / 180
+	x := (p.Longitude - origin.Longitude) * rad * earthRadiusKm * math.Cos(origin.Latitude*rad)
+	y := (p.Latitude - origin.Latitude) * rad * earthRadiusKm
+	return x, y
+}
+
+// SegmentDistanceKm 点 p 到线段 ab 的距离
+func SegmentDistanceKm(p, a, b Point) float64 {
+	bx, by := localKm(a, b)
+	px, py := localKm(a, p)
+	t := 0.0
+	if l := bx*bx + by*by; l > 0 {
+		t = math.Max(0, math.Min(1, (px*bx+py*by)/l))
+	}
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// PathDistanceKm 点 p 到折线 path 的最短距离
+func PathDistanceKm(p Point, path []Point) float64 {
+	if len(path) == 1 {
+		return HaversineKm(p, path[0])
+	}
+	d := math.Inf(1)
+	for i := 1; i < len(path); i++ {
+		d = math.Min(d, SegmentDistanceKm(p, path[i-1], path[i]))
+	}
+	return d
+}
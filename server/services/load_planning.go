@@ -0,0 +1,188 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var ErrItemTooLarge = errors.New("单件商品超出冷链箱容量")
+
+// 容量比较的误差，避免浮点累加导致刚好装满时判为超出
+const loadEpsilon = 1e-9
+
+// ModuleSpec 冷链箱的容量规格
+type ModuleSpec struct {
+	InnerVolume float64 // 内部容积，立方米
+	MaxPayload  float64 // 最大载重，千克
+}
+
+// StandardModuleSpec 按 MODULE_INNER_VOLUME 和 MODULE_MAX_PAYLOAD 的标准规格
+func StandardModuleSpec() ModuleSpec {
+	return ModuleSpec{InnerVolume: MODULE_INNER_VOLUME, MaxPayload: MODULE_MAX_PAYLOAD}
+}
+
+// LoadItem 装入一个冷链箱的某个订单项及件数，Index 为订单项在规划输入中的下标
+type LoadItem struct {
+	Index       int
+	OrderItemID uint
+	ProductName string
+	Quantity    int
+	Weight      float64
+	Volume      float64
+}
+
+// PackedModule 一个冷链箱的装载内容，温区为箱内所有商品温区的交集
+type PackedModule struct {
+	MinTemperature float64
+	MaxTemperature float64
+	Weight         float64
+	Volume         float64
+	Items          []LoadItem
+	// 没有重量和体积规格的商品每件独占一个冷链箱，不再与其他商品拼箱
+	exclusive bool
+}
+
+// Primary 箱内体积最大的订单项，分配时冷链箱归属于该订单项
+func (m PackedModule) Primary() LoadItem {
+	primary := m.Items[0]
+	for _, item := range m.Items[1:] {
+		if item.Volume > primary.Volume || (item.Volume == primary.Volume && item.Weight > primary.Weight) {
+			primary = item
+		}
+	}
+	return primary
+}
+
+// Contents 装载内容，用于记录在分配历史中
+func (m PackedModule) Contents() []models.ModuleContent {
+	contents := make([]models.ModuleContent, len(m.Items))
+	for i, item := range m.Items {
+		contents[i] = models.ModuleContent{
+			OrderItemID: item.OrderItemID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			Weight:      item.Weight,
+			Volume:      item.Volume,
+		}
+	}
+	return contents
+}
+
+// LoadPlan 订单的装箱规划
+type LoadPlan struct {
+	Spec    ModuleSpec
+	Modules []PackedModule
+	Weight  float64
+	Volume  float64
+}
+
+// compatible 商品温区与箱内温区有交集时可以拼箱
+func (m *PackedModule) compatible(product models.Product) bool {
+	return math.Max(m.MinTemperature, product.MinTemperature) <= math.Min(m.MaxTemperature, product.MaxTemperature)
+}
+
+// capacity 箱内剩余空间还能放下的件数
+func (m *PackedModule) capacity(product models.Product, spec ModuleSpec) int {
+	n := math.MaxInt
+	if product.SpecVolume > 0 {
+		n = min(n, int(math.Floor((spec.InnerVolume-m.Volume)/product.SpecVolume+loadEpsilon)))
+	}
+	if product.SpecWeight > 0 {
+		n = min(n, int(math.Floor((spec.MaxPayload-m.Weight)/product.SpecWeight+loadEpsilon)))
+	}
+	return max(n, 0)
+}
+
+func (m *PackedModule) add(index int, item models.OrderItem, quantity int) {
+	if len(m.Items) == 0 {
+		m.MinTemperature, m.MaxTemperature = item.Product.MinTemperature, item.Product.MaxTemperature
+	} else {
+		m.MinTemperature = math.Max(m.MinTemperature, item.Product.MinTemperature)
+		m.MaxTemperature = math.Min(m.MaxTemperature, item.Product.MaxTemperature)
+	}
+	weight := float64(quantity) * item.Product.SpecWeight
+	volume := float64(quantity) * item.Product.SpecVolume
+	m.Weight += weight
+	m.Volume += volume
+	m.Items = append(m.Items, LoadItem{
+		Index:       index,
+		OrderItemID: item.ID,
+		ProductName: item.Product.ProductName,
+		Quantity:    quantity,
+		Weight:      weight,
+		Volume:      volume,
+	})
+}
+
+// PlanLoad 按商品的重量、体积和温区把订单项装入规格为 spec 的冷链箱，计算所需箱数和每箱的装载内容
+//
+// 按单件体积从大到小依次装箱（首次适应递减），每次尽量把同一订单项的多件放入已开的第一个能装下的箱子，
+// 温区没有交集的商品不能同箱，拼箱后箱内温区取交集。
+// 没有重量和体积规格的商品沿用按件数分配，每件独占一个冷链箱。单件超出规格时返回 ErrItemTooLarge
+func PlanLoad(items []models.OrderItem, spec ModuleSpec) (*LoadPlan, error) {
+	if spec.InnerVolume <= 0 || spec.MaxPayload <= 0 {
+		return nil, fmt.Errorf("冷链箱规格无效：容积 %.3f 立方米，载重 %.2f 千克", spec.InnerVolume, spec.MaxPayload)
+	}
+	order := make([]int, 0, len(items))
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			continue
+		}
+		p := item.Product
+		if p.SpecVolume > spec.InnerVolume+loadEpsilon || p.SpecWeight > spec.MaxPayload+loadEpsilon {
+			return nil, fmt.Errorf("%w：%s 每件 %.3f 立方米、%.2f 千克，冷链箱容积 %.3f 立方米、载重 %.2f 千克",
+				ErrItemTooLarge, p.ProductName, p.SpecVolume, p.SpecWeight, spec.InnerVolume, spec.MaxPayload)
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := items[order[a]].Product, items[order[b]].Product
+		if pa.SpecVolume != pb.SpecVolume {
+			return pa.SpecVolume > pb.SpecVolume
+		}
+		return pa.SpecWeight > pb.SpecWeight
+	})
+
+	plan := &LoadPlan{Spec: spec}
+	for _, i := range order {
+		item := items[i]
+		remaining := item.Quantity
+		if item.Product.SpecVolume <= 0 && item.Product.SpecWeight <= 0 {
+			for ; remaining > 0; remaining-- {
+				module := PackedModule{exclusive: true}
+				module.add(i, item, 1)
+				plan.Modules = append(plan.Modules, module)
+			}
+			continue
+		}
+		for k := range plan.Modules {
+			if remaining == 0 {
+				break
+			}
+			module := &plan.Modules[k]
+			if module.exclusive || !module.compatible(item.Product) {
+				continue
+			}
+			if n := min(module.capacity(item.Product, spec), remaining); n > 0 {
+				module.add(i, item, n)
+				remaining -= n
+			}
+		}
+		for remaining > 0 {
+			var module PackedModule
+			n := min(module.capacity(item.Product, spec), remaining)
+			module.add(i, item, n)
+			plan.Modules = append(plan.Modules, module)
+			remaining -= n
+		}
+	}
+
+	for _, m := range plan.Modules {
+		plan.Weight += m.Weight
+		plan.Volume += m.Volume
+	}
+	return plan, nil
+}
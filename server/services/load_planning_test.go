@@ -0,0 +1,72 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"errors"
+	"testing"
+)
+
+func TestPlanLoadPacksCompatibleItemsTogether(t *testing.T) {
+	spec := ModuleSpec{InnerVolume: 0.1, MaxPayload: 50}
+	items := []models.OrderItem{
+		// 冷藏疫苗，每箱最多放 3 件
+		{ID: 1, Quantity: 4, Product: models.Product{ProductName: "疫苗", MinTemperature: 2, MaxTemperature: 8, SpecVolume: 0.03, SpecWeight: 5}},
+		// 冷冻品与冷藏品温区没有交集
+		{ID: 2, Quantity: 2, Product: models.Product{ProductName: "冻肉", MinTemperature: -20, MaxTemperature: -10, SpecVolume: 0.02, SpecWeight: 20}},
+		// 与疫苗温区有交集，可以拼进疫苗的第二箱
+		{ID: 3, Quantity: 3, Product: models.Product{ProductName: "试剂", MinTemperature: 4, MaxTemperature: 10, SpecVolume: 0.01, SpecWeight: 1}},
+	}
+	plan, err := PlanLoad(items, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Modules) != 3 {
+		t.Fatalf("got %d modules, want 3: %+v", len(plan.Modules), plan.Modules)
+	}
+
+	packed := map[uint]int{}
+	for _, m := range plan.Modules {
+		if m.Volume > spec.InnerVolume+loadEpsilon || m.Weight > spec.MaxPayload+loadEpsilon {
+			t.Fatalf("module over capacity: %+v", m)
+		}
+		if m.MinTemperature > m.MaxTemperature {
+			t.Fatalf("module range [%v, %v] is empty", m.MinTemperature, m.MaxTemperature)
+		}
+		frozen, chilled := false, false
+		for _, item := range m.Items {
+			packed[item.OrderItemID] += item.Quantity
+			p := items[item.Index].Product
+			if m.MinTemperature < p.MinTemperature || m.MaxTemperature > p.MaxTemperature {
+				t.Fatalf("module range [%v, %v] outside %s range", m.MinTemperature, m.MaxTemperature, p.ProductName)
+			}
+			frozen = frozen || p.MaxTemperature < 0
+			chilled = chilled || p.MinTemperature > 0
+		}
+		if frozen && chilled {
+			t.Fatalf("frozen and chilled items share a module: %+v", m.Items)
+		}
+	}
+	for _, item := range items {
+		if packed[item.ID] != item.Quantity {
+			t.Fatalf("order item %d packed %d, want %d", item.ID, packed[item.ID], item.Quantity)
+		}
+	}
+}
+
+func TestPlanLoadRejectsOversizedItem(t *testing.T) {
+	items := []models.OrderItem{{Quantity: 1, Product: models.Product{ProductName: "整箱血浆", SpecVolume: 0.2, SpecWeight: 10}}}
+	if _, err := PlanLoad(items, ModuleSpec{InnerVolume: 0.1, MaxPayload: 50}); !errors.Is(err, ErrItemTooLarge) {
+		t.Fatalf("err = %v, want ErrItemTooLarge", err)
+	}
+}
+
+func TestPlanLoadWithoutSpecUsesOneModulePerUnit(t *testing.T) {
+	items := []models.OrderItem{{Quantity: 3}}
+	plan, err := PlanLoad(items, ModuleSpec{InnerVolume: 0.1, MaxPayload: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Modules) != 3 {
+		t.Fatalf("got %d modules, want one per unit", len(plan.Modules))
+	}
+}
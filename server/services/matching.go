@@ -0,0 +1,164 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModuleRequirement 一个订单项对冷链箱的要求
+type ModuleRequirement struct {
+	dao.ModuleFilter
+	// 寄件地坐标，未知时不按距离排序
+	Origin *Point
+	// 所有仓库，模块没有上报位置时按所在仓库的坐标计算距离
+	Depots []models.Depot
+}
+
+// RequirementFor 根据商品温区和配送时长计算订单项的要求
+func RequirementFor(order *models.RentalOrder, item models.OrderItem, now time.Time) ModuleRequirement {
+	req := ModuleRequirement{
+		ModuleFilter: dao.ModuleFilter{
+			MinTemperature: item.Product.MinTemperature,
+			MaxTemperature: item.Product.MaxTemperature,
+			MinBattery:     RequiredBattery(order.DeliveryDate.Sub(now)),
+		},
+	}
+	if origin, ok := AddressLocation(order.SenderInfo); ok {
+		req.Origin = &origin
+	}
+	return req
+}
+
+// RequiredBattery 配送时长 window 所需的电量百分比
+func RequiredBattery(window time.Duration) float64 {
+	if window < MIN_DELIVERY_WINDOW {
+		window = MIN_DELIVERY_WINDOW
+	}
+	if window > MAX_DELIVERY_WINDOW {
+		window = MAX_DELIVERY_WINDOW
+	}
+	return math.Min(100, BATTERY_RESERVE+window.Hours()*BATTERY_DRAIN_PER_HOUR)
+}
+
+// ModuleMatch 被选中的冷链箱及选择理由
+type ModuleMatch struct {
+	Module models.Module
+	// 距寄件地的距离，位置未知时为 -1
+	DistanceKm float64
+	Reason     string
+}
+
+// moduleLocation 模块的位置，没有上报位置时取所在仓库的坐标
+func moduleLocation(m models.Module, depots []models.Depot) Point {
+	location := Point{Longitude: m.Longitude, Latitude: m.Latitude}
+	if !location.Valid() {
+		if depot, ok := findDepot(depots, m.DepotID); ok {
+			return DepotLocation(depot)
+		}
+	}
+	return location
+}
+
+func rangeSlack(m models.Module, req ModuleRequirement) float64 {
+	return (req.MinTemperature - m.SupportedMinTemperature) + (m.SupportedMaxTemperature - req.MaxTemperature)
+}
+
+// RankModules 对满足硬性条件的候选模块排序：
+// 距寄件地近的优先，位置未知的排在最后；
+// 距离相同时温区余量小的优先，避免冷冻箱被冷藏商品占用；
+// 再按电量从高到低
+func RankModules(candidates []models.Module, req ModuleRequirement) []ModuleMatch {
+	matches := make([]ModuleMatch, 0, len(candidates))
+	for _, m := range candidates {
+		distance := -1.0
+		location := moduleLocation(m, req.Depots)
+		if req.Origin != nil && location.Valid() {
+			distance = HaversineKm(*req.Origin, location)
+		}
+		matches = append(matches, ModuleMatch{Module: m, DistanceKm: distance})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if (a.DistanceKm < 0) != (b.DistanceKm < 0) {
+			return a.DistanceKm >= 0
+		}
+		if a.DistanceKm != b.DistanceKm {
+			return a.DistanceKm < b.DistanceKm
+		}
+		if sa, sb := rangeSlack(a.Module, req), rangeSlack(b.Module, req); sa != sb {
+			return sa < sb
+		}
+		if a.Module.BatteryLevel != b.Module.BatteryLevel {
+			return a.Module.BatteryLevel > b.Module.BatteryLevel
+		}
+		return a.Module.ID < b.Module.ID
+	})
+
+	for i := range matches {
+		matches[i].Reason = explainMatch(matches[i], req)
+	}
+	return matches
+}
+
+// SelectModules 从 RankModules 排好序的候选中选出 quantity 个：
+// 优先由距寄件地最近、且能凑齐数量的仓库整单出库，没有这样的仓库时按排序结果跨仓库选取
+func SelectModules(ranked []ModuleMatch, req ModuleRequirement, quantity int) []ModuleMatch {
+	if req.Origin != nil {
+		byDepot := make(map[uint][]ModuleMatch)
+		for _, m := range ranked {
+			if m.Module.DepotID != nil {
+				byDepot[*m.Module.DepotID] = append(byDepot[*m.Module.DepotID], m)
+			}
+		}
+		for _, depot := range NearestDepots(req.Depots, *req.Origin) {
+			if matches := byDepot[depot.ID]; len(matches) >= quantity {
+				return matches[:quantity]
+			}
+		}
+	}
+	return ranked[:quantity]
+}
+
+func explainMatch(match ModuleMatch, req ModuleRequirement) string {
+	m := match.Module
+	parts := []string{
+		fmt.Sprintf("温区[%.1f, %.1f]覆盖商品要求[%.1f, %.1f]",
+			m.SupportedMinTemperature, m.SupportedMaxTemperature, req.MinTemperature, req.MaxTemperature),
+		fmt.Sprintf("电量%.1f%%不低于所需%.1f%%", m.BatteryLevel, req.MinBattery),
+	}
+	if depot, ok := findDepot(req.Depots, m.DepotID); ok {
+		parts = append(parts, "从仓库"+depot.Name+"出库")
+	}
+	switch {
+	case match.DistanceKm >= 0:
+		parts = append(parts, fmt.Sprintf("距寄件地%.1fkm", match.DistanceKm))
+	case req.Origin == nil:
+		parts = append(parts, "寄件地坐标未知，未按距离排序")
+	default:
+		parts = append(parts, "存放位置未知")
+	}
+	return strings.Join(parts, "，")
+}
+
+// ExplainShortage 统计空闲模块不满足要求的原因
+func ExplainShortage(unassigned []models.Module, req ModuleRequirement) string {
+	var temperature, battery, capacity int
+	for _, m := range unassigned {
+		switch {
+		case m.SupportedMinTemperature > req.MinTemperature || m.SupportedMaxTemperature < req.MaxTemperature:
+			temperature++
+		case m.BatteryLevel < req.MinBattery:
+			battery++
+		case m.InnerVolume < req.MinVolume || m.MaxPayload < req.MinPayload:
+			capacity++
+		}
+	}
+	return fmt.Sprintf("空闲%d个，其中温区不符%d个，电量低于%.1f%%的%d个，容量不足%d个",
+		len(unassigned), temperature, req.MinBattery, battery, capacity)
+}
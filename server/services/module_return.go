@@ -0,0 +1,222 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrModuleNotAssigned   = errors.New("冷链箱未分配给订单，无法归还")
+	ErrModuleNotReturned   = errors.New("冷链箱尚未归还，无法检查")
+	ErrChecklistIncomplete = errors.New("清洁检查项未填写完整")
+)
+
+// InspectionItem 清洁检查项
+type InspectionItem struct {
+	Key  string
+	Name string
+}
+
+// InspectionItems 冷链箱归还后需要逐项确认的清洁检查项
+var InspectionItems = []InspectionItem{
+	{Key: "cleaned", Name: "清洁消毒"},
+	{Key: "sealed", Name: "箱体密封完好"},
+	{Key: "sensor_ok", Name: "温度传感器正常"},
+	{Key: "charged", Name: "电池已充电"},
+}
+
+// InspectionResult 一次清洁检查的结果，检查项未通过或填写了损坏说明时模块标记为故障
+type InspectionResult struct {
+	Checklist   map[string]bool
+	DamageNote  string
+	InspectorID uint
+}
+
+// Passed 所有检查项都通过且没有损坏
+func (r InspectionResult) Passed() bool {
+	for _, item := range InspectionItems {
+		if !r.Checklist[item.Key] {
+			return false
+		}
+	}
+	return strings.TrimSpace(r.DamageNote) == ""
+}
+
+func (r InspectionResult) validate() error {
+	var missing []string
+	for _, item := range InspectionItems {
+		if _, ok := r.Checklist[item.Key]; !ok {
+			missing = append(missing, item.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecklistIncomplete, strings.Join(missing, "、"))
+	}
+	return nil
+}
+
+// ReturnModules 在事务 tx 中将模块标记为已归还到仓库 depotID，返回涉及的订单。
+// depotID 为0时模块仍归属原仓库，否则与调拨一样锁定仓库并检查归还后不超过仓库容量
+func ReturnModules(tx *gorm.DB, moduleIDs []uint, depotID uint, now time.Time) ([]uint, error) {
+	moduleTxn := dao.NewModuleRepository(tx)
+	depotTxn := dao.NewDepotRepository(tx)
+	var depot *models.Depot
+	if depotID != 0 {
+		var err error
+		if depot, err = depotTxn.GetDepotForUpdate(depotID); err != nil {
+			return nil, err
+		}
+	}
+
+	var orderIDs []uint
+	seen := make(map[uint]bool)
+	for _, moduleID := range moduleIDs {
+		module, err := moduleTxn.GetModuleForUpdate(moduleID)
+		if err != nil {
+			return nil, err
+		}
+		if module.Status != models.StatusAssigned {
+			return nil, fmt.Errorf("%w: %s", ErrModuleNotAssigned, module.DeviceID)
+		}
+
+		assignment, err := returnModule(moduleTxn, module, depot, now)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[assignment.OrderID] {
+			seen[assignment.OrderID] = true
+			orderIDs = append(orderIDs, assignment.OrderID)
+		}
+	}
+	if depot != nil {
+		if err := checkDepotCapacity(depotTxn, depot); err != nil {
+			return nil, err
+		}
+	}
+	return orderIDs, nil
+}
+
+// ReturnOrderModules 将订单仍占用的模块全部标记为已归还，depot 为空时模块仍归属原仓库
+func ReturnOrderModules(tx *gorm.DB, orderID uint, depot *models.Depot, now time.Time) error {
+	moduleTxn := dao.NewModuleRepository(tx)
+	modules, err := moduleTxn.ListOrderModules(orderID)
+	if err != nil {
+		return err
+	}
+	for i := range modules {
+		if modules[i].Status != models.StatusAssigned {
+			continue
+		}
+		if _, err := returnModule(moduleTxn, &modules[i], depot, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 模块保留 OrderItemID 直到检查完毕，便于在检查前追溯来源订单
+func returnModule(moduleTxn *dao.ModuleRepository, module *models.Module, depot *models.Depot, now time.Time) (*models.ModuleAssignment, error) {
+	assignment, err := moduleTxn.GetOpenAssignment(module.ID)
+	if err != nil {
+		return nil, err
+	}
+	assignment.ReturnedAt = &now
+	if depot != nil {
+		assignment.ReturnDepot = depot.Name
+		if err := moduleTxn.UpdateModuleDepot(module.ID, depot.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := moduleTxn.SaveAssignment(assignment); err != nil {
+		return nil, err
+	}
+	if err := moduleTxn.UpdateModuleStatus(module.ID, models.StatusReturned, module.OrderItemID); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// OrderModulesReturned 订单占用的模块是否都已归还
+func OrderModulesReturned(tx *gorm.DB, orderID uint) (bool, error) {
+	modules, err := dao.NewModuleRepository(tx).ListOrderModules(orderID)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range modules {
+		if m.Status == models.StatusAssigned {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CompleteModuleReturn 订单已送达且冷链箱全部归还时，在事务 tx 中推进订单到已归还，返回是否推进。
+// 订单尚未送达时只保留冷链箱的归还记录，送达时状态机会再次检查
+func (m *OrderStateMachine) CompleteModuleReturn(tx *gorm.DB, orderID uint, actor Actor, remark string) (bool, error) {
+	returned, err := OrderModulesReturned(tx, orderID)
+	if err != nil || !returned {
+		return false, err
+	}
+	order, err := dao.NewOrderRepository(tx).GetOrderForUpdate(orderID)
+	if err != nil {
+		return false, err
+	}
+	if order.OrderStatus.StatusName != models.OrderDelivered {
+		return false, nil
+	}
+	if _, err := m.Fire(tx, orderID, EventReturnModules, actor, remark); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// InspectModule 记录已归还模块的清洁检查结果并释放模块，
+// 检查通过的模块回到空闲状态，否则标记为故障等待维修
+func InspectModule(tx *gorm.DB, moduleID uint, result InspectionResult, now time.Time) (*models.Module, error) {
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+
+	moduleTxn := dao.NewModuleRepository(tx)
+	module, err := moduleTxn.GetModuleForUpdate(moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if module.Status != models.StatusReturned {
+		return nil, fmt.Errorf("%w: %s", ErrModuleNotReturned, module.DeviceID)
+	}
+
+	assignment, err := moduleTxn.GetOpenAssignment(module.ID)
+	if err != nil {
+		return nil, err
+	}
+	checklist, err := json.Marshal(result.Checklist)
+	if err != nil {
+		return nil, err
+	}
+	assignment.Checklist = checklist
+	assignment.Damaged = strings.TrimSpace(result.DamageNote) != ""
+	assignment.DamageNote = result.DamageNote
+	assignment.InspectorID = result.InspectorID
+	assignment.ReleasedAt = &now
+	if err := moduleTxn.SaveAssignment(assignment); err != nil {
+		return nil, err
+	}
+
+	module.Status = models.StatusUnassigned
+	if !result.Passed() {
+		module.Status = models.StatusFaulty
+	}
+	module.OrderItemID = nil
+	if err := moduleTxn.UpdateModuleStatus(module.ID, module.Status, nil); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
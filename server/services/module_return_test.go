@@ -0,0 +1,110 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 归还到仓库与调拨一样受仓库容量限制
+func TestReturnModulesChecksDepotCapacity(t *testing.T) {
+	db := openOrderDB(t)
+	depot := models.Depot{Name: "东仓", Address: "宁波", Capacity: 2}
+	if err := db.Create(&depot).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 仓库中已存放一个空闲冷链箱
+	stored := models.Module{DeviceID: "DEV-STORED", Status: models.StatusUnassigned, DepotID: &depot.ID}
+	if err := db.Create(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	orderID := createOrder(t, db, 5, models.OrderDelivered)
+	modules := assignModules(t, db, orderID, 2)
+
+	returnTo := func(moduleIDs []uint) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			_, err := ReturnModules(tx, moduleIDs, depot.ID, time.Now())
+			return err
+		})
+	}
+	if err := returnTo(modules); !errors.Is(err, ErrDepotFull) {
+		t.Fatalf("return 2 modules to depot with 1 free slot: err = %v, want ErrDepotFull", err)
+	}
+	var assigned int64
+	if err := db.Model(&models.Module{}).Where("id IN ? AND status = ?", modules, models.StatusAssigned).Count(&assigned).Error; err != nil {
+		t.Fatal(err)
+	}
+	if assigned != 2 {
+		t.Fatalf("%d modules still assigned after rejected return, want 2", assigned)
+	}
+
+	if err := returnTo(modules[:1]); err != nil {
+		t.Fatalf("return 1 module: %v", err)
+	}
+	var module models.Module
+	if err := db.First(&module, modules[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if module.Status != models.StatusReturned || module.DepotID == nil || *module.DepotID != depot.ID {
+		t.Fatalf("module = %+v, want returned to depot %d", module, depot.ID)
+	}
+}
+
+// 已审核的订单部分冷链箱归还后取消：未归还的直接释放，已归还的仍需清洁检查
+func TestCancelAfterPartialReturnKeepsReturnedModulesForInspection(t *testing.T) {
+	db := openOrderDB(t)
+	fsm := NewOrderStateMachine().OnEvent(EventCancel, func(tc *TransitionContext) error {
+		return dao.NewModuleRepository(tc.Tx).ReleaseOrderModules(tc.Order.ID)
+	})
+	staff := Actor{UserID: 1, RoleName: models.RoleManager}
+	orderID := createOrder(t, db, 5, models.OrderApproved)
+	modules := assignModules(t, db, orderID, 2)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := ReturnModules(tx, modules[:1], 0, time.Now())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("return module: %v", err)
+	}
+	if _, err := fsm.Fire(db, orderID, EventCancel, staff, ""); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+
+	var returned, released models.Module
+	if err := db.First(&returned, modules[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&released, modules[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if returned.Status != models.StatusReturned {
+		t.Fatalf("returned module status = %s, want %s until inspected", returned.Status, models.StatusReturned)
+	}
+	if released.Status != models.StatusUnassigned || released.OrderItemID != nil {
+		t.Fatalf("unreturned module = %+v, want released", released)
+	}
+
+	checklist := make(map[string]bool)
+	for _, item := range InspectionItems {
+		checklist[item.Key] = true
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := InspectModule(tx, modules[0], InspectionResult{Checklist: checklist, InspectorID: 1}, time.Now())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("inspect returned module: %v", err)
+	}
+	var open int64
+	if err := db.Model(&models.ModuleAssignment{}).Where("order_id = ? AND released_at IS NULL", orderID).Count(&open).Error; err != nil {
+		t.Fatal(err)
+	}
+	if open != 0 {
+		t.Fatalf("%d assignments still open after inspection, want 0", open)
+	}
+}
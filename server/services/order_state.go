@@ -0,0 +1,228 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderEvent 触发订单状态流转的事件
+type OrderEvent string
+
+const (
+	EventCreate        OrderEvent = "create"         // 创建订单
+	EventPay           OrderEvent = "pay"            // 支付
+	EventApprove       OrderEvent = "approve"        // 审核通过
+	EventReject        OrderEvent = "reject"         // 驳回
+	EventDispatch      OrderEvent = "dispatch"       // 装车发车
+	EventDepart        OrderEvent = "depart"         // 离开仓库，开始运输
+	EventDeliver       OrderEvent = "deliver"        // 送达收件人
+	EventReturnModules OrderEvent = "return_modules" // 冷链箱归还
+	EventClose         OrderEvent = "close"          // 订单完成
+	EventCancel        OrderEvent = "cancel"         // 取消订单
+)
+
+var (
+	ErrInvalidTransition = errors.New("订单当前状态不允许该操作")
+	ErrForbidden         = errors.New("无权执行该操作")
+)
+
+// Actor 触发状态流转的操作人，系统触发时 UserID 为0
+type Actor struct {
+	UserID   uint
+	RoleName string
+}
+
+func (a Actor) isStaff() bool {
+	return a.RoleName == models.RoleAdmin || a.RoleName == models.RoleManager
+}
+
+// TransitionContext 守卫和副作用可以使用的上下文，Tx 为当前事务
+type TransitionContext struct {
+	Tx     *gorm.DB
+	Order  *models.RentalOrder
+	Event  OrderEvent
+	From   string
+	To     string
+	Actor  Actor
+	Remark string
+}
+
+// Guard 返回错误时拒绝本次流转
+type Guard func(tc *TransitionContext) error
+
+// Effect 在状态更新后、事务提交前执行，返回错误时整个流转回滚
+type Effect func(tc *TransitionContext) error
+
+type transition struct {
+	from  []string
+	to    string
+	guard Guard
+}
+
+// OrderStateMachine 订单状态机
+//
+//	待支付 -pay-> 已支付 -approve-> 已审核 -dispatch-> 已发车 -depart-> 运输中
+//	  -deliver-> 已送达 -return_modules-> 已归还 -close-> 已完成
+//	已支付 -reject-> 已驳回
+//	待支付/已支付/已审核 -cancel-> 已取消
+type OrderStateMachine struct {
+	transitions map[OrderEvent]transition
+	effects     map[OrderEvent][]Effect
+}
+
+// 只有订单所属用户或管理员可以操作
+func ownerOrStaff(tc *TransitionContext) error {
+	if tc.Actor.isStaff() || tc.Actor.UserID == tc.Order.UserID {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// 只有管理员可以操作
+func staffOnly(tc *TransitionContext) error {
+	if tc.Actor.isStaff() {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// NewOrderStateMachine 创建状态机，订单状态由数据库迁移写入 order_statuses。
+// 副作用通过 OnEvent 注册，整个服务共用一个状态机，保证各入口触发的事件副作用一致
+func NewOrderStateMachine() *OrderStateMachine {
+	m := &OrderStateMachine{
+		transitions: map[OrderEvent]transition{
+			EventPay:           {from: []string{models.OrderPendingPayment}, to: models.OrderPaid, guard: ownerOrStaff},
+			EventApprove:       {from: []string{models.OrderPaid}, to: models.OrderApproved, guard: staffOnly},
+			EventReject:        {from: []string{models.OrderPaid}, to: models.OrderRejected, guard: staffOnly},
+			EventDispatch:      {from: []string{models.OrderApproved}, to: models.OrderDispatched, guard: staffOnly},
+			EventDepart:        {from: []string{models.OrderDispatched}, to: models.OrderInTransit, guard: staffOnly},
+			EventDeliver:       {from: []string{models.OrderInTransit}, to: models.OrderDelivered, guard: staffOnly},
+			EventReturnModules: {from: []string{models.OrderDelivered}, to: models.OrderModulesReturned, guard: staffOnly},
+			EventClose:         {from: []string{models.OrderModulesReturned}, to: models.OrderClosed, guard: staffOnly},
+			EventCancel: {
+				from:  []string{models.OrderPendingPayment, models.OrderPaid, models.OrderApproved},
+				to:    models.OrderCancelled,
+				guard: cancelGuard,
+			},
+		},
+		effects: make(map[OrderEvent][]Effect),
+	}
+	// 送达前冷链箱已全部归还的订单，送达后直接进入已归还
+	return m.OnEvent(EventDeliver, func(tc *TransitionContext) error {
+		_, err := m.CompleteModuleReturn(tc.Tx, tc.Order.ID, tc.Actor, "冷链箱已在送达前全部归还")
+		return err
+	})
+}
+
+// 客户只能在审核前取消订单，管理员在发车前都可以取消
+func cancelGuard(tc *TransitionContext) error {
+	if tc.Actor.isStaff() {
+		return nil
+	}
+	if tc.Actor.UserID != tc.Order.UserID {
+		return ErrForbidden
+	}
+	if tc.From == models.OrderApproved {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// OnEvent 注册事件的副作用，按注册顺序执行
+func (m *OrderStateMachine) OnEvent(event OrderEvent, effect Effect) *OrderStateMachine {
+	m.effects[event] = append(m.effects[event], effect)
+	return m
+}
+
+// Can 检查订单在状态 from 下能否触发事件
+func (m *OrderStateMachine) Can(from string, event OrderEvent) bool {
+	t, ok := m.transitions[event]
+	if !ok {
+		return false
+	}
+	for _, s := range t.from {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// Fire 在事务 tx 中触发订单状态流转并记录，订单会被加行锁
+func (m *OrderStateMachine) Fire(tx *gorm.DB, orderID uint, event OrderEvent, actor Actor, remark string) (*TransitionContext, error) {
+	t, ok := m.transitions[event]
+	if !ok {
+		return nil, fmt.Errorf("未知的订单事件: %s", event)
+	}
+
+	orderTxn := dao.NewOrderRepository(tx)
+	order, err := orderTxn.GetOrderForUpdate(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &TransitionContext{
+		Tx:     tx,
+		Order:  order,
+		Event:  event,
+		From:   order.OrderStatus.StatusName,
+		To:     t.to,
+		Actor:  actor,
+		Remark: remark,
+	}
+	if !m.Can(tc.From, event) {
+		return nil, ErrInvalidTransition
+	}
+	if t.guard != nil {
+		if err := t.guard(tc); err != nil {
+			return nil, err
+		}
+	}
+
+	statusID, err := orderTxn.GetOrderStatusIDByName(t.to)
+	if err != nil {
+		return nil, err
+	}
+	if err := orderTxn.UpdateStatus(order.ID, statusID); err != nil {
+		return nil, err
+	}
+	order.StatusID = statusID
+
+	if err := m.record(orderTxn, tc); err != nil {
+		return nil, err
+	}
+	for _, effect := range m.effects[event] {
+		if err := effect(tc); err != nil {
+			return nil, err
+		}
+	}
+	return tc, nil
+}
+
+// RecordCreated 记录订单创建，需在创建订单的事务中调用
+func (m *OrderStateMachine) RecordCreated(tx *gorm.DB, order *models.RentalOrder, actor Actor) error {
+	return m.record(dao.NewOrderRepository(tx), &TransitionContext{
+		Order: order,
+		Event: EventCreate,
+		To:    models.OrderPendingPayment,
+		Actor: actor,
+	})
+}
+
+func (m *OrderStateMachine) record(orderTxn *dao.OrderRepository, tc *TransitionContext) error {
+	return orderTxn.CreateStatusTransition(&models.OrderStatusTransition{
+		OrderID:    tc.Order.ID,
+		Event:      string(tc.Event),
+		FromStatus: tc.From,
+		ToStatus:   tc.To,
+		ActorID:    tc.Actor.UserID,
+		ActorRole:  tc.Actor.RoleName,
+		Remark:     tc.Remark,
+		CreatedAt:  time.Now(),
+	})
+}
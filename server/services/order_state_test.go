@@ -0,0 +1,310 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// openOrderDB 在 openTestDB 的基础上建立订单、订单项、订单状态和状态流转记录表，订单状态与迁移时写入的一致
+func openOrderDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTestDB(t)
+	var err error
+	if db.Dialector.Name() == "sqlite" {
+		// 订单表的 MySQL 默认值在 SQLite 中不可用，手动建表
+		err = db.Exec(`CREATE TABLE rental_orders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at DATETIME, updated_at DATETIME, deleted_at DATETIME,
+			order_number TEXT, user_id INTEGER, status_id INTEGER, total_price REAL,
+			sender_info TEXT, receiver_info TEXT, delivery_date DATETIME, order_note TEXT,
+			rental_days INTEGER DEFAULT 1, deposit REAL, quote TEXT)`).Error
+		if err == nil {
+			err = db.Exec(`CREATE TABLE order_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				created_at DATETIME, updated_at DATETIME, deleted_at DATETIME,
+				order_id INTEGER, product_id INTEGER, quantity INTEGER DEFAULT 1, unit_price REAL)`).Error
+		}
+	} else {
+		err = db.Migrator().DropTable(&models.RentalOrder{}, &models.OrderItem{})
+		if err == nil {
+			err = db.AutoMigrate(&models.RentalOrder{}, &models.OrderItem{})
+		}
+	}
+	if err == nil {
+		err = db.Migrator().DropTable(&models.OrderStatus{}, &models.OrderStatusTransition{})
+	}
+	if err == nil {
+		err = db.AutoMigrate(&models.OrderStatus{}, &models.OrderStatusTransition{})
+	}
+	for _, name := range models.OrderStatuses {
+		if err == nil {
+			err = db.Create(&models.OrderStatus{StatusName: name}).Error
+		}
+	}
+	if err != nil {
+		t.Fatalf("create order tables: %v", err)
+	}
+	return db
+}
+
+// createOrder 创建用户 userID 的订单，状态为 status
+func createOrder(t *testing.T, db *gorm.DB, userID uint, status string) uint {
+	t.Helper()
+	var s models.OrderStatus
+	if err := db.Where("status_name = ?", status).First(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.RentalOrder{
+		OrderNumber:  fmt.Sprintf("T%d", time.Now().UnixNano()),
+		UserID:       userID,
+		StatusID:     s.ID,
+		SenderInfo:   datatypes.JSON("{}"),
+		ReceiverInfo: datatypes.JSON("{}"),
+		DeliveryDate: time.Now(),
+	}
+	if err := db.Omit(clause.Associations).Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order.ID
+}
+
+func orderStatus(t *testing.T, db *gorm.DB, orderID uint) string {
+	t.Helper()
+	var name string
+	err := db.Raw(`SELECT s.status_name FROM rental_orders o JOIN order_statuses s ON s.id = o.status_id
+		WHERE o.id = ?`, orderID).Scan(&name).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestOrderStateMachineCan(t *testing.T) {
+	fsm := NewOrderStateMachine()
+	cases := []struct {
+		from  string
+		event OrderEvent
+		want  bool
+	}{
+		{models.OrderPendingPayment, EventPay, true},
+		{models.OrderPendingPayment, EventApprove, false},
+		{models.OrderPaid, EventApprove, true},
+		{models.OrderPaid, EventReject, true},
+		{models.OrderApproved, EventDispatch, true},
+		{models.OrderDispatched, EventDepart, true},
+		{models.OrderInTransit, EventDeliver, true},
+		{models.OrderInTransit, EventReturnModules, false},
+		{models.OrderDelivered, EventReturnModules, true},
+		{models.OrderModulesReturned, EventClose, true},
+		{models.OrderApproved, EventCancel, true},
+		{models.OrderDispatched, EventCancel, false},
+		{models.OrderClosed, EventCancel, false},
+		{models.OrderPaid, EventCreate, false},
+	}
+	for _, c := range cases {
+		if got := fsm.Can(c.from, c.event); got != c.want {
+			t.Errorf("Can(%s, %s) = %v, want %v", c.from, c.event, got, c.want)
+		}
+	}
+}
+
+func TestOrderStateMachineGuards(t *testing.T) {
+	db := openOrderDB(t)
+	fsm := NewOrderStateMachine()
+	owner := Actor{UserID: 5, RoleName: models.RoleMerchant}
+	other := Actor{UserID: 6, RoleName: models.RoleIndividual}
+	staff := Actor{UserID: 1, RoleName: models.RoleManager}
+
+	cases := []struct {
+		name    string
+		status  string
+		event   OrderEvent
+		actor   Actor
+		wantErr error
+	}{
+		{"owner pays", models.OrderPendingPayment, EventPay, owner, nil},
+		{"other user pays", models.OrderPendingPayment, EventPay, other, ErrForbidden},
+		{"customer approves", models.OrderPaid, EventApprove, owner, ErrForbidden},
+		{"staff approves", models.OrderPaid, EventApprove, staff, nil},
+		{"owner cancels before approval", models.OrderPaid, EventCancel, owner, nil},
+		{"owner cancels after approval", models.OrderApproved, EventCancel, owner, ErrInvalidTransition},
+		{"staff cancels after approval", models.OrderApproved, EventCancel, staff, nil},
+		{"staff delivers before departure", models.OrderDispatched, EventDeliver, staff, ErrInvalidTransition},
+	}
+	for _, c := range cases {
+		orderID := createOrder(t, db, owner.UserID, c.status)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := fsm.Fire(tx, orderID, c.event, c.actor, "")
+			return err
+		})
+		if !errors.Is(err, c.wantErr) {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.wantErr)
+		}
+		if c.wantErr != nil && orderStatus(t, db, orderID) != c.status {
+			t.Errorf("%s: status changed after rejected transition", c.name)
+		}
+	}
+}
+
+func TestOrderStateMachineFireRecordsAndRunsEffects(t *testing.T) {
+	db := openOrderDB(t)
+	staff := Actor{UserID: 1, RoleName: models.RoleAdmin}
+
+	var calls []string
+	fail := false
+	fsm := NewOrderStateMachine().
+		OnEvent(EventReject, func(tc *TransitionContext) error {
+			calls = append(calls, "first:"+tc.From+"->"+tc.To)
+			return nil
+		}).
+		OnEvent(EventReject, func(tc *TransitionContext) error {
+			calls = append(calls, "second:"+tc.Remark)
+			if fail {
+				return errors.New("effect failed")
+			}
+			return nil
+		})
+
+	// 副作用失败时整个流转回滚
+	failed := createOrder(t, db, 5, models.OrderPaid)
+	fail = true
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := fsm.Fire(tx, failed, EventReject, staff, "库存不足")
+		return err
+	})
+	if err == nil {
+		t.Fatal("fire with failing effect succeeded")
+	}
+	if got := orderStatus(t, db, failed); got != models.OrderPaid {
+		t.Fatalf("status = %s after failed effect, want %s", got, models.OrderPaid)
+	}
+
+	fail = false
+	calls = nil
+	orderID := createOrder(t, db, 5, models.OrderPaid)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := fsm.Fire(tx, orderID, EventReject, staff, "库存不足")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := orderStatus(t, db, orderID); got != models.OrderRejected {
+		t.Fatalf("status = %s, want %s", got, models.OrderRejected)
+	}
+	if len(calls) != 2 || calls[0] != "first:"+models.OrderPaid+"->"+models.OrderRejected || calls[1] != "second:库存不足" {
+		t.Fatalf("effects = %v, want both in registration order", calls)
+	}
+
+	var transitions []models.OrderStatusTransition
+	if err := db.Where("order_id IN ?", []uint{failed, orderID}).Find(&transitions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 1 {
+		t.Fatalf("transitions = %+v, want only the committed one", transitions)
+	}
+	tr := transitions[0]
+	if tr.OrderID != orderID || tr.Event != string(EventReject) || tr.FromStatus != models.OrderPaid ||
+		tr.ToStatus != models.OrderRejected || tr.ActorID != staff.UserID || tr.Remark != "库存不足" {
+		t.Fatalf("transition = %+v", tr)
+	}
+}
+
+// assignModules 为订单分配 n 个冷链箱，返回模块ID
+func assignModules(t *testing.T, db *gorm.DB, orderID uint, n int) []uint {
+	t.Helper()
+	item := models.OrderItem{OrderID: orderID, Quantity: 1}
+	if err := db.Omit(clause.Associations).Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for i := 0; i < n; i++ {
+		module := models.Module{
+			DeviceID:    fmt.Sprintf("DEV-%d-%d", orderID, i),
+			Status:      models.StatusAssigned,
+			OrderItemID: &item.ID,
+		}
+		if err := db.Create(&module).Error; err != nil {
+			t.Fatal(err)
+		}
+		err := db.Create(&models.ModuleAssignment{
+			ModuleID:    module.ID,
+			DeviceID:    module.DeviceID,
+			OrderID:     orderID,
+			OrderItemID: item.ID,
+			AssignedAt:  time.Now(),
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, module.ID)
+	}
+	return ids
+}
+
+func TestModulesReturnedBeforeDeliveryAdvanceOrderAtDelivery(t *testing.T) {
+	db := openOrderDB(t)
+	fsm := NewOrderStateMachine()
+	staff := Actor{UserID: 1, RoleName: models.RoleManager}
+	fire := func(orderID uint, event OrderEvent) {
+		t.Helper()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := fsm.Fire(tx, orderID, event, staff, "")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	returnModules := func(orderID uint, moduleIDs []uint) bool {
+		t.Helper()
+		var done bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if _, err := ReturnModules(tx, moduleIDs, 0, time.Now()); err != nil {
+				return err
+			}
+			var err error
+			done, err = fsm.CompleteModuleReturn(tx, orderID, staff, "冷链箱已全部归还")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return done
+	}
+
+	// 运输途中冷链箱全部归还，订单保持运输中，送达后直接进入已归还
+	early := createOrder(t, db, 5, models.OrderInTransit)
+	if returnModules(early, assignModules(t, db, early, 2)) {
+		t.Fatal("order in transit advanced on module return")
+	}
+	if got := orderStatus(t, db, early); got != models.OrderInTransit {
+		t.Fatalf("status = %s, want %s", got, models.OrderInTransit)
+	}
+	fire(early, EventDeliver)
+	if got := orderStatus(t, db, early); got != models.OrderModulesReturned {
+		t.Fatalf("status after delivery = %s, want %s", got, models.OrderModulesReturned)
+	}
+
+	// 只归还部分冷链箱的订单送达后停在已送达，剩余冷链箱归还时进入已归还
+	partial := createOrder(t, db, 5, models.OrderInTransit)
+	modules := assignModules(t, db, partial, 2)
+	returnModules(partial, modules[:1])
+	fire(partial, EventDeliver)
+	if got := orderStatus(t, db, partial); got != models.OrderDelivered {
+		t.Fatalf("status after delivery = %s, want %s", got, models.OrderDelivered)
+	}
+	if !returnModules(partial, modules[1:]) {
+		t.Fatal("delivered order did not advance after all modules returned")
+	}
+	if got := orderStatus(t, db, partial); got != models.OrderModulesReturned {
+		t.Fatalf("status = %s, want %s", got, models.OrderModulesReturned)
+	}
+}
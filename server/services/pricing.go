@@ -0,0 +1,219 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// 报价明细的费用类型
+const (
+	QuoteService  = "service"  // 商品服务费，按商品分类单价计
+	QuoteRental   = "rental"   // 冷链箱租金，按温区和租期计
+	QuoteDistance = "distance" // 配送费，按配送里程计
+	QuoteUrgent   = "urgent"   // 加急费
+	QuoteDeposit  = "deposit"  // 冷链箱押金，归还后退还
+)
+
+// 冷链箱温区等级，温区上限低于0℃为冷冻
+const (
+	TemperatureFrozen  = "frozen"
+	TemperatureChilled = "chilled"
+)
+
+// QuoteLine 报价的一项费用
+type QuoteLine struct {
+	Kind        string  `json:"kind"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+	// 订单项在请求中的下标，只有商品服务费有
+	ItemIndex *int `json:"item_index,omitempty"`
+}
+
+// Quote 订单的分项报价，Total 为应付金额，包含可退还的押金
+type Quote struct {
+	Lines       []QuoteLine `json:"lines"`
+	Subtotal    float64     `json:"subtotal"` // 不含押金的费用
+	Deposit     float64     `json:"deposit"`
+	Total       float64     `json:"total"`
+	ModuleCount int         `json:"module_count"`
+	RentalDays  int         `json:"rental_days"`
+	DistanceKm  float64     `json:"distance_km"`
+	// 收寄地址无法定位时只收配送起步价
+	DistanceKnown bool      `json:"distance_known"`
+	Urgent        bool      `json:"urgent"`
+	QuotedAt      time.Time `json:"quoted_at"`
+}
+
+// QuoteRequest 计算报价的输入，Items 需带有商品及其分类单价
+type QuoteRequest struct {
+	Items        []models.OrderItem
+	RentalDays   int
+	DeliveryDate time.Time
+	// 配送里程，DistanceKnown 为 false 时不计超出起步里程的费用
+	DistanceKm    float64
+	DistanceKnown bool
+}
+
+func roundPrice(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// TemperatureClass 冷链箱温区等级
+func TemperatureClass(module PackedModule) string {
+	if module.MaxTemperature < 0 {
+		return TemperatureFrozen
+	}
+	return TemperatureChilled
+}
+
+func temperatureFactor(class string) float64 {
+	if class == TemperatureFrozen {
+		return PRICING_FROZEN_FACTOR
+	}
+	return PRICING_CHILLED_FACTOR
+}
+
+// PriceOrder 在 now 时刻计算订单的分项报价：
+// 商品服务费按分类单价乘件数；冷链箱数由 PlanLoad 算出，租金按温区系数、租期和 PRICING_MODULE_DAILY_RATE 计；
+// 配送费为起步价加超出 PRICING_DISTANCE_INCLUDED_KM 的里程费；
+// 距送达时间不足 PRICING_URGENT_WITHIN 时租金和配送费加收 PRICING_URGENT_RATE；
+// 每个冷链箱另收 PRICING_MODULE_DEPOSIT 押金
+func PriceOrder(req QuoteRequest, now time.Time) (*Quote, *LoadPlan, error) {
+	load, err := PlanLoad(req.Items, StandardModuleSpec())
+	if err != nil {
+		return nil, nil, err
+	}
+	quote := &Quote{
+		ModuleCount:   len(load.Modules),
+		RentalDays:    max(req.RentalDays, 1),
+		DistanceKm:    roundPrice(req.DistanceKm),
+		DistanceKnown: req.DistanceKnown,
+		QuotedAt:      now,
+	}
+	add := func(line QuoteLine) {
+		line.Amount = roundPrice(line.Quantity * line.UnitPrice)
+		quote.Lines = append(quote.Lines, line)
+	}
+
+	for i, item := range req.Items {
+		if item.Quantity <= 0 {
+			continue
+		}
+		index := i
+		add(QuoteLine{
+			Kind:        QuoteService,
+			Description: fmt.Sprintf("%s（%s）", item.Product.ProductName, item.Product.Category.CategoryName),
+			Quantity:    float64(item.Quantity),
+			UnitPrice:   item.Product.Category.Price,
+			ItemIndex:   &index,
+		})
+	}
+
+	classes := map[string]int{}
+	for _, m := range load.Modules {
+		classes[TemperatureClass(m)]++
+	}
+	var surchargeable float64
+	for _, class := range []string{TemperatureFrozen, TemperatureChilled} {
+		count := classes[class]
+		if count == 0 {
+			continue
+		}
+		name := "冷藏"
+		if class == TemperatureFrozen {
+			name = "冷冻"
+		}
+		add(QuoteLine{
+			Kind:        QuoteRental,
+			Description: fmt.Sprintf("%s冷链箱租金，%d个 × %d天", name, count, quote.RentalDays),
+			Quantity:    float64(count * quote.RentalDays),
+			UnitPrice:   roundPrice(PRICING_MODULE_DAILY_RATE * temperatureFactor(class)),
+		})
+		surchargeable += quote.Lines[len(quote.Lines)-1].Amount
+	}
+
+	add(QuoteLine{
+		Kind:        QuoteDistance,
+		Description: fmt.Sprintf("配送起步价，含%.0f千米", PRICING_DISTANCE_INCLUDED_KM),
+		Quantity:    1,
+		UnitPrice:   PRICING_DISTANCE_BASE_FEE,
+	})
+	surchargeable += PRICING_DISTANCE_BASE_FEE
+	if extra := req.DistanceKm - PRICING_DISTANCE_INCLUDED_KM; req.DistanceKnown && extra > 0 {
+		add(QuoteLine{
+			Kind:        QuoteDistance,
+			Description: fmt.Sprintf("超出里程，全程%.1f千米", req.DistanceKm),
+			Quantity:    roundPrice(extra),
+			UnitPrice:   PRICING_PER_KM,
+		})
+		surchargeable += quote.Lines[len(quote.Lines)-1].Amount
+	}
+
+	if lead := req.DeliveryDate.Sub(now); lead < PRICING_URGENT_WITHIN {
+		quote.Urgent = true
+		add(QuoteLine{
+			Kind:        QuoteUrgent,
+			Description: fmt.Sprintf("加急，距送达不足%.0f小时，租金和配送费加收%.0f%%", PRICING_URGENT_WITHIN.Hours(), PRICING_URGENT_RATE*100),
+			Quantity:    1,
+			UnitPrice:   roundPrice(surchargeable * PRICING_URGENT_RATE),
+		})
+	}
+
+	for _, line := range quote.Lines {
+		quote.Subtotal += line.Amount
+	}
+	quote.Subtotal = roundPrice(quote.Subtotal)
+	if quote.ModuleCount > 0 {
+		add(QuoteLine{
+			Kind:        QuoteDeposit,
+			Description: "冷链箱押金，归还后退还",
+			Quantity:    float64(quote.ModuleCount),
+			UnitPrice:   PRICING_MODULE_DEPOSIT,
+		})
+		quote.Deposit = quote.Lines[len(quote.Lines)-1].Amount
+	}
+	quote.Total = roundPrice(quote.Subtotal + quote.Deposit)
+	return quote, load, nil
+}
+
+// DeliveryRoute 单个订单的配送路线：从距寄件地最近的仓库出发，经寄件地取货后送到收件地
+type DeliveryRoute struct {
+	Depot      Point
+	Pickup     Point
+	Delivery   Point
+	PickupKm   float64 // 仓库到寄件地的道路距离
+	DistanceKm float64 // 仓库经寄件地到收件地的道路距离
+}
+
+// DeliveryRoute 按路径规划使用的距离数据来源估算订单的配送路线，没有仓库时从 ROUTE_DEPOT 出发。
+// 寄件或收件地址无法定位时返回 ErrGeocodeNotFound
+func (rp *RoutePlanner) DeliveryRoute(ctx context.Context, sender, receiver datatypes.JSON, depots []models.Depot) (*DeliveryRoute, error) {
+	pickup, err := ResolveLocation(ctx, rp.Distances, sender)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := ResolveLocation(ctx, rp.Distances, receiver)
+	if err != nil {
+		return nil, err
+	}
+	route := &DeliveryRoute{Depot: ROUTE_DEPOT, Pickup: pickup, Delivery: delivery}
+	if nearest := NearestDepots(depots, pickup); len(nearest) > 0 {
+		route.Depot = DepotLocation(nearest[0])
+	}
+	if route.PickupKm, err = rp.Distances.Distance(ctx, route.Depot, pickup); err != nil {
+		return nil, err
+	}
+	delivered, err := rp.Distances.Distance(ctx, pickup, delivery)
+	if err != nil {
+		return nil, err
+	}
+	route.DistanceKm = route.PickupKm + delivered
+	return route, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"testing"
+	"time"
+)
+
+func pricingItems() []models.OrderItem {
+	vaccine := models.Category{CategoryName: "疫苗", Price: 10}
+	meat := models.Category{CategoryName: "肉类", Price: 20}
+	return []models.OrderItem{
+		// 每箱最多放 3 件，需 2 个冷藏箱
+		{Quantity: 4, Product: models.Product{ProductName: "流感疫苗", Category: vaccine, MinTemperature: 2, MaxTemperature: 8, SpecVolume: 0.03, SpecWeight: 5}},
+		// 需 1 个冷冻箱
+		{Quantity: 2, Product: models.Product{ProductName: "冻牛肉", Category: meat, MinTemperature: -20, MaxTemperature: -10, SpecVolume: 0.02, SpecWeight: 20}},
+	}
+}
+
+func TestPriceOrderItemizesUrgentOrder(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	quote, load, err := PriceOrder(QuoteRequest{
+		Items:         pricingItems(),
+		RentalDays:    3,
+		DeliveryDate:  now.Add(12 * time.Hour),
+		DistanceKm:    25,
+		DistanceKnown: true,
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.ModuleCount != 3 || len(load.Modules) != 3 {
+		t.Fatalf("module count = %d, want 3", quote.ModuleCount)
+	}
+
+	amounts := map[string]float64{}
+	for _, line := range quote.Lines {
+		amounts[line.Kind] += line.Amount
+	}
+	// 服务费 4×10 + 2×20；租金冷藏 2箱×3天×30 + 冷冻 1箱×3天×45；配送费 50 + 15千米×3
+	want := map[string]float64{
+		QuoteService:  80,
+		QuoteRental:   315,
+		QuoteDistance: 95,
+		QuoteUrgent:   123, // (315 + 95) × 0.3
+		QuoteDeposit:  600,
+	}
+	for kind, amount := range want {
+		if amounts[kind] != amount {
+			t.Fatalf("%s = %v, want %v (lines %+v)", kind, amounts[kind], amount, quote.Lines)
+		}
+	}
+	if !quote.Urgent || quote.Subtotal != 613 || quote.Deposit != 600 || quote.Total != 1213 {
+		t.Fatalf("quote = %+v, want urgent subtotal 613 deposit 600 total 1213", quote)
+	}
+}
+
+func TestPriceOrderUnknownDistanceChargesBaseFeeOnly(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	quote, _, err := PriceOrder(QuoteRequest{
+		Items:        pricingItems(),
+		DeliveryDate: now.Add(72 * time.Hour),
+		DistanceKm:   80,
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Urgent || quote.RentalDays != 1 {
+		t.Fatalf("quote = %+v, want 1 rental day and no urgent surcharge", quote)
+	}
+	var distance float64
+	for _, line := range quote.Lines {
+		if line.Kind == QuoteDistance {
+			distance += line.Amount
+		}
+	}
+	if distance != PRICING_DISTANCE_BASE_FEE {
+		t.Fatalf("distance fee = %v, want base fee %v", distance, PRICING_DISTANCE_BASE_FEE)
+	}
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/services/routing"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 重新规划策略
+const (
+	RerouteSwap     = "swap"     // 先绕行到最近的仓库更换冷链箱，再送完剩余站点
+	ReroutePriority = "priority" // 故障冷链箱所装的货物按温区从窄到宽优先送达
+)
+
+var (
+	ErrUnknownStrategy = errors.New("未知的重新规划策略")
+	ErrNoSwapDepot     = errors.New("没有存放空闲冷链箱的仓库，无法绕行更换")
+	ErrRouteChanged    = errors.New("重新规划期间路线有新的到达记录，请重试")
+)
+
+// RerouteOptions 重新规划的参数
+type RerouteOptions struct {
+	Strategy string
+	// 车辆当前位置
+	Position Point
+	// swap 策略绕行的仓库
+	Depot *models.Depot
+	// 剩余站点涉及的订单
+	Orders map[uint]models.RentalOrder
+	// 故障冷链箱所装的订单，为空时 priority 策略按温区排列车上所有订单
+	Failing []uint
+}
+
+// Reroute 重新规划的结果，由 SaveReroute 保存
+type Reroute struct {
+	PlanID uint
+	// 新路线的站点，首个为车辆当前位置
+	Stops      []models.RouteStop
+	DistanceKm float64
+	// 重新规划时尚未到达的原站点
+	Remaining []uint
+	// 预计晚于送达期限的订单
+	Late   []uint
+	Reason string
+}
+
+// temperatureSpan 订单商品中最窄的温区宽度，越窄对温度越敏感
+func temperatureSpan(order models.RentalOrder) float64 {
+	span := math.Inf(1)
+	for _, item := range order.OrderItems {
+		span = math.Min(span, item.Product.MaxTemperature-item.Product.MinTemperature)
+	}
+	return span
+}
+
+// stopService 站点的停靠服务时长
+func stopService(stop models.RouteStop) time.Duration {
+	switch stop.NodeType {
+	case routing.NodePickup:
+		return ROUTE_PICKUP_SERVICE
+	case routing.NodeDelivery:
+		return ROUTE_DELIVERY_SERVICE
+	default:
+		return ROUTE_SWAP_SERVICE
+	}
+}
+
+// priorityOrders 车上需优先送达的订单，按温区从窄到宽排列
+func priorityOrders(opts RerouteOptions, onboard []uint) []uint {
+	failing := make(map[uint]bool, len(opts.Failing))
+	for _, id := range opts.Failing {
+		failing[id] = true
+	}
+	var orders []uint
+	for _, id := range onboard {
+		if len(failing) == 0 || failing[id] {
+			orders = append(orders, id)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return temperatureSpan(opts.Orders[orders[i]]) < temperatureSpan(opts.Orders[orders[j]])
+	})
+	return orders
+}
+
+// routeBuilder 从车辆当前位置起依次追加站点，计算里程和计划到达时间
+type routeBuilder struct {
+	points []Point
+	dist   [][]float64
+	stops  []models.RouteStop
+	cur    int       // 当前所在的点
+	clock  time.Time // 离开当前点的时间
+	total  float64
+}
+
+// visit 前往点 pt 并按 stop 的类型停靠，送货早于收货时段时等待
+func (b *routeBuilder) visit(pt int, stop models.RouteStop) {
+	leg := b.dist[b.cur][pt]
+	arrival := b.clock.Add(travelTime(leg))
+	if stop.NodeType == routing.NodeDelivery && stop.Deadline != nil {
+		if open, _ := deliveryWindow(*stop.Deadline); arrival.Before(open) {
+			arrival = open
+		}
+	}
+	b.stops = append(b.stops, models.RouteStop{
+		Sequence:       len(b.stops),
+		NodeType:       stop.NodeType,
+		OrderID:        stop.OrderID,
+		Longitude:      b.points[pt].Longitude,
+		Latitude:       b.points[pt].Latitude,
+		LegDistanceKm:  leg,
+		PlannedArrival: arrival,
+		Deadline:       stop.Deadline,
+	})
+	b.cur = pt
+	b.clock = arrival.Add(stopService(stop))
+	b.total += leg
+}
+
+// Reroute 按车辆当前位置和尚未到达的站点重新规划执行中的路线：
+// swap 先绕行到 opts.Depot，priority 先送达车上需优先的订单，其余站点重新求解。
+// 已取货的订单在当前位置虚拟取货，保证送货节点仍可参与求解
+func (rp *RoutePlanner) Reroute(ctx context.Context, plan *models.RoutePlan, opts RerouteOptions, now time.Time) (*Reroute, error) {
+	var remaining []models.RouteStop
+	pending := make(map[uint]bool)
+	result := &Reroute{PlanID: plan.ID}
+	for _, s := range plan.Stops {
+		if s.ActualArrival != nil {
+			continue
+		}
+		result.Remaining = append(result.Remaining, s.ID)
+		// 未到达的仓库站点不再保留，是否绕行由本次规划决定
+		if s.NodeType == routing.NodeDepot || s.OrderID == nil {
+			continue
+		}
+		remaining = append(remaining, s)
+		if s.NodeType == routing.NodePickup {
+			pending[*s.OrderID] = true
+		}
+	}
+
+	// 点的顺序：当前位置、绕行仓库、剩余站点
+	points := []Point{opts.Position}
+	via := -1
+	switch opts.Strategy {
+	case RerouteSwap:
+		if opts.Depot == nil {
+			return nil, ErrNoSwapDepot
+		}
+		via = len(points)
+		points = append(points, DepotLocation(*opts.Depot))
+		result.Reason = "冷链箱故障，绕行" + opts.Depot.Name + "更换冷链箱"
+	case ReroutePriority:
+		result.Reason = "冷链箱故障，优先送达温控要求高的货物"
+	default:
+		return nil, ErrUnknownStrategy
+	}
+	offset := len(points)
+	for _, s := range remaining {
+		points = append(points, Point{Longitude: s.Longitude, Latitude: s.Latitude})
+	}
+	dist, err := DistanceMatrix(ctx, rp.Distances, points)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &routeBuilder{points: points, dist: dist, clock: now}
+	b.stops = append(b.stops, models.RouteStop{
+		NodeType:       routing.NodeDepot,
+		Longitude:      opts.Position.Longitude,
+		Latitude:       opts.Position.Latitude,
+		PlannedArrival: now,
+		ActualArrival:  &now,
+		ArrivalSource:  models.ArrivalSourceReroute,
+	})
+	if via >= 0 {
+		b.visit(via, models.RouteStop{NodeType: routing.NodeDepot})
+	}
+
+	visited := make([]bool, len(remaining))
+	if opts.Strategy == ReroutePriority {
+		var onboard []uint
+		for _, s := range remaining {
+			if s.NodeType == routing.NodeDelivery && !pending[*s.OrderID] {
+				onboard = append(onboard, *s.OrderID)
+			}
+		}
+		for _, orderID := range priorityOrders(opts, onboard) {
+			for i, s := range remaining {
+				if s.NodeType == routing.NodeDelivery && *s.OrderID == orderID && !visited[i] {
+					b.visit(offset+i, s)
+					visited[i] = true
+				}
+			}
+		}
+	}
+
+	if err := rp.solveRemaining(b, remaining, visited, offset, opts, pending, plan.Vehicle.MaxCapacity); err != nil {
+		return nil, err
+	}
+
+	result.Stops = b.stops
+	result.DistanceKm = b.total
+	for _, s := range b.stops {
+		if s.Deadline != nil && s.PlannedArrival.After(*s.Deadline) {
+			result.Late = append(result.Late, *s.OrderID)
+		}
+	}
+	return result, nil
+}
+
+// solveRemaining 从 b 的当前位置求解未访问站点的顺序并追加到 b
+func (rp *RoutePlanner) solveRemaining(b *routeBuilder, remaining []models.RouteStop, visited []bool,
+	offset int, opts RerouteOptions, pending map[uint]bool, capacity int) error {
+	// nodes 为求解节点对应的点，stopOf 为对应的剩余站点，虚拟取货节点为 -1
+	nodes := []int{b.cur}
+	stopOf := []int{-1}
+	windows := []routing.Window{{Latest: math.Inf(1)}}
+	service := []float64{0}
+	var requests []routing.Request
+
+	addNode := func(pt, stop int) {
+		nodes = append(nodes, pt)
+		stopOf = append(stopOf, stop)
+		w := routing.Window{Latest: math.Inf(1)}
+		service = append(service, 0)
+		if stop >= 0 {
+			s := remaining[stop]
+			service[len(service)-1] = stopService(s).Hours()
+			if s.NodeType == routing.NodeDelivery && s.Deadline != nil {
+				open, _ := deliveryWindow(*s.Deadline)
+				w = routing.Window{Earliest: math.Max(0, open.Sub(b.clock).Hours()), Latest: s.Deadline.Sub(b.clock).Hours()}
+			}
+		}
+		windows = append(windows, w)
+	}
+	for i, s := range remaining {
+		if visited[i] || s.NodeType != routing.NodeDelivery {
+			continue
+		}
+		request := routing.Request{Pickup: len(nodes), Delivery: len(nodes) + 1, Load: 1}
+		if order, ok := opts.Orders[*s.OrderID]; ok {
+			request.Load = orderLoad(order)
+		}
+		if pending[*s.OrderID] {
+			pickup := -1
+			for k, p := range remaining {
+				if p.NodeType == routing.NodePickup && *p.OrderID == *s.OrderID {
+					pickup = k
+				}
+			}
+			if pickup < 0 {
+				return fmt.Errorf("订单 %d 缺少取货站点", *s.OrderID)
+			}
+			addNode(offset+pickup, pickup)
+		} else {
+			// 已在车上的货物在当前位置虚拟取货
+			addNode(b.cur, -1)
+		}
+		addNode(offset+i, i)
+		requests = append(requests, request)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	sub := newMatrix(len(nodes))
+	for i, from := range nodes {
+		for j, to := range nodes {
+			sub[i][j] = b.dist[from][to]
+		}
+	}
+	solution, err := routing.Solve(&routing.Problem{
+		Dist:       sub,
+		Requests:   requests,
+		Capacities: []int{capacity},
+		Speed:      ROUTE_SPEED_KMH,
+		Windows:    windows,
+		Service:    service,
+	}, rp.ACO)
+	if err != nil {
+		return err
+	}
+
+	route := solution.Routes[0]
+	// 无法安排的请求按原顺序排在最后，不丢弃站点
+	for _, r := range solution.Unserved {
+		route = append(route, requests[r].Pickup, requests[r].Delivery)
+	}
+	for _, node := range route {
+		if stop := stopOf[node]; stop >= 0 {
+			b.visit(nodes[node], remaining[stop])
+		}
+	}
+	return nil
+}
+
+// RouteStopOrders 读取路线站点涉及的订单
+func RouteStopOrders(db *gorm.DB, stops []models.RouteStop) (map[uint]models.RentalOrder, error) {
+	orders := make(map[uint]models.RentalOrder)
+	repo := dao.NewOrderRepository(db)
+	for _, s := range stops {
+		if s.OrderID == nil {
+			continue
+		}
+		if _, ok := orders[*s.OrderID]; ok {
+			continue
+		}
+		order, err := repo.GetOrderByID(*s.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		orders[order.ID] = *order
+	}
+	return orders, nil
+}
+
+// 告警级别由低到高，与 ClickHouse 中 alarm_record.alarm_level 的取值一致
+var alarmSeverity = map[string]int{"LOW": 1, "MEDIUM": 2, "HIGH": 3}
+
+// hasFailureAlarm 是否有告警达到 minLevel，未知级别的告警不计
+func hasFailureAlarm(alarms []dao.TelemetryAlarm, minLevel string) bool {
+	threshold, ok := alarmSeverity[minLevel]
+	if !ok {
+		threshold = alarmSeverity["HIGH"]
+	}
+	for _, a := range alarms {
+		if alarmSeverity[a.AlarmLevel] >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// FailingOrders 找出冷链箱故障的订单：指定了 moduleIDs 时为装有这些冷链箱的订单，
+// 否则为冷链箱已标记故障，或 since 之后分析器产生过达到 ROUTE_FAILURE_ALARM_LEVEL 告警的订单
+func FailingOrders(db *gorm.DB, telemetry *dao.TelemetryRepository, orderIDs, moduleIDs []uint,
+	since, now time.Time) ([]uint, error) {
+	flagged := make(map[uint]bool, len(moduleIDs))
+	for _, id := range moduleIDs {
+		flagged[id] = true
+	}
+
+	var failing []uint
+	moduleRepo := dao.NewModuleRepository(db)
+	for _, orderID := range orderIDs {
+		modules, err := moduleRepo.ListOrderModules(orderID)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, m := range modules {
+			if flagged[m.ID] || (len(flagged) == 0 && m.Status == models.StatusFaulty) {
+				found = true
+			}
+		}
+		if !found && len(flagged) == 0 && telemetry != nil {
+			windows, err := OrderTelemetryWindows(db, orderID, now)
+			if err != nil {
+				return nil, err
+			}
+			for i := range windows {
+				if windows[i].Start.Before(since) {
+					windows[i].Start = since
+				}
+			}
+			alarms, err := telemetry.ListAlarms(windows)
+			if err != nil {
+				return nil, err
+			}
+			found = hasFailureAlarm(alarms, ROUTE_FAILURE_ALARM_LEVEL)
+		}
+		if found {
+			failing = append(failing, orderID)
+		}
+	}
+	return failing, nil
+}
+
+// SwapDepot 距 p 最近的存放有空闲冷链箱的仓库
+func SwapDepot(depots []models.Depot, unassigned []models.Module, p Point) (*models.Depot, error) {
+	stocked := make(map[uint]bool)
+	for _, m := range unassigned {
+		if m.DepotID != nil && m.IsEnabled {
+			stocked[*m.DepotID] = true
+		}
+	}
+	for _, d := range NearestDepots(depots, p) {
+		if stocked[d.ID] {
+			return &d, nil
+		}
+	}
+	return nil, ErrNoSwapDepot
+}
+
+// SaveReroute 在事务 tx 中用重新规划的路线接替原路线，并通知受影响订单的客户。
+// 计算期间原路线有新的到达记录时返回 ErrRouteChanged
+func SaveReroute(tx *gorm.DB, reroute *Reroute, actor Actor, now time.Time) (*models.RoutePlan, error) {
+	repo := dao.NewRoutePlanRepository(tx)
+	old, err := repo.GetRoutePlanForUpdate(reroute.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if old.Status != models.RoutePlanExecuting {
+		return nil, ErrRoutePlanState
+	}
+	remaining := make(map[uint]bool, len(reroute.Remaining))
+	for _, id := range reroute.Remaining {
+		remaining[id] = true
+	}
+	for _, s := range old.Stops {
+		if (s.ActualArrival == nil) != remaining[s.ID] {
+			return nil, ErrRouteChanged
+		}
+	}
+
+	old.Status = models.RoutePlanReplaced
+	old.CompletedAt = &now
+	if err := repo.UpdateRoutePlan(old); err != nil {
+		return nil, err
+	}
+	plans := []models.RoutePlan{{
+		VehicleID:    old.VehicleID,
+		DepotID:      old.DepotID,
+		Status:       models.RoutePlanExecuting,
+		DistanceKm:   reroute.DistanceKm,
+		PlannedStart: now,
+		PlannedEnd:   reroute.Stops[len(reroute.Stops)-1].PlannedArrival,
+		StartedAt:    &now,
+		ReplacesID:   &old.ID,
+		RerouteNote:  reroute.Reason,
+		CreatedBy:    actor.UserID,
+		Stops:        reroute.Stops,
+	}}
+	if err := repo.CreateRoutePlans(plans); err != nil {
+		return nil, err
+	}
+	plan := &plans[0]
+	plan.Vehicle = old.Vehicle
+
+	if err := notifyRerouted(tx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// notifyRerouted 通知路线上尚未送达订单的客户新的预计送达时间
+func notifyRerouted(tx *gorm.DB, plan *models.RoutePlan) error {
+	orderRepo := dao.NewOrderRepository(tx)
+	notificationRepo := dao.NewNotificationRepository(tx)
+	for _, s := range plan.Stops {
+		if s.NodeType != routing.NodeDelivery {
+			continue
+		}
+		order, err := orderRepo.GetOrderByID(*s.OrderID)
+		if err != nil {
+			return err
+		}
+		err = notificationRepo.CreateNotification(&models.Notification{
+			Type:  "notice",
+			Title: "配送路线已调整",
+			Content: fmt.Sprintf("您的订单 %s 因%s调整了配送路线，预计 %s 送达",
+				order.OrderNumber, plan.RerouteNote, s.PlannedArrival.Format(time.DateTime)),
+		}, []uint{order.UserID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
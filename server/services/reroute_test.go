@@ -0,0 +1,120 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/services/routing"
+	"context"
+	"testing"
+	"time"
+)
+
+// executingPlan 已取走订单1、尚未取订单2的路线：仓库、取1、取2、送1、送2
+func executingPlan(now time.Time) *models.RoutePlan {
+	first, second := uint(1), uint(2)
+	departed, picked := now.Add(-time.Hour), now.Add(-30*time.Minute)
+	deadline := time.Date(now.Year(), now.Month(), now.Day(), 23, 0, 0, 0, now.Location())
+	return &models.RoutePlan{
+		ID:      7,
+		Status:  models.RoutePlanExecuting,
+		Vehicle: models.Vehicle{MaxCapacity: 4},
+		Stops: []models.RouteStop{
+			{ID: 1, NodeType: routing.NodeDepot, Longitude: 121.5440, Latitude: 29.9680, ActualArrival: &departed},
+			{ID: 2, NodeType: routing.NodePickup, OrderID: &first, Longitude: 121.5790, Latitude: 29.8520, ActualArrival: &picked},
+			{ID: 3, NodeType: routing.NodePickup, OrderID: &second, Longitude: 121.6200, Latitude: 29.9200},
+			{ID: 4, NodeType: routing.NodeDelivery, OrderID: &second, Longitude: 121.4300, Latitude: 29.8600, Deadline: &deadline},
+			{ID: 5, NodeType: routing.NodeDelivery, OrderID: &first, Longitude: 121.5480, Latitude: 29.8900, Deadline: &deadline},
+		},
+	}
+}
+
+func rerouteOrders() map[uint]models.RentalOrder {
+	product := func(min, max float64) []models.OrderItem {
+		return []models.OrderItem{{Quantity: 1, Product: models.Product{MinTemperature: min, MaxTemperature: max}}}
+	}
+	return map[uint]models.RentalOrder{
+		1: {ID: 1, OrderItems: product(2, 8)},
+		2: {ID: 2, OrderItems: product(-20, 10)},
+	}
+}
+
+func testPlanner() *RoutePlanner {
+	return NewRoutePlanner(HaversineProvider{RoadFactor: 1.3},
+		routing.ACOConfig{Ants: 5, Iterations: 20, Alpha: 1, Beta: 3, Rho: 0.05, GlobalBestEvery: 5, Seed: 1})
+}
+
+func TestReroutePriorityDeliversFailingOrderFirst(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	reroute, err := testPlanner().Reroute(context.Background(), executingPlan(now), RerouteOptions{
+		Strategy: ReroutePriority,
+		Position: Point{Longitude: 121.5600, Latitude: 29.8700},
+		Orders:   rerouteOrders(),
+		Failing:  []uint{1},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(reroute.Stops); got != 4 {
+		t.Fatalf("got %d stops, want position and 3 remaining stops", got)
+	}
+	if s := reroute.Stops[0]; s.ArrivalSource != models.ArrivalSourceReroute || s.ActualArrival == nil {
+		t.Fatalf("first stop = %+v, want the vehicle position marked as arrived", s)
+	}
+	if s := reroute.Stops[1]; s.NodeType != routing.NodeDelivery || *s.OrderID != 1 {
+		t.Fatalf("second stop = %+v, want delivery of failing order 1", s)
+	}
+	if reroute.Stops[2].NodeType != routing.NodePickup || reroute.Stops[3].NodeType != routing.NodeDelivery {
+		t.Fatalf("order 2 must be picked up before delivery: %+v", reroute.Stops[2:])
+	}
+	if len(reroute.Remaining) != 3 {
+		t.Fatalf("remaining = %v, want the 3 unvisited stops", reroute.Remaining)
+	}
+}
+
+func TestRerouteSwapDetoursToDepot(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	depot := models.Depot{ID: 3, Name: "鄞州仓", Longitude: 121.5500, Latitude: 29.8800}
+	reroute, err := testPlanner().Reroute(context.Background(), executingPlan(now), RerouteOptions{
+		Strategy: RerouteSwap,
+		Position: Point{Longitude: 121.5600, Latitude: 29.8700},
+		Depot:    &depot,
+		Orders:   rerouteOrders(),
+		Failing:  []uint{1},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swap := reroute.Stops[1]
+	if swap.NodeType != routing.NodeDepot || swap.Longitude != depot.Longitude {
+		t.Fatalf("second stop = %+v, want the swap depot", swap)
+	}
+	if want := swap.PlannedArrival.Add(ROUTE_SWAP_SERVICE); reroute.Stops[2].PlannedArrival.Before(want) {
+		t.Fatalf("next stop planned at %s, before swap finishes at %s", reroute.Stops[2].PlannedArrival, want)
+	}
+	total := 0.0
+	for _, s := range reroute.Stops {
+		total += s.LegDistanceKm
+	}
+	if total != reroute.DistanceKm || len(reroute.Stops) != 5 {
+		t.Fatalf("distance %v over %d stops, want %v over 5", reroute.DistanceKm, len(reroute.Stops), total)
+	}
+}
+
+func TestHasFailureAlarmFiltersByLevel(t *testing.T) {
+	alarms := []dao.TelemetryAlarm{{AlarmLevel: "LOW"}, {AlarmLevel: "MEDIUM"}}
+	if hasFailureAlarm(alarms, "HIGH") {
+		t.Fatal("low and medium alarms flagged as failure at HIGH")
+	}
+	if !hasFailureAlarm(alarms, "MEDIUM") {
+		t.Fatal("medium alarm not flagged as failure at MEDIUM")
+	}
+	if !hasFailureAlarm(append(alarms, dao.TelemetryAlarm{AlarmLevel: "HIGH"}), "HIGH") {
+		t.Fatal("high alarm not flagged as failure")
+	}
+	// 配置了未知级别时按 HIGH 处理
+	if hasFailureAlarm(alarms, "") {
+		t.Fatal("medium alarm flagged as failure with unknown threshold")
+	}
+}
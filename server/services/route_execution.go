@@ -0,0 +1,207 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoutePlanState = errors.New("路线计划当前状态不允许该操作")
+	ErrRouteStop      = errors.New("站点不属于该路线计划")
+)
+
+// SaveRoutePlans 在事务 tx 中保存路径规划结果，每辆有站点的车辆保存为一条路线计划，
+// 站点顺序、计划到达时间和里程与规划结果一致
+func SaveRoutePlans(tx *gorm.DB, plan *RoutePlan, actor Actor) ([]models.RoutePlan, error) {
+	var plans []models.RoutePlan
+	for i, trajectory := range plan.Trajectories {
+		if len(trajectory) < 2 {
+			continue
+		}
+		vehicle := plan.Vehicles[i]
+		record := models.RoutePlan{
+			VehicleID:    vehicle.VehicleID,
+			DepotID:      vehicle.DepotID,
+			Status:       models.RoutePlanPlanned,
+			DistanceKm:   vehicle.DistanceKm,
+			PlannedStart: vehicle.Arrivals[0],
+			PlannedEnd:   vehicle.Arrivals[len(vehicle.Arrivals)-1],
+			CreatedBy:    actor.UserID,
+		}
+		for k, node := range trajectory {
+			loc := plan.Locs[node]
+			stop := models.RouteStop{
+				Sequence:       k,
+				NodeType:       loc.NodeType,
+				Longitude:      loc.Position[0],
+				Latitude:       loc.Position[1],
+				LegDistanceKm:  vehicle.LegsKm[k],
+				PlannedArrival: vehicle.Arrivals[k],
+				Deadline:       loc.Deadline,
+			}
+			if loc.OrderID >= 0 {
+				orderID := plan.Orders[loc.OrderID]
+				stop.OrderID = &orderID
+			}
+			record.Stops = append(record.Stops, stop)
+		}
+		plans = append(plans, record)
+	}
+
+	if err := dao.NewRoutePlanRepository(tx).CreateRoutePlans(plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// StartRoutePlan 车辆出发，出发时间记为仓库站点的实际到达时间
+func StartRoutePlan(tx *gorm.DB, planID uint, now time.Time) (*models.RoutePlan, error) {
+	repo := dao.NewRoutePlanRepository(tx)
+	plan, err := repo.GetRoutePlanForUpdate(planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status != models.RoutePlanPlanned {
+		return nil, ErrRoutePlanState
+	}
+
+	plan.Status = models.RoutePlanExecuting
+	plan.StartedAt = &now
+	if err := repo.UpdateRoutePlan(plan); err != nil {
+		return nil, err
+	}
+	if len(plan.Stops) > 0 {
+		if err := recordArrival(repo, &plan.Stops[0], now, models.ArrivalSourceCheckIn); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// CheckInStop 司机在站点签到，签到时间覆盖按轨迹匹配的到达时间，所有站点到达后路线完成
+func CheckInStop(tx *gorm.DB, planID, stopID uint, at time.Time) (*models.RoutePlan, error) {
+	repo := dao.NewRoutePlanRepository(tx)
+	plan, err := repo.GetRoutePlanForUpdate(planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status != models.RoutePlanExecuting {
+		return nil, ErrRoutePlanState
+	}
+
+	for i := range plan.Stops {
+		if plan.Stops[i].ID != stopID {
+			continue
+		}
+		if err := recordArrival(repo, &plan.Stops[i], at, models.ArrivalSourceCheckIn); err != nil {
+			return nil, err
+		}
+		return plan, completeIfArrived(repo, plan, at)
+	}
+	return nil, ErrRouteStop
+}
+
+// VehicleTrackKeys 车辆在 vehicle_location 中可能使用的标识：车辆ID和车牌号
+func VehicleTrackKeys(vehicle models.Vehicle) []string {
+	keys := []string{strconv.FormatUint(uint64(vehicle.ID), 10)}
+	if vehicle.PlateNumber != "" {
+		keys = append(keys, vehicle.PlateNumber)
+	}
+	return keys
+}
+
+// RouteTrackWindow 查询路线执行轨迹的时间段：从出发到完成，未完成时到 now
+func RouteTrackWindow(plan *models.RoutePlan, now time.Time) (time.Time, time.Time, bool) {
+	if plan.StartedAt == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end := now
+	if plan.CompletedAt != nil {
+		end = *plan.CompletedAt
+	}
+	return *plan.StartedAt, end, true
+}
+
+// RouteSyncStart 按轨迹匹配到达时间的起点：第一个未到达站点的上一站到达时间，
+// 之前的轨迹不会再匹配到任何站点。所有站点都已到达或未出发时返回 false
+func RouteSyncStart(plan *models.RoutePlan) (time.Time, bool) {
+	if plan.StartedAt == nil {
+		return time.Time{}, false
+	}
+	start := *plan.StartedAt
+	for _, stop := range plan.Stops {
+		if stop.ActualArrival == nil {
+			return start, true
+		}
+		start = maxTime(start, *stop.ActualArrival)
+	}
+	return start, false
+}
+
+// MatchArrivals 按站点顺序在按时间排序的轨迹中查找到达时间：
+// 每个未到达的站点取上一站到达之后第一个进入 radiusKm 范围的定位点，
+// 已有到达时间的站点只推进查找位置。返回新匹配到到达时间的站点下标
+func MatchArrivals(stops []models.RouteStop, track []dao.TrackPoint, radiusKm float64) map[int]time.Time {
+	matched := make(map[int]time.Time)
+	cursor := 0
+	for i, stop := range stops {
+		if stop.ActualArrival != nil {
+			for cursor < len(track) && track[cursor].TimeStamp.Before(*stop.ActualArrival) {
+				cursor++
+			}
+			continue
+		}
+		target := Point{Longitude: stop.Longitude, Latitude: stop.Latitude}
+		for k := cursor; k < len(track); k++ {
+			p := Point{Longitude: float64(track[k].Longitude), Latitude: float64(track[k].Latitude)}
+			if HaversineKm(p, target) <= radiusKm {
+				matched[i] = track[k].TimeStamp
+				cursor = k
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// SyncRoutePlan 按车辆轨迹补全执行中路线的站点到达时间，所有站点到达后路线完成
+func SyncRoutePlan(tx *gorm.DB, planID uint, track []dao.TrackPoint, now time.Time) (*models.RoutePlan, error) {
+	repo := dao.NewRoutePlanRepository(tx)
+	plan, err := repo.GetRoutePlanForUpdate(planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status != models.RoutePlanExecuting {
+		return nil, ErrRoutePlanState
+	}
+
+	for i, at := range MatchArrivals(plan.Stops, track, ROUTE_ARRIVAL_RADIUS_KM) {
+		if err := recordArrival(repo, &plan.Stops[i], at, models.ArrivalSourceGPS); err != nil {
+			return nil, err
+		}
+	}
+	return plan, completeIfArrived(repo, plan, now)
+}
+
+func recordArrival(repo *dao.RoutePlanRepository, stop *models.RouteStop, at time.Time, source string) error {
+	stop.ActualArrival = &at
+	stop.ArrivalSource = source
+	return repo.UpdateStopArrival(stop)
+}
+
+// completeIfArrived 所有站点都有到达时间时将路线标记为完成
+func completeIfArrived(repo *dao.RoutePlanRepository, plan *models.RoutePlan, now time.Time) error {
+	for _, stop := range plan.Stops {
+		if stop.ActualArrival == nil {
+			return nil
+		}
+	}
+	plan.Status = models.RoutePlanCompleted
+	plan.CompletedAt = &now
+	return repo.UpdateRoutePlan(plan)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 站点沿纬度 29.90 自西向东，经度每 0.01 度约 0.96 千米
+func executionStops(arrivals ...*time.Time) []models.RouteStop {
+	stops := make([]models.RouteStop, len(arrivals))
+	for i, at := range arrivals {
+		stops[i] = models.RouteStop{Sequence: i, Longitude: 121.40 + 0.05*float64(i), Latitude: 29.90, ActualArrival: at}
+	}
+	return stops
+}
+
+func TestMatchArrivals(t *testing.T) {
+	start := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	point := func(minutes int, lon float32) dao.TrackPoint {
+		return dao.TrackPoint{TimeStamp: at(minutes), Longitude: lon, Latitude: 29.90}
+	}
+	checkedIn := at(30)
+
+	cases := []struct {
+		name  string
+		stops []models.RouteStop
+		track []dao.TrackPoint
+		want  map[int]time.Time
+	}{
+		{
+			name:  "matches stops in order",
+			stops: executionStops(nil, nil, nil),
+			// 先经过第 3 站附近再回到第 2 站，第 3 站只能在到达第 2 站之后匹配
+			track: []dao.TrackPoint{point(0, 121.40), point(10, 121.50), point(20, 121.45), point(30, 121.50)},
+			want:  map[int]time.Time{0: at(0), 1: at(20), 2: at(30)},
+		},
+		{
+			name:  "skips stops that already have an arrival",
+			stops: executionStops(&start, &checkedIn, nil),
+			// 签到前经过第 3 站的定位不计入
+			track: []dao.TrackPoint{point(10, 121.50), point(20, 121.45), point(40, 121.50)},
+			want:  map[int]time.Time{2: at(40)},
+		},
+		{
+			name:  "leaves unreached stops unmatched",
+			stops: executionStops(&start, nil, nil),
+			track: []dao.TrackPoint{point(10, 121.42), point(20, 121.45)},
+			want:  map[int]time.Time{1: at(20)},
+		},
+	}
+	for _, c := range cases {
+		got := MatchArrivals(c.stops, c.track, 0.3)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: matched %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i, want := range c.want {
+			if !got[i].Equal(want) {
+				t.Errorf("%s: stop %d arrival = %s, want %s", c.name, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestRouteSyncStart(t *testing.T) {
+	start := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	first, later := start.Add(20*time.Minute), start.Add(50*time.Minute)
+	cases := []struct {
+		name    string
+		started *time.Time
+		stops   []models.RouteStop
+		want    time.Time
+		wantOK  bool
+	}{
+		{"not started", nil, executionStops(nil, nil), time.Time{}, false},
+		{"from departure", &start, executionStops(&start, nil, nil), start, true},
+		{"from last arrival before the first unreached stop", &start, executionStops(&start, &first, nil, &later), first, true},
+		{"all arrived", &start, executionStops(&start, &first), first, false},
+	}
+	for _, c := range cases {
+		got, ok := RouteSyncStart(&models.RoutePlan{StartedAt: c.started, Stops: c.stops})
+		if ok != c.wantOK || (ok && !got.Equal(c.want)) {
+			t.Errorf("%s: RouteSyncStart = %s, %v, want %s, %v", c.name, got, ok, c.want, c.wantOK)
+		}
+	}
+}
+
+// openRouteDB 建立路线计划、站点和车辆表，并创建一条已出发、有 3 个站点的路线
+func openRouteDB(t *testing.T, now time.Time) (*gorm.DB, *models.RoutePlan) {
+	t.Helper()
+	db := openTestDB(t)
+	err := db.Migrator().DropTable(&models.RoutePlan{}, &models.RouteStop{}, &models.Vehicle{})
+	if err == nil {
+		err = db.AutoMigrate(&models.RoutePlan{}, &models.RouteStop{}, &models.Vehicle{})
+	}
+	if err != nil {
+		t.Fatalf("create route tables: %v", err)
+	}
+	vehicle := models.Vehicle{PlateNumber: "浙B12345", Status: models.StatusInUse, MaxCapacity: 4}
+	if err := db.Create(&vehicle).Error; err != nil {
+		t.Fatal(err)
+	}
+	plan := &models.RoutePlan{
+		VehicleID:    vehicle.ID,
+		Status:       models.RoutePlanPlanned,
+		PlannedStart: now,
+		PlannedEnd:   now.Add(time.Hour),
+		Stops:        executionStops(nil, nil, nil),
+	}
+	for i := range plan.Stops {
+		plan.Stops[i].PlannedArrival = now.Add(time.Duration(i) * 20 * time.Minute)
+	}
+	if err := db.Omit("Vehicle").Create(plan).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StartRoutePlan(db, plan.ID, now); err != nil {
+		t.Fatalf("start route: %v", err)
+	}
+	return db, plan
+}
+
+func TestSyncRoutePlanCompletesPlan(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	db, plan := openRouteDB(t, now)
+	track := []dao.TrackPoint{
+		{TimeStamp: now.Add(15 * time.Minute), Longitude: 121.45, Latitude: 29.90},
+		{TimeStamp: now.Add(35 * time.Minute), Longitude: 121.50, Latitude: 29.90},
+	}
+
+	// 只到达第 2 站时路线仍在执行
+	synced, err := SyncRoutePlan(db, plan.ID, track[:1], now.Add(20*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.Status != models.RoutePlanExecuting || synced.Stops[1].ArrivalSource != models.ArrivalSourceGPS {
+		t.Fatalf("plan = %s, stop 1 = %+v, want executing with a gps arrival", synced.Status, synced.Stops[1])
+	}
+
+	done := now.Add(40 * time.Minute)
+	synced, err = SyncRoutePlan(db, plan.ID, track, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.Status != models.RoutePlanCompleted || synced.CompletedAt == nil || !synced.CompletedAt.Equal(done) {
+		t.Fatalf("plan = %+v, want completed at %s", synced, done)
+	}
+	if !synced.Stops[2].ActualArrival.Equal(track[1].TimeStamp) {
+		t.Fatalf("last stop arrival = %s, want %s", synced.Stops[2].ActualArrival, track[1].TimeStamp)
+	}
+	if _, err := SyncRoutePlan(db, plan.ID, track, done); !errors.Is(err, ErrRoutePlanState) {
+		t.Fatalf("sync completed plan: err = %v, want ErrRoutePlanState", err)
+	}
+}
+
+func TestCheckInStop(t *testing.T) {
+	now := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	db, plan := openRouteDB(t, now)
+
+	// 签到时间覆盖按轨迹匹配的到达时间
+	gps := []dao.TrackPoint{{TimeStamp: now.Add(15 * time.Minute), Longitude: 121.45, Latitude: 29.90}}
+	if _, err := SyncRoutePlan(db, plan.ID, gps, now.Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	checkedIn := now.Add(18 * time.Minute)
+	got, err := CheckInStop(db, plan.ID, plan.Stops[1].ID, checkedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := got.Stops[1]; !s.ActualArrival.Equal(checkedIn) || s.ArrivalSource != models.ArrivalSourceCheckIn {
+		t.Fatalf("stop 1 = %+v, want checked in at %s", s, checkedIn)
+	}
+	if got.Status != models.RoutePlanExecuting {
+		t.Fatalf("plan status = %s, want executing", got.Status)
+	}
+
+	if _, err := CheckInStop(db, plan.ID, 999, now); !errors.Is(err, ErrRouteStop) {
+		t.Fatalf("check in at another plan's stop: err = %v, want ErrRouteStop", err)
+	}
+
+	done := now.Add(45 * time.Minute)
+	got, err = CheckInStop(db, plan.ID, plan.Stops[2].ID, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.RoutePlanCompleted || !got.CompletedAt.Equal(done) {
+		t.Fatalf("plan = %+v, want completed at %s", got, done)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"coldchain/common/logger"
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"gorm.io/gorm"
+)
+
+// 单次检查读取的车辆定位条数上限
+const maxMonitorPoints = 10000
+
+// segments 轨迹中连续满足 cond 的定位段，返回每段首尾定位的下标
+func segments(track []dao.TrackPoint, cond func(k int) bool) [][2]int {
+	var result [][2]int
+	start := -1
+	for k := range track {
+		switch {
+		case cond(k) && start < 0:
+			start = k
+		case !cond(k) && start >= 0:
+			result = append(result, [2]int{start, k - 1})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		result = append(result, [2]int{start, len(track) - 1})
+	}
+	return result
+}
+
+func trackPoint(p dao.TrackPoint) Point {
+	return Point{Longitude: float64(p.Longitude), Latitude: float64(p.Latitude)}
+}
+
+// CheckRouteTrack 按路线走廊、停车位置和禁行区域检查车辆轨迹，每段持续的异常返回一条告警：
+// 距站点连线超过 ROUTE_CORRIDOR_KM 持续 ROUTE_CORRIDOR_GRACE，
+// 在站点和仓库、客户围栏以外停车超过 ROUTE_STOP_LIMIT，或进入禁行围栏
+func CheckRouteTrack(plan *models.RoutePlan, track []dao.TrackPoint, fences []models.Geofence) []models.RouteAlert {
+	var path []Point
+	for _, s := range plan.Stops {
+		path = append(path, Point{Longitude: s.Longitude, Latitude: s.Latitude})
+	}
+	var allowed, forbidden []fenceShape
+	for _, f := range fences {
+		polygon, err := GeofencePolygon(f)
+		if err != nil {
+			logger.Warnf("围栏 %d 的顶点无法解析: %v", f.ID, err)
+			continue
+		}
+		if f.Kind == models.GeofenceForbidden {
+			forbidden = append(forbidden, fenceShape{fence: f, polygon: polygon})
+		} else {
+			allowed = append(allowed, fenceShape{fence: f, polygon: polygon})
+		}
+	}
+
+	var alerts []models.RouteAlert
+	raise := func(kind string, seg [2]int, fenceID *uint, detail string) {
+		first := track[seg[0]]
+		alerts = append(alerts, models.RouteAlert{
+			RoutePlanID: plan.ID,
+			VehicleID:   plan.VehicleID,
+			Kind:        kind,
+			GeofenceID:  fenceID,
+			StartedAt:   first.TimeStamp,
+			EndedAt:     track[seg[1]].TimeStamp,
+			Longitude:   float64(first.Longitude),
+			Latitude:    float64(first.Latitude),
+			Detail:      detail,
+		})
+	}
+	duration := func(seg [2]int) time.Duration {
+		return track[seg[1]].TimeStamp.Sub(track[seg[0]].TimeStamp)
+	}
+
+	if len(path) > 0 {
+		deviation := make([]float64, len(track))
+		for k, p := range track {
+			deviation[k] = PathDistanceKm(trackPoint(p), path)
+		}
+		for _, seg := range segments(track, func(k int) bool { return deviation[k] > ROUTE_CORRIDOR_KM }) {
+			if duration(seg) < ROUTE_CORRIDOR_GRACE {
+				continue
+			}
+			farthest := 0.0
+			for k := seg[0]; k <= seg[1]; k++ {
+				farthest = math.Max(farthest, deviation[k])
+			}
+			raise(models.RouteAlertCorridor, seg, nil,
+				fmt.Sprintf("驶出路线走廊 %.0f 分钟，最远偏离 %.1f 千米", duration(seg).Minutes(), farthest))
+		}
+	}
+
+	stopped := func(k int) bool {
+		if float64(track[k].Speed) > ROUTE_STOP_SPEED_KMH {
+			return false
+		}
+		p := trackPoint(track[k])
+		for _, s := range path {
+			if HaversineKm(p, s) <= ROUTE_ARRIVAL_RADIUS_KM {
+				return false
+			}
+		}
+		for _, f := range allowed {
+			if f.contains(p) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, seg := range segments(track, stopped) {
+		if duration(seg) >= ROUTE_STOP_LIMIT {
+			raise(models.RouteAlertStop, seg, nil,
+				fmt.Sprintf("在计划站点以外停车 %.0f 分钟", duration(seg).Minutes()))
+		}
+	}
+
+	for _, f := range forbidden {
+		f := f
+		inside := func(k int) bool { return f.contains(trackPoint(track[k])) }
+		for _, seg := range segments(track, inside) {
+			raise(models.RouteAlertForbidden, seg, &f.fence.ID, "进入禁行区域 "+f.fence.Name)
+		}
+	}
+	return alerts
+}
+
+func sameFence(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// SaveRouteAlerts 在事务 tx 中保存检查出的告警：与已有告警时间重叠的同类异常视为同一段，
+// 只延长已有告警，其余新建。返回新建的告警
+func SaveRouteAlerts(tx *gorm.DB, planID uint, alerts []models.RouteAlert) ([]models.RouteAlert, error) {
+	// 锁定路线，避免定期检查和手动检查重复记录
+	if _, err := dao.NewRoutePlanRepository(tx).GetRoutePlanForUpdate(planID); err != nil {
+		return nil, err
+	}
+	repo := dao.NewRouteAlertRepository(tx)
+	existing, err := repo.ListAlerts(planID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var created []models.RouteAlert
+	for _, a := range alerts {
+		merged := false
+		for i := range existing {
+			e := &existing[i]
+			if e.Kind != a.Kind || !sameFence(e.GeofenceID, a.GeofenceID) ||
+				a.StartedAt.After(e.EndedAt) || e.StartedAt.After(a.EndedAt) {
+				continue
+			}
+			merged = true
+			if a.EndedAt.After(e.EndedAt) {
+				e.EndedAt = a.EndedAt
+				e.Detail = a.Detail
+				if err := repo.UpdateAlertEnd(e); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if merged {
+			continue
+		}
+		a.Status = models.AlertUnread
+		if err := repo.CreateAlert(&a); err != nil {
+			return nil, err
+		}
+		existing = append(existing, a)
+		created = append(created, a)
+	}
+	return created, nil
+}
+
+// RouteMonitor 按 vehicle_location 中的车辆定位检查路线，记录偏离走廊、异常停车和进入禁行区域的告警，
+// 并通知可能延误的订单客户
+type RouteMonitor struct {
+	db    *gorm.DB
+	track *dao.VehicleTrackRepository
+}
+
+func NewRouteMonitor(db *gorm.DB, ch driver.Conn) *RouteMonitor {
+	return &RouteMonitor{db: db, track: dao.NewVehicleTrackRepository(ch)}
+}
+
+// CheckPlan 检查路线出发后、最近 ROUTE_MONITOR_LOOKBACK 内的轨迹，返回新产生的告警。
+// 同时按最近定位推算送达时间，通知可能延误的订单客户
+func (m *RouteMonitor) CheckPlan(plan *models.RoutePlan, fences []models.Geofence, now time.Time) ([]models.RouteAlert, error) {
+	start, end, ok := RouteTrackWindow(plan, now)
+	if !ok {
+		return nil, nil
+	}
+	if ROUTE_MONITOR_LOOKBACK > 0 && start.Before(end.Add(-ROUTE_MONITOR_LOOKBACK)) {
+		start = end.Add(-ROUTE_MONITOR_LOOKBACK)
+	}
+	track, err := m.track.ListTrack(VehicleTrackKeys(plan.Vehicle), start, end, maxMonitorPoints)
+	if err != nil {
+		return nil, err
+	}
+	alerts := CheckRouteTrack(plan, track, fences)
+	var latest *dao.TrackPoint
+	if len(track) > 0 {
+		latest = &track[len(track)-1]
+	}
+
+	var created []models.RouteAlert
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if len(alerts) > 0 {
+			var err error
+			if created, err = SaveRouteAlerts(tx, plan.ID, alerts); err != nil {
+				return err
+			}
+		}
+		late, err := NotifyLateRisk(tx, plan.ID, latest, now)
+		for _, eta := range late {
+			logger.Warnf("车辆 %s 路线 %d 订单 %d 预计晚到 %.0f 分钟", plan.Vehicle.PlateNumber, plan.ID, eta.OrderID, eta.LateMinutes)
+		}
+		return err
+	})
+	return created, err
+}
+
+// CheckAll 检查所有执行中的路线
+func (m *RouteMonitor) CheckAll(now time.Time) {
+	plans, err := dao.NewRoutePlanRepository(m.db).ListRoutePlans(models.RoutePlanExecuting)
+	if err != nil {
+		logger.Errorf("获取执行中的路线失败: %v", err)
+		return
+	}
+	fences, err := dao.NewGeofenceRepository(m.db).ListGeofences(true)
+	if err != nil {
+		logger.Errorf("获取地理围栏失败: %v", err)
+		return
+	}
+	for i := range plans {
+		created, err := m.CheckPlan(&plans[i], fences, now)
+		if err != nil {
+			logger.Errorf("检查路线 %d 失败: %v", plans[i].ID, err)
+			continue
+		}
+		for _, a := range created {
+			logger.Warnf("车辆 %s 路线 %d 告警: %s", plans[i].Vehicle.PlateNumber, plans[i].ID, a.Detail)
+		}
+	}
+}
+
+// Start 每隔 interval 检查一次，interval 不大于0时不启动
+func (m *RouteMonitor) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			m.CheckAll(now)
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"testing"
+	"time"
+)
+
+func TestCheckRouteTrackRaisesOneAlertPerEpisode(t *testing.T) {
+	// 路线沿纬度 29.90 自西向东，经度每 0.01 度约 0.96 千米
+	plan := &models.RoutePlan{
+		ID:        3,
+		VehicleID: 9,
+		Stops: []models.RouteStop{
+			{Longitude: 121.40, Latitude: 29.90},
+			{Longitude: 121.60, Latitude: 29.90},
+		},
+	}
+	forbidden := models.Geofence{ID: 5, Name: "隧道", Kind: models.GeofenceForbidden, Longitude: 121.55, Latitude: 29.90, RadiusKm: 0.5}
+	customer := models.Geofence{ID: 6, Name: "客户停车场", Kind: models.GeofenceCustomer, Longitude: 121.50, Latitude: 29.90, RadiusKm: 0.5}
+
+	start := time.Date(2024, 5, 20, 9, 0, 0, 0, time.Local)
+	var track []dao.TrackPoint
+	add := func(lon, lat, speed float32, minutes int) {
+		for i := 0; i < minutes; i++ {
+			track = append(track, dao.TrackPoint{
+				TimeStamp: start.Add(time.Duration(len(track)) * time.Minute),
+				Longitude: lon, Latitude: lat, Speed: speed,
+			})
+		}
+	}
+	add(121.42, 29.90, 50, 5)
+	add(121.44, 29.95, 50, 10) // 偏离约 5.5 千米，持续超过宽限
+	add(121.46, 29.90, 50, 2)
+	add(121.47, 29.92, 50, 3) // 偏离约 2.2 千米，未超过宽限
+	add(121.48, 29.90, 0, 25) // 路线上但不在站点，停车超过上限
+	add(121.50, 29.90, 0, 30) // 客户围栏内停车，允许
+	add(121.55, 29.90, 20, 2) // 进入禁行区域
+	add(121.60, 29.90, 0, 40) // 终点站停车，允许
+
+	alerts := CheckRouteTrack(plan, track, []models.Geofence{forbidden, customer})
+	kinds := map[string]int{}
+	for _, a := range alerts {
+		kinds[a.Kind]++
+		if a.RoutePlanID != plan.ID || a.VehicleID != plan.VehicleID {
+			t.Fatalf("alert %+v not tied to plan", a)
+		}
+	}
+	if kinds[models.RouteAlertCorridor] != 1 || kinds[models.RouteAlertStop] != 1 || kinds[models.RouteAlertForbidden] != 1 {
+		t.Fatalf("alerts by kind = %v, want one corridor, one stop and one forbidden", kinds)
+	}
+	for _, a := range alerts {
+		switch a.Kind {
+		case models.RouteAlertCorridor:
+			if want := start.Add(5 * time.Minute); !a.StartedAt.Equal(want) || a.EndedAt.Sub(a.StartedAt) != 9*time.Minute {
+				t.Fatalf("corridor alert %s - %s, want 10 minutes from %s", a.StartedAt, a.EndedAt, want)
+			}
+		case models.RouteAlertForbidden:
+			if a.GeofenceID == nil || *a.GeofenceID != forbidden.ID {
+				t.Fatalf("forbidden alert fence = %v, want %d", a.GeofenceID, forbidden.ID)
+			}
+		}
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	square := []Point{
+		{Longitude: 121.0, Latitude: 29.0},
+		{Longitude: 122.0, Latitude: 29.0},
+		{Longitude: 122.0, Latitude: 30.0},
+		{Longitude: 121.0, Latitude: 30.0},
+	}
+	if !pointInPolygon(Point{Longitude: 121.5, Latitude: 29.5}, square) {
+		t.Fatal("center should be inside")
+	}
+	if pointInPolygon(Point{Longitude: 122.5, Latitude: 29.5}, square) {
+		t.Fatal("point east of the square should be outside")
+	}
+}
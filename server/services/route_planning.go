@@ -0,0 +1,286 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/services/routing"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RouteLoc 路径中的一个节点，字段名与前端地图组件一致
+type RouteLoc struct {
+	Position [2]float64 `json:"position"` // [经度, 纬度]
+	NodeType int        `json:"nodeType"` // 0=仓库，1=取货，2=送货
+	OrderID  int        `json:"orderId"`  // 订单在 orders 中的下标，仓库为 -1
+	// 仓库节点对应的仓库，未配置仓库时为0
+	DepotID uint `json:"depotId,omitempty"`
+	// 送货节点的最晚送达时间
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// SkippedOrder 未参与规划或无法按时送达的订单及原因
+type SkippedOrder struct {
+	OrderID uint   `json:"order_id"`
+	Reason  string `json:"reason"`
+}
+
+// RouteVehicle 执行一条路线的车辆，Arrivals 与对应轨迹的节点一一对应，首个为从仓库出发的时间
+type RouteVehicle struct {
+	VehicleID   uint        `json:"vehicle_id"`
+	PlateNumber string      `json:"plate_number"`
+	Capacity    int         `json:"capacity"`
+	DepotID     *uint       `json:"depot_id"`
+	DistanceKm  float64     `json:"distance_km"`
+	LegsKm      []float64   `json:"legs_km"` // 距上一节点的里程，首个为0
+	Arrivals    []time.Time `json:"arrivals"`
+}
+
+// RoutePlan 路径规划结果，trajectories 为每辆车从所属仓库出发依次经过的节点下标，
+// vehicles 与 trajectories 一一对应
+type RoutePlan struct {
+	Locs         []RouteLoc     `json:"locs"`
+	Trajectories [][]int        `json:"trajectories"`
+	Vehicles     []RouteVehicle `json:"vehicles"`
+	Orders       []uint         `json:"orders"` // 下标对应的订单ID
+	DistanceKm   float64        `json:"distance_km"`
+	// 缺少坐标未参与规划的订单
+	Skipped []SkippedOrder `json:"skipped"`
+	// 无法按时送达的订单，迟到的订单仍出现在轨迹中
+	Infeasible []SkippedOrder `json:"infeasible"`
+}
+
+// deliveryWindow 按送达日期计算送货时间窗
+func deliveryWindow(date time.Time) (time.Time, time.Time) {
+	y, m, d := date.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+	return day.Add(ROUTE_DELIVERY_OPEN), day.Add(ROUTE_DELIVERY_CLOSE)
+}
+
+// orderLoad 订单占用的冷链箱数，按装箱规划计算，无法规划时按件数，至少为1
+func orderLoad(order models.RentalOrder) int {
+	if plan, err := PlanLoad(order.OrderItems, StandardModuleSpec()); err == nil && len(plan.Modules) > 0 {
+		return len(plan.Modules)
+	}
+	load := 0
+	for _, item := range order.OrderItems {
+		load += item.Quantity
+	}
+	return max(load, 1)
+}
+
+// travelTime 按 ROUTE_SPEED_KMH 估算行驶 km 千米所需的时间
+func travelTime(km float64) time.Duration {
+	if ROUTE_SPEED_KMH <= 0 {
+		return 0
+	}
+	return hoursToDuration(km / ROUTE_SPEED_KMH)
+}
+
+// RoutePlanner 路径规划，距离和地址解析来自 Distances
+type RoutePlanner struct {
+	Distances DistanceProvider
+	ACO       routing.ACOConfig
+}
+
+func NewRoutePlanner(distances DistanceProvider, cfg routing.ACOConfig) *RoutePlanner {
+	return &RoutePlanner{Distances: distances, ACO: cfg}
+}
+
+// routeCandidate 坐标已解析、等待检查能否按时送达的订单
+type routeCandidate struct {
+	order    models.RentalOrder
+	load     int
+	earliest time.Time
+	due      time.Time
+	node     int // 取货节点在完整距离矩阵中的下标，送货节点为 node+1
+}
+
+// Plan 在 now 时刻为订单规划取送货路径：从寄件地取货、在送达日期的时间窗内送到收件地，
+// 每辆车从所属仓库出发，未归属仓库的车辆从 ROUTE_DEPOT 出发，载量为车辆的 MaxCapacity。
+// 寄件或收件信息中没有坐标时按详细地址解析，仍无法定位的订单在 Skipped 中说明；
+// 无法按时送达的订单在 Infeasible 中说明
+func (rp *RoutePlanner) Plan(ctx context.Context, orders []models.RentalOrder, fleet []models.Vehicle,
+	depots []models.Depot, now time.Time) (*RoutePlan, error) {
+	plan := &RoutePlan{
+		Locs:         []RouteLoc{},
+		Trajectories: [][]int{},
+		Vehicles:     []RouteVehicle{},
+		Orders:       []uint{},
+		Skipped:      []SkippedOrder{},
+		Infeasible:   []SkippedOrder{},
+	}
+	if len(fleet) == 0 {
+		return nil, ErrVehicleUnavailable
+	}
+
+	// 仓库节点排在最前，车辆所属的每个仓库一个节点
+	var points []Point
+	depotNodes := make(map[uint]int)
+	starts := make([]int, len(fleet))
+	maxCapacity := 0
+	capacities := make([]int, len(fleet))
+	for i, v := range fleet {
+		capacities[i] = v.MaxCapacity
+		maxCapacity = max(maxCapacity, v.MaxCapacity)
+
+		var key uint
+		location := ROUTE_DEPOT
+		if depot, ok := findDepot(depots, v.DepotID); ok {
+			key, location = depot.ID, DepotLocation(depot)
+		}
+		node, ok := depotNodes[key]
+		if !ok {
+			node = len(points)
+			depotNodes[key] = node
+			points = append(points, location)
+			plan.Locs = append(plan.Locs, RouteLoc{
+				Position: [2]float64{location.Longitude, location.Latitude},
+				NodeType: routing.NodeDepot,
+				OrderID:  -1,
+				DepotID:  key,
+			})
+		}
+		starts[i] = node
+	}
+	numDepots := len(points)
+
+	var candidates []routeCandidate
+	for _, order := range orders {
+		pickup, err := ResolveLocation(ctx, rp.Distances, order.SenderInfo)
+		if err != nil {
+			plan.Skipped = append(plan.Skipped, SkippedOrder{OrderID: order.ID, Reason: "寄件地址无法定位"})
+			continue
+		}
+		delivery, err := ResolveLocation(ctx, rp.Distances, order.ReceiverInfo)
+		if err != nil {
+			plan.Skipped = append(plan.Skipped, SkippedOrder{OrderID: order.ID, Reason: "收件地址无法定位"})
+			continue
+		}
+
+		load := orderLoad(order)
+		if load > maxCapacity {
+			plan.Infeasible = append(plan.Infeasible, SkippedOrder{
+				OrderID: order.ID,
+				Reason:  fmt.Sprintf("需装载%d个冷链箱，超出所有空闲车辆的载量", load),
+			})
+			continue
+		}
+		earliest, due := deliveryWindow(order.DeliveryDate)
+		candidates = append(candidates, routeCandidate{order: order, load: load, earliest: earliest, due: due, node: len(points)})
+		points = append(points, pickup, delivery)
+	}
+	if len(candidates) == 0 {
+		return plan, nil
+	}
+
+	full, err := DistanceMatrix(ctx, rp.Distances, points)
+	if err != nil {
+		return nil, err
+	}
+
+	// 从距寄件地最近的仓库直达也赶不上的订单不参与求解，其余订单的节点重新编号
+	nodes := make([]int, numDepots)
+	for i := range nodes {
+		nodes[i] = i
+	}
+	windows := make([]routing.Window, numDepots)
+	service := make([]float64, numDepots)
+	for i := range windows {
+		windows[i].Latest = math.Inf(1)
+	}
+	var requests []routing.Request
+	for _, c := range candidates {
+		nearest := math.Inf(1)
+		for depot := 0; depot < numDepots; depot++ {
+			nearest = math.Min(nearest, full[depot][c.node])
+		}
+		direct := now.Add(travelTime(nearest + full[c.node][c.node+1])).Add(ROUTE_PICKUP_SERVICE)
+		if direct.After(c.due) {
+			plan.Infeasible = append(plan.Infeasible, SkippedOrder{
+				OrderID: c.order.ID,
+				Reason:  fmt.Sprintf("最早 %s 送达，晚于送达期限 %s", direct.Format(time.DateTime), c.due.Format(time.DateTime)),
+			})
+			continue
+		}
+
+		index := len(plan.Orders)
+		due := c.due
+		plan.Orders = append(plan.Orders, c.order.ID)
+		requests = append(requests, routing.Request{Pickup: len(nodes), Delivery: len(nodes) + 1, Load: c.load})
+		nodes = append(nodes, c.node, c.node+1)
+		windows = append(windows,
+			routing.Window{Latest: math.Inf(1)},
+			routing.Window{Earliest: c.earliest.Sub(now).Hours(), Latest: due.Sub(now).Hours()},
+		)
+		service = append(service, ROUTE_PICKUP_SERVICE.Hours(), ROUTE_DELIVERY_SERVICE.Hours())
+		pickup, delivery := points[c.node], points[c.node+1]
+		plan.Locs = append(plan.Locs,
+			RouteLoc{Position: [2]float64{pickup.Longitude, pickup.Latitude}, NodeType: routing.NodePickup, OrderID: index},
+			RouteLoc{Position: [2]float64{delivery.Longitude, delivery.Latitude}, NodeType: routing.NodeDelivery, OrderID: index, Deadline: &due},
+		)
+	}
+	if len(requests) == 0 {
+		return plan, nil
+	}
+
+	dist := newMatrix(len(nodes))
+	for i, from := range nodes {
+		for j, to := range nodes {
+			dist[i][j] = full[from][to]
+		}
+	}
+
+	solution, err := routing.Solve(&routing.Problem{
+		Dist:       dist,
+		Requests:   requests,
+		Capacities: capacities,
+		Starts:     starts,
+		Speed:      ROUTE_SPEED_KMH,
+		Windows:    windows,
+		Service:    service,
+	}, rp.ACO)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.DistanceKm = solution.Cost
+	for v, route := range solution.Routes {
+		if len(route) == 0 {
+			continue
+		}
+		vehicle := RouteVehicle{
+			VehicleID:   fleet[v].ID,
+			PlateNumber: fleet[v].PlateNumber,
+			Capacity:    fleet[v].MaxCapacity,
+			DepotID:     fleet[v].DepotID,
+			LegsKm:      []float64{0},
+			Arrivals:    []time.Time{now},
+		}
+		prev := starts[v]
+		for k, node := range route {
+			vehicle.DistanceKm += dist[prev][node]
+			vehicle.LegsKm = append(vehicle.LegsKm, dist[prev][node])
+			vehicle.Arrivals = append(vehicle.Arrivals, now.Add(hoursToDuration(solution.Arrivals[v][k])))
+			prev = node
+		}
+		plan.Trajectories = append(plan.Trajectories, append([]int{starts[v]}, route...))
+		plan.Vehicles = append(plan.Vehicles, vehicle)
+	}
+	for _, r := range solution.Unserved {
+		plan.Infeasible = append(plan.Infeasible, SkippedOrder{OrderID: plan.Orders[r], Reason: "车辆不足，无法按时安排"})
+	}
+	for _, r := range solution.Late {
+		deadline := plan.Locs[requests[r].Delivery].Deadline
+		plan.Infeasible = append(plan.Infeasible, SkippedOrder{
+			OrderID: plan.Orders[r],
+			Reason:  "无法在送达期限 " + deadline.Format(time.DateTime) + " 前送达",
+		})
+	}
+	return plan, nil
+}
+
+func hoursToDuration(h float64) time.Duration {
+	return time.Duration(h * float64(time.Hour))
+}
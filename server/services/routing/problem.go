@@ -0,0 +1,314 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 节点类型，与前端约定一致
+const (
+	NodeDepot    = 0
+	NodePickup   = 1
+	NodeDelivery = 2
+)
+
+// Request 一笔取送货请求，Pickup 和 Delivery 是节点下标
+type Request struct {
+	Pickup   int
+	Delivery int
+	Load     int
+}
+
+// Window 节点的时间窗，单位小时，从规划开始时刻算起。
+// 早于 Earliest 到达需等待，晚于 Latest 到达不可行
+type Window struct {
+	Earliest float64
+	Latest   float64
+}
+
+// Problem 带取送货约束的车辆路径问题（PDP），不属于任何请求的节点是仓库，
+// 每笔请求必须由同一辆车先取货后送货
+type Problem struct {
+	// 节点间的距离，单位千米
+	Dist     [][]float64
+	Requests []Request
+	// 可用车辆数，至少为1
+	Vehicles int
+	// 车辆载量，0 表示不限
+	Capacity int
+	// 每辆车的载量，非空时车辆数取其长度并忽略 Vehicles 和 Capacity
+	Capacities []int
+	// 每辆车出发的仓库节点，为空时都从节点 0 出发
+	Starts []int
+
+	// 车速，千米/小时，0 表示不考虑行驶时间
+	Speed float64
+	// 各节点的时间窗，为空表示不限
+	Windows []Window
+	// 各节点的服务时长，单位小时，为空表示不计
+	Service []float64
+
+	kind   []int // 节点类型
+	req    []int // 节点所属的请求，仓库为 -1
+	caps   []int // 每辆车的载量
+	starts []int // 每辆车出发的仓库节点
+}
+
+// prepare 检查问题并建立节点索引
+func (p *Problem) prepare() error {
+	n := len(p.Dist)
+	if n == 0 {
+		return errors.New("距离矩阵为空")
+	}
+	for i := range p.Dist {
+		if len(p.Dist[i]) != n {
+			return errors.New("距离矩阵不是方阵")
+		}
+	}
+	if len(p.Capacities) > 0 {
+		p.Vehicles = len(p.Capacities)
+		p.caps = p.Capacities
+	} else {
+		if p.Vehicles < 1 {
+			p.Vehicles = 1
+		}
+		p.caps = make([]int, p.Vehicles)
+		for v := range p.caps {
+			p.caps[v] = p.Capacity
+		}
+	}
+	if p.Windows == nil {
+		p.Windows = make([]Window, n)
+		for i := range p.Windows {
+			p.Windows[i].Latest = math.Inf(1)
+		}
+	} else if len(p.Windows) != n {
+		return errors.New("时间窗数量与节点数不一致")
+	}
+	if p.Service == nil {
+		p.Service = make([]float64, n)
+	} else if len(p.Service) != n {
+		return errors.New("服务时长数量与节点数不一致")
+	}
+
+	p.kind = make([]int, n)
+	p.req = make([]int, n)
+	for i := range p.req {
+		p.req[i] = -1
+	}
+	for r, q := range p.Requests {
+		for _, node := range []int{q.Pickup, q.Delivery} {
+			if node <= 0 || node >= n || p.req[node] >= 0 {
+				return fmt.Errorf("请求 %d 的节点 %d 无效", r, node)
+			}
+			p.req[node] = r
+		}
+		p.kind[q.Pickup] = NodePickup
+		p.kind[q.Delivery] = NodeDelivery
+	}
+
+	p.starts = p.Starts
+	if len(p.starts) == 0 {
+		p.starts = make([]int, p.Vehicles)
+	} else if len(p.starts) != p.Vehicles {
+		return errors.New("出发仓库数量与车辆数不一致")
+	}
+	for v, start := range p.starts {
+		if start < 0 || start >= n || p.req[start] >= 0 {
+			return fmt.Errorf("车辆 %d 的出发节点 %d 不是仓库", v, start)
+		}
+	}
+	return nil
+}
+
+// travel 两节点间的行驶时间，单位小时
+func (p *Problem) travel(i, j int) float64 {
+	if p.Speed <= 0 {
+		return 0
+	}
+	return p.Dist[i][j] / p.Speed
+}
+
+// Solution 每辆车依次访问的节点，不含出发的仓库，未使用的车辆路线为空
+type Solution struct {
+	Routes [][]int
+	// 与 Routes 对应，每个节点开始服务的时刻，单位小时
+	Arrivals [][]float64
+	Cost     float64
+	// 无法安排的请求
+	Unserved []int
+	// 已取货但无法在时间窗内送达的请求，送货节点仍排在路线末尾
+	Late []int
+}
+
+// vehicleState 构造解时一辆车的状态
+type vehicleState struct {
+	pos      int
+	load     int
+	length   float64
+	time     float64
+	route    []int
+	arrivals []float64
+	onboard  []int // 已取货未送达的请求
+}
+
+// construction 逐步构造解，只允许满足取送顺序和载量约束的移动
+type construction struct {
+	p        *Problem
+	vehicles []vehicleState
+	// 请求由哪辆车取货，未取货为 -1
+	pickedBy  []int
+	delivered []bool
+	late      []bool
+	remaining int
+}
+
+func newConstruction(p *Problem) *construction {
+	c := &construction{
+		p:         p,
+		vehicles:  make([]vehicleState, p.Vehicles),
+		pickedBy:  make([]int, len(p.Requests)),
+		delivered: make([]bool, len(p.Requests)),
+		late:      make([]bool, len(p.Requests)),
+		remaining: 2 * len(p.Requests),
+	}
+	for i := range c.pickedBy {
+		c.pickedBy[i] = -1
+	}
+	for v := range c.vehicles {
+		c.vehicles[v].pos = p.starts[v]
+	}
+	return c
+}
+
+// feasible 检查车辆 v 下一站去 node 是否可行：取送顺序、载量、该节点的时间窗，
+// 以及完成服务后车上每笔请求仍能直接送达
+func (c *construction) feasible(v, node int) bool {
+	r := c.p.req[node]
+	if r < 0 {
+		return false
+	}
+	vs := &c.vehicles[v]
+	q := c.p.Requests[r]
+	switch c.p.kind[node] {
+	case NodePickup:
+		if c.pickedBy[r] >= 0 {
+			return false
+		}
+		if limit := c.p.caps[v]; limit > 0 && vs.load+q.Load > limit {
+			return false
+		}
+	case NodeDelivery:
+		if c.pickedBy[r] != v || c.delivered[r] {
+			return false
+		}
+	default:
+		return false
+	}
+
+	start, ok := c.arrive(v, node)
+	if !ok {
+		return false
+	}
+	depart := start + c.p.Service[node]
+	for _, o := range vs.onboard {
+		if o != r && !c.reachable(node, depart, o) {
+			return false
+		}
+	}
+	return c.p.kind[node] == NodeDelivery || c.reachable(node, depart, r)
+}
+
+// arrive 车辆 v 从当前位置去 node 开始服务的时刻，超出时间窗时返回 false
+func (c *construction) arrive(v, node int) (float64, bool) {
+	vs := &c.vehicles[v]
+	t := vs.time + c.p.travel(vs.pos, node)
+	w := c.p.Windows[node]
+	if t > w.Latest {
+		return t, false
+	}
+	return math.Max(t, w.Earliest), true
+}
+
+// reachable 在 depart 时刻离开 from，能否在时间窗内送达请求 r
+func (c *construction) reachable(from int, depart float64, r int) bool {
+	delivery := c.p.Requests[r].Delivery
+	return depart+c.p.travel(from, delivery) <= c.p.Windows[delivery].Latest
+}
+
+func (c *construction) apply(v, node int) {
+	vs := &c.vehicles[v]
+	r := c.p.req[node]
+	start, _ := c.arrive(v, node)
+	vs.length += c.p.Dist[vs.pos][node]
+	vs.time = start + c.p.Service[node]
+	vs.pos = node
+	vs.route = append(vs.route, node)
+	vs.arrivals = append(vs.arrivals, start)
+	if c.p.kind[node] == NodePickup {
+		c.pickedBy[r] = v
+		vs.load += c.p.Requests[r].Load
+		vs.onboard = append(vs.onboard, r)
+	} else {
+		c.delivered[r] = true
+		vs.load -= c.p.Requests[r].Load
+		for i, o := range vs.onboard {
+			if o == r {
+				vs.onboard = append(vs.onboard[:i], vs.onboard[i+1:]...)
+				break
+			}
+		}
+	}
+	c.remaining--
+}
+
+// finish 没有可行移动后，车上仍未送达的请求按最近邻顺序送完并记为迟到
+func (c *construction) finish() {
+	for v := range c.vehicles {
+		vs := &c.vehicles[v]
+		for len(vs.onboard) > 0 {
+			next, nextDist := -1, math.Inf(1)
+			for _, r := range vs.onboard {
+				if d := c.p.Dist[vs.pos][c.p.Requests[r].Delivery]; d < nextDist {
+					next, nextDist = r, d
+				}
+			}
+			c.late[next] = true
+			c.apply(v, c.p.Requests[next].Delivery)
+		}
+	}
+}
+
+// moves 列出所有可行的移动
+func (c *construction) moves(fn func(v, node int)) {
+	for v := range c.vehicles {
+		for node := 1; node < len(c.p.Dist); node++ {
+			if c.feasible(v, node) {
+				fn(v, node)
+			}
+		}
+	}
+}
+
+func (c *construction) solution() Solution {
+	c.finish()
+	s := Solution{
+		Routes:   make([][]int, len(c.vehicles)),
+		Arrivals: make([][]float64, len(c.vehicles)),
+	}
+	for v, vs := range c.vehicles {
+		s.Routes[v] = vs.route
+		s.Arrivals[v] = vs.arrivals
+		s.Cost += vs.length
+	}
+	for r := range c.p.Requests {
+		switch {
+		case !c.delivered[r]:
+			s.Unserved = append(s.Unserved, r)
+		case c.late[r]:
+			s.Late = append(s.Late, r)
+		}
+	}
+	return s
+}
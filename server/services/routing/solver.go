@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ACOConfig 最大最小蚁群算法（MMAS）的参数
+type ACOConfig struct {
+	Ants       int
+	Iterations int
+	Alpha      float64 // 信息素权重
+	Beta       float64 // 启发信息（距离倒数）权重
+	Rho        float64 // 信息素挥发率
+	// 每隔多少次迭代用全局最优解而不是本轮最优解更新信息素
+	GlobalBestEvery int
+	// 求解时间上限，0 表示只受迭代次数限制
+	TimeLimit time.Duration
+	// 随机种子，相同种子得到相同结果
+	Seed int64
+}
+
+func DefaultACOConfig() ACOConfig {
+	return ACOConfig{
+		Ants:            20,
+		Iterations:      200,
+		Alpha:           1,
+		Beta:            3,
+		Rho:             0.05,
+		GlobalBestEvery: 10,
+		TimeLimit:       5 * time.Second,
+		Seed:            1,
+	}
+}
+
+// better 无法按时完成的请求少的解更优，其次比较总里程
+func better(a, b Solution) bool {
+	if fa, fb := len(a.Unserved)+len(a.Late), len(b.Unserved)+len(b.Late); fa != fb {
+		return fa < fb
+	}
+	return a.Cost < b.Cost
+}
+
+// Greedy 最近邻构造：每一步在所有车辆的可行移动中选择距离最近的一个，
+// 考虑行驶时间时选择最早开始服务的一个，避免为等待时间窗而耽误其他站点
+func Greedy(p *Problem) (Solution, error) {
+	if err := p.prepare(); err != nil {
+		return Solution{}, err
+	}
+	return greedy(p), nil
+}
+
+func greedy(p *Problem) Solution {
+	c := newConstruction(p)
+	for c.remaining > 0 {
+		bestV, bestNode, bestKey, bestDist := -1, -1, math.Inf(1), math.Inf(1)
+		c.moves(func(v, node int) {
+			d := p.Dist[c.vehicles[v].pos][node]
+			key := d
+			if p.Speed > 0 {
+				key, _ = c.arrive(v, node)
+			}
+			if key < bestKey || key == bestKey && d < bestDist {
+				bestV, bestNode, bestKey, bestDist = v, node, key, d
+			}
+		})
+		if bestV < 0 {
+			break
+		}
+		c.apply(bestV, bestNode)
+	}
+	return c.solution()
+}
+
+// Solve 以贪心解为初始解，用 MMAS 改进。
+// 信息素限制在 [tauMin, tauMax] 内，每轮只由最优的蚂蚁更新，避免过早收敛
+func Solve(p *Problem, cfg ACOConfig) (Solution, error) {
+	if err := p.prepare(); err != nil {
+		return Solution{}, err
+	}
+	best := greedy(p)
+	if len(p.Requests) < 2 || cfg.Ants <= 0 || cfg.Iterations <= 0 {
+		return best, nil
+	}
+
+	n := len(p.Dist)
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	tauMax := 1 / (cfg.Rho * math.Max(best.Cost, 1e-6))
+	tauMin := tauMax / (2 * float64(n))
+	tau := make([][]float64, n)
+	eta := make([][]float64, n)
+	for i := range tau {
+		tau[i] = make([]float64, n)
+		eta[i] = make([]float64, n)
+		for j := range tau[i] {
+			tau[i][j] = tauMax
+			eta[i][j] = math.Pow(1/math.Max(p.Dist[i][j], 1e-3), cfg.Beta)
+		}
+	}
+
+	var deadline time.Time
+	if cfg.TimeLimit > 0 {
+		deadline = time.Now().Add(cfg.TimeLimit)
+	}
+	for it := 0; it < cfg.Iterations; it++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+
+		var iterBest Solution
+		for a := 0; a < cfg.Ants; a++ {
+			s := construct(p, tau, eta, cfg.Alpha, rng)
+			if a == 0 || better(s, iterBest) {
+				iterBest = s
+			}
+		}
+		if better(iterBest, best) {
+			best = iterBest
+			tauMax = 1 / (cfg.Rho * math.Max(best.Cost, 1e-6))
+			tauMin = tauMax / (2 * float64(n))
+		}
+
+		deposit := iterBest
+		if cfg.GlobalBestEvery > 0 && it%cfg.GlobalBestEvery == 0 {
+			deposit = best
+		}
+		for i := range tau {
+			for j := range tau[i] {
+				tau[i][j] *= 1 - cfg.Rho
+			}
+		}
+		delta := 1 / math.Max(deposit.Cost, 1e-6)
+		for v, route := range deposit.Routes {
+			prev := p.starts[v]
+			for _, node := range route {
+				tau[prev][node] += delta
+				prev = node
+			}
+		}
+		for i := range tau {
+			for j := range tau[i] {
+				tau[i][j] = math.Min(tauMax, math.Max(tauMin, tau[i][j]))
+			}
+		}
+	}
+	return best, nil
+}
+
+// construct 一只蚂蚁按 tau^alpha * eta 的概率在可行移动中选择，直到无可行移动。
+// 需要等待时间窗的移动按等待时长降低权重
+func construct(p *Problem, tau, eta [][]float64, alpha float64, rng *rand.Rand) Solution {
+	c := newConstruction(p)
+	type move struct {
+		v, node int
+		weight  float64
+	}
+	moves := make([]move, 0, len(p.Dist)*len(p.caps))
+	for c.remaining > 0 {
+		moves = moves[:0]
+		total := 0.0
+		c.moves(func(v, node int) {
+			vs := &c.vehicles[v]
+			from := vs.pos
+			w := math.Pow(tau[from][node], alpha) * eta[from][node]
+			if p.Speed > 0 {
+				start, _ := c.arrive(v, node)
+				w /= 1 + start - vs.time - p.travel(from, node)
+			}
+			moves = append(moves, move{v: v, node: node, weight: w})
+			total += w
+		})
+		if len(moves) == 0 {
+			break
+		}
+
+		pick := moves[len(moves)-1]
+		r := rng.Float64() * total
+		for _, m := range moves {
+			if r < m.weight {
+				pick = m
+				break
+			}
+			r -= m.weight
+		}
+		c.apply(pick.v, pick.node)
+	}
+	return c.solution()
+}
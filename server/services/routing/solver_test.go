@@ -0,0 +1,312 @@
+package routing
+
+import (
+	"math"
+	"testing"
+)
+
+// lineDist 节点在一条直线上，xs 为各节点坐标（千米）
+func lineDist(xs ...float64) [][]float64 {
+	dist := make([][]float64, len(xs))
+	for i := range xs {
+		dist[i] = make([]float64, len(xs))
+		for j := range xs {
+			dist[i][j] = math.Abs(xs[i] - xs[j])
+		}
+	}
+	return dist
+}
+
+// planeDist 节点在平面上，pts 为各节点坐标（千米）
+func planeDist(pts ...[2]float64) [][]float64 {
+	dist := make([][]float64, len(pts))
+	for i := range pts {
+		dist[i] = make([]float64, len(pts))
+		for j := range pts {
+			dist[i][j] = math.Hypot(pts[i][0]-pts[j][0], pts[i][1]-pts[j][1])
+		}
+	}
+	return dist
+}
+
+// testConfig 固定种子、不限时间的蚁群参数，结果可重复
+func testConfig() ACOConfig {
+	cfg := DefaultACOConfig()
+	cfg.Iterations = 100
+	cfg.TimeLimit = 0
+	return cfg
+}
+
+// checkSolution 检查解满足取送顺序、载量和时间窗，里程与路线一致，每笔请求恰好送达一次或列为无法安排
+func checkSolution(t *testing.T, p *Problem, s Solution) {
+	t.Helper()
+	late := make(map[int]bool)
+	for _, r := range s.Late {
+		late[r] = true
+	}
+	served := make(map[int]int)
+	cost := 0.0
+	for v, route := range s.Routes {
+		load, prev := 0, p.starts[v]
+		pickedBy := make(map[int]bool)
+		for i, node := range route {
+			r := p.req[node]
+			switch p.kind[node] {
+			case NodePickup:
+				pickedBy[r] = true
+				load += p.Requests[r].Load
+			case NodeDelivery:
+				if !pickedBy[r] {
+					t.Errorf("vehicle %d delivers request %d without picking it up: %v", v, r, route)
+				}
+				load -= p.Requests[r].Load
+				served[r]++
+			default:
+				t.Errorf("vehicle %d visits depot node %d", v, node)
+			}
+			if limit := p.caps[v]; limit > 0 && load > limit {
+				t.Errorf("vehicle %d carries %d over capacity %d at node %d", v, load, limit, node)
+			}
+			w := p.Windows[node]
+			if at := s.Arrivals[v][i]; at < w.Earliest-1e-9 || at > w.Latest+1e-9 && !late[r] {
+				t.Errorf("vehicle %d serves node %d at %.3f outside window %+v", v, node, at, w)
+			}
+			cost += p.Dist[prev][node]
+			prev = node
+		}
+		if len(pickedBy) > 0 && load != 0 {
+			t.Errorf("vehicle %d ends with load %d", v, load)
+		}
+	}
+	if math.Abs(cost-s.Cost) > 1e-9 {
+		t.Errorf("cost = %v, want route length %v", s.Cost, cost)
+	}
+	unserved := make(map[int]bool)
+	for _, r := range s.Unserved {
+		unserved[r] = true
+	}
+	for r := range p.Requests {
+		if served[r] != 1 && !unserved[r] || served[r] != 0 && unserved[r] {
+			t.Errorf("request %d delivered %d times, unserved %v", r, served[r], unserved[r])
+		}
+	}
+}
+
+// 送货点比取货点离仓库更近，仍需先取货
+func TestSolveVisitsPickupBeforeDelivery(t *testing.T) {
+	p := &Problem{
+		// 仓库、送1、送2、取1、取2
+		Dist:     lineDist(0, 1, 2, 5, 6),
+		Requests: []Request{{Pickup: 3, Delivery: 1, Load: 1}, {Pickup: 4, Delivery: 2, Load: 1}},
+	}
+	for name, solve := range map[string]func() (Solution, error){
+		"greedy": func() (Solution, error) { return Greedy(p) },
+		"aco":    func() (Solution, error) { return Solve(p, testConfig()) },
+	} {
+		s, err := solve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSolution(t, p, s)
+		if len(s.Unserved) != 0 || len(s.Routes[0]) != 4 {
+			t.Fatalf("%s: solution = %+v, want all requests served", name, s)
+		}
+		// 先去远处取货，再回头送货
+		if s.Routes[0][0] != 3 && s.Routes[0][0] != 4 {
+			t.Fatalf("%s: route %v starts with a delivery", name, s.Routes[0])
+		}
+	}
+}
+
+// 载量只够装一笔请求时，取一笔送一笔交替进行
+func TestSolveRespectsCapacity(t *testing.T) {
+	p := &Problem{
+		// 仓库、取1、取2、取3、送1、送2、送3
+		Dist: planeDist([2]float64{0, 0}, [2]float64{1, 0}, [2]float64{1, 1}, [2]float64{0, 1},
+			[2]float64{5, 0}, [2]float64{5, 5}, [2]float64{0, 5}),
+		Requests: []Request{{Pickup: 1, Delivery: 4, Load: 2}, {Pickup: 2, Delivery: 5, Load: 2}, {Pickup: 3, Delivery: 6, Load: 2}},
+		Capacity: 2,
+	}
+	s, err := Solve(p, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSolution(t, p, s)
+	if len(s.Unserved) != 0 {
+		t.Fatalf("unserved = %v, want none", s.Unserved)
+	}
+	for i, node := range s.Routes[0] {
+		if want := i%2 == 0; (p.kind[node] == NodePickup) != want {
+			t.Fatalf("route %v does not alternate pickup and delivery", s.Routes[0])
+		}
+	}
+}
+
+// 最近邻贪心先走近处的取货点会多绕路，蚁群算法的结果不差于贪心初始解
+func TestSolveNeverWorseThanGreedy(t *testing.T) {
+	newProblem := func() *Problem {
+		return &Problem{
+			Dist: planeDist(
+				[2]float64{0, 0},                                      // 仓库
+				[2]float64{1, 0}, [2]float64{-2, 1}, [2]float64{3, 3}, // 取货
+				[2]float64{-1, -1}, [2]float64{4, 0}, [2]float64{-3, 4}, // 取货
+				[2]float64{6, 2}, [2]float64{-4, -2}, [2]float64{2, 6}, // 送货
+				[2]float64{0, -4}, [2]float64{7, -1}, [2]float64{-5, 5}, // 送货
+			),
+			Requests: []Request{
+				{Pickup: 1, Delivery: 7, Load: 1}, {Pickup: 2, Delivery: 8, Load: 1}, {Pickup: 3, Delivery: 9, Load: 1},
+				{Pickup: 4, Delivery: 10, Load: 1}, {Pickup: 5, Delivery: 11, Load: 1}, {Pickup: 6, Delivery: 12, Load: 1},
+			},
+			Vehicles: 2,
+			Capacity: 2,
+		}
+	}
+	greedy, err := Greedy(newProblem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seed := range []int64{1, 2, 3, 4, 5} {
+		cfg := testConfig()
+		cfg.Seed = seed
+		p := newProblem()
+		s, err := Solve(p, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSolution(t, p, s)
+		if better(greedy, s) {
+			t.Fatalf("seed %d: aco cost %.3f unserved %v, worse than greedy cost %.3f unserved %v",
+				seed, s.Cost, s.Unserved, greedy.Cost, greedy.Unserved)
+		}
+	}
+}
+
+// unlimited 各节点不限时间窗
+func unlimited(n int) []Window {
+	windows := make([]Window, n)
+	for i := range windows {
+		windows[i].Latest = math.Inf(1)
+	}
+	return windows
+}
+
+// 请求2的送货时间窗很紧，最近邻先走近处的请求1会迟到，需先服务请求2
+func TestSolveTimeWindowForcesReordering(t *testing.T) {
+	newProblem := func() *Problem {
+		windows := unlimited(5)
+		windows[4].Latest = 0.7
+		return &Problem{
+			// 仓库、取1、送1、取2、送2
+			Dist:     lineDist(0, -4, -5, 5, 6),
+			Requests: []Request{{Pickup: 1, Delivery: 2, Load: 1}, {Pickup: 3, Delivery: 4, Load: 1}},
+			Speed:    10,
+			Windows:  windows,
+		}
+	}
+
+	greedy, err := Greedy(newProblem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(greedy.Unserved)+len(greedy.Late) == 0 {
+		t.Fatalf("greedy = %+v, want request 2 missed when serving the nearer request first", greedy)
+	}
+
+	p := newProblem()
+	s, err := Solve(p, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSolution(t, p, s)
+	if len(s.Unserved) != 0 || len(s.Late) != 0 {
+		t.Fatalf("solution = %+v, want both requests on time", s)
+	}
+	if want := []int{3, 4, 1, 2}; !equalRoute(s.Routes[0], want) {
+		t.Fatalf("route = %v, want %v", s.Routes[0], want)
+	}
+	if s.Arrivals[0][1] > 0.7 {
+		t.Fatalf("request 2 delivered at %.2f, after its window", s.Arrivals[0][1])
+	}
+}
+
+func equalRoute(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 两笔请求须在同一时限内送达，一辆车装得下时合并配送，装不下时由第二辆车配送
+func TestSolveCapacityForcesSecondVehicle(t *testing.T) {
+	newProblem := func(capacity int) *Problem {
+		windows := unlimited(5)
+		windows[3].Latest = 1.2
+		windows[4].Latest = 1.2
+		return &Problem{
+			// 仓库、取1、取2、送1、送2
+			Dist:     lineDist(0, 1, 1.5, 10, 10.5),
+			Requests: []Request{{Pickup: 1, Delivery: 3, Load: 2}, {Pickup: 2, Delivery: 4, Load: 2}},
+			Vehicles: 2,
+			Capacity: capacity,
+			Speed:    10,
+			Windows:  windows,
+		}
+	}
+
+	used := func(s Solution) int {
+		n := 0
+		for _, route := range s.Routes {
+			if len(route) > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	for _, c := range []struct {
+		capacity int
+		vehicles int
+	}{{4, 1}, {3, 2}} {
+		p := newProblem(c.capacity)
+		s, err := Solve(p, testConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSolution(t, p, s)
+		if len(s.Unserved) != 0 || len(s.Late) != 0 {
+			t.Fatalf("capacity %d: solution = %+v, want both requests on time", c.capacity, s)
+		}
+		if used(s) != c.vehicles {
+			t.Fatalf("capacity %d: routes = %v, want %d vehicles", c.capacity, s.Routes, c.vehicles)
+		}
+	}
+}
+
+// 超过所有车辆载量的请求无法安排，其余请求照常配送
+func TestSolveMarksOversizedRequestUnserved(t *testing.T) {
+	p := &Problem{
+		// 仓库、取1、送1、取2、送2
+		Dist:       lineDist(0, 1, 2, 3, 4),
+		Requests:   []Request{{Pickup: 1, Delivery: 2, Load: 5}, {Pickup: 3, Delivery: 4, Load: 2}},
+		Capacities: []int{3, 2},
+	}
+	s, err := Solve(p, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSolution(t, p, s)
+	if len(s.Unserved) != 1 || s.Unserved[0] != 0 {
+		t.Fatalf("unserved = %v, want request 0", s.Unserved)
+	}
+	for _, route := range s.Routes {
+		for _, node := range route {
+			if node == 1 || node == 2 {
+				t.Fatalf("routes = %v visit the unserved request", s.Routes)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderTelemetryWindows 订单各冷链箱的工作时间段，模块被重新分配后旧订单的数据仍按时间段归属
+func OrderTelemetryWindows(db *gorm.DB, orderID uint, now time.Time) ([]dao.TelemetryWindow, error) {
+	order, err := dao.NewOrderRepository(db).GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := dao.NewModuleRepository(db).ListOrderAssignments(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make([]dao.TelemetryWindow, 0, len(assignments))
+	for _, a := range assignments {
+		w, err := assignmentWindow(a, order.OrderItems, now)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// assignmentWindow 一条分配记录的工作时间段和温区。箱内装有多个订单项时取各商品温区的交集，
+// 与分配时写入模块的阈值一致；没有记录装箱内容时按所属订单项的商品温区
+func assignmentWindow(a models.ModuleAssignment, items []models.OrderItem, now time.Time) (dao.TelemetryWindow, error) {
+	start, end := a.Window(now)
+	w := dao.TelemetryWindow{
+		DeviceID:    a.DeviceID,
+		OrderItemID: a.OrderItemID,
+		Start:       start,
+		End:         end,
+	}
+	packed := map[uint]bool{a.OrderItemID: true}
+	if len(a.Contents) > 0 {
+		var contents []models.ModuleContent
+		if err := json.Unmarshal(a.Contents, &contents); err != nil {
+			return w, fmt.Errorf("冷链箱 %s 的装箱内容无法解析: %w", a.DeviceID, err)
+		}
+		for _, c := range contents {
+			packed[c.OrderItemID] = true
+		}
+	}
+	first := true
+	for _, item := range items {
+		if !packed[item.ID] {
+			continue
+		}
+		if first || item.Product.MinTemperature > w.MinTemperature {
+			w.MinTemperature = item.Product.MinTemperature
+		}
+		if first || item.Product.MaxTemperature < w.MaxTemperature {
+			w.MaxTemperature = item.Product.MaxTemperature
+		}
+		first = false
+	}
+	return w, nil
+}
+
+// DeviceCompliance 一个冷链箱在订单期间的温控情况
+type DeviceCompliance struct {
+	Window    dao.TelemetryWindow  `json:"window"`
+	Summary   dao.TelemetrySummary `json:"summary"`
+	Compliant bool                 `json:"compliant"`
+}
+
+// ComplianceReport 订单的温控合规报告，没有监控数据的冷链箱视为不合规
+type ComplianceReport struct {
+	OrderID   uint               `json:"order_id"`
+	Compliant bool               `json:"compliant"`
+	Devices   []DeviceCompliance `json:"devices"`
+}
+
+// OrderCompliance 统计订单每个冷链箱工作期间的读数是否都在商品温区内
+func OrderCompliance(telemetry *dao.TelemetryRepository, orderID uint, windows []dao.TelemetryWindow) (*ComplianceReport, error) {
+	report := &ComplianceReport{
+		OrderID:   orderID,
+		Compliant: len(windows) > 0,
+		Devices:   make([]DeviceCompliance, 0, len(windows)),
+	}
+	for _, w := range windows {
+		summary, err := telemetry.Summarize(w)
+		if err != nil {
+			return nil, err
+		}
+		device := DeviceCompliance{
+			Window:    w,
+			Summary:   *summary,
+			Compliant: summary.Readings > 0 && summary.Excursions == 0,
+		}
+		report.Compliant = report.Compliant && device.Compliant
+		report.Devices = append(report.Devices, device)
+	}
+	return report, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAssignmentWindowIntersectsPackedItems(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	items := []models.OrderItem{
+		{ID: 1, Product: models.Product{ProductName: "鲜奶", MinTemperature: 0, MaxTemperature: 10}},
+		{ID: 2, Product: models.Product{ProductName: "流感疫苗", MinTemperature: 2, MaxTemperature: 8}},
+		{ID: 3, Product: models.Product{ProductName: "冻牛肉", MinTemperature: -20, MaxTemperature: -10}},
+	}
+	contents, err := json.Marshal([]models.ModuleContent{{OrderItemID: 1, Quantity: 2}, {OrderItemID: 2, Quantity: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		a        models.ModuleAssignment
+		min, max float64
+	}{
+		{"co-packed items", models.ModuleAssignment{DeviceID: "DEV-1", OrderItemID: 1, Contents: contents}, 2, 8},
+		{"no recorded contents", models.ModuleAssignment{DeviceID: "DEV-2", OrderItemID: 3}, -20, -10},
+	}
+	for _, c := range cases {
+		w, err := assignmentWindow(c.a, items, now)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if w.MinTemperature != c.min || w.MaxTemperature != c.max {
+			t.Errorf("%s: range = [%v, %v], want [%v, %v]", c.name, w.MinTemperature, w.MaxTemperature, c.min, c.max)
+		}
+	}
+}
+
+// 冷链箱在仓库中的读数不计入订单，工作时间段从装车发车开始
+func TestAssignmentWindowStartsAtDispatch(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	assigned, dispatched := now.Add(-5*time.Hour), now.Add(-2*time.Hour)
+	a := models.ModuleAssignment{DeviceID: "DEV-1", OrderItemID: 1, AssignedAt: assigned}
+
+	w, err := assignmentWindow(a, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Start.Equal(assigned) || !w.End.Equal(now) {
+		t.Fatalf("window = [%s, %s], want from assignment until now before dispatch", w.Start, w.End)
+	}
+
+	a.DispatchedAt = &dispatched
+	if w, _ = assignmentWindow(a, nil, now); !w.Start.Equal(dispatched) {
+		t.Fatalf("window start = %s, want dispatch at %s", w.Start, dispatched)
+	}
+}
+
+func TestMarkOrderDispatchedRecordsOpenAssignments(t *testing.T) {
+	db := openOrderDB(t)
+	at := time.Now().Truncate(time.Second)
+	fsm := NewOrderStateMachine().OnEvent(EventDispatch, func(tc *TransitionContext) error {
+		return dao.NewModuleRepository(tc.Tx).MarkOrderDispatched(tc.Order.ID, at)
+	})
+	orderID := createOrder(t, db, 5, models.OrderApproved)
+	assignModules(t, db, orderID, 2)
+
+	if _, err := fsm.Fire(db, orderID, EventDispatch, Actor{UserID: 1, RoleName: models.RoleManager}, ""); err != nil {
+		t.Fatal(err)
+	}
+	assignments, err := dao.NewModuleRepository(db).ListOrderAssignments(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range assignments {
+		if start, _ := a.Window(time.Now()); !start.Equal(at) {
+			t.Fatalf("assignment %d window starts at %s, want dispatch at %s", a.ID, start, at)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/dao"
+	"coldchain/server/services/routing"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var ErrOverWeight = errors.New("装载重量超出车辆额定载重")
+
+// CargoModule 待装车的冷链箱，Weight 为箱内商品重量，不含冷链箱自重
+type CargoModule struct {
+	ModuleID uint
+	DeviceID string
+	OrderID  uint
+	Weight   float64
+}
+
+// VehicleLoading 车辆的装车方案，Modules 按装车顺序排列
+type VehicleLoading struct {
+	Modules []models.DispatchModule
+	Weight  float64 // 含冷链箱自重，千克
+	Volume  float64 // 冷链箱占用的货厢容积，立方米
+}
+
+// PlanVehicleLoading 按送达顺序 deliveryOrder 的倒序安排装车：最后送达的订单先装、放在货厢最里侧，
+// 最先送达的最后装、靠近车门，同一订单的冷链箱连续装载。
+// 冷链箱数量超出 MaxCapacity 或占用容积超出 CargoVolume 时返回 ErrOverCapacity，
+// 总重超出 MaxPayload 时返回 ErrOverWeight，车辆容积和载重为0时不检查
+func PlanVehicleLoading(vehicle models.Vehicle, cargo []CargoModule, deliveryOrder []uint) (*VehicleLoading, error) {
+	index := make(map[uint]int, len(deliveryOrder))
+	for i, orderID := range deliveryOrder {
+		if _, ok := index[orderID]; !ok {
+			index[orderID] = i
+		}
+	}
+	sorted := append([]CargoModule(nil), cargo...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return index[sorted[a].OrderID] > index[sorted[b].OrderID]
+	})
+
+	loading := &VehicleLoading{Modules: make([]models.DispatchModule, 0, len(sorted))}
+	for k, m := range sorted {
+		weight := m.Weight + MODULE_TARE_WEIGHT
+		loading.Modules = append(loading.Modules, models.DispatchModule{
+			ModuleID:      m.ModuleID,
+			DeviceID:      m.DeviceID,
+			OrderID:       m.OrderID,
+			LoadSequence:  k + 1,
+			DeliveryIndex: index[m.OrderID] + 1,
+			Weight:        weight,
+		})
+		loading.Weight += weight
+	}
+	loading.Volume = float64(len(sorted)) * MODULE_OUTER_VOLUME
+
+	if len(sorted) > vehicle.MaxCapacity {
+		return nil, fmt.Errorf("%w: 需装载%d个，车辆 %s 最多%d个",
+			ErrOverCapacity, len(sorted), vehicle.PlateNumber, vehicle.MaxCapacity)
+	}
+	if vehicle.CargoVolume > 0 && loading.Volume > vehicle.CargoVolume+loadEpsilon {
+		return nil, fmt.Errorf("%w: 冷链箱占用%.2f立方米，车辆 %s 货厢%.2f立方米",
+			ErrOverCapacity, loading.Volume, vehicle.PlateNumber, vehicle.CargoVolume)
+	}
+	if vehicle.MaxPayload > 0 && loading.Weight > vehicle.MaxPayload+loadEpsilon {
+		return nil, fmt.Errorf("%w: 装载%.1f千克，车辆 %s 额定载重%.1f千克",
+			ErrOverWeight, loading.Weight, vehicle.PlateNumber, vehicle.MaxPayload)
+	}
+	return loading, nil
+}
+
+// routeDeliveryOrder 订单的送达顺序：按路线上送货站点的先后，不在路线上的订单按 orderIDs 中的顺序排在后面
+func routeDeliveryOrder(plan *models.RoutePlan, orderIDs []uint) []uint {
+	requested := make(map[uint]bool, len(orderIDs))
+	for _, id := range orderIDs {
+		requested[id] = true
+	}
+	var result []uint
+	placed := make(map[uint]bool, len(orderIDs))
+	if plan != nil {
+		for _, s := range plan.Stops {
+			if s.NodeType != routing.NodeDelivery || s.OrderID == nil || !requested[*s.OrderID] || placed[*s.OrderID] {
+				continue
+			}
+			result = append(result, *s.OrderID)
+			placed[*s.OrderID] = true
+		}
+	}
+	for _, id := range orderIDs {
+		if !placed[id] {
+			result = append(result, id)
+			placed[id] = true
+		}
+	}
+	return result
+}
+
+// orderCargo 订单已分配的冷链箱及箱内商品重量：优先取分配记录中的装箱内容，
+// 没有记录装箱内容时按所属订单项的总重平均到该订单项的冷链箱
+func orderCargo(tx *gorm.DB, orderID uint) ([]CargoModule, error) {
+	moduleRepo := dao.NewModuleRepository(tx)
+	modules, err := moduleRepo.ListOrderModules(orderID)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := moduleRepo.ListOrderAssignments(orderID)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[uint][]models.ModuleContent)
+	for _, a := range assignments {
+		if a.ReleasedAt != nil || len(a.Contents) == 0 {
+			continue
+		}
+		var c []models.ModuleContent
+		if err := json.Unmarshal(a.Contents, &c); err != nil {
+			return nil, fmt.Errorf("冷链箱 %s 的装箱内容无法解析: %w", a.DeviceID, err)
+		}
+		contents[a.ModuleID] = c
+	}
+
+	var assigned []models.Module
+	perItem := make(map[uint]int)
+	for _, m := range modules {
+		if m.Status != models.StatusAssigned {
+			continue
+		}
+		assigned = append(assigned, m)
+		if m.OrderItemID != nil {
+			perItem[*m.OrderItemID]++
+		}
+	}
+	var items map[uint]models.OrderItem
+	cargo := make([]CargoModule, 0, len(assigned))
+	for _, m := range assigned {
+		c := CargoModule{ModuleID: m.ID, DeviceID: m.DeviceID, OrderID: orderID}
+		if packed, ok := contents[m.ID]; ok {
+			for _, item := range packed {
+				c.Weight += item.Weight
+			}
+		} else if m.OrderItemID != nil {
+			if items == nil {
+				order, err := dao.NewOrderRepository(tx).GetOrderByID(orderID)
+				if err != nil {
+					return nil, err
+				}
+				items = make(map[uint]models.OrderItem, len(order.OrderItems))
+				for _, item := range order.OrderItems {
+					items[item.ID] = item
+				}
+			}
+			item := items[*m.OrderItemID]
+			c.Weight = float64(item.Quantity) * item.Product.SpecWeight / float64(perItem[*m.OrderItemID])
+		}
+		cargo = append(cargo, c)
+	}
+	return cargo, nil
+}
+
+// PlanLoading 在事务 tx 中为车辆和订单生成装车方案，订单的送达顺序取车辆待执行或执行中的路线，
+// 没有路线时按 orderIDs 的顺序
+func (d *Dispatcher) PlanLoading(tx *gorm.DB, vehicle *models.Vehicle, orderIDs []uint) (*VehicleLoading, error) {
+	route, err := dao.NewRoutePlanRepository(tx).GetActiveRoutePlan(vehicle.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var cargo []CargoModule
+	for _, orderID := range orderIDs {
+		modules, err := orderCargo(tx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		cargo = append(cargo, modules...)
+	}
+	return PlanVehicleLoading(*vehicle, cargo, routeDeliveryOrder(route, orderIDs))
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"coldchain/common/mysql/models"
+	"coldchain/server/services/routing"
+	"errors"
+	"testing"
+)
+
+func TestPlanVehicleLoadingReversesDeliveryOrder(t *testing.T) {
+	first, second := uint(11), uint(12)
+	route := &models.RoutePlan{Stops: []models.RouteStop{
+		{NodeType: routing.NodeDepot},
+		{NodeType: routing.NodePickup, OrderID: &first},
+		{NodeType: routing.NodeDelivery, OrderID: &second},
+		{NodeType: routing.NodeDelivery, OrderID: &first},
+	}}
+	// 订单 13 不在路线上，排在最后送达
+	order := routeDeliveryOrder(route, []uint{first, 13, second})
+	if len(order) != 3 || order[0] != second || order[1] != first || order[2] != 13 {
+		t.Fatalf("delivery order = %v, want [12 11 13]", order)
+	}
+
+	cargo := []CargoModule{
+		{ModuleID: 1, OrderID: first, Weight: 10},
+		{ModuleID: 2, OrderID: second, Weight: 20},
+		{ModuleID: 3, OrderID: 13, Weight: 5},
+		{ModuleID: 4, OrderID: first, Weight: 10},
+	}
+	vehicle := models.Vehicle{PlateNumber: "浙B12345", MaxCapacity: 4, MaxPayload: 200}
+	loading, err := PlanVehicleLoading(vehicle, cargo, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []uint{}
+	for k, m := range loading.Modules {
+		got = append(got, m.ModuleID)
+		if m.LoadSequence != k+1 {
+			t.Fatalf("module %d load sequence = %d, want %d", m.ModuleID, m.LoadSequence, k+1)
+		}
+	}
+	// 最后送达的先装，最先送达的订单 12 最后装、靠近车门
+	want := []uint{3, 1, 4, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("load order = %v, want %v", got, want)
+		}
+	}
+	if wantWeight := 45 + 4*MODULE_TARE_WEIGHT; loading.Weight != wantWeight {
+		t.Fatalf("weight = %v, want %v including tare", loading.Weight, wantWeight)
+	}
+}
+
+func TestPlanVehicleLoadingRejectsOverweight(t *testing.T) {
+	vehicle := models.Vehicle{PlateNumber: "浙B12345", MaxCapacity: 10, MaxPayload: 60}
+	cargo := []CargoModule{{ModuleID: 1, OrderID: 1, Weight: 40}, {ModuleID: 2, OrderID: 1, Weight: 10}}
+	if _, err := PlanVehicleLoading(vehicle, cargo, []uint{1}); !errors.Is(err, ErrOverWeight) {
+		t.Fatalf("err = %v, want ErrOverWeight", err)
+	}
+	vehicle.MaxPayload = 0
+	if _, err := PlanVehicleLoading(vehicle, cargo, []uint{1}); err != nil {
+		t.Fatalf("vehicle without payload limit: %v", err)
+	}
+}